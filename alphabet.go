@@ -0,0 +1,84 @@
+package asn1
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// alphabet is a set of permitted characters defined by ranges.
+type alphabet []struct {
+	from, to rune
+}
+
+// parseAlphabet parses an alphabet specification such as "0-9A-F". A '-'
+// that is the first or last character of the specification is taken
+// literally.
+func parseAlphabet(spec string) (alphabet, error) {
+	if spec == "" {
+		return nil, syntaxError("empty alphabet")
+	}
+	if !utf8.ValidString(spec) {
+		return nil, syntaxError("invalid UTF-8 in alphabet '%s'", spec)
+	}
+	chars := []rune(spec)
+	var a alphabet
+	for i := 0; i < len(chars); i++ {
+		from, to := chars[i], chars[i]
+		if i+2 < len(chars) && chars[i+1] == '-' {
+			to = chars[i+2]
+			i += 2
+			if to < from {
+				return nil, syntaxError("invalid range '%c-%c' in alphabet '%s'",
+					from, to, spec)
+			}
+		}
+		a = append(a, struct{ from, to rune }{from, to})
+	}
+	return a, nil
+}
+
+// contains checks if c is a permitted character.
+func (a alphabet) contains(c rune) bool {
+	for _, r := range a {
+		if c >= r.from && c <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// Check implements the Constraint interface for strings and byte slices.
+func (a alphabet) Check(value interface{}) error {
+	reflected := reflect.ValueOf(value)
+	var s string
+	switch {
+	case reflected.Kind() == reflect.String:
+		s = reflected.String()
+	case reflected.Kind() == reflect.Slice &&
+		reflected.Type().Elem().Kind() == reflect.Uint8:
+		s = string(reflected.Bytes())
+	default:
+		return fmt.Errorf("alphabet cannot be applied to Go type '%T'", value)
+	}
+	for _, c := range s {
+		if !a.contains(c) {
+			return fmt.Errorf("character %q is not in the permitted alphabet", c)
+		}
+	}
+	return nil
+}
+
+// AlphabetConstraint returns a Constraint that accepts strings and byte
+// slices containing only the characters of the given alphabet. The alphabet
+// is specified by characters and ranges of characters, for instance "0-9A-F"
+// for hexadecimal digits.
+//
+// It's the same constraint applied by the option "alphabet".
+func AlphabetConstraint(spec string) (Constraint, error) {
+	a, err := parseAlphabet(spec)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
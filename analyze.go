@@ -0,0 +1,249 @@
+package asn1
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Report holds statistics about encoded data, as returned by
+// (*Context).Analyze.
+type Report struct {
+	// Elements is the number of elements, including nested ones.
+	Elements int
+	// Constructed is the number of constructed elements.
+	Constructed int
+	// MaxDepth is the greatest nesting level of the elements, which is 1 when
+	// no element is nested.
+	MaxDepth int
+	// Largest is the element with the longest encoding.
+	Largest ElementRange
+	// Violations lists the encodings that BER allows but DER does not.
+	Violations []Violation
+	// Tags counts the elements by tag, keyed by TagString.
+	Tags map[string]int
+}
+
+// ElementRange is the position of an element in encoded data.
+type ElementRange struct {
+	Class uint
+	Tag   uint
+	// Offset is the position of the first octet of the element.
+	Offset int
+	// Length is the number of octets of the element, including its
+	// identifier and length octets.
+	Length int
+}
+
+// Violation is an encoding that does not follow DER.
+type Violation struct {
+	// Offset is the position of the first octet of the element.
+	Offset int
+	Msg    string
+}
+
+// String returns the message of the violation with its offset.
+func (v Violation) String() string {
+	return fmt.Sprintf("offset %d: %s", v.Offset, v.Msg)
+}
+
+// Analyze returns statistics about the elements in data, which can hold any
+// number of consecutive elements, such as a traffic capture. Constructed
+// elements are analyzed recursively, while the content of primitive ones,
+// such as encapsulated data in an OCTET STRING, is not.
+//
+// The limits set by SetMaxTagNumber and SetMaxLengthOctets are applied. If
+// the data is malformed, the report of the elements found before the error is
+// returned with the error.
+func (ctx *Context) Analyze(data []byte) (*Report, error) {
+	report := &Report{Tags: make(map[string]int)}
+	a := analyzer{ctx: ctx, report: report}
+	return report, a.analyzeContent(data, 0, 1, false)
+}
+
+// analyzer keeps the state of (*Context).Analyze.
+type analyzer struct {
+	ctx    *Context
+	report *Report
+	// constructs holds the construct of each violation of the report.
+	constructs []Construct
+}
+
+// analyzeContent analyzes a sequence of elements found at the given offset
+// and nesting level. set tells if the elements are the content of a SET,
+// whose elements must be sorted by their encodings.
+func (a *analyzer) analyzeContent(data []byte, offset int, depth int, set bool) error {
+	limits := rawLimits{
+		maxTagNumber:    a.ctx.getMaxTagNumber(),
+		maxLengthOctets: a.ctx.maxLengthOctets,
+	}
+	reader := bytes.NewReader(data)
+	var previous []byte
+	for reader.Len() > 0 {
+		start := len(data) - reader.Len()
+		raw, err := decodeLimitedRawValue(reader, limits)
+		if err != nil {
+			return parseError("invalid element at offset %d: %s", offset+start, err)
+		}
+		end := len(data) - reader.Len()
+		element := ElementRange{raw.Class, raw.Tag, offset + start, end - start}
+		if set && previous != nil && bytes.Compare(previous, data[start:end]) > 0 {
+			a.violation(element, UnsortedSet, "%s is not sorted in its SET", TagString(raw.Class, raw.Tag))
+		}
+		previous = data[start:end]
+		if err := a.analyzeElement(raw, element, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// analyzeElement analyzes a single element and its content.
+func (a *analyzer) analyzeElement(raw *rawValue, element ElementRange, depth int) error {
+	name := TagString(raw.Class, raw.Tag)
+	report := a.report
+	report.Elements++
+	report.Tags[name]++
+	if depth > report.MaxDepth {
+		report.MaxDepth = depth
+	}
+	if element.Length > report.Largest.Length {
+		report.Largest = element
+	}
+
+	universal := raw.Class == ClassUniversal
+	switch {
+	case raw.Indefinite:
+		a.violation(element, IndefiniteLength, "indefinite length of %s", name)
+	case raw.nonMinimalLength:
+		a.violation(element, NonMinimalLength, "length of %s is not minimal", name)
+	}
+	if !raw.Constructed {
+		if universal {
+			switch raw.Tag {
+			case TagBoolean:
+				if len(raw.Content) != 1 || (raw.Content[0] != 0x00 && raw.Content[0] != 0xff) {
+					a.violation(element, NonCanonicalBoolean, "BOOLEAN is not 0x00 or 0xff")
+				}
+			case TagInteger, TagEnum:
+				if len(raw.Content) == 0 || len(removeIntLeadingBytes(raw.Content)) != len(raw.Content) {
+					a.violation(element, NonMinimalInteger, "%s is not encoded in the minimum number of octets", name)
+				}
+			case TagBitString:
+				if hasUnusedBitsSet(raw.Content) {
+					a.violation(element, NonZeroUnusedBits, "unused bits of BIT STRING are not zero")
+				}
+			}
+		}
+		return nil
+	}
+
+	report.Constructed++
+	if universal && universalStringTags[raw.Tag] {
+		a.violation(element, ConstructedString, "constructed %s", name)
+	}
+	header := element.Length - len(raw.Content)
+	if raw.Indefinite {
+		// End of contents octets
+		header -= 2
+	}
+	return a.analyzeContent(raw.Content, element.Offset+header, depth+1,
+		universal && raw.Tag == TagSet)
+}
+
+// violation adds a violation of DER found in element to the report.
+func (a *analyzer) violation(element ElementRange, construct Construct, msg string, args ...interface{}) {
+	a.constructs = append(a.constructs, construct)
+	a.report.Violations = append(a.report.Violations, Violation{
+		Offset: element.Offset,
+		Msg:    fmt.Sprintf(msg, args...),
+	})
+}
+
+// Construct identifies an encoding that BER allows but DER does not.
+type Construct int
+
+// Constructs reported by Detect.
+const (
+	// IndefiniteLength is the indefinite length form.
+	IndefiniteLength Construct = iota + 1
+	// NonMinimalLength is a length encoded with more octets than necessary.
+	NonMinimalLength
+	// NonCanonicalBoolean is a BOOLEAN whose content is not 0x00 or 0xff.
+	NonCanonicalBoolean
+	// NonMinimalInteger is an INTEGER or ENUMERATED with leading octets that
+	// can be removed.
+	NonMinimalInteger
+	// ConstructedString is a string type encoded in the constructed form.
+	ConstructedString
+	// UnsortedSet is a SET whose elements are not sorted by their encodings.
+	UnsortedSet
+	// NonZeroUnusedBits is a BIT STRING whose unused bits are not zero.
+	NonZeroUnusedBits
+)
+
+// String returns a short description of the construct.
+func (c Construct) String() string {
+	switch c {
+	case IndefiniteLength:
+		return "indefinite length"
+	case NonMinimalLength:
+		return "non-minimal length"
+	case NonCanonicalBoolean:
+		return "non-canonical BOOLEAN"
+	case NonMinimalInteger:
+		return "non-minimal INTEGER"
+	case ConstructedString:
+		return "constructed string"
+	case UnsortedSet:
+		return "unsorted SET"
+	case NonZeroUnusedBits:
+		return "non-zero unused bits"
+	}
+	return "Construct(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Findings describes the BER constructs found by Detect.
+type Findings struct {
+	// Violations lists the encodings that DER does not allow, in the order
+	// they were found.
+	Violations []Violation
+	// Constructs counts the violations by construct.
+	Constructs map[Construct]int
+}
+
+// Detect inspects the elements in data and returns the strictest rules they
+// follow: DER if no encoding that DER forbids is found and BER otherwise, with
+// the constructs that are not DER. It's useful before verifying a signature,
+// which requires the exact encoding that was signed, or to decide if data must
+// be transcoded.
+//
+// Detect uses a default Context, see (*Context).Detect.
+func Detect(data []byte) (Rules, Findings, error) {
+	return NewContext().Detect(data)
+}
+
+// Detect works like the function Detect with the limits set in ctx, such as
+// SetMaxTagNumber. An error is returned if data is not a valid BER encoding.
+//
+// Implicitly tagged values can't be identified without their types, so their
+// contents are not verified, as in Analyze: a DER result means that no
+// violation was found in the headers and in the universal types.
+func (ctx *Context) Detect(data []byte) (Rules, Findings, error) {
+	report := &Report{Tags: make(map[string]int)}
+	a := analyzer{ctx: ctx, report: report}
+	if err := a.analyzeContent(data, 0, 1, false); err != nil {
+		return BER, Findings{}, err
+	}
+	findings := Findings{
+		Violations: report.Violations,
+		Constructs: make(map[Construct]int),
+	}
+	for _, construct := range a.constructs {
+		findings.Constructs[construct]++
+	}
+	if len(findings.Violations) > 0 {
+		return BER, findings, nil
+	}
+	return DER, findings, nil
+}
@@ -15,7 +15,9 @@
 // - BER allows STRING types, such as OCTET STRING and BIT STRING, to be
 // encoded as constructed types containing inner elements that should be
 // concatenated to form the complete string. The package does not support that,
-// but in the future decoding of constructed strings should be included.
+// but in the future decoding of constructed strings should be included. For
+// now, WriteChunkedOctetString and ReadChunkedOctetString can be used to
+// stream OCTET STRINGs using the constructed form.
 package asn1
 
 // TODO add a mechanism for extendability
@@ -74,10 +76,26 @@ func DecodeWithOptions(data []byte, obj interface{}, options string) (rest []byt
 	return ctx.DecodeWithOptions(data, obj, options)
 }
 
+// DecodeSequenceOf parses the given BER encoded SEQUENCE OF and calls callback
+// for each item. DecodeSequenceOf uses a default Context and is equivalent
+// to:
+//
+//	rest, err := asn1.NewContext().DecodeSequenceOf(data, callback)
+//
+func DecodeSequenceOf(data []byte, callback interface{}) (rest []byte, err error) {
+	ctx := NewContext()
+	return ctx.DecodeSequenceOf(data, callback)
+}
+
 // ParseError is returned by the package to indicate that the given data is
 // invalid.
 type ParseError struct {
 	Msg string
+
+	// fieldMsg is the message of errors created by fieldError, which is
+	// prefixed by path in Msg.
+	fieldMsg string
+	path     string
 }
 
 // Error returns the error message of a ParseError.
@@ -87,7 +105,40 @@ func (e *ParseError) Error() string {
 
 // parseError allocates a new ParseError.
 func parseError(msg string, args ...interface{}) *ParseError {
-	return &ParseError{fmt.Sprintf(msg, args...)}
+	return &ParseError{Msg: fmt.Sprintf(msg, args...)}
+}
+
+// fieldError allocates a new ParseError for an invalid value whose message
+// includes the path of the field being decoded. The path is completed by
+// addFieldPath while the error is returned by the enclosing values.
+func fieldError(msg string, args ...interface{}) *ParseError {
+	msg = fmt.Sprintf(msg, args...)
+	return &ParseError{Msg: msg, fieldMsg: msg}
+}
+
+// redactError replaces an error found in a sensitive field, whose message may
+// include the content of the field, by an error without details.
+func redactError(err error) error {
+	if _, ok := err.(*ParseError); ok {
+		return fieldError("invalid value of sensitive field")
+	}
+	return syntaxError("invalid value of sensitive field")
+}
+
+// addFieldPath prepends the name of a struct field or the index of an item,
+// such as "[1]", to the path of err if it was created by fieldError.
+func addFieldPath(err error, name string) error {
+	e, ok := err.(*ParseError)
+	if !ok || e.fieldMsg == "" || name == "" {
+		return err
+	}
+	if e.path == "" {
+		e.path = name
+	} else {
+		e.path = joinTracePath(name, e.path)
+	}
+	e.Msg = fmt.Sprintf("field %s: %s", e.path, e.fieldMsg)
+	return err
 }
 
 // SyntaxError is returned by the package to indicate that the given value or
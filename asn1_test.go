@@ -1,9 +1,21 @@
 package asn1
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	stdasn1 "encoding/asn1"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
+	"os"
 	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -191,6 +203,98 @@ func TestSimpleInteger(t *testing.T) {
 	testEncodeDecode(t, ctx, "", tests...)
 }
 
+func TestIntegerOverflow(t *testing.T) {
+	ctx := NewContext()
+	// Any size and negative values are decoded into big.Int
+	testDecode(t, ctx, "", testCase{
+		big.NewInt(0).Neg(big.NewInt(0).SetBit(big.NewInt(0), 72, 1)),
+		[]byte{0x02, 0x0a, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	})
+	testDecode(t, ctx, "", testCase{big.NewInt(-129), []byte{0x02, 0x02, 0xff, 0x7f}})
+
+	tests := []struct {
+		value    interface{}
+		data     []byte
+		expected string
+	}{
+		{new(int8), []byte{0x02, 0x02, 0x00, 0x80}, "integer 128 overflows Go type 'int8'"},
+		{new(int8), []byte{0x02, 0x02, 0xff, 0x7f}, "integer -129 overflows Go type 'int8'"},
+		{new(int32), []byte{0x02, 0x05, 0x01, 0x00, 0x00, 0x00, 0x00}, "integer 4294967296 overflows Go type 'int32'"},
+		{new(int64), []byte{0x02, 0x09, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, "integer 18446744073709551616 overflows Go type 'int64'"},
+		{new(*big.Int), []byte{0x02, 0x00}, "integer has no content octets"},
+	}
+	for _, test := range tests {
+		_, err := ctx.Decode(test.data, test.value)
+		if _, ok := err.(*ParseError); !ok {
+			t.Fatalf("Expected a ParseError, got: %v", err)
+		}
+		if err.Error() != test.expected {
+			t.Fatalf("Invalid error.\n  got: %s\n  expected: %s", err, test.expected)
+		}
+	}
+}
+
+func TestUnsignedRange(t *testing.T) {
+	type Counter struct {
+		Name  string
+		Count uint8
+	}
+	type Counters struct {
+		Total uint64
+		Items []Counter
+	}
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "", testCase{
+		uint64(1<<64 - 1),
+		[]byte{0x02, 0x09, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	})
+
+	tests := []struct {
+		value    interface{}
+		data     []byte
+		expected string
+	}{
+		{new(uint), []byte{0x02, 0x01, 0xff}, "negative integer -1 can't be assigned to Go type 'uint'"},
+		{new(uint16), []byte{0x02, 0x03, 0x01, 0x00, 0x00}, "integer 65536 overflows Go type 'uint16'"},
+		{
+			new(uint64),
+			[]byte{0x02, 0x0a, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			"integer 4722366482869645213695 overflows Go type 'uint64'",
+		},
+		{
+			new(Counters),
+			[]byte{0x30, 0x05, 0x02, 0x01, 0x80, 0x30, 0x00},
+			"field Total: negative integer -128 can't be assigned to Go type 'uint64'",
+		},
+		{
+			new(Counters),
+			[]byte{
+				0x30, 0x15, 0x02, 0x01, 0x01, 0x30, 0x10,
+				0x30, 0x06, 0x04, 0x01, 0x61, 0x02, 0x01, 0x01,
+				0x30, 0x06, 0x04, 0x01, 0x62, 0x02, 0x01, 0xff,
+			},
+			"field Items[1].Count: negative integer -1 can't be assigned to Go type 'uint8'",
+		},
+		{
+			new(Counters),
+			[]byte{
+				0x30, 0x0e, 0x02, 0x01, 0x01, 0x30, 0x09,
+				0x30, 0x07, 0x04, 0x01, 0x61, 0x02, 0x02, 0x01, 0x00,
+			},
+			"field Items[0].Count: integer 256 overflows Go type 'uint8'",
+		},
+	}
+	for _, test := range tests {
+		_, err := ctx.Decode(test.data, test.value)
+		if _, ok := err.(*ParseError); !ok {
+			t.Fatalf("Expected a ParseError, got: %v", err)
+		}
+		if err.Error() != test.expected {
+			t.Fatalf("Invalid error.\n  got: %s\n  expected: %s", err, test.expected)
+		}
+	}
+}
+
 func TestSimpleString(t *testing.T) {
 	lenStr := func(length int, lenBytes ...byte) testCase {
 		buf := make([]byte, length)
@@ -318,9 +422,24 @@ func TestSimpleOid(t *testing.T) {
 		{Oid{0, 0, 255}, []byte{0x06, 0x03, 0x00, 0x81, 0x7f}},
 		{Oid{0, 0, 1000}, []byte{0x06, 0x03, 0x00, 0x87, 0x68}},
 		{Oid{0, 0, ^uint(0)}, []byte{0x06, 0x0b, 0x00, 0x81, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{Oid{2, 40}, []byte{0x06, 0x01, 0x78}},
+		{Oid{2, 48}, []byte{0x06, 0x02, 0x81, 0x00}},
+		{Oid{2, 999, 3}, []byte{0x06, 0x03, 0x88, 0x37, 0x03}},
+		{Oid{2, ^uint(0)}, []byte{0x06, 0x0a, 0x82, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x4f}},
 	}
 	testEncodeDecode(t, ctx, "", tests...)
 
+	// Second arc too large for an uint
+	oid := Oid{}
+	data := []byte{0x06, 0x0a, 0x82, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x81, 0x50}
+	if _, err := ctx.Decode(data, &oid); err == nil {
+		t.Fatalf("Decoding %#v should have failed.", data)
+	}
+	data = []byte{0x06, 0x01, 0x81}
+	if _, err := ctx.Decode(data, &oid); err == nil {
+		t.Fatalf("Decoding %#v should have failed.", data)
+	}
+
 	// Cases that should fail
 	oids := []Oid{
 		{3, 0}, {4, 0}, {5, 0}, {256, 0},
@@ -355,6 +474,8 @@ func TestCmpOid(t *testing.T) {
 		{-1, Oid{1, 1, 10, 10}, Oid{1, 1, 11}},
 		{-1, Oid{1, 1, 10, 10}, Oid{1, 1, 11, 0}},
 		{-1, Oid{1, 1, 10, 10}, Oid{2}},
+		{1, Oid{2, ^uint(0)}, Oid{2, 0}},
+		{-1, Oid{2, 0}, Oid{2, ^uint(0)}},
 	}
 	op := map[int]string{1: ">", 0: "=", -1: "<"}
 	for _, test := range tests {
@@ -371,6 +492,87 @@ func TestCmpOid(t *testing.T) {
 	}
 }
 
+func TestBigOid(t *testing.T) {
+	ctx := NewContext()
+	// The OID formed by a UUID in X.667
+	uuid, _ := new(big.Int).SetString("329800735698586629295641978511506172918", 10)
+	oid := BigOid{big.NewInt(2), big.NewInt(25), uuid}
+	expected := []byte{0x06, 0x14, 0x69, 0x83, 0xf0, 0x9d, 0xa7, 0xeb, 0xcf, 0xde,
+		0xe0, 0xc7, 0xa1, 0xa7, 0xb2, 0xc0, 0x94, 0x8c, 0xc8, 0xf9, 0xd7, 0x76}
+	data, err := ctx.Encode(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, expected)
+	var decoded BigOid
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Cmp(oid) != 0 {
+		t.Fatalf("got %s, expected %s", decoded, oid)
+	}
+	if s := decoded.String(); s != ".2.25.329800735698586629295641978511506172918" {
+		t.Fatalf("unexpected string %s", s)
+	}
+	if _, err := ctx.Decode(data, &Oid{}); err == nil {
+		t.Fatal("decoding a large element into an Oid should fail")
+	}
+
+	// Oversized subidentifiers are rejected by Oid as they are read, and
+	// BigOid reads them in linear time
+	content := append(bytes.Repeat([]byte{0xff}, 200000), 0x7f)
+	data, err = ctx.Encode(RawValue{Tag: TagOid, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Decode(data, &Oid{}); err == nil {
+		t.Fatal("decoding an oversized first element into an Oid should fail")
+	}
+	start := time.Now()
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("decoding a large element took %s", elapsed)
+	}
+	if decoded[1].BitLen() != 7*len(content) {
+		t.Fatalf("got second element of %d bits", decoded[1].BitLen())
+	}
+	for _, data := range [][]byte{{0x06, 0x02, 0x80, 0x01}, {0x06, 0x03, 0x2a, 0x80, 0x01}} {
+		if _, err := ctx.Decode(data, &decoded); err == nil {
+			t.Fatalf("Decoding %#v with a leading zero octet should have failed.", data)
+		}
+	}
+
+	// Small elements in every position
+	data, err = ctx.Encode(BigOid{big.NewInt(1), big.NewInt(2), big.NewInt(840), big.NewInt(113549)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x06, 0x06, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d})
+	if _, err := ctx.Encode(BigOid{big.NewInt(1), big.NewInt(40)}); err == nil {
+		t.Fatal("second element above 39 under 1 should fail")
+	}
+	if _, err := ctx.Encode(BigOid{big.NewInt(2), big.NewInt(-1)}); err == nil {
+		t.Fatal("negative element should fail")
+	}
+
+	text, err := ctx.ToValueNotation(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "{ 2 25 329800735698586629295641978511506172918 }" {
+		t.Fatalf("unexpected value notation %s", text)
+	}
+	var parsed BigOid
+	if err := ctx.ParseValueNotation(text, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Cmp(oid) != 0 {
+		t.Fatalf("got %s, expected %s", parsed, oid)
+	}
+}
+
 func TestSimpleNull(t *testing.T) {
 	tests := []testCase{
 		{Null{}, []byte{0x05, 0x00}},
@@ -598,7 +800,47 @@ func TestTag(t *testing.T) {
 		true,
 		[]byte{0xbf, 0x87, 0x68, 0x3, 0x1, 0x1, 0xff},
 	})
+	testEncodeDecode(t, ctx, "explicit,universal,tag:2", testCase{
+		true,
+		[]byte{0x22, 0x03, 0x01, 0x01, 0xff},
+	})
+	testEncodeDecode(t, ctx, "explicit,application,tag:1,indefinite", testCase{
+		true,
+		[]byte{0x61, 0x80, 0x01, 0x01, 0xff, 0x00, 0x00},
+	})
+
+}
+
+func TestTagClassPrefix(t *testing.T) {
+	ctx := NewContext()
+	for _, options := range []string{"tag:APPLICATION 5", "tag:[APPLICATION 5]", "tag:a5"} {
+		testEncodeDecode(t, ctx, options, testCase{
+			true,
+			[]byte{0x45, 0x01, 0xff},
+		})
+	}
+	testEncodeDecode(t, ctx, "explicit,tag:p17", testCase{
+		true,
+		[]byte{0xf1, 0x03, 0x01, 0x01, 0xff},
+	})
+	testEncodeDecode(t, ctx, "private,tag:3", testCase{
+		5,
+		[]byte{0xc3, 0x01, 0x05},
+	})
+	testEncodeDecode(t, ctx, "tag:UNIVERSAL 4", testCase{
+		[]byte{0x01},
+		[]byte{0x04, 0x01, 0x01},
+	})
+	testEncodeDecode(t, ctx, "application,tag:c1", testCase{
+		true,
+		[]byte{0x81, 0x01, 0xff},
+	})
 
+	for _, options := range []string{"tag:b5", "tag:APPLICATION", "application,private,tag:1", "private"} {
+		if _, err := ctx.EncodeWithOptions(true, options); err == nil {
+			t.Fatalf("Options '%s' should have failed.", options)
+		}
+	}
 }
 
 func TestIndefinite(t *testing.T) {
@@ -791,3 +1033,4556 @@ func TestPointerInterface(t *testing.T) {
 	}
 	checkEqual(t, obj, value)
 }
+
+func TestFrameReader(t *testing.T) {
+	frames := [][]byte{
+		{0x02, 0x01, 0x01},
+		{0x30, 0x80, 0x01, 0x01, 0xff, 0x30, 0x80, 0x00, 0x00, 0x00, 0x00},
+		{0x04, 0x03, 0x61, 0x62, 0x63},
+	}
+	stream := []byte{}
+	for _, frame := range frames {
+		stream = append(stream, frame...)
+	}
+	reader := NewFrameReader(bytes.NewReader(stream))
+	for _, expected := range frames {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isBytesEqual(frame, expected) {
+			t.Fatalf("Wrong frame.\n Expected: %#v\n Got:      %#v", expected, frame)
+		}
+	}
+	if _, err := reader.ReadFrame(); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got: %v", err)
+	}
+	// Truncated stream
+	reader = NewFrameReader(bytes.NewReader(frames[1][:6]))
+	if _, err := reader.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+}
+
+func TestFramedReader(t *testing.T) {
+	message := []byte{0x02, 0x01, 0x01}
+	tests := []struct {
+		framing Framing
+		header  []byte
+	}{
+		{FramingNone, []byte{}},
+		{FramingLength16, []byte{0x00, 0x03}},
+		{FramingLength32, []byte{0x00, 0x00, 0x00, 0x03}},
+		{FramingTPKT, []byte{0x03, 0x00, 0x00, 0x07}},
+	}
+	for _, test := range tests {
+		buffer := &bytes.Buffer{}
+		writer := NewFrameWriter(buffer, test.framing)
+		for i := 0; i < 2; i++ {
+			if err := writer.WriteFrame(message); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected := append(append([]byte{}, test.header...), message...)
+		if !isBytesEqual(buffer.Bytes()[:len(expected)], expected) {
+			t.Fatalf("Wrong frame.\n Expected: %#v\n Got:      %#v", expected, buffer.Bytes())
+		}
+
+		reader := NewFramedReader(buffer, test.framing)
+		for i := 0; i < 2; i++ {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isBytesEqual(frame, message) {
+				t.Fatalf("Wrong frame.\n Expected: %#v\n Got:      %#v", message, frame)
+			}
+		}
+		if _, err := reader.ReadFrame(); err != io.EOF {
+			t.Fatalf("Expected io.EOF, got: %v", err)
+		}
+	}
+
+	// Invalid frames
+	reader := NewFramedReader(bytes.NewReader([]byte{0x02, 0x00, 0x00, 0x07}), FramingTPKT)
+	if _, err := reader.ReadFrame(); err == nil {
+		t.Fatal("Reading an invalid TPKT version should have failed.")
+	}
+	reader = NewFramedReader(bytes.NewReader([]byte{0x00, 0x05, 0x01}), FramingLength16)
+	if _, err := reader.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+	reader = NewFramedReader(bytes.NewReader([]byte{0x00, 0x05, 0x01}), FramingLength16)
+	reader.SetMaxFrameSize(4)
+	if _, err := reader.ReadFrame(); err == nil {
+		t.Fatal("Reading a frame above the limit should have failed.")
+	}
+
+	// The limit also applies to elements without a prefix
+	for _, data := range [][]byte{
+		{0x04, 0x84, 0x7f, 0xff, 0xff, 0xff},
+		{0x30, 0x80, 0x04, 0x03, 0x61, 0x62, 0x63, 0x00, 0x00},
+	} {
+		reader = NewFrameReader(bytes.NewReader(data))
+		reader.SetMaxFrameSize(8)
+		if _, err := reader.ReadFrame(); err == nil || err == io.ErrUnexpectedEOF {
+			t.Errorf("expected an error for the limit reading %x, got %v", data, err)
+		}
+	}
+	reader = NewFrameReader(bytes.NewReader(message))
+	reader.SetMaxFrameSize(len(message))
+	if frame, err := reader.ReadFrame(); err != nil || !isBytesEqual(frame, message) {
+		t.Errorf("reading a frame within the limit returned %x, %v", frame, err)
+	}
+}
+
+func TestDecodeSequenceOf(t *testing.T) {
+	data := []byte{0x30, 0x09, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}
+	items := []int{}
+	rest, err := DecodeSequenceOf(data, func(item int) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) > 0 {
+		t.Fatalf("Unexpected remaining bytes: %#v", rest)
+	}
+	checkEqual(t, items, []int{0, 1, 2})
+
+	// Errors returned by the callback stop the parsing
+	stop := fmt.Errorf("stop")
+	count := 0
+	_, err = DecodeSequenceOf(data, func(item int) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Fatalf("Callback error not returned: %v (%d calls)", err, count)
+	}
+
+	// Invalid callback
+	var nilCallback func(int) error
+	for _, callback := range []interface{}{func(item int) {}, nil, nilCallback, 1} {
+		_, err = DecodeSequenceOf(data, callback)
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("Expected a SyntaxError for %T, got: %v", callback, err)
+		}
+	}
+}
+
+func TestStreamOctetString(t *testing.T) {
+	type Type struct {
+		Num     int
+		Payload io.Reader
+	}
+	encoded := []byte{0x30, 0x08, 0x02, 0x01, 0x01, 0x04, 0x03, 0x61, 0x62, 0x63}
+	ctx := NewContext()
+	payload := strings.NewReader("abc")
+	testEncode(t, ctx, "", testCase{Type{1, payload}, encoded})
+
+	// The same value can be encoded again
+	if n, err := ctx.EncodedLen(Type{1, payload}, ""); err != nil || n != len(encoded) {
+		t.Fatalf("got length %d, %v, expected %d", n, err, len(encoded))
+	}
+	testEncode(t, ctx, "", testCase{Type{1, payload}, encoded})
+
+	// The content starts at the current position
+	if _, err := payload.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	testEncode(t, ctx, "", testCase{Type{1, payload},
+		[]byte{0x30, 0x07, 0x02, 0x01, 0x01, 0x04, 0x02, 0x62, 0x63}})
+	type WriterToType struct {
+		Num     int
+		Payload io.WriterTo `asn1:"tag:0"`
+	}
+	testEncode(t, ctx, "", testCase{WriterToType{1, bytes.NewReader([]byte("abc"))},
+		[]byte{0x30, 0x08, 0x02, 0x01, 0x01, 0x80, 0x03, 0x61, 0x62, 0x63}})
+	testEncode(t, ctx, "", testCase{Type{Num: 1}, []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x04, 0x00}})
+
+	// Readers that can't seek are rejected in DER
+	_, err := ctx.Encode(Type{1, bytes.NewBufferString("abc")})
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("Expected a SyntaxError, got: %v", err)
+	}
+
+	// Otherwise they use the constructed indefinite length form
+	ctx = NewContext()
+	ctx.SetDer(false, false)
+	testEncode(t, ctx, "", testCase{Type{1, bytes.NewBufferString("abc")},
+		[]byte{0x30, 0x80, 0x02, 0x01, 0x01, 0x24, 0x80, 0x04, 0x03, 0x61, 0x62, 0x63,
+			0x00, 0x00, 0x00, 0x00}})
+	testEncode(t, ctx, "", testCase{WriterToType{1, writerToFunc(func(w io.Writer) (int64, error) {
+		n, err := io.WriteString(w, "abc")
+		return int64(n), err
+	})}, []byte{0x30, 0x80, 0x02, 0x01, 0x01, 0xa0, 0x80, 0x04, 0x03, 0x61, 0x62, 0x63,
+		0x00, 0x00, 0x00, 0x00}})
+	_, err = ctx.EncodedLen(Type{1, bytes.NewBufferString("abc")}, "")
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("Expected a SyntaxError, got: %v", err)
+	}
+
+	// And they are written in segments of 1000 octets as they are read
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		for i := 0; i < len(content); i += 100 {
+			pipeWriter.Write(content[i : i+100])
+		}
+		pipeWriter.Close()
+	}()
+	data, err := ctx.Encode(Type{1, pipeReader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data[5:11], []byte{0x24, 0x80, 0x04, 0x82, 0x03, 0xe8})
+	if len(data) != 5+2+3*4+2500+2+2 {
+		t.Fatalf("Unexpected encoding length: %d", len(data))
+	}
+	chunked := &bytes.Buffer{}
+	if err := ReadChunkedOctetString(chunked, bytes.NewReader(data[5:len(data)-2])); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, chunked.Bytes(), content)
+
+	// The constructed form is decoded into readers and writers
+	decoded := Type{}
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	chunked.Reset()
+	if _, err := chunked.ReadFrom(decoded.Payload); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, chunked.Bytes(), content)
+	chunked.Reset()
+	if _, err := ctx.Decode(data, &struct {
+		Num     int
+		Payload io.Writer
+	}{Payload: chunked}); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, chunked.Bytes(), content)
+
+	// Readers are copied as the encoding is written
+	large := bytes.NewReader(make([]byte, 1<<24))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err = ctx.EncodeHash(Type{1, large}, sha256.New())
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("EncodeHash allocated %d octets", allocated)
+	}
+
+	// Decode into a reader
+	obj := Type{}
+	if _, err := ctx.Decode(encoded, &obj); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := buf.ReadFrom(obj.Payload); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, buf.String(), "abc")
+
+	// Decode into a writer
+	type WriterType struct {
+		Num     int
+		Payload io.Writer
+	}
+	buf = &bytes.Buffer{}
+	writerObj := WriterType{Payload: buf}
+	if _, err := ctx.Decode(encoded, &writerObj); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, buf.String(), "abc")
+}
+
+// writerToFunc is an io.WriterTo that can't seek.
+type writerToFunc func(w io.Writer) (int64, error)
+
+func (f writerToFunc) WriteTo(w io.Writer) (int64, error) {
+	return f(w)
+}
+
+func TestChunkedOctetString(t *testing.T) {
+	// Short contents are written in the primitive form
+	buf := &bytes.Buffer{}
+	if err := WriteChunkedOctetString(buf, bytes.NewBufferString("abc")); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, buf.Bytes(), []byte{0x04, 0x03, 0x61, 0x62, 0x63})
+
+	// Long contents are split in segments of 1000 octets
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	buf.Reset()
+	if err := WriteChunkedOctetString(buf, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	checkEqual(t, encoded[:6], []byte{0x24, 0x80, 0x04, 0x82, 0x03, 0xe8})
+	checkEqual(t, encoded[len(encoded)-2:], []byte{0x00, 0x00})
+	if len(encoded) != 2+3*4+2500+2 {
+		t.Fatalf("Unexpected encoding length: %d", len(encoded))
+	}
+
+	// And reassembled when reading
+	out := &bytes.Buffer{}
+	if err := ReadChunkedOctetString(out, bytes.NewReader(encoded)); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, out.Bytes(), content)
+
+	// Nested definite length segments
+	out.Reset()
+	nested := []byte{0x24, 0x09, 0x04, 0x01, 0x61, 0x24, 0x04, 0x04, 0x02, 0x62, 0x63}
+	if err := ReadChunkedOctetString(out, bytes.NewReader(nested)); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, out.String(), "abc")
+}
+
+func TestStrictOrder(t *testing.T) {
+	type Type struct {
+		A int    `asn1:"optional"`
+		B string `asn1:"optional"`
+	}
+	tests := []struct {
+		data []byte
+		msg  string
+	}{
+		{
+			// B, A
+			[]byte{0x30, 0x08, 0x04, 0x03, 0x61, 0x62, 0x63, 0x02, 0x01, 0x01},
+			"element (0,2) for field 'A' is out of order",
+		},
+		{
+			// B, B
+			[]byte{0x30, 0x0a, 0x04, 0x03, 0x61, 0x62, 0x63, 0x04, 0x03, 0x61, 0x62, 0x63},
+			"duplicated element (0,4) for field 'B'",
+		},
+	}
+	ctx := NewContext()
+	for _, test := range tests {
+		// Lax mode ignores the unexpected element
+		obj := Type{}
+		if _, err := ctx.Decode(test.data, &obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx.SetStrictOrder(true)
+	for _, test := range tests {
+		obj := Type{}
+		_, err := ctx.Decode(test.data, &obj)
+		if err == nil || err.Error() != test.msg {
+			t.Fatalf("Expected error %q, got: %v", test.msg, err)
+		}
+	}
+}
+
+func TestSetDuplicates(t *testing.T) {
+	type Type struct {
+		A int    `asn1:"optional"`
+		B string `asn1:"optional"`
+	}
+	// A, A
+	data := []byte{0x31, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}
+	ctx := NewContext()
+	obj := Type{}
+	if _, err := ctx.DecodeWithOptions(data, &obj, "set"); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetRejectDuplicates(true)
+	_, err := ctx.DecodeWithOptions(data, &obj, "set")
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Expected a ParseError, got: %v", err)
+	}
+}
+
+func TestTagString(t *testing.T) {
+	tests := []struct {
+		class, tag uint
+		expected   string
+	}{
+		{ClassUniversal, TagInteger, "INTEGER"},
+		{ClassUniversal, TagSequence, "SEQUENCE"},
+		{ClassUniversal, 99, "[UNIVERSAL 99]"},
+		{ClassApplication, 5, "[APPLICATION 5]"},
+		{ClassContextSpecific, 3, "[3]"},
+		{ClassPrivate, 17, "[PRIVATE 17]"},
+	}
+	for _, test := range tests {
+		s := TagString(test.class, test.tag)
+		if s != test.expected {
+			t.Fatalf("Expected %q, got %q", test.expected, s)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		data        []byte
+		class, tag  uint
+		constructed bool
+		length      int
+		headerLen   int
+	}{
+		{[]byte{0x02, 0x01, 0x00}, ClassUniversal, TagInteger, false, 1, 2},
+		{[]byte{0x30, 0x80}, ClassUniversal, TagSequence, true, -1, 2},
+		{[]byte{0x04, 0x82, 0x03, 0xe8}, ClassUniversal, TagOctetString, false, 1000, 4},
+		{[]byte{0xbf, 0x87, 0x68, 0x03}, ClassContextSpecific, 1000, true, 3, 4},
+	}
+	for _, test := range tests {
+		class, tag, constructed, length, headerLen, err := ParseHeader(test.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if class != test.class || tag != test.tag || constructed != test.constructed ||
+			length != test.length || headerLen != test.headerLen {
+			t.Fatalf("Wrong header for %#v: %d %d %v %d %d", test.data,
+				class, tag, constructed, length, headerLen)
+		}
+	}
+	if _, _, _, _, _, err := ParseHeader([]byte{0x04, 0x80}); err == nil {
+		t.Fatal("Primitive element with indefinite length should have failed.")
+	}
+}
+
+func TestSkipValue(t *testing.T) {
+	tests := [][]byte{
+		{0x02, 0x01, 0x01},
+		{0x30, 0x80, 0x01, 0x01, 0xff, 0x30, 0x80, 0x00, 0x00, 0x00, 0x00},
+		{0x04, 0x03, 0x61, 0x62, 0x63},
+	}
+	next := []byte{0x05, 0x00}
+	for _, test := range tests {
+		rest, err := SkipValue(append(append([]byte{}, test...), next...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, rest, next)
+		// Truncated data
+		if _, err := SkipValue(test[:len(test)-1]); err == nil {
+			t.Fatalf("Skipping truncated value %#v should have failed.", test)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	type Type struct {
+		A int
+		B string `asn1:"tag:0"`
+		C []bool `asn1:"explicit,tag:1"`
+		D Oid
+		E Null
+	}
+	obj := Type{1, "abc", []bool{true}, Oid{1, 2, 3}, Null{}}
+	ctx := NewContext()
+	expected, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := ctx.NewBuilder()
+	b.BeginSequence()
+	b.AddInteger(1)
+	b.AddValue("abc", "tag:0")
+	b.BeginConstructed(ClassContextSpecific, 1)
+	b.BeginSequence()
+	b.AddBoolean(true)
+	b.EndSequence()
+	b.EndConstructed(ClassContextSpecific, 1)
+	b.AddOid(Oid{1, 2, 3})
+	b.AddNull()
+	b.EndSequence()
+	data, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, expected)
+
+	// Unbalanced elements
+	b = NewBuilder()
+	b.BeginSequence()
+	b.EndSet()
+	if _, err := b.Bytes(); err == nil {
+		t.Fatal("Ending the wrong element should have failed.")
+	}
+	b = NewBuilder()
+	b.BeginSequence()
+	if _, err := b.Bytes(); err == nil {
+		t.Fatal("Element not ended should have failed.")
+	}
+}
+
+func TestStdlibTypes(t *testing.T) {
+	type Type struct {
+		A stdasn1.ObjectIdentifier
+		B stdasn1.BitString
+		C stdasn1.Enumerated
+		D stdasn1.RawValue
+	}
+	obj := Type{
+		A: stdasn1.ObjectIdentifier{1, 2, 840, 113549},
+		B: stdasn1.BitString{Bytes: []byte{0x80}, BitLength: 1},
+		C: 2,
+		D: stdasn1.RawValue{Class: ClassPrivate, Tag: 3, Bytes: []byte{0x01}},
+	}
+
+	// Both packages must produce the same encoding
+	ctx := NewContext()
+	ctx.SetDer(true, true)
+	expected, err := stdasn1.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, expected)
+
+	decoded := Type{}
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	stdDecoded := Type{}
+	if _, err := stdasn1.Unmarshal(data, &stdDecoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, stdDecoded)
+
+	// FullBytes are used verbatim
+	raw := stdasn1.RawValue{FullBytes: []byte{0x0c, 0x01, 0x61}}
+	testEncode(t, ctx, "", testCase{raw, raw.FullBytes})
+
+	// Even when their length is not encoded in the minimum number of octets
+	raw = stdasn1.RawValue{FullBytes: []byte{0x02, 0x81, 0x01, 0x05}}
+	testEncode(t, ctx, "", testCase{raw, raw.FullBytes})
+	testEncode(t, ctx, "", testCase{struct{ D stdasn1.RawValue }{raw},
+		[]byte{0x30, 0x04, 0x02, 0x81, 0x01, 0x05}})
+}
+
+func TestJSON(t *testing.T) {
+	type Type struct {
+		A Oid
+		B BitString
+		C Null
+	}
+	obj := Type{Oid{1, 2, 840, 113549}, BitString{[]byte{0xa0}, 3}, Null{}}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"A":"1.2.840.113549","B":{"hex":"a0","bitLength":3},"C":null}`
+	if string(data) != expected {
+		t.Fatalf("Invalid JSON.\n Expected: %s\n Got:      %s", expected, data)
+	}
+	decoded := Type{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, obj)
+
+	// Invalid values
+	invalid := []string{
+		`{"A":"1.a"}`,
+		`{"B":{"hex":"a0","bitLength":9}}`,
+		`{"C":1}`,
+	}
+	for _, s := range invalid {
+		if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+			t.Fatalf("Decoding %s should have failed.", s)
+		}
+	}
+}
+
+func TestSQL(t *testing.T) {
+	oid := Oid{1, 2, 840}
+	v, err := oid.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, v, "1.2.840")
+	var scannedOid Oid
+	if err := scannedOid.Scan([]byte("1.2.840")); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, scannedOid, oid)
+
+	b := BitString{[]byte{0xa0}, 3}
+	v, err = b.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, v, "101")
+	for _, s := range []string{"101", "'101'B"} {
+		var scanned BitString
+		if err := scanned.Scan(s); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, scanned, b)
+	}
+	var scanned BitString
+	if err := scanned.Scan("'A0'H"); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, scanned, BitString{[]byte{0xa0}, 8})
+	if err := scanned.Scan("102"); err == nil {
+		t.Fatal("Scanning an invalid bit string should have failed.")
+	}
+	if err := scanned.Scan(1); err == nil {
+		t.Fatal("Scanning an integer should have failed.")
+	}
+}
+
+func TestStringers(t *testing.T) {
+	tests := []struct {
+		value    fmt.Stringer
+		expected string
+	}{
+		{BitString{[]byte{0xa0}, 3}, "'101'B"},
+		{BitString{[]byte{0xa0, 0x01}, 16}, "'A001'H"},
+		{BitString{}, "''B"},
+		{Oid{1, 2, 3}, ".1.2.3"},
+		{Null{}, "NULL"},
+		{Enum(2), "2"},
+		{&rawValue{Class: ClassContextSpecific, Tag: 1, Content: []byte{0x01, 0xff}}, "[1] 01FF"},
+	}
+	for _, test := range tests {
+		if s := test.value.String(); s != test.expected {
+			t.Fatalf("Expected %q but got %q", test.expected, s)
+		}
+	}
+	// The output can be parsed back
+	b := BitString{[]byte{0xa0}, 3}
+	parsed, err := parseBitString(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, parsed, b)
+}
+
+func TestAudit(t *testing.T) {
+	type Type struct {
+		A int
+		B []string
+		C Oid `asn1:"optional"`
+	}
+	obj := Type{1, []string{"a", "b"}, nil}
+	ctx := NewContext()
+	ctx.SetAudit(true)
+	if _, err := ctx.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Encode(&obj); err != nil {
+		t.Fatal(err)
+	}
+
+	// The indefinite length form is not canonical
+	_, err := ctx.EncodeWithOptions(obj, "indefinite")
+	auditErr, ok := err.(*AuditError)
+	if !ok {
+		t.Fatalf("Expected an AuditError but got %v", err)
+	}
+	if auditErr.Offset != -1 || len(auditErr.Encoded) == 0 {
+		t.Fatalf("Invalid AuditError: %+v", auditErr)
+	}
+
+	// A preserved BER encoding is decoded with DER, but it's encoded again
+	// with a different length
+	type Message struct {
+		ID   int
+		Body string
+	}
+	ber := []byte{0x30, 0x07, 0x02, 0x01, 0x01, 0x04, 0x81, 0x01, 0x61}
+	ctx = NewContext()
+	ctx.SetPreserveEncoding(true)
+	var msg Message
+	if _, err := ctx.Decode(ber, &msg); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetAudit(true)
+	_, err = ctx.Encode(&msg)
+	auditErr, ok = err.(*AuditError)
+	if !ok {
+		t.Fatalf("Expected an AuditError but got %v", err)
+	}
+	checkEqual(t, auditErr.Encoded, ber)
+	checkEqual(t, auditErr.Reencoded, []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x04, 0x01, 0x61})
+	checkEqual(t, auditErr.Offset, 1)
+	checkEqual(t, firstDifference([]byte{1, 2, 3}, []byte{1, 2, 4}), 2)
+	checkEqual(t, firstDifference([]byte{1, 2}, []byte{1, 2, 3}), 2)
+	checkEqual(t, firstDifference([]byte{1, 2}, []byte{1, 2}), -1)
+}
+
+func TestConstraints(t *testing.T) {
+	type Hex string
+	type Type struct {
+		A string `asn1:"constraint:digits"`
+		B Hex
+		C int `asn1:"optional,constraint:positive"`
+	}
+	ctx := NewContext()
+	err := ctx.AddConstraint("digits", PatternConstraint(regexp.MustCompile("^[0-9]*$")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctx.AddConstraint("positive", ConstraintFunc(func(value interface{}) error {
+		if value.(int) <= 0 {
+			return fmt.Errorf("%d is not positive", value)
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.AddTypeConstraint(reflect.TypeOf(Hex("")),
+		PatternConstraint(regexp.MustCompile("^[0-9A-F]*$")))
+
+	testSimple(t, ctx, "", Type{"123", "A0", 1}, Type{"", "", 0})
+
+	invalid := []Type{{"12a", "", 0}, {"1", "G", 0}, {"1", "0", -1}}
+	for _, obj := range invalid {
+		if _, err := ctx.Encode(obj); err == nil {
+			t.Fatalf("Encoding %v should have failed.", obj)
+		}
+		// Encode without constraints and check the decoding
+		plain := struct {
+			A string
+			B string
+			C int `asn1:"optional"`
+		}{obj.A, string(obj.B), obj.C}
+		data, err := Encode(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := Type{}
+		_, err = ctx.Decode(data, &decoded)
+		if _, ok := err.(*ParseError); !ok {
+			t.Fatalf("Expected a ParseError decoding %v but got %v", obj, err)
+		}
+	}
+	if _, err := ctx.EncodeWithOptions("", "constraint:unknown"); err == nil {
+		t.Fatal("Unknown constraint should have failed.")
+	}
+}
+
+func TestAlphabet(t *testing.T) {
+	type Type struct {
+		A string `asn1:"alphabet:0-9A-F"`
+		B []byte `asn1:"optional,alphabet:a-c-"`
+	}
+	ctx := NewContext()
+	testSimple(t, ctx, "", Type{"09AF", []byte("ab-c")}, Type{"", nil})
+
+	invalid := []Type{{"09a", nil}, {"G", nil}, {"", []byte("d")}}
+	for _, obj := range invalid {
+		if _, err := ctx.Encode(obj); err == nil {
+			t.Fatalf("Encoding %v should have failed.", obj)
+		}
+	}
+	data, err := Encode("12:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ""
+	if _, err := DecodeWithOptions(data, &s, "alphabet:0-9"); err == nil {
+		t.Fatal("Decoding an invalid character should have failed.")
+	}
+	for _, options := range []string{"alphabet", "alphabet:", "alphabet:z-a"} {
+		if _, err := EncodeWithOptions("", options); err == nil {
+			t.Fatalf("Option %q should have failed.", options)
+		}
+	}
+}
+
+func TestExtensibleEnum(t *testing.T) {
+	type Color Enum
+	type Type struct {
+		A Color
+		B Color `asn1:"extensible"`
+	}
+	ctx := NewContext()
+	if err := ctx.AddEnum(reflect.TypeOf(Color(0)), 0, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddEnum(reflect.TypeOf("")); err == nil {
+		t.Fatal("Registering a string as ENUMERATED should have failed.")
+	}
+	testSimple(t, ctx, "", Type{1, 2}, Type{2, 5})
+
+	if _, err := ctx.Encode(Type{3, 0}); err == nil {
+		t.Fatal("Encoding an unknown value should have failed.")
+	}
+	data, err := Encode(Type{3, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := Type{}
+	if _, err := ctx.Decode(data, &decoded); err == nil {
+		t.Fatal("Decoding an unknown value should have failed.")
+	}
+
+	data, err = Encode(Type{0, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, Type{0, 7})
+	checkEqual(t, ctx.IsKnownEnum(decoded.A), true)
+	checkEqual(t, ctx.IsKnownEnum(decoded.B), false)
+}
+
+func TestNamedEnum(t *testing.T) {
+	type Version int
+	type Message struct {
+		Version Version
+		Data    []byte
+	}
+	ctx := NewContext()
+	err := ctx.AddNamedEnum(reflect.TypeOf(Version(0)), map[int64]string{
+		0: "v1", 1: "v2", 5: "v3-draft",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncodeDecode(t, ctx, "",
+		testCase{Version(5), []byte{0x0a, 0x01, 0x05}},
+		testCase{Message{1, []byte{0xaa}}, []byte{0x30, 0x06, 0x0a, 0x01, 0x01, 0x04, 0x01, 0xaa}},
+	)
+	if _, err := ctx.Encode(Version(2)); err == nil {
+		t.Fatal("Encoding an unknown value should have failed.")
+	}
+
+	name, ok := ctx.EnumName(Version(5))
+	checkEqual(t, name, "v3-draft")
+	checkEqual(t, ok, true)
+	_, ok = ctx.EnumName(Version(2))
+	checkEqual(t, ok, false)
+
+	s, err := ctx.ToValueNotation(Message{5, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, "{ version v3-draft, data ''H }")
+	var obj Message
+	if err := ctx.ParseValueNotation("{ version v2, data ''H }", &obj); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, obj.Version, Version(1))
+
+	s, err = ctx.Describe(Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, "Message ::= SEQUENCE {\n  version ENUMERATED { v1(0), v2(1), v3-draft(5) },\n  data OCTET STRING\n}\n")
+
+	for _, names := range []map[int64]string{
+		nil,
+		{0: "V1"},
+		{0: "a", 1: "a"},
+	} {
+		if err := ctx.AddNamedEnum(reflect.TypeOf(Version(0)), names); err == nil {
+			t.Fatalf("Registering the names %v should have failed.", names)
+		}
+	}
+}
+
+func TestISOTime(t *testing.T) {
+	utc := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	zone := time.FixedZone("", -3*3600)
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "",
+		testCase{ISOTime{Time: utc}, append([]byte{0x0e, 0x14}, "2019-03-04T05:06:07Z"...)},
+		testCase{ISOTime{Time: time.Date(2019, 3, 4, 5, 6, 7, 500000000, zone)},
+			append([]byte{0x0e, 0x1b}, "2019-03-04T05:06:07.5-03:00"...)},
+		testCase{ISOTime{Raw: "R5/2019-03-04T05:06:07Z/P1D"},
+			append([]byte{0x0e, 0x1b}, "R5/2019-03-04T05:06:07Z/P1D"...)},
+		// Values without a time zone are kept without it
+		testCase{ISOTime{Time: utc, Local: true}, append([]byte{0x0e, 0x13}, "2019-03-04T05:06:07"...)},
+	)
+
+	// Other representations are accepted when decoding
+	for _, s := range []string{"20190304T050607Z", "2019-03-04T05:06:07", "20190304T050607"} {
+		var decoded ISOTime
+		data := append([]byte{0x0e, byte(len(s))}, s...)
+		if _, err := ctx.Decode(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Equal(utc) || decoded.Raw != "" {
+			t.Fatalf("Invalid time decoded from %q: %v", s, decoded)
+		}
+		if local := !strings.HasSuffix(s, "Z"); decoded.Local != local {
+			t.Fatalf("Time decoded from %q has Local %v", s, decoded.Local)
+		}
+	}
+}
+
+func TestImplicitPrimitives(t *testing.T) {
+	n := 3
+	values := []interface{}{
+		true, int(-1), int8(-2), int16(3), int32(4), int64(-5),
+		uint(5), uint8(6), uint16(7), uint32(8), uint64(9),
+		"abc", []byte{1, 2}, [2]byte{3, 4}, big.NewInt(-5),
+		BitString{[]byte{0x80}, 1}, Oid{1, 2, 3}, Null{}, Enum(3),
+		UTCTime{time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)},
+		ISOTime{Time: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)},
+		&n,
+	}
+	ctx := NewContext()
+	ctx.SetDer(true, true)
+	for _, options := range []string{"tag:0", "tag:31", "tag:200", "application,tag:2", "universal,tag:40"} {
+		for _, value := range values {
+			testSimple(t, ctx, options, value)
+		}
+	}
+
+	// The tag must match and the field type defines the decoder
+	type Type struct {
+		A bool      `asn1:"tag:0"`
+		B int       `asn1:"tag:1"`
+		C uint8     `asn1:"tag:2"`
+		D string    `asn1:"tag:3"`
+		E []byte    `asn1:"tag:4"`
+		F [2]byte   `asn1:"tag:5"`
+		G *big.Int  `asn1:"tag:6"`
+		H BitString `asn1:"tag:7"`
+		I Oid       `asn1:"tag:8"`
+		J Null      `asn1:"tag:9"`
+		K Enum      `asn1:"tag:10"`
+		L UTCTime   `asn1:"tag:11"`
+		M ISOTime   `asn1:"tag:12"`
+		N *int      `asn1:"tag:13"`
+	}
+	obj := Type{true, -1, 2, "x", []byte{1}, [2]byte{1, 2}, big.NewInt(5),
+		BitString{[]byte{0x80}, 1}, Oid{1, 2}, Null{}, 3,
+		UTCTime{time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)},
+		ISOTime{Time: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)}, &n}
+	testSimple(t, ctx, "", obj)
+
+	data, err := ctx.EncodeWithOptions(1, "tag:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.DecodeWithOptions(data, &n, "tag:2"); err == nil {
+		t.Fatal("Decoding with the wrong tag should have failed.")
+	}
+}
+
+func TestExplicitTag(t *testing.T) {
+	type Inner struct {
+		A int `asn1:"tag:0"`
+	}
+	type Type struct {
+		A Inner `asn1:"explicit,tag:1"`
+		B Inner `asn1:"explicit,application,tag:2,set"`
+		C int   `asn1:"explicit,tag:3,optional"`
+	}
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "", testCase{
+		Type{Inner{1}, Inner{2}, 0},
+		[]byte{
+			0x30, 0x0e,
+			0xa1, 0x05, 0x30, 0x03, 0x80, 0x01, 0x01,
+			0x62, 0x05, 0x31, 0x03, 0x80, 0x01, 0x02,
+		},
+	})
+
+	// Choice options are not modified by decoding
+	ctx.AddChoice("msg", []Choice{
+		{reflect.TypeOf(""), "explicit,tag:1"},
+	})
+	for i := 0; i < 2; i++ {
+		testEncodeDecode(t, ctx, "choice:msg", testCase{
+			"abc",
+			[]byte{0xa1, 0x05, 0x04, 0x03, 0x61, 0x62, 0x63},
+		})
+	}
+
+	// Explicit tags must contain a single element
+	var n int
+	data := []byte{0xa1, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01}
+	if _, err := ctx.DecodeWithOptions(data, &n, "explicit,tag:1"); err == nil {
+		t.Fatal("Trailing data inside an explicit tag should have failed.")
+	}
+	if _, err := ctx.DecodeWithOptions(data, &n, "explicit"); err == nil {
+		t.Fatal("Explicit without tag should have failed.")
+	}
+}
+
+func TestSecondTag(t *testing.T) {
+	type Type struct {
+		A int `asn1:"tag:1,explicit,tag2:3,explicit2"`
+		B int `asn1:"tag:2,tag2:4,explicit2,optional"`
+	}
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "", testCase{
+		Type{1, 2},
+		[]byte{
+			0x30, 0x0c,
+			0xa3, 0x05, 0xa1, 0x03, 0x02, 0x01, 0x01,
+			0xa4, 0x03, 0x82, 0x01, 0x02,
+		},
+	})
+	testEncodeDecode(t, ctx, "", testCase{
+		Type{1, 0},
+		[]byte{0x30, 0x07, 0xa3, 0x05, 0xa1, 0x03, 0x02, 0x01, 0x01},
+	})
+	for _, options := range []string{"tag2:1", "explicit2", "tag2:-1,explicit2"} {
+		if _, err := EncodeWithOptions(1, options); err == nil {
+			t.Fatalf("Options %q should have failed.", options)
+		}
+	}
+}
+
+func TestCustomOptions(t *testing.T) {
+	ctx := NewContext()
+	err := ctx.AddOption("snmp", func(arg string) (string, error) {
+		switch arg {
+		case "counter32":
+			return "application,tag:1", nil
+		case "ipaddress":
+			return "application,tag:0,alphabet:0-9.", nil
+		}
+		return "", fmt.Errorf("invalid SNMP type '%s'", arg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctx.AddOption("counter", func(string) (string, error) {
+		return "snmp:counter32", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Type struct {
+		A uint32 `asn1:"snmp:counter32"`
+		B string `asn1:"snmp:ipaddress"`
+		C uint32 `asn1:"counter,optional"`
+	}
+	testEncodeDecode(t, ctx, "", testCase{
+		Type{1, "1.2", 0},
+		[]byte{0x30, 0x08, 0x41, 0x01, 0x01, 0x40, 0x03, 0x31, 0x2e, 0x32},
+	})
+	if _, err := ctx.EncodeWithOptions(1, "snmp:unknown"); err == nil {
+		t.Fatal("Invalid argument should have failed.")
+	}
+
+	// Invalid registrations
+	noop := func(string) (string, error) { return "", nil }
+	for _, name := range []string{"", "tag", "explicit", "snmp", "a:b"} {
+		if err := ctx.AddOption(name, noop); err == nil {
+			t.Fatalf("Registering option %q should have failed.", name)
+		}
+	}
+	ctx.AddOption("loop", func(string) (string, error) { return "loop", nil })
+	if _, err := ctx.EncodeWithOptions(1, "loop"); err == nil {
+		t.Fatal("Recursive option should have failed.")
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	ctx := NewContext()
+	ctx.AddChoice("msg", []Choice{
+		{reflect.TypeOf(""), "tag:0"},
+		{reflect.TypeOf(int(0)), "tag:1"},
+	})
+	type Inner struct {
+		A string `asn1:"alphabet:a-z"`
+		B []int  `asn1:"set"`
+	}
+	type Valid struct {
+		A int           `asn1:"default:1"`
+		B interface{}   `asn1:"choice:msg"`
+		C []interface{} `asn1:"choices:msg"`
+		D Inner         `asn1:"indefinite"`
+		E []Inner
+		F *Inner `asn1:"tag:0,explicit,optional"`
+		G BitString
+		H bool `asn1:"tag:1,explicit,indefinite"`
+	}
+	if err := ctx.CheckType(Valid{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.CheckType(&Valid{}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []interface{}{
+		struct {
+			A string `asn1:"default:1"`
+		}{},
+		struct {
+			A int `asn1:"set"`
+		}{},
+		struct {
+			A int `asn1:"choice:msg"`
+		}{},
+		struct {
+			A interface{} `asn1:"choice:unknown"`
+		}{},
+		struct {
+			A []int `asn1:"choices:msg"`
+		}{},
+		struct {
+			A []interface{}
+		}{},
+		struct {
+			A int `asn1:"indefinite"`
+		}{},
+		struct {
+			A int `asn1:"alphabet:0-9"`
+		}{},
+		struct {
+			A string `asn1:"constraint:unknown"`
+		}{},
+		struct {
+			A []struct {
+				B complex128
+			}
+		}{},
+		struct {
+			A int `asn1:"explicit"`
+		}{},
+	}
+	for _, obj := range invalid {
+		if err := ctx.CheckType(obj); err == nil {
+			t.Fatalf("Checking %T should have failed.", obj)
+		}
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	type Inner struct {
+		A int    `asn1:"tag:0"`
+		B string `asn1:"tag:1,optional"`
+	}
+	type Outer struct {
+		A Inner
+		B []Inner `asn1:"set"`
+		C int     `asn1:"-"`
+	}
+	ctx := NewContext()
+	if err := ctx.RegisterType(&Outer{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []reflect.Type{reflect.TypeOf(Outer{}), reflect.TypeOf(Inner{})} {
+		if _, ok := ctx.structOptions[typ]; !ok {
+			t.Fatalf("Options of %s were not kept.", typ)
+		}
+	}
+
+	obj := Outer{A: Inner{1, "a"}, B: []Inner{{2, ""}, {3, "b"}}, C: 4}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewContext().Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("Invalid encoding.\n  got: %x\n  expected: %x", data, expected)
+	}
+	var decoded Outer
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	obj.C = 0
+	if !reflect.DeepEqual(decoded, obj) {
+		t.Fatalf("Decoded value differs.\n  got: %+v\n  expected: %+v", decoded, obj)
+	}
+
+	type Invalid struct {
+		A Inner
+		B int `asn1:"choice:unknown"`
+	}
+	if err := ctx.RegisterType(Invalid{}); err == nil {
+		t.Fatal("Registering an invalid type should have failed.")
+	}
+	if _, ok := ctx.structOptions[reflect.TypeOf(Invalid{})]; ok {
+		t.Fatal("Options of an invalid type should not be kept.")
+	}
+}
+
+func TestFieldSyntaxError(t *testing.T) {
+	type Certificate struct {
+		Version int `asn1:"exlicit"`
+	}
+	expected := "field Certificate.Version: invalid option 'exlicit', did you mean 'explicit'?"
+	ctx := NewContext()
+	_, err := ctx.Encode(Certificate{})
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Invalid encoding error: %v", err)
+	}
+	var obj Certificate
+	_, err = ctx.Decode([]byte{0x30, 0x03, 0x02, 0x01, 0x00}, &obj)
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Invalid decoding error: %v", err)
+	}
+	err = ctx.CheckType(obj)
+	if _, ok := err.(*SyntaxError); !ok || err.Error() != expected {
+		t.Fatalf("Invalid check error: %v", err)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	type Type struct {
+		A int `asn1:"optional"`
+		B int `asn1:"tag:0,default:1"`
+	}
+	// B uses a long form length and its default value, while A comes after
+	// it and is ignored
+	data := []byte{0x30, 0x07, 0x80, 0x81, 0x01, 0x01, 0x02, 0x01, 0x05}
+
+	var warnings []WarningKind
+	ctx := NewContext()
+	ctx.SetWarningHandler(func(w Warning) {
+		warnings = append(warnings, w.Kind)
+	})
+	var obj Type
+	if _, err := ctx.Decode(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	expected := []WarningKind{
+		WarningNonMinimalLength,
+		WarningDefaultValuePresent,
+		WarningIgnoredElement,
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("Invalid warnings.\n  got: %v\n  expected: %v", warnings, expected)
+	}
+
+	// No warnings for a DER encoding
+	warnings = nil
+	if _, err := ctx.Decode([]byte{0x30, 0x03, 0x02, 0x01, 0x05}, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("Unexpected warnings: %v", warnings)
+	}
+}
+
+func TestDecodeWithTrace(t *testing.T) {
+	type Item struct {
+		Name string
+	}
+	type Type struct {
+		A int
+		B []Item `asn1:"tag:0,explicit"`
+		C bool   `asn1:"optional"`
+		D string `asn1:"tag:1"`
+	}
+	data := []byte{
+		0x30, 0x80, // SEQUENCE, indefinite
+		0x02, 0x01, 0x05, // A
+		0xa0, 0x0c, 0x30, 0x0a, // B
+		0x30, 0x03, 0x04, 0x01, 0x61, // B[0]
+		0x30, 0x03, 0x04, 0x01, 0x62, // B[1]
+		0x81, 0x81, 0x01, 0x63, // D, non-minimal length
+		0x00, 0x00,
+	}
+	var obj Type
+	ctx := NewContext()
+	rest, trace, err := ctx.DecodeWithTrace(data, &obj, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Unexpected trailing data: %x", rest)
+	}
+	expected := []FieldRange{
+		{"A", 2, 3},
+		{"B", 5, 14},
+		{"B[0]", 9, 5},
+		{"B[0].Name", 11, 3},
+		{"B[1]", 14, 5},
+		{"B[1].Name", 16, 3},
+		{"D", 19, 4},
+	}
+	if !reflect.DeepEqual(trace.Fields, expected) {
+		t.Fatalf("Invalid trace.\n  got: %v\n  expected: %v", trace.Fields, expected)
+	}
+	if field, ok := trace.Lookup("B[1].Name"); !ok || field.Offset != 16 {
+		t.Fatalf("Invalid lookup: %v", field)
+	}
+	if _, ok := trace.Lookup("C"); ok {
+		t.Fatal("Absent field should not be traced.")
+	}
+	if ctx.trace != nil {
+		t.Fatal("The Context should not be modified.")
+	}
+}
+
+func TestElementTypes(t *testing.T) {
+	type Payload struct {
+		Items []interface{}
+	}
+	ctx := NewContext()
+	if err := ctx.AddElementType(reflect.TypeOf(""), "tag:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddElementType(reflect.TypeOf(int(0)), "tag:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddElementType(reflect.TypeOf(true), "tag:1"); err == nil {
+		t.Fatal("Registering a duplicated tag should have failed.")
+	}
+	if err := ctx.CheckType(Payload{}); err != nil {
+		t.Fatal(err)
+	}
+
+	obj := Payload{[]interface{}{"a", 1, "b"}}
+	expected := []byte{
+		0x30, 0x0b, 0x30, 0x09,
+		0x80, 0x01, 0x61,
+		0x81, 0x01, 0x01,
+		0x80, 0x01, 0x62,
+	}
+	testEncodeDecode(t, ctx, "", testCase{obj, expected})
+
+	if _, err := ctx.Encode(Payload{[]interface{}{true}}); err == nil {
+		t.Fatal("Encoding an unregistered type should have failed.")
+	}
+	if _, err := ctx.Encode(Payload{[]interface{}{nil}}); err == nil {
+		t.Fatal("Encoding a nil element should have failed.")
+	}
+	var decoded Payload
+	if _, err := ctx.Decode([]byte{0x30, 0x05, 0x30, 0x03, 0x82, 0x01, 0x00}, &decoded); err == nil {
+		t.Fatal("Decoding an unregistered tag should have failed.")
+	}
+}
+
+func TestValueNotation(t *testing.T) {
+	type Name string
+	type Serial int
+	type Item struct {
+		ID    Oid
+		Flags BitString `asn1:"optional"`
+	}
+	type Record struct {
+		Version int `asn1:"default:1"`
+		Serial  *big.Int
+		Subject interface{} `asn1:"choice:subject"`
+		Items   []Item
+		Data    []byte
+		Text    string `asn1:"optional"`
+		Valid   bool
+		Nothing Null
+		ignored int
+	}
+	ctx := NewContext()
+	ctx.AddChoice("subject", []Choice{
+		{reflect.TypeOf(Name("")), "tag:0"},
+		{reflect.TypeOf(Serial(0)), "tag:1"},
+	})
+	obj := Record{
+		Version: 2,
+		Serial:  big.NewInt(1234),
+		Subject: Name(`say "hi"`),
+		Items: []Item{
+			{ID: Oid{1, 2, 3}},
+			{ID: Oid{2, 5}, Flags: BitString{[]byte{0xa0}, 3}},
+		},
+		Data:  []byte{0x01, 0xab},
+		Valid: true,
+	}
+	expected := `{ version 2, serial 1234, subject name : "say ""hi""", ` +
+		`items { { iD { 1 2 3 } }, { iD { 2 5 }, flags '101'B } }, ` +
+		`data '01AB'H, valid TRUE, nothing NULL }`
+	s, err := ctx.ToValueNotation(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != expected {
+		t.Fatalf("Invalid value notation.\n  got: %s\n  expected: %s", s, expected)
+	}
+
+	s, err = ctx.ToValueNotation([]Item{})
+	if err != nil || s != "{}" {
+		t.Fatalf("Invalid value notation of an empty list: %s, %v", s, err)
+	}
+	if _, err := ctx.ToValueNotation(struct{ A complex128 }{}); err == nil {
+		t.Fatal("Writing an invalid type should have failed.")
+	}
+}
+
+func TestParseValueNotation(t *testing.T) {
+	type Name string
+	type Serial int
+	type Item struct {
+		ID    Oid
+		Flags BitString `asn1:"optional"`
+	}
+	type Record struct {
+		Version int `asn1:"default:1"`
+		Serial  *big.Int
+		Subject interface{} `asn1:"choice:subject"`
+		Items   []Item
+		Data    []byte
+		Text    string `asn1:"optional"`
+		Valid   bool
+		Nothing Null
+		Time    UTCTime `asn1:"optional"`
+	}
+	ctx := NewContext()
+	ctx.AddChoice("subject", []Choice{
+		{reflect.TypeOf(Name("")), "tag:0"},
+		{reflect.TypeOf(Serial(0)), "tag:1"},
+	})
+	text := `{
+		serial 1234,
+		subject name : "say ""hi""",
+		items {
+			{ iD { iso(1) member-body(2) 3 } },
+			{ iD { 2 5 }, flags '101'B }
+		},
+		data '01 AB'H,
+		valid TRUE,
+		nothing NULL,
+		time "191215190210Z"
+	}`
+	var obj Record
+	if err := ctx.ParseValueNotation(text, &obj); err != nil {
+		t.Fatal(err)
+	}
+	expected := Record{
+		Version: 1,
+		Serial:  big.NewInt(1234),
+		Subject: Name(`say "hi"`),
+		Items: []Item{
+			{ID: Oid{1, 2, 3}},
+			{ID: Oid{2, 5}, Flags: BitString{[]byte{0xa0}, 3}},
+		},
+		Data:  []byte{0x01, 0xab},
+		Valid: true,
+		Time:  UTCTime{time.Date(2019, 12, 15, 19, 2, 10, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Fatalf("Invalid value.\n  got: %+v\n  expected: %+v", obj, expected)
+	}
+
+	// The output of ToValueNotation is parsed back
+	s, err := ctx.ToValueNotation(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Record
+	if err := ctx.ParseValueNotation(s, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("Invalid value.\n  got: %+v\n  expected: %+v", parsed, expected)
+	}
+
+	invalid := []string{
+		`{ valid TRUE }`,
+		`{ serial 1, items {}, data ''H, valid TRUE, nothing NULL, other 1 }`,
+		`{ serial 1, items {}, data ''H, valid yes, nothing NULL }`,
+		`{ serial 1, items {}, data ''H, valid TRUE, nothing NULL } 1`,
+		`{ serial 1, subject other : 1, items {}, data ''H, valid TRUE, nothing NULL }`,
+	}
+	for _, text := range invalid {
+		var obj Record
+		if err := ctx.ParseValueNotation(text, &obj); err == nil {
+			t.Fatalf("Parsing %s should have failed.", text)
+		}
+	}
+}
+
+func TestGSER(t *testing.T) {
+	type Name string
+	type Algorithm struct {
+		Algorithm  Oid
+		Parameters Null `asn1:"optional"`
+	}
+	type Record struct {
+		Version   int
+		Signature Algorithm
+		Subject   interface{}   `asn1:"choice:subject"`
+		Values    []interface{} `asn1:"choices:subject"`
+		Data      []byte
+	}
+	ctx := NewContext()
+	ctx.AddChoice("subject", []Choice{
+		{reflect.TypeOf(Name("")), "tag:0"},
+		{reflect.TypeOf(int(0)), "tag:1"},
+	})
+	obj := Record{
+		Version:   2,
+		Signature: Algorithm{Algorithm: Oid{1, 2, 840, 113549, 1, 1, 11}},
+		Subject:   Name("example"),
+		Values:    []interface{}{1, Name("a")},
+		Data:      []byte{0xff},
+	}
+	expected := `{ version 2, signature { algorithm 1.2.840.113549.1.1.11 }, ` +
+		`subject name:"example", values { int:1, name:"a" }, data 'FF'H }`
+	s, err := ctx.EncodeGSER(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != expected {
+		t.Fatalf("Invalid GSER encoding.\n  got: %s\n  expected: %s", s, expected)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	ber := []byte{
+		0x31, 0x80, // SET, indefinite
+		0x24, 0x80, // OCTET STRING, constructed
+		0x04, 0x01, 0x61,
+		0x04, 0x81, 0x01, 0x62, // non-minimal length
+		0x00, 0x00,
+		0x23, 0x08, // BIT STRING, constructed
+		0x03, 0x02, 0x00, 0xff,
+		0x03, 0x02, 0x04, 0xf0,
+		0x01, 0x01, 0x01, // BOOLEAN
+		0x02, 0x02, 0x00, 0x05, // INTEGER
+		0x00, 0x00,
+	}
+	der := []byte{
+		0x31, 0x0f,
+		0x01, 0x01, 0xff,
+		0x02, 0x01, 0x05,
+		0x03, 0x03, 0x04, 0xff, 0xf0,
+		0x04, 0x02, 0x61, 0x62,
+	}
+	ctx := NewContext()
+	data, err := ctx.Transcode(ber, BER, DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, der) {
+		t.Fatalf("Invalid transcoding.\n  got: %x\n  expected: %x", data, der)
+	}
+	data, err = ctx.Transcode(der, DER, BER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, der) {
+		t.Fatalf("Invalid transcoding.\n  got: %x\n  expected: %x", data, der)
+	}
+	if _, err := ctx.Transcode(ber, DER, DER); err == nil {
+		t.Fatal("Transcoding BER data as DER should have failed.")
+	}
+	if _, err := ctx.Transcode(der, DER, Rules(5)); err == nil {
+		t.Fatal("Transcoding to invalid rules should have failed.")
+	}
+
+	// Unused bits of BIT STRINGs are cleared
+	data, err = ctx.Transcode([]byte{0x03, 0x02, 0x07, 0xff}, BER, DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x03, 0x02, 0x07, 0x80})
+	if _, err := ctx.Transcode([]byte{0x03, 0x02, 0x07, 0xff}, DER, DER); err == nil {
+		t.Fatal("Transcoding a BIT STRING with unused bits set as DER should have failed.")
+	}
+	for _, invalid := range [][]byte{{0x03, 0x02, 0x08, 0xff}, {0x03, 0x01, 0x01}} {
+		if _, err := ctx.Transcode(invalid, BER, DER); err == nil {
+			t.Errorf("Transcoding the invalid BIT STRING %x should have failed.", invalid)
+		}
+	}
+}
+
+type treeNode struct {
+	Value    int
+	Next     *treeNode  `asn1:"optional,tag:0"`
+	Children []treeNode `asn1:"optional,tag:1"`
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	ctx := NewContext()
+	if err := ctx.CheckType(treeNode{}); err != nil {
+		t.Fatal(err)
+	}
+	obj := treeNode{
+		Value: 1,
+		Next:  &treeNode{Value: 2, Next: &treeNode{Value: 3}},
+		Children: []treeNode{
+			{Value: 4, Children: []treeNode{{Value: 5}}},
+		},
+	}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded treeNode
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Next == nil || decoded.Next.Next == nil || decoded.Next.Next.Value != 3 ||
+		decoded.Next.Next.Next != nil || decoded.Children[0].Children[0].Value != 5 {
+		t.Fatalf("Invalid decoded value: %+v", decoded)
+	}
+
+	// A nil pointer is only accepted for optional elements
+	type Required struct {
+		Next *treeNode
+	}
+	if _, err := ctx.Encode(Required{}); err == nil {
+		t.Fatal("Encoding a nil required element should have failed.")
+	}
+	if _, err := ctx.Encode(nil); err == nil {
+		t.Fatal("Encoding nil should have failed.")
+	}
+
+	// Cyclic data
+	cyclic := &treeNode{Value: 1}
+	cyclic.Next = &treeNode{Value: 2, Next: cyclic}
+	_, err = ctx.Encode(cyclic)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("Encoding cyclic data should have failed with a cycle error: %v", err)
+	}
+	// The same value can be used more than once if it does not contain itself
+	shared := &treeNode{Value: 2}
+	if _, err := ctx.Encode([]*treeNode{shared, shared}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddChoiceFromStruct(t *testing.T) {
+	type SimpleError string
+	type ComplexError string
+	type Message struct {
+		Value interface{} `asn1:"choice:value"`
+	}
+	ctx := NewContext()
+	err := ctx.AddChoiceFromStruct("value", struct {
+		Code    int
+		Simple  SimpleError  `asn1:"tag:1"`
+		Complex ComplexError `asn1:"tag:2"`
+		Ignored string       `asn1:"-"`
+		unused  bool
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncodeDecode(t, ctx, "",
+		testCase{Message{5}, []byte{0x30, 0x03, 0x02, 0x01, 0x05}},
+		testCase{Message{SimpleError("a")}, []byte{0x30, 0x03, 0x81, 0x01, 0x61}},
+		testCase{Message{ComplexError("b")}, []byte{0x30, 0x03, 0x82, 0x01, 0x62}},
+	)
+
+	// Field names identify the alternatives
+	s, err := ctx.ToValueNotation(Message{ComplexError("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{ value complex : "b" }`; s != expected {
+		t.Fatalf("Invalid value notation.\n  got: %s\n  expected: %s", s, expected)
+	}
+	var obj Message
+	if err := ctx.ParseValueNotation(`{ value simple : "a" }`, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Value != SimpleError("a") {
+		t.Fatalf("Invalid value: %#v", obj.Value)
+	}
+
+	if err := ctx.AddChoiceFromStruct("other", 1); err == nil {
+		t.Fatal("Registering a choice from a non-struct should have failed.")
+	}
+	if err := ctx.AddChoiceFromStruct("other", struct{}{}); err == nil {
+		t.Fatal("Registering a choice without alternatives should have failed.")
+	}
+	err = ctx.AddChoiceFromStruct("name", struct {
+		Rfc822Name string `asn1:"tag:1"`
+		DNSName    string `asn1:"tag:2"`
+	}{})
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("Expected a SyntaxError for alternatives of the same type, got: %v", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	type Extension struct {
+		ExtnID   Oid
+		Critical bool `asn1:"optional"`
+		Value    []byte
+	}
+	type Record struct {
+		Version    int         `asn1:"explicit,tag:0,default:1"`
+		Serial     *big.Int    `asn1:"application,tag:5"`
+		Names      []string    `asn1:"set"`
+		Value      interface{} `asn1:"choice:value"`
+		Extensions []Extension `asn1:"tag:3,explicit,optional"`
+		Extra      Extension   `asn1:"optional"`
+		Info       struct {
+			Created UTCTime
+			Raw     stdasn1.RawValue
+		}
+	}
+	ctx := NewContext()
+	err := ctx.AddChoice("value", []Choice{
+		{Type: reflect.TypeOf(""), Options: "tag:0"},
+		{Type: reflect.TypeOf(BitString{}), Options: "tag:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ctx.Describe(Record{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Record ::= SEQUENCE {
+  version [0] EXPLICIT INTEGER DEFAULT 1,
+  serial [APPLICATION 5] IMPLICIT INTEGER,
+  names SET OF OCTET STRING,
+  value CHOICE {
+    string [0] IMPLICIT OCTET STRING,
+    bitString [1] IMPLICIT BIT STRING
+  },
+  extensions [3] EXPLICIT SEQUENCE OF Extension OPTIONAL,
+  extra Extension OPTIONAL,
+  info SEQUENCE {
+    created UTCTime,
+    raw ANY
+  }
+}
+
+Extension ::= SEQUENCE {
+  extnID OBJECT IDENTIFIER,
+  critical BOOLEAN OPTIONAL,
+  value OCTET STRING
+}
+`
+	if s != expected {
+		t.Fatalf("Invalid description.\n  got:\n%s\n  expected:\n%s", s, expected)
+	}
+
+	if _, err := ctx.Describe(struct {
+		Value interface{} `asn1:"choice:undefined"`
+	}{}); err == nil {
+		t.Fatal("Describing an invalid type should have failed.")
+	}
+}
+
+func TestPerConstraints(t *testing.T) {
+	type Record struct {
+		Count  int      `asn1:"per-constrained:0..255"`
+		Delta  int      `asn1:"per-constrained:MIN..0,per-extensible"`
+		Name   string   `asn1:"per-constrained:1..MAX"`
+		Digest []byte   `asn1:"per-constrained:32"`
+		Items  []int    `asn1:"per-constrained:0..8,per-extensible"`
+		Serial *big.Int `asn1:"per-constrained:1..MAX"`
+	}
+	ctx := NewContext()
+	// BER and DER encodings are not affected
+	obj := Record{1, -1, "a", make([]byte, 32), []int{2}, big.NewInt(3)}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ctx.Encode(struct {
+		Count  int
+		Delta  int
+		Name   string
+		Digest []byte
+		Items  []int
+		Serial *big.Int
+	}(obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, expected)
+
+	s, err := ctx.Describe(Record{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, `Record ::= SEQUENCE {
+  count INTEGER (0..255),
+  delta INTEGER (MIN..0, ...),
+  name OCTET STRING (SIZE (1..MAX)),
+  digest OCTET STRING (SIZE (32)),
+  items SEQUENCE OF INTEGER (SIZE (0..8, ...)),
+  serial INTEGER (1..MAX)
+}
+`)
+
+	invalid := []interface{}{
+		struct {
+			A int `asn1:"per-constrained:5..1"`
+		}{},
+		struct {
+			A int `asn1:"per-constrained:a..b"`
+		}{},
+		struct {
+			A int `asn1:"per-extensible"`
+		}{},
+		struct {
+			A bool `asn1:"per-constrained:0..1"`
+		}{},
+		struct {
+			A string `asn1:"per-constrained:MIN..5"`
+		}{},
+	}
+	for _, obj := range invalid {
+		if err := ctx.CheckType(obj); err == nil {
+			t.Fatalf("Checking %T should have failed.", obj)
+		}
+	}
+}
+
+// cents implements Number with an int64.
+type cents struct {
+	value int64
+}
+
+func (c cents) Int64() int64      { return c.value }
+func (c *cents) SetInt64(n int64) { c.value = n }
+func (c cents) Bytes() []byte     { return nil }
+
+// wideNumber implements Number for non-negative values of any size.
+type wideNumber struct {
+	value *big.Int
+}
+
+func (w wideNumber) Int64() int64      { return w.value.Int64() }
+func (w *wideNumber) SetInt64(n int64) { w.value = big.NewInt(n) }
+func (w wideNumber) Bytes() []byte     { return append([]byte{0x00}, w.value.Bytes()...) }
+func (w *wideNumber) SetBytes(data []byte) error {
+	w.value = new(big.Int).SetBytes(data)
+	return nil
+}
+
+func TestNumber(t *testing.T) {
+	type Payment struct {
+		Amount cents
+		Fee    *cents `asn1:"optional"`
+	}
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "",
+		testCase{cents{-1050}, []byte{0x02, 0x02, 0xfb, 0xe6}},
+		testCase{Payment{cents{100}, &cents{5}}, []byte{0x30, 0x06, 0x02, 0x01, 0x64, 0x02, 0x01, 0x05}},
+		testCase{Payment{cents{100}, nil}, []byte{0x30, 0x03, 0x02, 0x01, 0x64}},
+	)
+
+	large := []byte{0x02, 0x09, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	var c cents
+	if _, err := ctx.Decode(large, &c); err == nil {
+		t.Fatal("Decoding a value larger than int64 should have failed.")
+	}
+	var w wideNumber
+	if _, err := ctx.Decode(large, &w); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, w.value.String(), "18446744073709551616")
+	data, err := ctx.Encode(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, large)
+
+	s, err := ctx.ToValueNotation(Payment{cents{250}, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, "{ amount 250 }")
+	var p Payment
+	if err := ctx.ParseValueNotation("{ amount 300, fee 7 }", &p); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, p, Payment{cents{300}, &cents{7}})
+}
+
+// computedMessage has fields computed when it's encoded.
+type computedMessage struct {
+	Length  int `asn1:"compute:PayloadLength"`
+	Payload []byte
+	Sum     int `asn1:"tag:0,optional,compute:Checksum"`
+}
+
+func (m computedMessage) PayloadLength() int {
+	return len(m.Payload)
+}
+
+func (m *computedMessage) Checksum() (int, error) {
+	if len(m.Payload) > 4 {
+		return 0, fmt.Errorf("payload too long")
+	}
+	sum := 0
+	for _, b := range m.Payload {
+		sum += int(b)
+	}
+	return sum, nil
+}
+
+func TestComputedFields(t *testing.T) {
+	ctx := NewContext()
+	data, err := ctx.Encode(computedMessage{Payload: []byte{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x30, 0x0a, 0x02, 0x01, 0x02, 0x04, 0x02, 0x01, 0x02, 0x80, 0x01, 0x03}
+	checkEqual(t, data, expected)
+	var decoded computedMessage
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, computedMessage{2, []byte{1, 2}, 3})
+
+	// Methods with pointer receivers are called for values that are not
+	// addressable
+	data, err = ctx.Encode([]computedMessage{{Payload: []byte{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x30, 0x07, 0x30, 0x05, 0x02, 0x01, 0x00, 0x04, 0x00})
+
+	if _, err := ctx.Encode(computedMessage{Payload: []byte{1, 2, 3, 4, 5}}); err == nil {
+		t.Fatal("Encoding should have failed with the error of the method.")
+	}
+	invalid := []interface{}{
+		struct {
+			A int `asn1:"compute:Missing"`
+		}{},
+		struct {
+			A string `asn1:"compute:PayloadLength"`
+			computedMessage
+		}{},
+	}
+	for _, obj := range invalid {
+		if err := ctx.CheckType(obj); err == nil {
+			t.Fatalf("Checking %T should have failed.", obj)
+		}
+	}
+}
+
+// validatedRange checks its invariant after it's decoded.
+type validatedRange struct {
+	Low, High int
+}
+
+func (r *validatedRange) Validate() error {
+	if r.Low > r.High {
+		return fmt.Errorf("low %d is greater than high %d", r.Low, r.High)
+	}
+	return nil
+}
+
+// taggedValue uses the Context after it's decoded.
+type taggedValue struct {
+	Name  string
+	Value stdasn1.RawValue
+	Kind  string `asn1:"-"`
+}
+
+func (v *taggedValue) AfterDecode(ctx *Context) error {
+	v.Kind = TagString(uint(v.Value.Class), uint(v.Value.Tag))
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	type Message struct {
+		Ranges []validatedRange
+		Extra  *validatedRange `asn1:"tag:0,explicit,optional"`
+	}
+	ctx := NewContext()
+	valid := Message{[]validatedRange{{1, 2}}, &validatedRange{3, 3}}
+	testEncodeDecode(t, ctx, "", testCase{valid, []byte{
+		0x30, 0x14,
+		0x30, 0x08, 0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02,
+		0xa0, 0x08, 0x30, 0x06, 0x02, 0x01, 0x03, 0x02, 0x01, 0x03,
+	}})
+
+	for _, test := range []struct {
+		obj      Message
+		expected string
+	}{
+		{
+			Message{[]validatedRange{{1, 2}, {5, 4}}, nil},
+			"field Ranges[1]: invalid value of Go type 'asn1.validatedRange': low 5 is greater than high 4",
+		},
+		{
+			Message{nil, &validatedRange{2, 1}},
+			"field Extra: invalid value of Go type 'asn1.validatedRange': low 2 is greater than high 1",
+		},
+	} {
+		data, err := ctx.Encode(test.obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Message
+		_, err = ctx.Decode(data, &decoded)
+		if _, ok := err.(*ParseError); !ok {
+			t.Fatalf("Expected a ParseError, got: %v", err)
+		}
+		checkEqual(t, err.Error(), test.expected)
+
+		ctx.SetValidation(false)
+		if _, err := ctx.Decode(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		ctx.SetValidation(true)
+	}
+
+	var v taggedValue
+	if _, err := ctx.Decode([]byte{0x30, 0x06, 0x04, 0x01, 0x61, 0x01, 0x01, 0xff}, &v); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, v.Kind, "BOOLEAN")
+}
+
+func TestSensitive(t *testing.T) {
+	type Subscriber struct {
+		Name string
+		IMSI string `asn1:"sensitive,alphabet:0-9"`
+		Key  []byte `asn1:"tag:0,optional,sensitive"`
+		Age  uint8  `asn1:"sensitive"`
+	}
+	ctx := NewContext()
+	obj := Subscriber{"alice", "001010123456789", []byte{0xaa, 0xbb}, 30}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Subscriber
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, obj)
+
+	s, err := ctx.Dump(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, `{ name "alice", iMSI <redacted>, key <redacted>, age <redacted> }`)
+	s, err = ctx.ToValueNotation(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, `{ name "alice", iMSI "001010123456789", key 'AABB'H, age 30 }`)
+
+	// Errors don't include the content
+	_, err = ctx.Encode(Subscriber{IMSI: "00101x"})
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("Expected a SyntaxError, got: %v", err)
+	}
+	checkEqual(t, err.Error(), "field Subscriber.IMSI: invalid value of sensitive field")
+	data = []byte{0x30, 0x0a, 0x04, 0x01, 0x61, 0x04, 0x01, 0x31, 0x02, 0x02, 0x01, 0x2c}
+	_, err = ctx.Decode(data, &decoded)
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Expected a ParseError, got: %v", err)
+	}
+	checkEqual(t, err.Error(), "field Age: invalid value of sensitive field")
+}
+
+// xorCodec is a Codec that inverts the bits of the content.
+type xorCodec struct{}
+
+func (xorCodec) Encode(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = ^b
+	}
+	return out, nil
+}
+
+func (c xorCodec) Decode(data []byte) ([]byte, error) {
+	return c.Encode(data)
+}
+
+func TestCodecs(t *testing.T) {
+	type Message struct {
+		ID   int
+		Body []byte `asn1:"compress:gzip"`
+		Note string `asn1:"tag:0,explicit,compress:xor"`
+	}
+	ctx := NewContext()
+	if err := ctx.AddCodec("xor", xorCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddCodec("gzip", xorCodec{}); err == nil {
+		t.Fatal("Registering a codec twice should have failed.")
+	}
+	obj := Message{1, bytes.Repeat([]byte("payload "), 100), "ab"}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 100 {
+		t.Fatalf("Body was not compressed: %d bytes", len(data))
+	}
+	checkEqual(t, data[len(data)-6:], []byte{0xa0, 0x04, 0x04, 0x02, 0x9e, 0x9d})
+	var decoded Message
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, obj)
+
+	// Invalid content
+	_, err = ctx.Decode([]byte{0x30, 0x0b, 0x02, 0x01, 0x01, 0x04, 0x00, 0xa0, 0x04, 0x04, 0x02, 0x9e, 0x9d}, &decoded)
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Expected a ParseError, got: %v", err)
+	}
+
+	// Restored contents are limited by the codec limit and the memory budget
+	bomb, err := ctx.Encode(Message{1, make([]byte, 1<<20), "ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := ctx.NewChild()
+	limited.SetMaxCodecLength(1000)
+	if _, err := limited.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	_, err = limited.Decode(bomb, &decoded)
+	if _, ok := err.(*ParseError); !ok || !strings.Contains(err.Error(), "limit of 1000 octets") {
+		t.Fatalf("Expected a ParseError for the codec limit, got: %v", err)
+	}
+	limited = ctx.NewChild()
+	limited.SetMemoryBudget(int64(len(bomb)) * 10)
+	_, err = limited.Decode(bomb, &decoded)
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Expected a ParseError for the memory budget, got: %v", err)
+	}
+
+	invalid := []interface{}{
+		struct {
+			A int `asn1:"compress:gzip"`
+		}{},
+		struct {
+			A []byte `asn1:"compress:zip"`
+		}{},
+	}
+	for _, obj := range invalid {
+		if err := ctx.CheckType(obj); err == nil {
+			t.Fatalf("Checking %T should have failed.", obj)
+		}
+	}
+}
+
+// testCipher is a FieldCipher that prefixes the key identifier and inverts
+// the bits of the plaintext.
+type testCipher struct{}
+
+func (testCipher) Encrypt(keyID string, plaintext []byte) ([]byte, error) {
+	data, _ := xorCodec{}.Encode(plaintext)
+	return append([]byte(keyID+":"), data...), nil
+}
+
+func (testCipher) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, []byte(keyID+":")) {
+		return nil, fmt.Errorf("wrong key")
+	}
+	return xorCodec{}.Decode(ciphertext[len(keyID)+1:])
+}
+
+func TestEncryptedFields(t *testing.T) {
+	type Credentials struct {
+		User     string
+		Password string
+	}
+	type Message struct {
+		ID     int
+		Secret Credentials `asn1:"tag:1,encrypt:k"`
+		Pin    int         `asn1:"tag:2,explicit,optional,encrypt"`
+	}
+	ctx := NewContext()
+	obj := Message{1, Credentials{"a", "b"}, 7}
+	if _, err := ctx.Encode(obj); err == nil {
+		t.Fatal("Encoding without a FieldCipher should have failed.")
+	}
+	ctx.SetFieldCipher(testCipher{})
+	testEncodeDecode(t, ctx, "",
+		testCase{obj, []byte{
+			0x30, 0x17,
+			0x02, 0x01, 0x01,
+			0x81, 0x0a, 'k', ':', 0xcf, 0xf9, 0xfb, 0xfe, 0x9e, 0xfb, 0xfe, 0x9d,
+			0xa2, 0x06, 0x04, 0x04, ':', 0xfd, 0xfe, 0xf8,
+		}},
+	)
+	data, err := ctx.Encode(Message{2, Credentials{}, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, Message{2, Credentials{}, 0})
+
+	// Wrong key
+	data = []byte{0x30, 0x0b, 0x02, 0x01, 0x01, 0x81, 0x06, 'x', ':', 0xcf, 0xff, 0xcf, 0xff}
+	_, err = ctx.Decode(data, &decoded)
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Expected a ParseError, got: %v", err)
+	}
+	checkEqual(t, err.Error(), "field Secret: decryption failed: wrong key")
+}
+
+func TestTopLevelOptions(t *testing.T) {
+	type KdcReq struct {
+		Pvno  int    `asn1:"tag:1,explicit"`
+		Realm string `asn1:"tag:2,explicit"`
+	}
+	ctx := NewContext()
+	obj := KdcReq{5, "X"}
+	content := []byte{0x30, 0x0a, 0xa1, 0x03, 0x02, 0x01, 0x05, 0xa2, 0x03, 0x04, 0x01, 'X'}
+	asReq := append([]byte{0x6a, 0x0c}, content...)
+	testEncodeDecode(t, ctx, "application,tag:10,explicit", testCase{obj, asReq})
+	testEncodeDecode(t, ctx, "tag:a10,explicit", testCase{obj, asReq})
+	testEncodeDecode(t, ctx, "private,tag:3", testCase{obj, append([]byte{0xe3}, content[1:]...)})
+	testEncodeDecode(t, ctx, "set,application,tag:10,explicit",
+		testCase{obj, append([]byte{0x6a, 0x0c, 0x31}, content[1:]...)})
+	testEncodeDecode(t, ctx, "application,tag:10,explicit,tag2:0,explicit2",
+		testCase{obj, append([]byte{0xa0, 0x0e}, asReq...)})
+
+	var decoded KdcReq
+	if _, err := ctx.DecodeWithOptions(asReq, &decoded, "application,tag:11,explicit"); err == nil {
+		t.Fatal("Decoding with a different tag should have failed.")
+	}
+
+	// A choice with application tags
+	err := ctx.AddChoice("message", []Choice{
+		{Type: reflect.TypeOf(KdcReq{}), Options: "application,tag:10,explicit"},
+		{Type: reflect.TypeOf(0), Options: "application,tag:30"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ctx.EncodeWithOptions(obj, "choice:message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, asReq)
+	var msg interface{}
+	if _, err := ctx.DecodeWithOptions(data, &msg, "choice:message"); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, msg, obj)
+
+	// Absent root values
+	data, err = ctx.EncodeWithOptions((*KdcReq)(nil), "optional,application,tag:10,explicit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("Expected no data for an absent value, got: %#v", data)
+	}
+	num := 5
+	if _, err := ctx.DecodeWithOptions(nil, &num, "default:3,application,tag:10"); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, num, 3)
+	if _, err := ctx.DecodeWithOptions(nil, &num, "application,tag:10"); err == nil {
+		t.Fatal("Decoding empty data should have failed.")
+	}
+}
+
+func TestChoiceWithExplicitAlternatives(t *testing.T) {
+	// GeneralName ::= CHOICE {
+	//   dNSName [2] IA5String,
+	//   directoryName [4] EXPLICIT Name,
+	//   uniformResourceIdentifier [6] IA5String }
+	type DNSName string
+	type URI string
+	type Name []string
+	type Names struct {
+		Subject interface{}   `asn1:"choice:gn,optional"`
+		Issuer  interface{}   `asn1:"tag:0,explicit,choice:gn"`
+		Others  []interface{} `asn1:"tag:1,choices:gn"`
+	}
+	ctx := NewContext()
+	err := ctx.AddChoice("gn", []Choice{
+		{reflect.TypeOf(DNSName("")), "tag:2"},
+		{reflect.TypeOf(Name{}), "tag:4,explicit"},
+		{reflect.TypeOf(URI("")), "tag:6"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncodeDecode(t, ctx, "",
+		testCase{Names{Name{"a"}, Name{"b"}, []interface{}{URI("c"), DNSName("d")}}, []byte{
+			0x30, 0x18,
+			0xa4, 0x05, 0x30, 0x03, 0x04, 0x01, 'a',
+			0xa0, 0x07, 0xa4, 0x05, 0x30, 0x03, 0x04, 0x01, 'b',
+			0xa1, 0x06, 0x86, 0x01, 'c', 0x82, 0x01, 'd',
+		}},
+		testCase{Names{nil, URI("b"), nil}, []byte{
+			0x30, 0x07,
+			0xa0, 0x03, 0x86, 0x01, 'b',
+			0xa1, 0x00,
+		}},
+	)
+
+	desc, err := ctx.Describe(Names{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(desc, "issuer [0] EXPLICIT CHOICE {") {
+		t.Fatalf("Unexpected description:\n%s", desc)
+	}
+}
+
+func TestGeneralizedTime(t *testing.T) {
+	ctx := NewContext()
+	date := time.Date(2051, 2, 3, 4, 5, 6, 0, time.UTC)
+	testEncodeDecode(t, ctx, "",
+		testCase{GeneralizedTime{date}, append([]byte{0x18, 0x0f}, "20510203040506Z"...)},
+		testCase{GeneralizedTime{date.Add(500 * time.Millisecond)},
+			append([]byte{0x18, 0x11}, "20510203040506.5Z"...)},
+	)
+
+	// Local times and time zones are only accepted in BER
+	ctx.SetDer(true, true)
+	for _, s := range []string{"20510203040506", "20510203070506+0300", "205102030405Z", "20510203040506.50Z"} {
+		data := append([]byte{0x18, byte(len(s))}, s...)
+		var decoded GeneralizedTime
+		if _, err := ctx.Decode(data, &decoded); err == nil {
+			t.Fatalf("Decoding %q in DER should have failed.", s)
+		}
+	}
+	ctx.SetDer(true, false)
+	var decoded GeneralizedTime
+	data := append([]byte{0x18, 0x13}, "20510203070506+0300"...)
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded.UTC(), date)
+}
+
+func TestUntaggedChoice(t *testing.T) {
+	type Validity struct {
+		NotBefore interface{} `asn1:"choice:time"`
+		NotAfter  interface{} `asn1:"choice:time"`
+	}
+	ctx := NewContext()
+	err := ctx.AddChoice("time", []Choice{
+		{Type: reflect.TypeOf(UTCTime{})},
+		{Type: reflect.TypeOf(GeneralizedTime{})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := UTCTime{time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)}
+	notAfter := GeneralizedTime{time.Date(2051, 1, 2, 3, 4, 5, 0, time.UTC)}
+	testEncodeDecode(t, ctx, "", testCase{Validity{notBefore, notAfter}, []byte{
+		0x30, 0x20,
+		0x17, 0x0d, '1', '9', '0', '1', '0', '2', '0', '3', '0', '4', '0', '5', 'Z',
+		0x18, 0x0f, '2', '0', '5', '1', '0', '1', '0', '2', '0', '3', '0', '4', '0', '5', 'Z',
+	}})
+
+	// Other universal tags are not alternatives of the choice
+	var decoded Validity
+	_, err = ctx.Decode([]byte{0x30, 0x06, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00}, &decoded)
+	if err == nil {
+		t.Fatal("Decoding an INTEGER as a time should have failed.")
+	}
+
+	// Two alternatives can't have the same universal tag
+	err = ctx.AddChoice("number", []Choice{
+		{Type: reflect.TypeOf(0)},
+		{Type: reflect.TypeOf(Enum(0)), Options: "universal,tag:2"},
+	})
+	if err == nil {
+		t.Fatal("Adding alternatives with the same tag should have failed.")
+	}
+}
+
+func TestTime(t *testing.T) {
+	type Validity struct {
+		NotBefore Time
+		NotAfter  Time
+		Revoked   Time `asn1:"tag:0,explicit,optional"`
+	}
+	ctx := NewContext()
+	zone := time.FixedZone("", 3*3600)
+	notBefore := Time{time.Date(2019, 1, 2, 6, 4, 5, 0, zone)}
+	notAfter := Time{time.Date(2051, 1, 2, 3, 4, 5, 0, time.UTC)}
+	revoked := Time{time.Date(1949, 12, 31, 23, 59, 59, 0, time.UTC)}
+	obj := Validity{notBefore, notAfter, revoked}
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0x30, 0x33,
+		0x17, 0x0d, '1', '9', '0', '1', '0', '2', '0', '3', '0', '4', '0', '5', 'Z',
+		0x18, 0x0f, '2', '0', '5', '1', '0', '1', '0', '2', '0', '3', '0', '4', '0', '5', 'Z',
+		0xa0, 0x11, 0x18, 0x0f, '1', '9', '4', '9', '1', '2', '3', '1', '2', '3', '5', '9', '5', '9', 'Z',
+	})
+	var decoded Validity
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded.NotBefore.Equal(notBefore.Time), true)
+	checkEqual(t, decoded.NotAfter.Equal(notAfter.Time), true)
+	checkEqual(t, decoded.Revoked.Equal(revoked.Time), true)
+
+	// GeneralizedTime is accepted for any date
+	data = append([]byte{0x18, 0x0f}, "20190102030405Z"...)
+	var decodedTime Time
+	if _, err := ctx.Decode(data, &decodedTime); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decodedTime.Equal(notBefore.Time), true)
+
+	// Other types are not
+	if _, err := ctx.Decode([]byte{0x04, 0x00}, &decodedTime); err == nil {
+		t.Fatal("Decoding an OCTET STRING as Time should have failed.")
+	}
+	if _, err := ctx.EncodeWithOptions(notAfter, "tag:1"); err == nil {
+		t.Fatal("Encoding Time with an implicit tag should have failed.")
+	}
+	if err := ctx.CheckTypeWithOptions(notAfter, "tag:1"); err == nil {
+		t.Fatal("Checking Time with an implicit tag should have failed.")
+	}
+
+	notation, err := ctx.ToValueNotation(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Validity
+	if err := ctx.ParseValueNotation(notation, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, parsed.NotAfter.Equal(notAfter.Time), true)
+}
+
+type intSet []int
+
+func (intSet) SetOf() {}
+
+type intsSET []int
+
+func TestSetOfType(t *testing.T) {
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "",
+		testCase{[]intSet{{1}, {2, 3}}, []byte{
+			0x30, 0x0d,
+			0x31, 0x03, 0x02, 0x01, 0x01,
+			0x31, 0x06, 0x02, 0x01, 0x02, 0x02, 0x01, 0x03,
+		}},
+	)
+	if err := ctx.CheckType([]intSet{}); err != nil {
+		t.Fatal(err)
+	}
+	// The name of the type doesn't change its encoding
+	testEncodeDecode(t, ctx, "",
+		testCase{[]intsSET{{1}}, []byte{0x30, 0x05, 0x30, 0x03, 0x02, 0x01, 0x01}},
+	)
+}
+
+func TestSetOfOrder(t *testing.T) {
+	type Attribute struct {
+		Type   Oid
+		Values []interface{} `asn1:"set,choices:value"`
+	}
+	type SignedAttributes struct {
+		Attributes []Attribute `asn1:"set"`
+	}
+	ctx := NewContext()
+	err := ctx.AddChoice("value", []Choice{
+		{reflect.TypeOf(0), ""},
+		{reflect.TypeOf(""), ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsorted := []byte{
+		0x30, 0x19,
+		0x31, 0x17,
+		0x30, 0x0b, 0x06, 0x01, 0x2a, 0x31, 0x06, 0x04, 0x01, 'b', 0x02, 0x01, 0x00,
+		0x30, 0x08, 0x06, 0x01, 0x29, 0x31, 0x03, 0x02, 0x01, 0x01,
+	}
+	var obj SignedAttributes
+	if _, err := ctx.Decode(unsorted, &obj); err != nil {
+		t.Fatal(err)
+	}
+
+	// The elements are sorted in DER, including the nested ones
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0x30, 0x19,
+		0x31, 0x17,
+		0x30, 0x08, 0x06, 0x01, 0x29, 0x31, 0x03, 0x02, 0x01, 0x01,
+		0x30, 0x0b, 0x06, 0x01, 0x2a, 0x31, 0x06, 0x02, 0x01, 0x00, 0x04, 0x01, 'b',
+	})
+
+	// Or kept in their original order
+	ctx.SetPreserveSetOrder(true)
+	data, err = ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, unsorted)
+}
+
+func TestPreserveEncoding(t *testing.T) {
+	type Body struct {
+		N int
+		S []byte
+	}
+	type Message struct {
+		Hop  int
+		Body Body
+	}
+	// The body has an indefinite length and a length in the long form
+	data := []byte{
+		0x30, 0x0e,
+		0x02, 0x01, 0x01,
+		0x30, 0x80, 0x02, 0x81, 0x01, 0x05, 0x04, 0x01, 'A', 0x00, 0x00,
+	}
+	ctx := NewContext()
+	ctx.SetPreserveEncoding(true)
+	var msg Message
+	if _, err := ctx.Decode(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := ctx.Encode(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, encoded, data)
+
+	// Only the modified values are encoded again
+	msg.Hop = 2
+	encoded, err = ctx.Encode(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, encoded, []byte{
+		0x30, 0x0e,
+		0x02, 0x01, 0x02,
+		0x30, 0x80, 0x02, 0x81, 0x01, 0x05, 0x04, 0x01, 'A', 0x00, 0x00,
+	})
+	msg.Body.N = 6
+	expected := []byte{
+		0x30, 0x0b,
+		0x02, 0x01, 0x02,
+		0x30, 0x06, 0x02, 0x01, 0x06, 0x04, 0x01, 'A',
+	}
+	encoded, err = ctx.Encode(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, encoded, expected)
+
+	// Disabling the preservation releases the original encodings
+	msg.Body.N = 5
+	ctx.SetPreserveEncoding(false)
+	encoded, err = ctx.Encode(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected[9] = 0x05
+	checkEqual(t, encoded, expected)
+}
+
+func TestPatch(t *testing.T) {
+	type Info struct {
+		Serial    int
+		Timestamp []byte `asn1:"optional,tag:0"`
+	}
+	type Signed struct {
+		Info      Info
+		Signature []byte
+	}
+	// The signature has a length in the long form, which must be kept
+	data := []byte{
+		0x30, 0x0e,
+		0x30, 0x07, 0x02, 0x01, 0x01, 0x80, 0x02, 0x00, 0x00,
+		0x04, 0x81, 0x02, 0xaa, 0xbb,
+	}
+	var obj Signed
+	_, trace, err := NewContext().DecodeWithTrace(data, &obj, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := append([]byte{0x80, 0x81, 0x80}, make([]byte, 0x80)...)
+	patched, err := trace.Patch(data, "Info.Timestamp", timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x30, 0x81, 0x8e, 0x30, 0x81, 0x86, 0x02, 0x01, 0x01}
+	expected = append(expected, timestamp...)
+	expected = append(expected, 0x04, 0x81, 0x02, 0xaa, 0xbb)
+	checkEqual(t, patched, expected)
+	if !bytes.Equal(data[:3], []byte{0x30, 0x0e, 0x30}) {
+		t.Error("data was modified")
+	}
+
+	// The range must match an element
+	if _, err := Patch(data, 3, 3, []byte{0x02, 0x01, 0x02}); err == nil {
+		t.Error("expected an error for a range inside an element")
+	}
+	if _, err := Patch(data, 4, 3, []byte{0x02, 0x01, 0x02, 0x00}); err == nil {
+		t.Error("expected an error for a replacement with trailing data")
+	}
+	patched, err = Patch(data, 4, 3, []byte{0x02, 0x01, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[6] = 0x02
+	checkEqual(t, patched, data)
+}
+
+func TestLengthOctets(t *testing.T) {
+	type Message struct {
+		A int
+		B []byte `asn1:"length-octets:2"`
+		C int    `asn1:"tag:0,explicit,length-octets:1"`
+	}
+	obj := Message{1, []byte{0xaa}, 2}
+	ctx := NewContext()
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0x30, 0x0e,
+		0x02, 0x01, 0x01,
+		0x04, 0x82, 0x00, 0x01, 0xaa,
+		0xa0, 0x81, 0x03, 0x02, 0x01, 0x02,
+	})
+
+	// Every length is forced unless the field gives its own
+	ctx.SetLengthOctets(4)
+	data, err = ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0x30, 0x84, 0x00, 0x00, 0x00, 0x16,
+		0x02, 0x84, 0x00, 0x00, 0x00, 0x01, 0x01,
+		0x04, 0x82, 0x00, 0x01, 0xaa,
+		0xa0, 0x81, 0x07, 0x02, 0x84, 0x00, 0x00, 0x00, 0x01, 0x02,
+	})
+	var decoded Message
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, obj) {
+		t.Errorf("got %#v, expected %#v", decoded, obj)
+	}
+
+	// Lengths that don't fit are rejected
+	_, err = ctx.EncodeWithOptions(make([]byte, 256), "length-octets:1")
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("expected a SyntaxError, got %v", err)
+	}
+	_, err = ctx.EncodeWithOptions(1, "length-octets:9")
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("expected a SyntaxError, got %v", err)
+	}
+
+	// The length of lengths can be limited when decoding
+	ctx.SetMaxLengthOctets(2)
+	_, err = ctx.Decode(data, &decoded)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+}
+
+func TestMaxTagNumber(t *testing.T) {
+	ctx := NewContext()
+	var obj stdasn1.RawValue
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		// [PRIVATE 2^31] is above the default limit
+		{[]byte{0xdf, 0x88, 0x80, 0x80, 0x80, 0x00, 0x00}, "tag number 2147483648 is greater than the maximum of 2147483647"},
+		{[]byte{0xdf, 0x80, 0x80, 0x80, 0x01, 0x00}, "multi byte tag with leading zero octet"},
+	}
+	for _, test := range tests {
+		_, err := ctx.Decode(test.data, &obj)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error %q for %x, got %v", test.err, test.data, err)
+		}
+	}
+
+	data := []byte{0x9f, 0x82, 0x00, 0x01, 0x00}
+	if _, err := ctx.Decode(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetMaxTagNumber(255)
+	_, err := ctx.Decode(data, &obj)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	data := []byte{
+		// SEQUENCE with an indefinite length
+		0x30, 0x80,
+		0x02, 0x02, 0x00, 0x01,
+		0x31, 0x06, 0x04, 0x01, 0x02, 0x04, 0x01, 0x01,
+		0x01, 0x01, 0x01,
+		0x00, 0x00,
+		// Another element with a length in the long form
+		0x04, 0x81, 0x01, 0xaa,
+	}
+	report, err := NewContext().Analyze(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Report{
+		Elements:    7,
+		Constructed: 2,
+		MaxDepth:    3,
+		Largest:     ElementRange{ClassUniversal, TagSequence, 0, 19},
+		Violations: []Violation{
+			{0, "indefinite length of SEQUENCE"},
+			{2, "INTEGER is not encoded in the minimum number of octets"},
+			{11, "OCTET STRING is not sorted in its SET"},
+			{14, "BOOLEAN is not 0x00 or 0xff"},
+			{19, "length of OCTET STRING is not minimal"},
+		},
+		Tags: map[string]int{
+			"SEQUENCE": 1, "SET": 1, "INTEGER": 1, "OCTET STRING": 3, "BOOLEAN": 1,
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("got %+v, expected %+v", report, expected)
+	}
+
+	// The elements found before an error are reported
+	report, err = NewContext().Analyze(data[:21])
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+	if report.Elements != 6 {
+		t.Errorf("got %d elements, expected 6", report.Elements)
+	}
+}
+
+func TestGoTime(t *testing.T) {
+	type Record struct {
+		Created  time.Time
+		Expires  *time.Time `asn1:"optional"`
+		Modified time.Time  `asn1:"timelayout:2006-01-02T15:04:05,universal,tag:4"`
+		Deleted  *time.Time `asn1:"tag:0,optional,timelayout:20060102"`
+	}
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	deleted := time.Date(2061, 1, 2, 0, 0, 0, 0, time.UTC)
+	obj := Record{
+		Created:  created,
+		Modified: created,
+		Deleted:  &deleted,
+	}
+	data := []byte{
+		0x30, 0x2e,
+		0x17, 0x0d, '2', '0', '0', '1', '0', '2', '0', '3', '0', '4', '0', '5', 'Z',
+		0x04, 0x13, '2', '0', '2', '0', '-', '0', '1', '-', '0', '2', 'T',
+		'0', '3', ':', '0', '4', ':', '0', '5',
+		0x80, 0x08, '2', '0', '6', '1', '0', '1', '0', '2',
+	}
+	testEncodeDecode(t, NewContext(), "", testCase{obj, data})
+
+	// Strings that don't match the layout are rejected
+	data[21] = '/'
+	var decoded Record
+	if _, err := Decode(data, &decoded); err == nil {
+		t.Error("expected an error for a time with the wrong layout")
+	}
+
+	// The layout can only be used with time.Time
+	type Invalid struct {
+		N int `asn1:"timelayout:2006"`
+	}
+	err := NewContext().CheckType(Invalid{})
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("expected a SyntaxError, got %v", err)
+	}
+	_, err = EncodeWithOptions(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC), "timelayout:2006")
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("expected a SyntaxError, got %v", err)
+	}
+}
+
+func TestReal(t *testing.T) {
+	ctx := NewContext()
+	testCases := []testCase{
+		{0.0, []byte{0x09, 0x00}},
+		{1.0, []byte{0x09, 0x03, 0x80, 0x00, 0x01}},
+		{0.5, []byte{0x09, 0x03, 0x80, 0xff, 0x01}},
+		{-2.5, []byte{0x09, 0x03, 0xc0, 0xff, 0x05}},
+		{float32(1024), []byte{0x09, 0x03, 0x80, 0x0a, 0x01}},
+		{math.Inf(1), []byte{0x09, 0x01, 0x40}},
+		{math.Inf(-1), []byte{0x09, 0x01, 0x41}},
+		{math.Copysign(0, -1), []byte{0x09, 0x01, 0x43}},
+	}
+	for _, test := range testCases {
+		testEncodeDecode(t, ctx, "", test)
+	}
+
+	// Decimal form required by DER
+	ctx.SetRealFormat(RealFormat{Decimal: true})
+	testCases = []testCase{
+		{1.5, append([]byte{0x09, 0x07, 0x03}, "15.E-1"...)},
+		{100.0, append([]byte{0x09, 0x05, 0x03}, "1.E2"...)},
+		{-1.0, append([]byte{0x09, 0x07, 0x03}, "-1.E+0"...)},
+		{float32(0.1), append([]byte{0x09, 0x06, 0x03}, "1.E-1"...)},
+	}
+	for _, test := range testCases {
+		testEncodeDecode(t, ctx, "", test)
+	}
+
+	// Fixed precision with a two-digit exponent
+	ctx.SetRealFormat(RealFormat{Decimal: true, Digits: 4, ExponentDigits: 2})
+	testCases = []testCase{
+		{15.0, append([]byte{0x09, 0x0a, 0x03}, "1.500E+01"...)},
+		{0.015, append([]byte{0x09, 0x0a, 0x03}, "1.500E-02"...)},
+		{-2.0, append([]byte{0x09, 0x0b, 0x03}, "-2.000E+00"...)},
+	}
+	for _, test := range testCases {
+		testEncodeDecode(t, ctx, "", test)
+	}
+
+	// Other decimal forms
+	var f float64
+	for data, expected := range map[string]float64{
+		"\x0142":    42,
+		"\x02 1,5":  1.5,
+		"\x03-5E-1": -0.5,
+	} {
+		if _, err := Decode(append([]byte{0x09, byte(len(data))}, data...), &f); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, f, expected)
+	}
+	for _, data := range []string{"\x011.5", "\x02Inf", "\x03", "\x04", "\x03NaN"} {
+		if _, err := Decode(append([]byte{0x09, byte(len(data))}, data...), &f); err == nil {
+			t.Errorf("expected an error for REAL %q", data)
+		}
+	}
+
+	// Values that don't fit
+	var small float32
+	if _, err := Decode([]byte{0x09, 0x04, 0x81, 0x03, 0xe8, 0x01}, &small); err == nil {
+		t.Error("expected an error for a REAL that does not fit in a float32")
+	}
+}
+
+type embeddedCode int
+
+type EmbeddedCode int
+
+func TestUnexportedFields(t *testing.T) {
+	type Inner struct {
+		N int
+	}
+	type Record struct {
+		A            int
+		b            int
+		c            string `asn1:"tag:0"`
+		d            int    `asn1:"-"`
+		Inner               // Regular component named Inner
+		EmbeddedCode        // Regular component named EmbeddedCode
+		embeddedCode        // Ignored
+	}
+	obj := Record{A: 1, b: 2, c: "c", d: 3, Inner: Inner{4}, EmbeddedCode: 5, embeddedCode: 6}
+	data := []byte{
+		0x30, 0x0b,
+		0x02, 0x01, 0x01,
+		0x30, 0x03, 0x02, 0x01, 0x04,
+		0x02, 0x01, 0x05,
+	}
+	ctx := NewContext()
+	encoded, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, encoded, data)
+
+	// Unexported fields are left untouched when decoding
+	decoded := Record{b: 7}
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, Record{A: 1, b: 7, Inner: Inner{4}, EmbeddedCode: 5})
+
+	// Strict fields reject the tagged unexported field and the embedded field
+	// of an unexported type
+	ctx.SetStrictFields(true)
+	if _, err := ctx.Encode(obj); err == nil || !strings.Contains(err.Error(), "Record.c") {
+		t.Errorf("expected an error for the unexported field c, got %v", err)
+	}
+	type Embedded struct {
+		A int
+		embeddedCode
+	}
+	if err := ctx.CheckType(Embedded{}); err == nil || !strings.Contains(err.Error(), "embeddedCode") {
+		t.Errorf("expected an error for the embedded field, got %v", err)
+	}
+	type Untagged struct {
+		A int
+		b int
+		c int `asn1:"-"`
+	}
+	testEncodeDecode(t, ctx, "", testCase{Untagged{A: 1}, []byte{0x30, 0x03, 0x02, 0x01, 0x01}})
+}
+
+func TestNameOption(t *testing.T) {
+	type Record struct {
+		Serial  int  `asn1:"name:serial-number"`
+		Enabled bool `asn1:"optional"`
+		Count   int  `asn1:"name:count,default:1"`
+	}
+	ctx := NewContext()
+	s, err := ctx.ToValueNotation(Record{Serial: 5, Enabled: true, Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, s, "{ serial-number 5, enabled TRUE, count 2 }")
+
+	var decoded Record
+	if err := ctx.ParseValueNotation("{ serial-number 7 }", &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, Record{Serial: 7, Count: 1})
+	if err := ctx.ParseValueNotation("{ serial 7 }", &decoded); err == nil {
+		t.Error("expected an error for the identifier derived from the field name")
+	}
+
+	s, err = ctx.Describe(Record{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Record ::= SEQUENCE {
+  serial-number INTEGER,
+  enabled BOOLEAN OPTIONAL,
+  count INTEGER DEFAULT 1
+}
+`
+	checkEqual(t, s, expected)
+
+	invalid := []interface{}{
+		struct {
+			A int `asn1:"name:Upper"`
+		}{},
+		struct {
+			A int `asn1:"name:trailing-"`
+		}{},
+		struct {
+			A int
+			B int `asn1:"name:a"`
+		}{},
+	}
+	for _, obj := range invalid {
+		if err := ctx.CheckType(obj); err == nil {
+			t.Errorf("checking %T should have failed", obj)
+		}
+	}
+}
+
+func TestOptionAliases(t *testing.T) {
+	type Record struct {
+		A int `asn1:"Tag:0,OPTIONAL"`
+		B int `asn1:"app,tag:1,opt"`
+		C int `asn1:"tag:2,implicit"`
+	}
+	obj := Record{A: 1, C: 2}
+	data := []byte{0x30, 0x06, 0x80, 0x01, 0x01, 0x82, 0x01, 0x02}
+	testEncodeDecode(t, NewContext(), "", testCase{obj, data})
+
+	ctx := NewContext()
+	if err := ctx.AddOption("mytag", func(arg string) (string, error) {
+		return "tag:" + arg, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddOption("Explicit", nil); err == nil {
+		t.Error("expected an error for a built-in option in upper case")
+	}
+	for options, expected := range map[string]string{
+		"optinal":                 "invalid option 'optinal', did you mean 'optional'?",
+		"tga:1":                   "invalid option 'tga', did you mean 'tag'?",
+		"Per-Extensibel":          "invalid option 'Per-Extensibel', did you mean 'per-extensible'?",
+		"mytga:1":                 "invalid option 'mytga', did you mean 'mytag'?",
+		"unrelated":               "invalid option 'unrelated'",
+		"tag:1,implicit,explicit": "'implicit' and 'explicit' cannot be used together",
+	} {
+		_, err := ctx.EncodeWithOptions(1, options)
+		if err == nil || err.Error() != expected {
+			t.Errorf("options %q: got error %v, expected %q", options, err, expected)
+		}
+	}
+
+	// Every built-in option is known
+	for _, name := range builtinOptions {
+		if known, _ := parseBuiltinOption(&fieldOptions{}, []string{name}); !known {
+			t.Errorf("option '%s' is not known", name)
+		}
+	}
+}
+
+func TestExclusiveOptions(t *testing.T) {
+	ctx := NewContext()
+	for options, expected := range map[string]string{
+		"universal,application,tag:1": "'universal' and 'application' cannot be used together",
+		"universal,private,tag:1":     "'universal' and 'private' cannot be used together",
+		"application,private,tag:1":   "'application' and 'private' cannot be used together",
+		"implicit,explicit,tag:1":     "'implicit' and 'explicit' cannot be used together",
+		"optional,default:1":          "'optional' and 'default' cannot be used together",
+		"choice:a,choices:b":          "'choice' and 'choices' cannot be used together",
+		"choice:a,set":                "'choice' and 'set' cannot be used together",
+		"indefinite,length-octets:2":  "'indefinite' and 'length-octets' cannot be used together",
+	} {
+		_, err := ctx.EncodeWithOptions(1, options)
+		if err == nil || err.Error() != expected {
+			t.Errorf("options %q: got error %v, expected %q", options, err, expected)
+		}
+	}
+
+	// Options that don't apply to the type
+	for _, obj := range []interface{}{
+		struct {
+			A int `asn1:"set"`
+		}{},
+		struct {
+			A []byte `asn1:"set"`
+		}{},
+		struct {
+			A string `asn1:"explicit,tag:0,set"`
+		}{},
+	} {
+		err := ctx.CheckType(obj)
+		if err == nil || !strings.Contains(err.Error(), "option 'set' cannot be used") {
+			t.Errorf("checking %T: got error %v", obj, err)
+		}
+	}
+
+	// Valid combinations
+	type Inner struct {
+		A int
+	}
+	for _, obj := range []interface{}{
+		struct {
+			A *Inner  `asn1:"set,optional"`
+			B []int   `asn1:"set,tag:0"`
+			C [2]int  `asn1:"set,explicit,tag:1"`
+			D int     `asn1:"explicit,indefinite,tag:2"`
+			E Inner   `asn1:"implicit,tag:3,length-octets:2"`
+			F []Inner `asn1:"indefinite"`
+		}{},
+	} {
+		if err := ctx.CheckType(obj); err != nil {
+			t.Errorf("checking %T: %v", obj, err)
+		}
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	type Record struct {
+		Name  string
+		Items []int
+	}
+	data := []byte{
+		0x30, 0x0e,
+		0x04, 0x03, 'a', 'b', 'c',
+		0x30, 0x07, 0x02, 0x01, 0x01, 0x02, 0x02, 0x01, 0x00,
+	}
+	var metrics []DecodeMetrics
+	ctx := NewContext()
+	ctx.SetMetricsHandler(func(m DecodeMetrics) {
+		metrics = append(metrics, m)
+	})
+	var obj Record
+	if _, err := ctx.Decode(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, obj, Record{"abc", []int{1, 256}})
+	if len(metrics) != 1 {
+		t.Fatalf("got %d reports, expected 1", len(metrics))
+	}
+	m := metrics[0]
+	if m.Elements != 5 || m.Err != nil {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	// Contents of 14+3+7+1+2 octets, the string and the slice
+	minimum := int64(27 + 3 + 2*reflect.TypeOf(0).Size())
+	if m.Allocated < minimum {
+		t.Errorf("allocated %d bytes, expected at least %d", m.Allocated, minimum)
+	}
+
+	// The budget is enforced and the failed decoding is reported
+	ctx.SetMemoryBudget(m.Allocated - 1)
+	_, err := ctx.Decode(data, &obj)
+	if _, ok := err.(*ParseError); !ok || !strings.Contains(err.Error(), "memory budget") {
+		t.Errorf("expected a ParseError for the budget, got %v", err)
+	}
+	if len(metrics) != 2 || metrics[1].Err != err {
+		t.Errorf("the failed decoding was not reported: %+v", metrics)
+	}
+	ctx.SetMemoryBudget(m.Allocated)
+	if _, err := ctx.Decode(data, &obj); err != nil {
+		t.Errorf("decoding within the budget failed: %v", err)
+	}
+
+	// Elements whose content doesn't fit are rejected before being read
+	ctx.SetMemoryBudget(10)
+	_, err = ctx.Decode([]byte{0x04, 0x84, 0x7f, 0xff, 0xff, 0xff}, new([]byte))
+	if err == nil || !strings.Contains(err.Error(), "more than the maximum of 10") {
+		t.Errorf("expected an error for the content length, got %v", err)
+	}
+
+	// Values decoded through a choice are accounted as well
+	type Wrapper struct {
+		V interface{} `asn1:"choice:record"`
+	}
+	err = ctx.AddChoice("record", []Choice{{reflect.TypeOf(Record{}), ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetMemoryBudget(0)
+	var wrapper Wrapper
+	if _, err := ctx.Decode(append([]byte{0x30, 0x10}, data...), &wrapper); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, wrapper, Wrapper{Record{"abc", []int{1, 256}}})
+	last := metrics[len(metrics)-1]
+	if last.Elements != m.Elements+1 || last.Allocated < m.Allocated {
+		t.Errorf("unexpected metrics through a choice %+v, direct %+v", last, m)
+	}
+	ctx.SetMemoryBudget(m.Allocated - 1)
+	_, err = ctx.Decode(append([]byte{0x30, 0x10}, data...), &wrapper)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a ParseError for the budget through a choice, got %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	type Record struct {
+		ID   int
+		Name string
+	}
+	records := make([]Record, 50)
+	for i := range records {
+		records[i] = Record{i, fmt.Sprintf("record %d", i)}
+	}
+	ctx := NewContext()
+	for _, workers := range []int{0, 1, 4, 100} {
+		encoded, err := ctx.EncodeAll(records, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, data := range encoded {
+			expected, err := ctx.Encode(records[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEqual(t, data, expected)
+		}
+		var decoded []Record
+		if err := ctx.DecodeAll(encoded, &decoded, workers); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, decoded, records)
+
+		// The error of the first invalid item is returned
+		invalid := append([][]byte{}, encoded...)
+		invalid[30] = []byte{0x02, 0x01, 0x00}
+		invalid[40] = append(append([]byte{}, encoded[40]...), 0x00)
+		decoded = nil
+		err = ctx.DecodeAll(invalid, &decoded, workers)
+		if _, ok := err.(*ParseError); !ok || !strings.HasPrefix(err.Error(), "item 30: ") {
+			t.Errorf("expected a ParseError for item 30, got %v", err)
+		}
+		if decoded != nil {
+			t.Error("the slice was modified by a failed decoding")
+		}
+	}
+
+	if _, err := ctx.EncodeAll([]interface{}{1, nil}, 2); err == nil ||
+		!strings.HasPrefix(err.Error(), "item 1: ") {
+		t.Errorf("expected an error for item 1, got %v", err)
+	}
+	if _, err := ctx.EncodeAll(1, 2); err == nil {
+		t.Error("expected an error for a value that is not a slice")
+	}
+	if err := ctx.DecodeAll(nil, []Record{}, 2); err == nil {
+		t.Error("expected an error for a slice that is not a pointer")
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	type Record struct {
+		ID      int
+		Name    string   `asn1:"tag:0,explicit,indefinite"`
+		Payload []byte   `asn1:"compress:gzip,optional"`
+		Values  []string `asn1:"set,length-octets:2"`
+		Next    *Record  `asn1:"optional"`
+	}
+	obj := Record{
+		ID:      1000,
+		Name:    "name",
+		Payload: bytes.Repeat([]byte("payload"), 100),
+		Values:  []string{"b", "a"},
+		Next:    &Record{ID: 1},
+	}
+	for _, der := range []bool{false, true} {
+		ctx := NewContext()
+		ctx.SetDer(der, der)
+		for _, options := range []string{"", "application,tag:3", "-"} {
+			data, err := ctx.EncodeWithOptions(obj, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := ctx.EncodedLen(obj, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(data) {
+				t.Errorf("options %q: got length %d, expected %d", options, n, len(data))
+			}
+		}
+	}
+
+	if _, err := NewContext().EncodedLen(nil, ""); err == nil {
+		t.Error("expected an error for a nil value")
+	}
+
+	// The contents of constructed values are not built
+	type Block struct {
+		ID   int
+		Data []byte `asn1:"tag:0,explicit"`
+	}
+	type Nested struct {
+		Blocks []Block
+		Extra  Block `asn1:"tag:1,explicit,indefinite"`
+	}
+	payload := make([]byte, 1<<24)
+	nested := Nested{
+		Blocks: []Block{{1, payload}, {2, payload}},
+		Extra:  Block{3, payload},
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	n, err := NewContext().EncodedLen(nested, "")
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 3*len(payload) {
+		t.Fatalf("got length %d, expected at least %d", n, 3*len(payload))
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("EncodedLen allocated %d octets", allocated)
+	}
+}
+
+func TestEncodeHash(t *testing.T) {
+	type Record struct {
+		ID     int
+		Values []string `asn1:"set"`
+		Data   []byte   `asn1:"tag:0,explicit,indefinite"`
+	}
+	obj := Record{ID: 1, Values: []string{"b", "a"}, Data: bytes.Repeat([]byte{1}, 200)}
+
+	// The DER encoding is hashed even if the Context uses BER
+	ctx := NewContext()
+	ctx.SetDer(true, false)
+	expected, err := ctx.Encode(&obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.SetDer(false, false)
+	h := sha256.New()
+	if err := ctx.EncodeHash(&obj, h); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(expected)
+	checkEqual(t, h.Sum(nil), digest[:])
+
+	if err := ctx.EncodeHash(nil, sha256.New()); err == nil {
+		t.Error("expected an error for a nil value")
+	}
+
+	// The encoding is not held in memory
+	type Signed struct {
+		Records []Record
+		Extra   Record `asn1:"tag:1,explicit"`
+	}
+	payload := make([]byte, 1<<24)
+	signed := Signed{
+		Records: []Record{{ID: 1, Data: payload}, {ID: 2, Data: payload}},
+		Extra:   Record{ID: 3, Data: payload},
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	h.Reset()
+	err = ctx.EncodeHash(signed, h)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("EncodeHash allocated %d octets", allocated)
+	}
+	derCtx := ctx.NewChild()
+	derCtx.SetDer(true, false)
+	expected, err = derCtx.Encode(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest = sha256.Sum256(expected)
+	checkEqual(t, h.Sum(nil), digest[:])
+}
+
+func TestSequenceWriter(t *testing.T) {
+	type Record struct {
+		ID   int
+		Name string
+	}
+	records := []Record{{1, "a"}, {2, "b"}, {3, "c"}}
+	ctx := NewContext()
+
+	// Indefinite length form
+	var buf bytes.Buffer
+	w, err := ctx.BeginSequence(&buf, "application,tag:1,indefinite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.WriteElement(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Record
+	if _, err := ctx.DecodeWithOptions(buf.Bytes(), &decoded, "application,tag:1"); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, records)
+	checkEqual(t, buf.Bytes()[:2], []byte{0x61, 0x80})
+	if err := w.WriteElement(records[0]); err == nil {
+		t.Error("expected an error for a closed writer")
+	}
+
+	// Length fixed by Close
+	f, err := os.CreateTemp(t.TempDir(), "records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("header")); err != nil {
+		t.Fatal(err)
+	}
+	w, err = ctx.BeginSequence(f, "length-octets:4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.WriteElement(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("trailer")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data[6:12], []byte{0x30, 0x84, 0x00, 0x00, 0x00, 0x18})
+	decoded = nil
+	rest, err := ctx.Decode(data[6:], &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, records)
+	checkEqual(t, string(rest), "trailer")
+
+	// The length can't be fixed in a stream
+	if _, err := ctx.BeginSequence(&buf, ""); err == nil {
+		t.Error("expected an error for a writer that is not seekable")
+	}
+	if _, err := ctx.BeginSequence(f, "explicit,tag:1"); err == nil {
+		t.Error("expected an error for invalid options")
+	}
+}
+
+func TestSequenceReader(t *testing.T) {
+	type Record struct {
+		ID   int
+		Name string
+	}
+	records := []Record{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}}
+	ctx := NewContext()
+	definite, err := ctx.EncodeWithOptions(records, "application,tag:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := ctx.BeginSequence(&buf, "application,tag:2,indefinite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.WriteElement(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	indefinite := append(buf.Bytes(), "rest"...)
+
+	for _, data := range [][]byte{definite, indefinite} {
+		r, err := ctx.NewSequenceReader(bytes.NewReader(data), "application,tag:2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded []Record
+		for i := 0; i < 2; i++ {
+			var record Record
+			if err := r.ReadElement(&record); err != nil {
+				t.Fatal(err)
+			}
+			decoded = append(decoded, record)
+		}
+
+		// Persist the state and resume from another reader
+		saved, err := json.Marshal(r.State())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var state SequenceState
+		if err := json.Unmarshal(saved, &state); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, state.Index, 2)
+		stream := bytes.NewReader(data)
+		if _, err := stream.Seek(state.Offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		r = ctx.ResumeSequence(stream, state)
+		for {
+			var record Record
+			err := r.ReadElement(&record)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded = append(decoded, record)
+		}
+		checkEqual(t, decoded, records)
+		checkEqual(t, r.State().Done, true)
+		checkEqual(t, r.State().Offset, int64(len(data)-stream.Len()))
+		if err := r.ReadElement(&Record{}); err != io.EOF {
+			t.Errorf("expected io.EOF after the end, got %v", err)
+		}
+	}
+
+	if _, err := ctx.NewSequenceReader(bytes.NewReader(definite), ""); err == nil {
+		t.Error("expected an error for the wrong tag")
+	}
+	r, err := ctx.NewSequenceReader(bytes.NewReader(definite[:len(definite)-2]), "application,tag:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var err2 error
+	for err2 == nil {
+		err2 = r.ReadElement(&Record{})
+	}
+	if err2 != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF for truncated data, got %v", err2)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	der := []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x01, 0x01, 0xff}
+	rules, findings, err := Detect(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, rules, DER)
+	if len(findings.Violations) != 0 || len(findings.Constructs) != 0 {
+		t.Errorf("unexpected findings %+v", findings)
+	}
+
+	ber := []byte{
+		0x30, 0x80,
+		0x24, 0x80, 0x04, 0x01, 'a', 0x00, 0x00,
+		0x01, 0x01, 0x01,
+		0x04, 0x81, 0x01, 'b',
+		0x00, 0x00,
+	}
+	rules, findings, err = Detect(ber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, rules, BER)
+	checkEqual(t, findings.Constructs, map[Construct]int{
+		IndefiniteLength:    2,
+		ConstructedString:   1,
+		NonCanonicalBoolean: 1,
+		NonMinimalLength:    1,
+	})
+	checkEqual(t, len(findings.Violations), 5)
+	checkEqual(t, IndefiniteLength.String(), "indefinite length")
+
+	if _, _, err := Detect([]byte{0x30, 0x05, 0x02}); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
+
+func TestLongForm(t *testing.T) {
+	type Message struct {
+		A int
+		B []byte `asn1:"longform"`
+		C int    `asn1:"tag:0,explicit,longform"`
+	}
+	obj := Message{1, []byte{0xaa}, 2}
+	ctx := NewContext()
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0x30, 0x0d,
+		0x02, 0x01, 0x01,
+		0x04, 0x81, 0x01, 0xaa,
+		0xa0, 0x81, 0x03, 0x02, 0x01, 0x02,
+	})
+
+	// Every length uses the long form, with more octets when needed
+	ctx.SetLongForm(true)
+	data, err = ctx.EncodeWithOptions(make([]byte, 300), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data[:4], []byte{0x04, 0x82, 0x01, 0x2c})
+	data, err = ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0x30, 0x81, 0x0f,
+		0x02, 0x81, 0x01, 0x01,
+		0x04, 0x81, 0x01, 0xaa,
+		0xa0, 0x81, 0x04, 0x02, 0x81, 0x01, 0x02,
+	})
+	var decoded Message
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, obj) {
+		t.Errorf("got %#v, expected %#v", decoded, obj)
+	}
+
+	// A number of length octets takes precedence
+	ctx.SetLengthOctets(2)
+	data, err = ctx.Encode(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x01, 0x82, 0x00, 0x01, 0xff})
+
+	for _, options := range []string{"longform,indefinite", "longform,length-octets:2"} {
+		if _, err := ctx.EncodeWithOptions([]int{1}, options); err == nil {
+			t.Errorf("options '%s' should fail", options)
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	// The DER profile rejects BER
+	ctx := NewContext()
+	if err := ctx.UseProfile("der"); err != nil {
+		t.Fatal(err)
+	}
+	var b bool
+	if _, err := ctx.Decode([]byte{0x01, 0x01, 0x01}, &b); err == nil {
+		t.Error("non-canonical BOOLEAN should fail with the der profile")
+	}
+
+	err := RegisterProfile("test-long-lengths", func(ctx *Context) {
+		ctx.SetDer(false, false)
+		ctx.SetLengthOctets(2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = NewContext()
+	if err := ctx.UseProfile("test-long-lengths"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ctx.Encode(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x01, 0x82, 0x00, 0x01, 0xff})
+
+	names := Profiles()
+	if !sort.StringsAreSorted(names) || len(names) < 2 {
+		t.Errorf("unexpected profiles %v", names)
+	}
+	if err := ctx.UseProfile("unknown"); err == nil {
+		t.Error("unknown profile should fail")
+	}
+	if err := RegisterProfile("", func(*Context) {}); err == nil {
+		t.Error("empty profile name should fail")
+	}
+}
+
+// longLengthRules is a variant of DER whose lengths are always encoded in the
+// long form.
+type longLengthRules struct {
+	BasicRules
+}
+
+func (r longLengthRules) Allows(construct Construct) bool {
+	return construct == NonMinimalLength
+}
+
+func (r longLengthRules) EncodeLength(length int) ([]byte, error) {
+	if length < 0 {
+		return nil, syntaxError("indefinite length is not allowed")
+	}
+	return encodeLengthOctets(uint(length), longFormOctets)
+}
+
+// Rules are registered once, since they can't be unregistered.
+var ler, lerErr = RegisterRules("LER", longLengthRules{BasicRules{Distinguished: true}})
+
+func TestRegisterRules(t *testing.T) {
+	if lerErr != nil {
+		t.Fatal(lerErr)
+	}
+	if ler.String() != "LER" {
+		t.Errorf("got name %s, expected LER", ler)
+	}
+	if _, err := RegisterRules("LER", BasicRules{}); err == nil {
+		t.Error("duplicated rules should fail")
+	}
+
+	ber := []byte{
+		0x31, 0x80, // SET, indefinite
+		0x01, 0x01, 0x01,
+		0x02, 0x02, 0x00, 0x05,
+		0x00, 0x00,
+	}
+	ctx := NewContext()
+	data, err := ctx.Transcode(ber, BER, ler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x31, 0x81, 0x08,
+		0x01, 0x81, 0x01, 0xff,
+		0x02, 0x81, 0x01, 0x05,
+	}
+	checkEqual(t, data, expected)
+
+	// Long lengths are allowed when decoding, but not other constructs
+	data, err = ctx.Transcode(data, ler, DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x31, 0x06, 0x01, 0x01, 0xff, 0x02, 0x01, 0x05})
+	if _, err := ctx.Transcode(ber, ler, DER); err == nil {
+		t.Error("indefinite length should not be allowed by LER")
+	}
+
+	// DER verification covers every construct
+	if _, err := ctx.Transcode([]byte{0x01, 0x01, 0x01}, DER, DER); err == nil {
+		t.Error("non-canonical BOOLEAN should not be allowed by DER")
+	}
+	// Values are encoded and decoded with the rules selected in a Context
+	type Record struct {
+		Flag  bool
+		Value int
+	}
+	if err := ctx.SetRules(ler); err != nil {
+		t.Fatal(err)
+	}
+	expected = []byte{0x30, 0x81, 0x08, 0x01, 0x81, 0x01, 0xff, 0x02, 0x81, 0x01, 0x05}
+	testEncodeDecode(t, ctx, "", testCase{Record{true, 5}, expected})
+	if n, err := ctx.EncodedLen(Record{true, 5}, ""); err != nil || n != len(expected) {
+		t.Fatalf("got length %d, %v, expected %d", n, err, len(expected))
+	}
+	var record Record
+	_, err = ctx.Decode([]byte{0x30, 0x80, 0x01, 0x01, 0xff, 0x02, 0x01, 0x05, 0x00, 0x00}, &record)
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Expected a ParseError for an indefinite length, got: %v", err)
+	}
+	ctx.SetDer(true, true)
+	testEncodeDecode(t, ctx, "", testCase{Record{true, 5},
+		[]byte{0x30, 0x06, 0x01, 0x01, 0xff, 0x02, 0x01, 0x05}})
+	if err := ctx.SetRules(Rules(1000)); err == nil {
+		t.Error("unknown rules should fail")
+	}
+}
+
+func TestNewChild(t *testing.T) {
+	parent := NewContext()
+	err := parent.AddChoice("payload", []Choice{
+		{reflect.TypeOf(int(0)), "tag:0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parent.AddOption("version", func(arg string) (string, error) {
+		return "tag:0", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.SetDer(true, true)
+
+	child := parent.NewChild()
+	err = child.AddChoice("payload", []Choice{
+		{reflect.TypeOf(""), "tag:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = child.AddOption("version", func(arg string) (string, error) {
+		return "tag:1", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := child.AddOption("version", func(string) (string, error) { return "", nil }); err == nil {
+		t.Error("options registered by the child can't be replaced")
+	}
+
+	// The child extends the inherited choice and replaces the option
+	for _, obj := range []interface{}{5, "abc"} {
+		data, err := child.EncodeWithOptions(obj, "choice:payload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded interface{}
+		if _, err := child.DecodeWithOptions(data, &decoded, "choice:payload"); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, decoded, obj)
+	}
+	data, err := child.EncodeWithOptions(true, "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x81, 0x01, 0xff})
+
+	// The parent is not changed
+	if _, err := parent.EncodeWithOptions("abc", "choice:payload"); err == nil {
+		t.Error("the alternative added by the child should not be in the parent")
+	}
+	data, err = parent.EncodeWithOptions(true, "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x80, 0x01, 0xff})
+
+	// Settings are inherited
+	var b bool
+	if _, err := child.Decode([]byte{0x01, 0x01, 0x01}, &b); err == nil {
+		t.Error("the child should inherit the DER decoding")
+	}
+
+	// Inherited choices use the alternatives added by the child
+	type Inner struct {
+		V interface{} `asn1:"choice:payload"`
+	}
+	type Outer struct {
+		V interface{} `asn1:"choice:outer"`
+	}
+	err = parent.AddChoice("outer", []Choice{
+		{reflect.TypeOf(Inner{}), "tag:0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child = parent.NewChild()
+	err = child.AddChoice("payload", []Choice{
+		{reflect.TypeOf(""), "tag:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncodeDecode(t, child, "", testCase{
+		Outer{Inner{"abc"}},
+		[]byte{0x30, 0x07, 0xa0, 0x05, 0x81, 0x03, 0x61, 0x62, 0x63},
+	})
+}
+
+func TestGroup(t *testing.T) {
+	type Request struct {
+		ID       int
+		Priority int    `asn1:"optional,group:extra"`
+		Comment  string `asn1:"optional,group:extra"`
+		Retries  int    `asn1:"default:3,group:extra"`
+		Last     bool   `asn1:"optional"`
+	}
+	ctx := NewContext()
+	if err := ctx.CheckType(Request{}); err != nil {
+		t.Fatal(err)
+	}
+	// The group is omitted when its fields are empty
+	data, err := ctx.Encode(Request{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x30, 0x03, 0x02, 0x01, 0x01})
+	var decoded Request
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, Request{ID: 1, Retries: 3})
+
+	testEncodeDecode(t, ctx, "", testCase{
+		Request{ID: 1, Comment: "a", Retries: 3, Last: true},
+		[]byte{
+			0x30, 0x0e,
+			0x02, 0x01, 0x01,
+			0x30, 0x06, 0x04, 0x01, 0x61, 0x02, 0x01, 0x03,
+			0x01, 0x01, 0xff,
+		},
+	})
+	testEncodeDecode(t, ctx, "", testCase{
+		Request{ID: 1, Priority: 2, Retries: 5},
+		[]byte{
+			0x30, 0x0b,
+			0x02, 0x01, 0x01,
+			0x30, 0x06, 0x02, 0x01, 0x02, 0x02, 0x01, 0x05,
+		},
+	})
+
+	type Split struct {
+		A int `asn1:"optional,group:g"`
+		B int
+		C int `asn1:"optional,group:g"`
+	}
+	if err := ctx.CheckType(Split{}); err == nil {
+		t.Error("fields of a group that are not adjacent should fail")
+	}
+}
+
+type filterAnd []interface{}
+
+type filterNot struct {
+	Filter interface{} `asn1:"choice:filter"`
+}
+
+type filterPresent string
+
+func TestAddChoiceFunc(t *testing.T) {
+	ctx := NewContext()
+	err := ctx.AddChoiceFunc("filter", func() ([]Choice, error) {
+		return []Choice{
+			{reflect.TypeOf(filterAnd{}), "tag:0,set,choices:filter"},
+			{reflect.TypeOf(filterNot{}), "tag:2"},
+			{reflect.TypeOf(filterPresent("")), "tag:7"},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddChoice("filter", nil); err == nil {
+		t.Error("choice should already be registered")
+	}
+
+	obj := filterAnd{filterPresent("cn"), filterNot{filterPresent("sn")}}
+	data, err := ctx.EncodeWithOptions(obj, "choice:filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{
+		0xa0, 0x0a,
+		0x87, 0x02, 0x63, 0x6e,
+		0xa2, 0x04, 0x87, 0x02, 0x73, 0x6e,
+	})
+	var decoded interface{}
+	if _, err := ctx.DecodeWithOptions(data, &decoded, "choice:filter"); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, obj)
+
+	// Errors of the definition are returned when the choice is used
+	err = ctx.AddChoiceFunc("broken", func() ([]Choice, error) {
+		return []Choice{{reflect.TypeOf(0), "tga:1"}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.EncodeWithOptions(1, "choice:broken"); err == nil {
+		t.Error("invalid definition should fail")
+	}
+}
+
+func TestNullAsAbsent(t *testing.T) {
+	type Params struct {
+		A int
+	}
+	type Message struct {
+		ID     int
+		Params Params   `asn1:"optional"`
+		Items  []string `asn1:"optional,tag:1"`
+		Flag   bool     `asn1:"optional"`
+	}
+	data := []byte{
+		0x30, 0x0c,
+		0x02, 0x01, 0x07,
+		0x05, 0x00, // Params
+		0x05, 0x00, // Items
+		0x01, 0x01, 0xff,
+		0x05, 0x00, // ignored
+	}
+	ctx := NewContext()
+	ctx.SetDer(false, false)
+	ctx.SetStrictOrder(true)
+	var msg Message
+	if _, err := ctx.Decode(data, &msg); err == nil {
+		t.Error("NULL should not be accepted by default")
+	}
+
+	var warnings []WarningKind
+	ctx.SetWarningHandler(func(w Warning) {
+		warnings = append(warnings, w.Kind)
+	})
+	ctx.SetNullAsAbsent(true)
+	data = data[:len(data)-2]
+	data[1] = 0x0a
+	msg = Message{}
+	if _, err := ctx.Decode(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, msg, Message{ID: 7, Flag: true})
+	checkEqual(t, warnings, []WarningKind{WarningNullAsAbsent, WarningNullAsAbsent})
+
+	// NULL is only accepted for constructed fields
+	data = []byte{0x30, 0x05, 0x02, 0x01, 0x07, 0x05, 0x00}
+	var other struct {
+		ID   int
+		Flag bool `asn1:"optional"`
+	}
+	if _, err := ctx.Decode(data, &other); err == nil {
+		t.Error("NULL should not be accepted for a BOOLEAN")
+	}
+}
+
+func TestUTF8Validation(t *testing.T) {
+	type Name struct {
+		Text string `asn1:"universal,tag:12"`
+	}
+	invalid := Name{"a\xffb"}
+	invalidData := []byte{0x30, 0x05, 0x0c, 0x03, 0x61, 0xff, 0x62}
+	bomData := []byte{0x30, 0x06, 0x0c, 0x04, 0xef, 0xbb, 0xbf, 0x61}
+
+	ctx := NewContext()
+	if _, err := ctx.Encode(invalid); err == nil {
+		t.Error("invalid UTF-8 should not be encoded")
+	}
+	for _, data := range [][]byte{invalidData, bomData} {
+		var name Name
+		if _, err := ctx.Decode(data, &name); err == nil {
+			t.Errorf("decoding %x should fail", data)
+		}
+	}
+	testEncodeDecode(t, ctx, "", testCase{Name{"añb"}, []byte{0x30, 0x06, 0x0c, 0x04, 0x61, 0xc3, 0xb1, 0x62}})
+
+	ctx.SetUTF8Validation(UTF8Sanitize)
+	data, err := ctx.Encode(invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x30, 0x07, 0x0c, 0x05, 0x61, 0xef, 0xbf, 0xbd, 0x62})
+	var name Name
+	if _, err := ctx.Decode(invalidData, &name); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, name.Text, "a�b")
+	if _, err := ctx.Decode(bomData, &name); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, name.Text, "a")
+
+	ctx.SetUTF8Validation(UTF8Accept)
+	if _, err := ctx.Decode(invalidData, &name); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, name.Text, invalid.Text)
+}
+
+func TestCollectErrors(t *testing.T) {
+	type Inner struct {
+		Flag bool
+		Name string
+	}
+	type Record struct {
+		ID    int8
+		Inner Inner
+		Count int
+	}
+	data := []byte{
+		0x30, 0x10,
+		0x02, 0x02, 0x01, 0x00, // too large for int8
+		0x30, 0x07,
+		0x01, 0x02, 0xff, 0xff, // invalid BOOLEAN
+		0x04, 0x01, 0x61,
+		0x02, 0x01, 0x05,
+	}
+	ctx := NewContext()
+	ctx.SetDer(true, true)
+	var record Record
+	if _, err := ctx.Decode(data, &record); err == nil {
+		t.Fatal("decoding should fail")
+	} else if _, ok := err.(DecodeErrors); ok {
+		t.Error("errors should not be collected by default")
+	}
+
+	ctx.SetCollectErrors(true)
+	record = Record{}
+	_, err := ctx.Decode(data, &record)
+	errs, ok := err.(DecodeErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("got %#v, expected 2 errors", err)
+	}
+	checkEqual(t, record, Record{Inner: Inner{Name: "a"}, Count: 5})
+	for i, prefix := range []string{"field ID: ", "field Inner.Flag: "} {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("got error %q, expected prefix %q", errs[i], prefix)
+		}
+	}
+
+	// Malformed elements can't be skipped
+	if _, err := ctx.Decode([]byte{0x30, 0x03, 0x02, 0x05, 0x01}, &record); err == nil {
+		t.Error("decoding should fail")
+	} else if _, ok := err.(DecodeErrors); ok {
+		t.Errorf("got %v, expected a single error", err)
+	}
+}
+
+// onlyByteReader hides every method of a reader but ReadByte.
+type onlyByteReader struct {
+	reader io.ByteReader
+}
+
+func (r onlyByteReader) ReadByte() (byte, error) {
+	return r.reader.ReadByte()
+}
+
+func TestDecodeFrom(t *testing.T) {
+	type Message struct {
+		ID   int
+		Body string
+	}
+	data := []byte{
+		0x30, 0x06, 0x02, 0x01, 0x01, 0x04, 0x01, 0x61,
+		0x30, 0x80, 0x02, 0x01, 0x02, 0x04, 0x01, 0x62, 0x00, 0x00,
+		0x30, 0x06, 0x02, 0x01,
+	}
+	ctx := NewContext()
+	ctx.SetDer(false, false)
+	for _, r := range []io.ByteReader{
+		bufio.NewReader(bytes.NewReader(data)),
+		onlyByteReader{bytes.NewReader(data)},
+	} {
+		var msgs []Message
+		for {
+			var msg Message
+			err := ctx.DecodeFrom(r, &msg)
+			if err != nil {
+				if err != io.ErrUnexpectedEOF {
+					t.Errorf("got %v, expected %v", err, io.ErrUnexpectedEOF)
+				}
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+		checkEqual(t, msgs, []Message{{1, "a"}, {2, "b"}})
+	}
+
+	var msg Message
+	if err := ctx.DecodeFrom(bytes.NewReader(nil), &msg); err != io.EOF {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+	if err := ctx.DecodeFromWithOptions(bytes.NewReader(data[:8]), &msg, "tag:1"); err == nil {
+		t.Error("unexpected tag should fail")
+	}
+}
+
+func TestMaxStringLength(t *testing.T) {
+	type Entry struct {
+		Host string `asn1:"universal,tag:22"`
+		Name string `asn1:"universal,tag:12"`
+	}
+	ctx := NewContext()
+	if err := ctx.SetMaxStringLength(TagIA5String, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SetMaxStringLength(TagUtf8String, 2); err != nil {
+		t.Fatal(err)
+	}
+	testEncodeDecode(t, ctx, "", testCase{Entry{"host", "ñé"}, []byte{
+		0x30, 0x0c, 0x16, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x0c, 0x04, 0xc3, 0xb1, 0xc3, 0xa9}})
+	for _, entry := range []Entry{{"hosts", ""}, {"", "abc"}} {
+		if _, err := ctx.Encode(entry); err == nil {
+			t.Errorf("encoding %+v should fail", entry)
+		}
+	}
+	data := []byte{0x30, 0x09, 0x16, 0x05, 0x68, 0x6f, 0x73, 0x74, 0x73, 0x0c, 0x00}
+	var entry Entry
+	if _, err := ctx.Decode(data, &entry); err == nil {
+		t.Error("decoding a long IA5String should fail")
+	} else if !strings.HasPrefix(err.Error(), "field Host: ") {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	// The limits are inherited and can be removed
+	child := ctx.NewChild()
+	if err := child.SetMaxStringLength(TagIA5String, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := child.Decode(data, &entry); err != nil {
+		t.Error(err)
+	}
+	if _, err := ctx.Decode(data, &entry); err == nil {
+		t.Error("limit of the parent should be kept")
+	}
+	if err := ctx.SetMaxStringLength(TagInteger, 1); err == nil {
+		t.Error("INTEGER should not accept a maximum length")
+	}
+}
+
+func TestAbsent(t *testing.T) {
+	type TBSCertificate struct {
+		Serial         int
+		IssuerUniqueID []byte `asn1:"tag:1,absent"`
+		Subject        string
+	}
+	ctx := NewContext()
+	cert := TBSCertificate{Serial: 1, IssuerUniqueID: []byte{0x01}, Subject: "a"}
+	data, err := ctx.Encode(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x04, 0x01, 0x61}
+	checkEqual(t, data, expected)
+	var decoded TBSCertificate
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, decoded, TBSCertificate{Serial: 1, Subject: "a"})
+
+	data = []byte{0x30, 0x09, 0x02, 0x01, 0x01, 0x81, 0x01, 0x01, 0x04, 0x01, 0x61}
+	if _, err := ctx.Decode(data, &decoded); err == nil {
+		t.Error("present field should fail")
+	} else if !strings.HasPrefix(err.Error(), "field IssuerUniqueID: ") {
+		t.Errorf("unexpected error %q", err)
+	}
+	if _, err := ctx.EncodeWithOptions(1, "absent,default:1"); err == nil {
+		t.Error("'absent' and 'default' should not be accepted together")
+	}
+}
+
+func TestPresenceRules(t *testing.T) {
+	type Certificate struct {
+		Version    int `asn1:"optional,explicit,tag:0"`
+		Serial     int
+		Extensions []int  `asn1:"optional,explicit,tag:3,requires:Version"`
+		Legacy     string `asn1:"optional,tag:4,excludes:Extensions"`
+	}
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "", testCase{
+		Certificate{Version: 2, Serial: 1, Extensions: []int{5}},
+		[]byte{0x30, 0x0f, 0xa0, 0x03, 0x02, 0x01, 0x02, 0x02, 0x01, 0x01,
+			0xa3, 0x05, 0x30, 0x03, 0x02, 0x01, 0x05}})
+	testEncodeDecode(t, ctx, "", testCase{
+		Certificate{Serial: 1, Legacy: "a"},
+		[]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x84, 0x01, 0x61}})
+
+	for _, cert := range []Certificate{
+		{Serial: 1, Extensions: []int{5}},
+		{Version: 2, Serial: 1, Extensions: []int{5}, Legacy: "a"},
+	} {
+		if _, err := ctx.Encode(cert); err == nil {
+			t.Errorf("encoding %+v should fail", cert)
+		}
+	}
+	data := []byte{0x30, 0x0a, 0x02, 0x01, 0x01, 0xa3, 0x05, 0x30, 0x03, 0x02, 0x01, 0x05}
+	var cert Certificate
+	if _, err := ctx.Decode(data, &cert); err == nil {
+		t.Error("decoding extensions without version should fail")
+	} else if err.Error() != "field Extensions: field 'Version' must be present" {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	// Fields are present when decoding if their elements are found, even
+	// with empty values
+	type Flags struct {
+		A int `asn1:"optional,tag:0,requires:B"`
+		B int `asn1:"optional,tag:1"`
+	}
+	type Exclusive struct {
+		A int `asn1:"optional,tag:0,excludes:B"`
+		B int `asn1:"optional,tag:1"`
+	}
+	data = []byte{0x30, 0x06, 0x80, 0x01, 0x01, 0x81, 0x01, 0x00}
+	var flags Flags
+	if _, err := ctx.Decode(data, &flags); err != nil {
+		t.Errorf("decoding a required field with an empty value failed: %v", err)
+	}
+	var exclusive Exclusive
+	if _, err := ctx.Decode(data, &exclusive); err == nil {
+		t.Error("decoding an excluded field with an empty value should fail")
+	}
+
+	var invalid struct {
+		A int `asn1:"requires:B"`
+	}
+	if err := ctx.CheckType(&invalid); err == nil {
+		t.Error("unknown field should fail")
+	}
+}
+
+func TestVersionGatedFields(t *testing.T) {
+	type Message struct {
+		Version int    `asn1:"version-field"`
+		Name    string `asn1:"tag:0"`
+		Old     int    `asn1:"optional,tag:1,maxver:1"`
+		New     int    `asn1:"optional,tag:2,minver:2"`
+	}
+	ctx := NewContext()
+	testEncodeDecode(t, ctx, "", testCase{
+		Message{Version: 2, Name: "a", New: 5},
+		[]byte{0x30, 0x09, 0x02, 0x01, 0x02, 0x80, 0x01, 0x61, 0x82, 0x01, 0x05}})
+
+	// Fields of other versions are omitted
+	data, err := ctx.Encode(Message{Version: 1, Name: "a", Old: 3, New: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, []byte{0x30, 0x09, 0x02, 0x01, 0x01, 0x80, 0x01, 0x61, 0x81, 0x01, 0x03})
+
+	data = []byte{0x30, 0x09, 0x02, 0x01, 0x01, 0x80, 0x01, 0x61, 0x82, 0x01, 0x05}
+	var msg Message
+	if _, err := ctx.Decode(data, &msg); err == nil {
+		t.Error("field of version 2 should not be accepted in version 1")
+	} else if err.Error() != "field New: field is not valid in version 1" {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	var noVersion struct {
+		A int `asn1:"minver:2"`
+	}
+	if err := ctx.CheckType(&noVersion); err == nil {
+		t.Error("missing version field should fail")
+	}
+	if _, err := ctx.EncodeWithOptions(1, "minver:3,maxver:2"); err == nil {
+		t.Error("empty version range should fail")
+	}
+}
+
+func TestEncodeWithTrace(t *testing.T) {
+	type Request struct {
+		Version int
+		Nonce   []byte `asn1:"tag:2,explicit"`
+		Names   []string
+	}
+	ctx := NewContext()
+	obj := &Request{Version: 1, Nonce: []byte{0xaa, 0xbb}, Names: []string{"a", "b"}}
+	data, trace, err := ctx.EncodeWithTrace(obj, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ctx.Encode(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, data, expected)
+	nonce, ok := trace.Lookup("Nonce")
+	if !ok {
+		t.Fatal("Nonce should be traced")
+	}
+	checkEqual(t, nonce, FieldRange{"Nonce", 5, 6})
+	checkEqual(t, data[nonce.Offset:nonce.Offset+nonce.Length], []byte{0xa2, 0x04, 0x04, 0x02, 0xaa, 0xbb})
+	if item, ok := trace.Lookup("Names[1]"); !ok || item.Offset != 16 || item.Length != 3 {
+		t.Errorf("got %+v, expected Names[1] at 16 with 3 octets", item)
+	}
+}
+
+func TestRawValueFields(t *testing.T) {
+	type Message struct {
+		ID         int
+		Extensions []RawValue
+		Any        RawValue `asn1:"optional"`
+	}
+	data := []byte{
+		0x30, 0x15,
+		0x02, 0x01, 0x01,
+		0x30, 0x0e,
+		0x01, 0x81, 0x01, 0xff, // non-minimal length
+		0xa5, 0x80, 0x05, 0x00, 0x00, 0x00, // indefinite length
+		0x0c, 0x02, 0x61, 0x62,
+		0x04, 0x00,
+	}
+	ctx := NewContext()
+	ctx.SetDer(false, false)
+	var msg Message
+	rest, err := ctx.Decode(data, &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("unexpected trailing data: %x", rest)
+	}
+	if len(msg.Extensions) != 3 {
+		t.Fatalf("got %d extensions, expected 3", len(msg.Extensions))
+	}
+	checkEqual(t, msg.Extensions[1], RawValue{
+		Class: ClassContextSpecific, Tag: 5, Constructed: true,
+		Content:   []byte{0x05, 0x00},
+		FullBytes: []byte{0xa5, 0x80, 0x05, 0x00, 0x00, 0x00},
+	})
+	checkEqual(t, msg.Any.Tag, uint(TagOctetString))
+
+	// Elements are encoded verbatim
+	encoded, err := ctx.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, encoded, data)
+
+	// Values without FullBytes are encoded from their tag and content
+	msg = Message{ID: 1, Extensions: []RawValue{{Tag: TagBoolean, Content: []byte{0xff}}}}
+	encoded, err = ctx.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, encoded, []byte{0x30, 0x08, 0x02, 0x01, 0x01, 0x30, 0x03, 0x01, 0x01, 0xff})
+}
+
+func TestExtensions(t *testing.T) {
+	type BasicConstraints struct {
+		CA         bool `asn1:"optional"`
+		PathLength int  `asn1:"optional"`
+	}
+	type Certificate struct {
+		Serial     int
+		Extensions Extensions `asn1:"tag:3,explicit,optional"`
+	}
+	oidBasicConstraints := Oid{2, 5, 29, 19}
+	oidKeyID := Oid{2, 5, 29, 14}
+	ctx := NewContext()
+	err := ctx.AddExtensionType(oidBasicConstraints, reflect.TypeOf(BasicConstraints{}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cert Certificate
+	cert.Serial = 1
+	if err := cert.Extensions.Add(ctx, oidBasicConstraints, true, BasicConstraints{CA: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Extensions.Add(ctx, oidKeyID, false, []byte{0xab}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Extensions.Add(ctx, oidKeyID, false, []byte{0xcd}); err == nil {
+		t.Error("duplicated extension should fail")
+	}
+	if err := cert.Extensions.Add(ctx, Oid{2, 5, 29, 19, 1}, false, 1); err != nil {
+		t.Fatal(err)
+	}
+	cert.Extensions = cert.Extensions[:2]
+	testEncodeDecode(t, ctx, "", testCase{cert, []byte{
+		0x30, 0x24, 0x02, 0x01, 0x01,
+		0xa3, 0x1f, 0x30, 0x1d,
+		0x30, 0x0f, 0x06, 0x03, 0x55, 0x1d, 0x13, 0x01, 0x01, 0xff,
+		0x04, 0x05, 0x30, 0x03, 0x01, 0x01, 0xff,
+		0x30, 0x0a, 0x06, 0x03, 0x55, 0x1d, 0x0e, 0x04, 0x03, 0x04, 0x01, 0xab,
+	}})
+
+	var bc BasicConstraints
+	found, err := cert.Extensions.Get(ctx, oidBasicConstraints, &bc)
+	if err != nil || !found {
+		t.Fatalf("got %v, %v, expected the extension", found, err)
+	}
+	checkEqual(t, bc, BasicConstraints{CA: true})
+	value, err := cert.Extensions.Value(ctx, oidBasicConstraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, value, BasicConstraints{CA: true})
+	var keyID []byte
+	if found, err := cert.Extensions.Get(ctx, oidKeyID, &keyID); err != nil || !found {
+		t.Fatalf("got %v, %v, expected the extension", found, err)
+	}
+	checkEqual(t, keyID, []byte{0xab})
+	text, err := ctx.ToValueNotation(cert.Extensions[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{ extnID { 2 5 29 14 }, extnValue '0401AB'H }"; text != expected {
+		t.Errorf("got %q, expected %q", text, expected)
+	}
+
+	if _, err := cert.Extensions.Get(ctx, oidBasicConstraints, &keyID); err == nil {
+		t.Error("type other than the registered one should fail")
+	}
+	if found, err := cert.Extensions.Get(ctx, Oid{1, 2, 3}, &keyID); found || err != nil {
+		t.Errorf("got %v, %v, expected a missing extension", found, err)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	type BindRequest struct {
+		Version int
+		Name    string
+	}
+	type UnbindRequest struct{}
+	ctx := NewContext()
+	var handled []interface{}
+	err := ctx.AddHandler(ClassApplication, 0, "", func(req BindRequest) error {
+		handled = append(handled, req)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctx.AddHandler(ClassApplication, 2, "", func(req UnbindRequest) error {
+		return fmt.Errorf("unbind")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctx.AddHandler(ClassContextSpecific, 7, "explicit", func(id int) error {
+		handled = append(handled, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte{
+		0x60, 0x06, 0x02, 0x01, 0x03, 0x04, 0x01, 0x61, // [APPLICATION 0]
+		0xa7, 0x03, 0x02, 0x01, 0x05, // [7] EXPLICIT
+		0x42, 0x00, // [APPLICATION 2]
+	}
+	rest, err := ctx.Dispatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err = ctx.Dispatch(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, handled, []interface{}{BindRequest{3, "a"}, 5})
+	if _, err := ctx.Dispatch(rest); err == nil || err.Error() != "unbind" {
+		t.Errorf("got %v, expected the error of the handler", err)
+	}
+	if _, err := ctx.Dispatch([]byte{0x61, 0x00}); err == nil {
+		t.Error("message without handler should fail")
+	}
+
+	if err := ctx.AddHandler(ClassApplication, 0, "", func(BindRequest) error { return nil }); err == nil {
+		t.Error("duplicated handler should fail")
+	}
+	if err := ctx.AddHandler(ClassApplication, 5, "", func(BindRequest) {}); err == nil {
+		t.Error("invalid handler should fail")
+	}
+	child := ctx.NewChild()
+	if err := child.AddHandler(ClassApplication, 0, "", func(BindRequest) error { return nil }); err != nil {
+		t.Errorf("inherited handler should be replaced: %v", err)
+	}
+}
+
+func TestLengthBeyondData(t *testing.T) {
+	data := []byte{0x7d, 0x88, 0x04, 0x01, 0x41, 0x04, 0x01, 0x42, 0x00, 0x00}
+	ctx := NewContext()
+	for elem, err := range ctx.Elements(data) {
+		if err == nil {
+			t.Errorf("Elements returned %v", elem)
+		}
+	}
+	if _, err := ctx.Analyze(data); err == nil {
+		t.Error("Analyze should fail")
+	}
+	if _, _, err := ctx.Detect(data); err == nil {
+		t.Error("Detect should fail")
+	}
+	if _, err := ctx.Transcode(data, BER, DER); err == nil {
+		t.Error("Transcode should fail")
+	}
+	if _, err := Patch(data, 0, 1, []byte{0x00}); err == nil {
+		t.Error("Patch should fail")
+	}
+	var raw RawValue
+	if _, err := ctx.Decode(data, &raw); err == nil {
+		t.Error("Decode should fail")
+	}
+}
+
+func TestRealNotation(t *testing.T) {
+	type Measure struct {
+		Value float64
+		Scale float32 `asn1:"optional,tag:0"`
+	}
+	ctx := NewContext()
+	tests := []struct {
+		obj      Measure
+		notation string
+	}{
+		{Measure{3.25, 0.5}, "{ value 3.25, scale 0.5 }"},
+		{Measure{-1e21, 0}, "{ value -1E21 }"},
+		{Measure{math.Inf(1), 0}, "{ value PLUS-INFINITY }"},
+		{Measure{math.Inf(-1), 0}, "{ value MINUS-INFINITY }"},
+	}
+	for _, test := range tests {
+		text, err := ctx.ToValueNotation(test.obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, text, test.notation)
+		var parsed Measure
+		if err := ctx.ParseValueNotation(text, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		checkEqual(t, parsed, test.obj)
+	}
+	if _, err := ctx.Dump(Measure{Value: 1}); err != nil {
+		t.Error(err)
+	}
+	gser, err := ctx.EncodeGSER(Measure{Value: 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, gser, "{ value 1.5 }")
+	var parsed Measure
+	if err := ctx.ParseValueNotation("{ value NOT-A-NUMBER }", &parsed); err != nil || !math.IsNaN(parsed.Value) {
+		t.Errorf("parsing NOT-A-NUMBER returned %v, %v", parsed.Value, err)
+	}
+	if err := ctx.ParseValueNotation("{ value Inf }", &parsed); err == nil {
+		t.Error("parsing a REAL that is not a realnumber should fail")
+	}
+	desc, err := ctx.Describe(Measure{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(desc, "value REAL,") || !strings.Contains(desc, "scale [0] IMPLICIT REAL OPTIONAL") {
+		t.Errorf("unexpected description:\n%s", desc)
+	}
+}
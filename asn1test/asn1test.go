@@ -0,0 +1,164 @@
+// Package asn1test runs suites of test vectors against the asn1 package, so
+// packages implementing protocols on top of it can keep regression tests
+// based on golden files.
+//
+// A suite is a directory with one or more vectors. Each vector is an encoded
+// element in a file with the extension ".der" or ".ber" and a file with the
+// same base name and the extension ".json" holding the expected Go value in
+// JSON. For example:
+//
+//	testdata/
+//		version.der
+//		version.json
+//		indefinite.ber
+//		indefinite.json
+//		truncated.ber
+//		truncated.err
+//
+// A vector is decoded into a new Go value and compared to the value in the
+// JSON file. DER vectors are also encoded again and compared to the original
+// data, while BER vectors are encoded and decoded again to check that the
+// value is preserved. Vectors with a ".err" file instead of a ".json" file are
+// expected to fail decoding with an error message containing the text in the
+// file.
+package asn1test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pipistrellka/asn1"
+)
+
+// Suite describes a directory of test vectors.
+type Suite struct {
+	// Dir is the directory containing the vectors.
+	Dir string
+	// New returns a pointer to a new Go value used to decode a vector. The
+	// name of the vector, without extension, is given so suites can hold
+	// vectors of different types.
+	New func(name string) interface{}
+	// Context is used to encode and decode the vectors. If nil, a new
+	// Context is used.
+	Context *asn1.Context
+	// Options are the options used to encode and decode the vectors.
+	Options string
+}
+
+// RunVectors runs the vectors in dir as a subtest each, decoding them into
+// the values returned by newValue. See Suite for details.
+func RunVectors(t *testing.T, dir string, newValue func() interface{}) {
+	Suite{
+		Dir: dir,
+		New: func(string) interface{} { return newValue() },
+	}.Run(t)
+}
+
+// Run runs the vectors of the suite as a subtest each. The test fails if the
+// directory does not contain any vector.
+func (s Suite) Run(t *testing.T) {
+	names, err := s.vectors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatalf("no test vectors found in %s", s.Dir)
+	}
+	for _, name := range names {
+		name := name
+		t.Run(strings.TrimSuffix(name, filepath.Ext(name)), func(t *testing.T) {
+			s.run(t, name)
+		})
+	}
+}
+
+// vectors returns the file names of the encoded vectors in the directory.
+func (s Suite) vectors() ([]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		switch filepath.Ext(file.Name()) {
+		case ".der", ".ber":
+			if !file.IsDir() {
+				names = append(names, file.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// run runs a single vector.
+func (s Suite) run(t *testing.T, file string) {
+	ctx := s.Context
+	if ctx == nil {
+		ctx = asn1.NewContext()
+	}
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Negative vectors
+	if msg, err := ioutil.ReadFile(filepath.Join(s.Dir, base+".err")); err == nil {
+		_, err := ctx.DecodeWithOptions(data, s.New(base), s.Options)
+		if err == nil {
+			t.Fatalf("decoding should have failed")
+		}
+		if !strings.Contains(err.Error(), strings.TrimSpace(string(msg))) {
+			t.Fatalf("unexpected error: %s\n  expected: %s", err, msg)
+		}
+		return
+	}
+
+	expected := s.New(base)
+	text, err := ioutil.ReadFile(filepath.Join(s.Dir, base+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(text, expected); err != nil {
+		t.Fatalf("invalid JSON value: %s", err)
+	}
+
+	decoded := s.New(base)
+	rest, err := ctx.DecodeWithOptions(data, decoded, s.Options)
+	if err != nil {
+		t.Fatalf("decoding failed: %s", err)
+	}
+	if len(rest) > 0 {
+		t.Fatalf("trailing data after element: %x", rest)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("decoded value differs.\n  got: %+v\n  expected: %+v",
+			reflect.ValueOf(decoded).Elem(), reflect.ValueOf(expected).Elem())
+	}
+
+	encoded, err := ctx.EncodeWithOptions(reflect.ValueOf(decoded).Elem().Interface(), s.Options)
+	if err != nil {
+		t.Fatalf("encoding failed: %s", err)
+	}
+	if filepath.Ext(file) == ".der" {
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("encoding differs.\n  got: %x\n  expected: %x", encoded, data)
+		}
+		return
+	}
+	again := s.New(base)
+	if _, err := ctx.DecodeWithOptions(encoded, again, s.Options); err != nil {
+		t.Fatalf("decoding the encoded value failed: %s", err)
+	}
+	if !reflect.DeepEqual(again, expected) {
+		t.Fatalf("value changed after encoding.\n  got: %+v\n  expected: %+v",
+			reflect.ValueOf(again).Elem(), reflect.ValueOf(expected).Elem())
+	}
+}
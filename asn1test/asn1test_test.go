@@ -0,0 +1,36 @@
+package asn1test
+
+import (
+	"testing"
+
+	"github.com/pipistrellka/asn1"
+)
+
+type record struct {
+	Version int
+	Name    string `asn1:"tag:0,optional"`
+	Oid     asn1.Oid
+}
+
+func TestRunVectors(t *testing.T) {
+	RunVectors(t, "testdata/vectors", func() interface{} {
+		return &record{}
+	})
+}
+
+func TestSuite(t *testing.T) {
+	names := map[string]bool{}
+	Suite{
+		Dir:     "testdata/vectors",
+		Context: asn1.NewContext(),
+		New: func(name string) interface{} {
+			names[name] = true
+			return &record{}
+		},
+	}.Run(t)
+	for _, name := range []string{"full", "indefinite", "truncated"} {
+		if !names[name] {
+			t.Fatalf("Vector %s was not run.", name)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package asn1
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AuditError is returned by EncodeWithOptions when the audit is enabled and
+// the encoding of a value is not reproduced by decoding it with DER and
+// encoding it again.
+type AuditError struct {
+	Msg       string
+	Encoded   []byte // The original encoding.
+	Reencoded []byte // The encoding of the decoded value, if it was decoded.
+	Offset    int    // Offset of the first different byte or -1.
+}
+
+// Error returns the error message of an AuditError.
+func (e *AuditError) Error() string {
+	return e.Msg
+}
+
+// auditEncoding decodes data with DER into a new value of the same type of
+// obj, encodes it again and compares the result with data.
+func (ctx *Context) auditEncoding(data []byte, obj interface{}, options string) error {
+	if obj == nil {
+		return nil
+	}
+	auditCtx := *ctx
+	auditCtx.audit = false
+	auditCtx.collectErrors = false
+	auditCtx.warningHandler = nil
+	auditCtx.metricsHandler = nil
+	auditCtx.der.decoding = true
+	auditCtx.rules = nil
+
+	objType := reflect.TypeOf(obj)
+	for objType.Kind() == reflect.Ptr && objType != bigIntType {
+		objType = objType.Elem()
+	}
+	value := reflect.New(objType)
+	rest, err := auditCtx.DecodeWithOptions(data, value.Interface(), options)
+	if err == nil && len(rest) > 0 {
+		err = parseError("trailing data after element")
+	}
+	if err != nil {
+		return &AuditError{
+			Msg:     fmt.Sprintf("audit failed to decode the encoding of '%s': %s", objType, err),
+			Encoded: data,
+			Offset:  -1,
+		}
+	}
+
+	reencoded, err := auditCtx.EncodeWithOptions(value.Elem().Interface(), options)
+	if err != nil {
+		return &AuditError{
+			Msg:     fmt.Sprintf("audit failed to encode the decoded '%s': %s", objType, err),
+			Encoded: data,
+			Offset:  -1,
+		}
+	}
+	offset := firstDifference(data, reencoded)
+	if offset >= 0 {
+		return &AuditError{
+			Msg: fmt.Sprintf("encoding of '%s' is not canonical: encodings differ at offset %d",
+				objType, offset),
+			Encoded:   data,
+			Reencoded: reencoded,
+			Offset:    offset,
+		}
+	}
+	return nil
+}
+
+// firstDifference returns the index of the first different byte of a and b or
+// -1 if both are equal.
+func firstDifference(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
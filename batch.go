@@ -0,0 +1,128 @@
+package asn1
+
+import (
+	"reflect"
+	"sync"
+)
+
+// EncodeAll encodes each item of values, which must be a slice or an array,
+// and returns their encodings in the same order. It's meant for bulk
+// processing, such as CDR files and certificate stores.
+//
+// The items are encoded by the given number of goroutines, which share the
+// Context. The Context must not be modified until EncodeAll returns. A
+// number of workers lower than 2 encodes the items sequentially.
+//
+// If any item fails, the error of the first one, in the order of values, is
+// returned and the remaining items are not encoded. The index of the item is
+// added to the message of a ParseError or a SyntaxError.
+func (ctx *Context) EncodeAll(values interface{}, workers int) ([][]byte, error) {
+	slice := reflect.ValueOf(values)
+	if slice.Kind() != reflect.Slice && slice.Kind() != reflect.Array {
+		return nil, syntaxError("invalid Go type '%T' for EncodeAll, expecting a slice or array", values)
+	}
+	encoded := make([][]byte, slice.Len())
+	err := runBatch(slice.Len(), workers, func(i int) (err error) {
+		encoded[i], err = ctx.Encode(slice.Index(i).Interface())
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// DecodeAll decodes each item of data into a new element of the slice pointed
+// by obj, which is replaced by a slice with the decoded values in the same
+// order. Each item must hold a single element without trailing data.
+//
+// The items are decoded by the given number of goroutines, which share the
+// Context, as in EncodeAll. If any item fails, the error of the first one, in
+// the order of data, is returned as in EncodeAll and obj is left untouched.
+func (ctx *Context) DecodeAll(data [][]byte, obj interface{}, workers int) error {
+	ptr := reflect.ValueOf(obj)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return syntaxError("invalid Go type '%T' for DecodeAll, expecting a pointer to a slice", obj)
+	}
+	slice := reflect.MakeSlice(ptr.Elem().Type(), len(data), len(data))
+	err := runBatch(len(data), workers, func(i int) error {
+		rest, err := ctx.Decode(data[i], slice.Index(i).Addr().Interface())
+		if err == nil && len(rest) > 0 {
+			err = parseError("trailing data after element")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	ptr.Elem().Set(slice)
+	return nil
+}
+
+// runBatch calls process for each index lower than n using the given number
+// of goroutines. Indexes are processed in ascending order, which is stopped
+// by the first error, so the error returned is the one of the lowest index
+// that fails.
+func runBatch(n int, workers int, process func(i int) error) error {
+	if workers > n {
+		workers = n
+	}
+	if workers < 2 {
+		for i := 0; i < n; i++ {
+			if err := process(i); err != nil {
+				return batchError(i, err)
+			}
+		}
+		return nil
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = -1
+		first  error
+	)
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := process(i); err != nil {
+					mu.Lock()
+					if failed < 0 || i < failed {
+						failed, first = i, err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		mu.Lock()
+		stop := failed >= 0
+		mu.Unlock()
+		if stop {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	if first != nil {
+		return batchError(failed, first)
+	}
+	return nil
+}
+
+// batchError prefixes the message of the error of an item with its index,
+// keeping the type of the error.
+func batchError(i int, err error) error {
+	switch err.(type) {
+	case *ParseError:
+		return parseError("item %d: %s", i, err)
+	case *SyntaxError:
+		return syntaxError("item %d: %s", i, err)
+	}
+	return err
+}
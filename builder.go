@@ -0,0 +1,217 @@
+package asn1
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// Builder constructs an encoding element by element, for the cases where
+// defining Go types for the whole structure is not worth it.
+//
+// Constructed elements are started by one of the Begin methods and must be
+// closed by the matching End method. The elements added in between become
+// the content of the constructed element:
+//
+//	b := asn1.NewBuilder()
+//	b.BeginSequence()
+//	b.AddInteger(1)
+//	b.AddValue("abc", "tag:0")
+//	b.EndSequence()
+//	data, err := b.Bytes()
+//
+// A Builder records the first error found and ignores any following call.
+// The error is returned by Bytes.
+type Builder struct {
+	ctx    *Context
+	frames []*builderFrame
+	err    error
+}
+
+// builderFrame keeps the elements added to a constructed element.
+type builderFrame struct {
+	raw      *rawValue
+	children []*rawValue
+}
+
+// NewBuilder creates a Builder that uses a default Context.
+func NewBuilder() *Builder {
+	return NewContext().NewBuilder()
+}
+
+// NewBuilder creates a Builder that uses the encoding rules and choices of
+// ctx.
+func (ctx *Context) NewBuilder() *Builder {
+	return &Builder{
+		ctx:    ctx,
+		frames: []*builderFrame{{}},
+	}
+}
+
+// current returns the innermost open element.
+func (b *Builder) current() *builderFrame {
+	return b.frames[len(b.frames)-1]
+}
+
+// add appends a raw value to the innermost open element.
+func (b *Builder) add(raw *rawValue) {
+	if raw == nil {
+		return
+	}
+	frame := b.current()
+	frame.children = append(frame.children, raw)
+}
+
+// AddValue encodes obj with the given options, as EncodeWithOptions does, and
+// adds the result to the innermost open element.
+func (b *Builder) AddValue(obj interface{}, options string) {
+	if b.err != nil {
+		return
+	}
+	opts, err := b.ctx.parseOptions(options)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if opts == nil {
+		return
+	}
+	raw, err := b.ctx.encode(reflect.ValueOf(obj), opts)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.add(raw)
+}
+
+// AddEncoded adds an element that is already encoded. The data must contain
+// exactly one element.
+func (b *Builder) AddEncoded(data []byte) {
+	if b.err != nil {
+		return
+	}
+	reader := bytes.NewBuffer(data)
+	raw, err := decodeRawValue(reader)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if reader.Len() > 0 {
+		b.err = syntaxError("trailing data after encoded element")
+		return
+	}
+	b.add(raw)
+}
+
+// AddBoolean adds a BOOLEAN.
+func (b *Builder) AddBoolean(v bool) {
+	b.AddValue(v, "")
+}
+
+// AddInteger adds an INTEGER.
+func (b *Builder) AddInteger(n int64) {
+	b.AddValue(n, "")
+}
+
+// AddOctetString adds an OCTET STRING.
+func (b *Builder) AddOctetString(data []byte) {
+	b.AddValue(data, "")
+}
+
+// AddNull adds a NULL.
+func (b *Builder) AddNull() {
+	b.AddValue(Null{}, "")
+}
+
+// AddOid adds an OBJECT IDENTIFIER.
+func (b *Builder) AddOid(oid Oid) {
+	b.AddValue(oid, "")
+}
+
+// begin opens a new constructed element.
+func (b *Builder) begin(class, tag uint) {
+	if b.err != nil {
+		return
+	}
+	raw := &rawValue{Class: class, Tag: tag, Constructed: true}
+	b.frames = append(b.frames, &builderFrame{raw: raw})
+}
+
+// end closes the innermost open element, which must have the given class and
+// tag.
+func (b *Builder) end(class, tag uint) {
+	if b.err != nil {
+		return
+	}
+	frame := b.current()
+	if frame.raw == nil {
+		b.err = syntaxError("no open element to end")
+		return
+	}
+	if frame.raw.Class != class || frame.raw.Tag != tag {
+		b.err = syntaxError("cannot end %s when %s is open",
+			TagString(class, tag), TagString(frame.raw.Class, frame.raw.Tag))
+		return
+	}
+	if class == ClassUniversal && tag == TagSet && b.ctx.der.encoding {
+		sort.Stable(rawValueSlice(frame.children))
+	}
+	content, err := b.ctx.encodeRawValues(frame.children...)
+	if err != nil {
+		b.err = err
+		return
+	}
+	frame.raw.Content = content
+	b.frames = b.frames[:len(b.frames)-1]
+	b.add(frame.raw)
+}
+
+// BeginSequence opens a SEQUENCE.
+func (b *Builder) BeginSequence() {
+	b.begin(ClassUniversal, TagSequence)
+}
+
+// EndSequence closes a SEQUENCE opened by BeginSequence.
+func (b *Builder) EndSequence() {
+	b.end(ClassUniversal, TagSequence)
+}
+
+// BeginSet opens a SET. When DER encoding is used, the elements of the SET are
+// sorted by their tags.
+func (b *Builder) BeginSet() {
+	b.begin(ClassUniversal, TagSet)
+}
+
+// EndSet closes a SET opened by BeginSet.
+func (b *Builder) EndSet() {
+	b.end(ClassUniversal, TagSet)
+}
+
+// BeginConstructed opens a constructed element with the given class and tag.
+// It can be used to add explicit tags or implicitly tagged SEQUENCEs.
+func (b *Builder) BeginConstructed(class, tag uint) {
+	if class > ClassPrivate {
+		b.err = syntaxError("invalid class value: %d", class)
+		return
+	}
+	b.begin(class, tag)
+}
+
+// EndConstructed closes an element opened by BeginConstructed.
+func (b *Builder) EndConstructed(class, tag uint) {
+	b.end(class, tag)
+}
+
+// Bytes returns the encoding of all top-level elements added so far or the
+// first error found.
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.frames) > 1 {
+		raw := b.current().raw
+		return nil, syntaxError("element %s was not ended",
+			TagString(raw.Class, raw.Tag))
+	}
+	return b.ctx.encodeRawValues(b.frames[0].children...)
+}
@@ -0,0 +1,251 @@
+package asn1
+
+import (
+	"reflect"
+)
+
+// CheckType verifies that the type of obj can be encoded and decoded with
+// ctx. The options of all struct fields are parsed and checked against the
+// field types, the referenced choices and constraints must be registered and
+// every nested type is also verified.
+//
+// Errors in struct tags are otherwise only found when a value is encoded or
+// decoded, so CheckType can be used during initialization or in tests to
+// find them early:
+//
+//	if err := ctx.CheckType(Certificate{}); err != nil {
+//		panic(err)
+//	}
+func (ctx *Context) CheckType(obj interface{}) error {
+	return ctx.CheckTypeWithOptions(obj, "")
+}
+
+// CheckTypeWithOptions works as CheckType for values encoded and decoded
+// with the given options.
+func (ctx *Context) CheckTypeWithOptions(obj interface{}, options string) error {
+	if obj == nil {
+		return syntaxError("cannot check the type of a nil value")
+	}
+	opts, err := ctx.parseOptions(options)
+	if err != nil || opts == nil {
+		return err
+	}
+	return ctx.checkType(reflect.TypeOf(obj), opts, make(map[reflect.Type][]*fieldOptions))
+}
+
+// checkType verifies a type and the options used with it. The parsed options
+// of the fields of each struct type found are stored in visited and struct
+// types already in visited are not verified again.
+func (ctx *Context) checkType(t reflect.Type, opts *fieldOptions, visited map[reflect.Type][]*fieldOptions) error {
+	if err := ctx.checkOptions(t, opts); err != nil {
+		return err
+	}
+	if opts.choice != nil {
+		// The types of the choices are checked when they are added
+		return nil
+	}
+
+	// Verify if the type is supported
+	elemOpts := *opts
+	elemOpts.tag2 = nil
+	elemOpts.explicit2 = false
+	if _, err := ctx.getExpectedElement(&rawValue{}, t, &elemOpts); err != nil {
+		return err
+	}
+
+	// And check nested types
+	for t.Kind() == reflect.Ptr && t != bigIntType {
+		t = t.Elem()
+	}
+	universal, err := ctx.getUniversalTag(t, &fieldOptions{})
+	if err != nil {
+		return err
+	}
+	if universal.class != ClassUniversal || (universal.tag != TagSequence && universal.tag != TagSet) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := visited[t]; ok {
+			return nil
+		}
+		fields := make([]*fieldOptions, t.NumField())
+		visited[t] = fields
+		identifiers := make(map[string]string)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldOpts, err := ctx.parseFieldOptions(t, i)
+			if err != nil {
+				return err
+			}
+			if fieldOpts == nil {
+				continue
+			}
+			identifier := componentIdentifier(field, fieldOpts)
+			if other, ok := identifiers[identifier]; ok {
+				return syntaxError("fields %s.%s and %s.%s have the same identifier '%s'",
+					t.Name(), other, t.Name(), field.Name, identifier)
+			}
+			identifiers[identifier] = field.Name
+			fields[i] = fieldOpts
+			if fieldOpts.group != nil {
+				if _, err := ctx.getGroupEnd(t, i, *fieldOpts.group); err != nil {
+					return err
+				}
+			}
+			if fieldOpts.versionField || fieldOpts.isVersioned() {
+				if _, err := ctx.getVersion(reflect.New(t).Elem()); err != nil {
+					return err
+				}
+			}
+			for _, rule := range fieldOpts.presence {
+				if _, err := ctx.getPresenceTarget(t, field, rule); err != nil {
+					return err
+				}
+			}
+			if fieldOpts.compute != nil {
+				if _, err := getComputeMethod(t, field, *fieldOpts.compute); err != nil {
+					return err
+				}
+			}
+			if err := ctx.checkType(field.Type, fieldOpts, visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() != reflect.Interface {
+			return ctx.checkType(t.Elem(), &fieldOptions{}, visited)
+		}
+	}
+	return nil
+}
+
+// checkOptions verifies that the options can be used with the type t.
+func (ctx *Context) checkOptions(t reflect.Type, opts *fieldOptions) error {
+	invalid := func(option string) error {
+		return syntaxError("option '%s' cannot be used with Go type '%s'", option, t)
+	}
+	kind := t.Kind()
+	isInteger := false
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		isInteger = true
+	}
+	isBytes := (kind == reflect.Slice || kind == reflect.Array) &&
+		t.Elem().Kind() == reflect.Uint8
+	isChoices := kind == reflect.Slice && t.Elem().Kind() == reflect.Interface
+
+	if opts.choice != nil {
+		if kind != reflect.Interface {
+			return invalid("choice")
+		}
+		if _, err := ctx.getChoices(*opts.choice); err != nil {
+			return err
+		}
+	}
+	if opts.choices != nil {
+		if !isChoices {
+			return invalid("choices")
+		}
+		if _, err := ctx.getChoices(*opts.choices); err != nil {
+			return err
+		}
+	} else if isChoices && len(ctx.elementTypes) == 0 {
+		return syntaxError("option 'choices' is required by Go type '%s'", t)
+	}
+	if opts.timeLayout != nil {
+		base := t
+		for base.Kind() == reflect.Ptr {
+			base = base.Elem()
+		}
+		if base != goTimeType {
+			return invalid("timelayout")
+		}
+	}
+	if opts.set {
+		base := t
+		for base.Kind() == reflect.Ptr {
+			base = base.Elem()
+		}
+		isList := (base.Kind() == reflect.Slice || base.Kind() == reflect.Array) &&
+			base.Elem().Kind() != reflect.Uint8
+		if base.Kind() != reflect.Struct && !isList {
+			return invalid("set")
+		}
+	}
+	if opts.defaultValue != nil && !isInteger {
+		return invalid("default")
+	}
+	if opts.extensible && !isInteger {
+		return invalid("extensible")
+	}
+	if opts.alphabet != nil && kind != reflect.String && !isBytes {
+		return invalid("alphabet")
+	}
+	if opts.compress != nil {
+		if kind != reflect.String && !isBytes {
+			return invalid("compress")
+		}
+		if _, err := ctx.getCodec(*opts.compress); err != nil {
+			return err
+		}
+	}
+	if opts.indefinite && !opts.explicit && opts.choice == nil {
+		universal, err := ctx.getUniversalTag(t, &fieldOptions{})
+		if err != nil {
+			return err
+		}
+		if universal.tag != TagSequence && universal.tag != TagSet {
+			return invalid("indefinite")
+		}
+	}
+	if opts.perConstraint != nil {
+		isInteger = isInteger || t == bigIntType
+		isSized := kind == reflect.String || kind == reflect.Slice || kind == reflect.Array
+		if !isInteger && !isSized {
+			return invalid("per-constrained")
+		}
+		lower := opts.perConstraint.lower
+		if !isInteger && (lower == nil || *lower < 0) {
+			return syntaxError("invalid size constraint '%s' for Go type '%s'",
+				opts.perConstraint, t)
+		}
+	}
+	for _, name := range opts.constraints {
+		if _, ok := ctx.namedConstraints[name]; !ok {
+			return syntaxError("invalid constraint '%s'", name)
+		}
+	}
+	return nil
+}
+
+// RegisterType verifies the type of obj, as CheckType does, and keeps the
+// parsed options of all struct types found, so struct tags are not parsed
+// again each time a value of those types is encoded or decoded.
+//
+// The options are parsed with the custom options registered at the time
+// RegisterType is called. RegisterType must not be called concurrently with
+// other methods of ctx.
+func (ctx *Context) RegisterType(obj interface{}) error {
+	if obj == nil {
+		return syntaxError("cannot register the type of a nil value")
+	}
+	visited := make(map[reflect.Type][]*fieldOptions)
+	if err := ctx.checkType(reflect.TypeOf(obj), &fieldOptions{}, visited); err != nil {
+		return err
+	}
+	for t, fields := range visited {
+		ctx.structOptions[t] = fields
+	}
+	return nil
+}
+
+// getFieldOptions returns the options of the i-th field of the struct type t.
+// It returns nil if the field is ignored.
+func (ctx *Context) getFieldOptions(t reflect.Type, i int) (*fieldOptions, error) {
+	if fields, ok := ctx.structOptions[t]; ok {
+		return fields[i], nil
+	}
+	return ctx.parseFieldOptions(t, i)
+}
@@ -0,0 +1,172 @@
+package asn1
+
+import (
+	"io"
+)
+
+// cerSegmentSize is the maximum number of content octets that CER allows in
+// a primitive string. Longer strings are split in segments of this size.
+const cerSegmentSize = 1000
+
+// WriteChunkedOctetString reads the content of an OCTET STRING from reader
+// until EOF and writes it to writer following the CER rules: contents up to
+// 1000 octets are written as a primitive OCTET STRING while longer contents are
+// written as a constructed OCTET STRING with the indefinite length form and
+// segments of 1000 octets.
+//
+// Only two segments are kept in memory, so it can be used to encode payloads
+// of any size.
+func WriteChunkedOctetString(writer io.Writer, reader io.Reader) error {
+	current := make([]byte, cerSegmentSize)
+	next := make([]byte, cerSegmentSize)
+
+	n, err := readSegment(reader, current)
+	if err != nil {
+		return err
+	}
+	m := 0
+	if n == cerSegmentSize {
+		m, err = readSegment(reader, next)
+		if err != nil {
+			return err
+		}
+	}
+	if m == 0 {
+		// Short enough to be encoded as a primitive
+		return writeSegment(writer, current[:n])
+	}
+
+	if _, err = writer.Write([]byte{0x24, 0x80}); err != nil {
+		return err
+	}
+	for n > 0 {
+		if err = writeSegment(writer, current[:n]); err != nil {
+			return err
+		}
+		current, next = next, current
+		n = m
+		m = 0
+		if n == cerSegmentSize {
+			m, err = readSegment(reader, next)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = writer.Write([]byte{0x00, 0x00})
+	return err
+}
+
+// readSegment fills buf with data from reader and returns the number of bytes
+// read. A short count means that the reader reached EOF.
+func readSegment(reader io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(reader, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// writeSegment writes a primitive OCTET STRING.
+func writeSegment(writer io.Writer, content []byte) error {
+	raw := rawValue{Tag: TagOctetString, Content: content}
+	return raw.writeTo(writer)
+}
+
+// segmentWriter writes the data written to it as the primitive segments of a
+// constructed OCTET STRING, following the CER rules. Only the last segment,
+// written by flush, can be shorter than 1000 octets.
+type segmentWriter struct {
+	writer io.Writer
+	buf    []byte
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		m := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+		if len(s.buf) == cap(s.buf) {
+			if err := writeSegment(s.writer, s.buf); err != nil {
+				return n, err
+			}
+			s.buf = s.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// flush writes the data that doesn't fill a segment.
+func (s *segmentWriter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := writeSegment(s.writer, s.buf)
+	s.buf = s.buf[:0]
+	return err
+}
+
+// ReadChunkedOctetString reads an OCTET STRING from reader and writes its
+// content to writer. Both the primitive and the constructed forms are
+// accepted, in which case the content of the segments is concatenated. The
+// content is copied as it's read and it's never entirely kept in memory.
+func ReadChunkedOctetString(writer io.Writer, reader io.Reader) error {
+	class, tag, constructed, err := decodeIdentifier(reader)
+	if err != nil {
+		return err
+	}
+	if class != ClassUniversal || tag != TagOctetString {
+		return parseError("expected OCTET STRING but found (%d,%d)", class, tag)
+	}
+	length, indefinite, err := decodeLength(reader)
+	if err != nil {
+		return err
+	}
+	return copyStringSegments(writer, reader, constructed, length, indefinite)
+}
+
+// copyStringSegments copies the content of an OCTET STRING whose identifier
+// and length were already read.
+func copyStringSegments(writer io.Writer, reader io.Reader, constructed bool, length uint, indefinite bool) error {
+	if !constructed {
+		if indefinite {
+			return parseError("primitive node with indefinite length")
+		}
+		_, err := io.CopyN(writer, reader, int64(length))
+		return err
+	}
+
+	var limited *io.LimitedReader
+	if !indefinite {
+		limited = &io.LimitedReader{R: reader, N: int64(length)}
+		reader = limited
+	}
+	for {
+		if limited != nil && limited.N == 0 {
+			return nil
+		}
+		class, tag, constructed, err := decodeIdentifier(reader)
+		if err != nil {
+			return err
+		}
+		length, indefiniteSegment, err := decodeLength(reader)
+		if err != nil {
+			return err
+		}
+		if indefinite && class == 0 && tag == 0 && !constructed &&
+			!indefiniteSegment && length == 0 {
+			// End of contents
+			return nil
+		}
+		if class != ClassUniversal || tag != TagOctetString {
+			return parseError("invalid segment (%d,%d) in constructed OCTET STRING",
+				class, tag)
+		}
+		err = copyStringSegments(writer, reader, constructed, length, indefiniteSegment)
+		if err != nil {
+			return err
+		}
+	}
+}
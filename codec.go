@@ -0,0 +1,170 @@
+package asn1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// Codec transforms the content of OCTET STRINGs, such as a compression
+// algorithm. Codecs are registered with (*Context).AddCodec and selected with
+// the option "compress" (ie: "compress:gzip").
+type Codec interface {
+	// Encode transforms the content of a value before it's written.
+	Encode(data []byte) ([]byte, error)
+	// Decode restores the content of a value after it's read.
+	Decode(data []byte) ([]byte, error)
+}
+
+// LimitedCodec is a Codec that can stop restoring a content as soon as it
+// exceeds a limit, such as a decompressor. Contents restored by codecs that
+// don't implement it are only checked after they are restored.
+type LimitedCodec interface {
+	Codec
+	// DecodeLimit works like Decode and returns an error if the restored
+	// content has more than limit octets.
+	DecodeLimit(data []byte, limit int) ([]byte, error)
+}
+
+// AddCodec registers a Codec used by the option "compress:name". The codec
+// "gzip", which implements the gzip format of RFC 1952, is registered by
+// NewContext.
+func (ctx *Context) AddCodec(name string, codec Codec) error {
+	if name == "" || codec == nil {
+		return syntaxError("invalid codec '%s'", name)
+	}
+	if _, ok := ctx.codecs[name]; ok && !ctx.replaceInherited("codec", name) {
+		return syntaxError("codec already registered: %s", name)
+	}
+	ctx.codecs[name] = codec
+	return nil
+}
+
+// SetMaxCodecLength limits the length of the contents restored by codecs
+// when decoding. A ParseError is returned for longer contents, which protects
+// against data that expands to much more than its length, such as a gzip bomb.
+// When a memory budget is set, contents are also limited to the remaining
+// budget. Zero, the default, disables the limit.
+func (ctx *Context) SetMaxCodecLength(length int) {
+	ctx.maxCodecLength = length
+}
+
+// codecLimit returns the greatest length of a content restored by a codec, or
+// zero if there is no limit.
+func (ctx *Context) codecLimit() int {
+	limit := ctx.maxCodecLength
+	if ctx.memory != nil {
+		if left := ctx.memory.remaining(); left > 0 && (limit <= 0 || left < limit) {
+			limit = left
+		}
+	}
+	return limit
+}
+
+// getCodec returns a registered codec.
+func (ctx *Context) getCodec(name string) (Codec, error) {
+	codec, ok := ctx.codecs[name]
+	if !ok {
+		return nil, syntaxError("invalid codec '%s'", name)
+	}
+	return codec, nil
+}
+
+// codecDecoder returns a decoder that restores the content of a value with
+// the codec given by the options before decoding it.
+func (ctx *Context) codecDecoder(decoder decoderFunction, opts *fieldOptions) (decoderFunction, error) {
+	if opts.compress == nil {
+		return decoder, nil
+	}
+	codec, err := ctx.getCodec(*opts.compress)
+	if err != nil {
+		return nil, err
+	}
+	return func(data []byte, value reflect.Value) error {
+		var decoded []byte
+		var err error
+		limit := ctx.codecLimit()
+		if limited, ok := codec.(LimitedCodec); ok && limit > 0 {
+			decoded, err = limited.DecodeLimit(data, limit)
+		} else {
+			decoded, err = codec.Decode(data)
+		}
+		if err != nil {
+			return parseError("codec '%s': %s", *opts.compress, err)
+		}
+		if limit > 0 && len(decoded) > limit {
+			return parseError("codec '%s': content exceeds the limit of %d octets",
+				*opts.compress, limit)
+		}
+		if ctx.memory != nil {
+			if err := ctx.memory.charge(int64(len(decoded))); err != nil {
+				return err
+			}
+		}
+		return decoder(decoded, value)
+	}, nil
+}
+
+// applyCodec transforms the content of raw with the codec given by the
+// options.
+func (ctx *Context) applyCodec(raw *rawValue, opts *fieldOptions) error {
+	if opts.compress == nil {
+		return nil
+	}
+	codec, err := ctx.getCodec(*opts.compress)
+	if err != nil {
+		return err
+	}
+	if err := raw.build(); err != nil {
+		return err
+	}
+	raw.Content, err = codec.Encode(raw.Content)
+	if err != nil {
+		return syntaxError("codec '%s': %s", *opts.compress, err)
+	}
+	return nil
+}
+
+// gzipCodec implements the gzip Codec.
+type gzipCodec struct{}
+
+func (gzipCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (gzipCodec) DecodeLimit(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// One more octet tells a content longer than the limit
+	decoded, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > limit {
+		return nil, fmt.Errorf("content exceeds the limit of %d octets", limit)
+	}
+	return decoded, nil
+}
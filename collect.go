@@ -0,0 +1,96 @@
+package asn1
+
+import (
+	"strings"
+)
+
+// DecodeErrors is returned by DecodeWithOptions when errors are collected, as
+// enabled by (*Context).SetCollectErrors, and the content of some fields
+// could not be decoded. It holds an error for each of those fields, in the
+// order they were found.
+type DecodeErrors []error
+
+// Error returns the messages of the errors separated by semicolons.
+func (e DecodeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the collected errors.
+func (e DecodeErrors) Unwrap() []error {
+	return e
+}
+
+// SetCollectErrors enables or disables the collection of the errors found in
+// the fields of the decoded structs, to recover as much data as possible from
+// partially corrupt records.
+//
+// By default, decoding stops at the first error. When errors are collected, a
+// field whose element is found but whose content is invalid, such as an
+// INTEGER too large for its Go type or a nested SEQUENCE with an unexpected
+// element, is left as it was decoded and the decoding continues with the next
+// field. The errors of those fields are returned together as DecodeErrors
+// once the decoding ends, with the path of each field in the messages. Errors
+// that don't allow continuing, such as malformed lengths, are still returned
+// alone.
+func (ctx *Context) SetCollectErrors(collect bool) {
+	ctx.collectErrors = collect
+}
+
+// errorCollector keeps the errors collected by a decoding.
+type errorCollector struct {
+	errs DecodeErrors
+}
+
+// decodeCollecting decodes data with a new errorCollector and returns the
+// errors it collects.
+func (ctx *Context) decodeCollecting(data []byte, obj interface{}, options string) ([]byte, error) {
+	collectCtx := *ctx
+	collector := &errorCollector{}
+	collectCtx.collector = collector
+	rest, err := collectCtx.DecodeWithOptions(data, obj, options)
+	if err == nil && len(collector.errs) > 0 {
+		err = collector.errs
+	}
+	return rest, err
+}
+
+// collect adds err to the collected errors if it's the error of a field that
+// can be skipped. It returns false if err must be returned instead.
+func (ctx *Context) collect(err error) bool {
+	e, ok := err.(*ParseError)
+	if !ok || ctx.collector == nil || (ctx.memory != nil && ctx.memory.exceeded()) {
+		return false
+	}
+	if e.fieldMsg == "" {
+		e.fieldMsg = e.Msg
+	}
+	ctx.collector.errs = append(ctx.collector.errs, e)
+	return true
+}
+
+// collected returns the number of errors collected.
+func (ctx *Context) collected() int {
+	if ctx.collector == nil {
+		return 0
+	}
+	return len(ctx.collector.errs)
+}
+
+// addCollectedPath adds name to the path of the errors collected after the
+// first n ones, which are redacted if the field is sensitive.
+func (ctx *Context) addCollectedPath(n int, name string, sensitive bool) {
+	if ctx.collector == nil {
+		return
+	}
+	errs := ctx.collector.errs
+	for i := n; i < len(errs); i++ {
+		if sensitive {
+			errs[i] = redactError(errs[i])
+		}
+		errs[i] = addFieldPath(errs[i], name)
+	}
+}
@@ -0,0 +1,128 @@
+package asn1
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// Constraint validates values during encoding and decoding. It allows
+// expressing constraints of an ASN.1 specification that can't be represented
+// by Go types, such as patterns or permitted values.
+//
+// Constraints are registered in a Context either for a Go type, with
+// AddTypeConstraint, or with a name, with AddConstraint, to be referenced by
+// the option "constraint".
+type Constraint interface {
+	// Check returns an error if the value violates the constraint.
+	Check(value interface{}) error
+}
+
+// ConstraintFunc is an adapter to allow the use of ordinary functions as
+// Constraints.
+type ConstraintFunc func(value interface{}) error
+
+// Check calls f(value).
+func (f ConstraintFunc) Check(value interface{}) error {
+	return f(value)
+}
+
+// PatternConstraint returns a Constraint that accepts strings and byte slices
+// matching the regular expression re.
+func PatternConstraint(re *regexp.Regexp) Constraint {
+	return ConstraintFunc(func(value interface{}) error {
+		reflected := reflect.ValueOf(value)
+		var matched bool
+		switch {
+		case reflected.Kind() == reflect.String:
+			matched = re.MatchString(reflected.String())
+		case reflected.Kind() == reflect.Slice &&
+			reflected.Type().Elem().Kind() == reflect.Uint8:
+			matched = re.Match(reflected.Bytes())
+		default:
+			return fmt.Errorf("pattern cannot be applied to Go type '%T'", value)
+		}
+		if !matched {
+			return fmt.Errorf("value %q does not match the pattern %s", value, re)
+		}
+		return nil
+	})
+}
+
+// AddConstraint registers a constraint with the given name. The constraint is
+// applied to elements with the option "constraint:name".
+func (ctx *Context) AddConstraint(name string, constraint Constraint) error {
+	if _, ok := ctx.namedConstraints[name]; ok && !ctx.replaceInherited("constraint", name) {
+		return fmt.Errorf("constraint already registered: %s", name)
+	}
+	ctx.namedConstraints[name] = constraint
+	return nil
+}
+
+// AddTypeConstraint registers a constraint that is applied to every value of
+// the Go type t.
+func (ctx *Context) AddTypeConstraint(t reflect.Type, constraint Constraint) {
+	ctx.typeConstraints[t] = append(ctx.typeConstraints[t], constraint)
+}
+
+// checkConstraints checks value against the constraints registered for its
+// type and against the constraints named in opts.
+func (ctx *Context) checkConstraints(value reflect.Value, opts *fieldOptions) error {
+	if len(opts.constraints) == 0 && len(ctx.typeConstraints) == 0 &&
+		opts.alphabet == nil && len(ctx.enums) == 0 {
+		return nil
+	}
+	obj := value.Interface()
+	if obj == nil {
+		return nil
+	}
+	if err := ctx.checkEnum(reflect.ValueOf(obj), opts); err != nil {
+		return err
+	}
+	if opts.alphabet != nil {
+		if err := opts.alphabet.Check(obj); err != nil {
+			return err
+		}
+	}
+	for _, constraint := range ctx.typeConstraints[reflect.TypeOf(obj)] {
+		if err := constraint.Check(obj); err != nil {
+			return err
+		}
+	}
+	for _, name := range opts.constraints {
+		constraint, ok := ctx.namedConstraints[name]
+		if !ok {
+			return syntaxError("invalid constraint '%s'", name)
+		}
+		if err := constraint.Check(obj); err != nil {
+			return fmt.Errorf("%s (constraint '%s')", err, name)
+		}
+	}
+	return nil
+}
+
+// constrainedDecoder returns a decoder that checks the constraints after the
+// value is decoded.
+func (ctx *Context) constrainedDecoder(decoder decoderFunction, opts *fieldOptions) decoderFunction {
+	return func(data []byte, value reflect.Value) error {
+		if err := decoder(data, value); err != nil {
+			return err
+		}
+		return constraintError(ctx.checkConstraints(value, opts), true)
+	}
+}
+
+// constraintError converts a constraint violation into a ParseError when
+// decoding or into a SyntaxError when encoding.
+func constraintError(err error, decoding bool) error {
+	switch err.(type) {
+	case nil:
+		return nil
+	case *SyntaxError, *ParseError:
+		return err
+	}
+	if decoding {
+		return parseError("constraint violated: %s", err)
+	}
+	return syntaxError("constraint violated: %s", err)
+}
@@ -25,6 +25,50 @@ type Context struct {
 		encoding bool
 		decoding bool
 	}
+	// rules are the registered rules selected by SetRules, or nil for BER
+	// and DER.
+	rules            *namedRules
+	strictOrder      bool
+	rejectDuplicates bool
+	audit            bool
+	namedConstraints map[string]Constraint
+	typeConstraints  map[reflect.Type][]Constraint
+	enums            map[reflect.Type]map[int64]bool
+	enumNames        map[reflect.Type]map[int64]string
+	options          map[string]OptionFunc
+	structOptions    map[reflect.Type][]*fieldOptions
+	warningHandler   func(Warning)
+	trace            *decodeTrace
+	elementTypes     []choiceEntry
+	encoding         *encodeState
+	skipValidation   bool
+	codecs           map[string]Codec
+	cipher           FieldCipher
+	preserveSetOrder bool
+	preserved        *preservedEncodings
+	lengthOctets     int
+	longForm         bool
+	maxLengthOctets  int
+	maxTagNumber     uint
+	realFormat       RealFormat
+	strictFields     bool
+	memory           *memoryAccount
+	memoryBudget     int64
+	metricsHandler   func(DecodeMetrics)
+	nullAsAbsent     bool
+	utf8Validation   UTF8Validation
+	collectErrors    bool
+	collector        *errorCollector
+	maxStringLengths map[uint]int
+	maxCodecLength   int
+	extensionTypes   map[string]extensionType
+	routes           map[routeKey]route
+	// lazyChoices holds the definitions of the choices registered with
+	// AddChoiceFunc that were not used yet.
+	lazyChoices map[string]func() ([]Choice, error)
+	// inherited holds the keys of the named registrations copied from the
+	// parent by NewChild, which can be replaced in the child.
+	inherited map[string]bool
 }
 
 // Choice represents one option available for a CHOICE element.
@@ -38,6 +82,20 @@ type choiceEntry struct {
 	expectedElement
 	typ  reflect.Type
 	opts *fieldOptions
+	// name identifies the alternative in the value notation, if defined.
+	name string
+}
+
+// identifier returns the identifier of the alternative in the value notation
+// or an empty string if there is none.
+func (entry choiceEntry) identifier() string {
+	if entry.name != "" {
+		return entry.name
+	}
+	if entry.typ.Name() == "" {
+		return ""
+	}
+	return notationIdentifier(entry.typ.Name())
 }
 
 // NewContext creates and initializes a new context. The returned Context does
@@ -47,12 +105,123 @@ func NewContext() *Context {
 	ctx := &Context{}
 	ctx.log = defaultLogger()
 	ctx.choices = make(map[string][]choiceEntry)
+	ctx.lazyChoices = make(map[string]func() ([]Choice, error))
+	ctx.namedConstraints = make(map[string]Constraint)
+	ctx.typeConstraints = make(map[reflect.Type][]Constraint)
+	ctx.enums = make(map[reflect.Type]map[int64]bool)
+	ctx.enumNames = make(map[reflect.Type]map[int64]string)
+	ctx.options = make(map[string]OptionFunc)
+	ctx.structOptions = make(map[reflect.Type][]*fieldOptions)
+	ctx.codecs = map[string]Codec{"gzip": gzipCodec{}}
+	ctx.extensionTypes = make(map[string]extensionType)
+	ctx.routes = make(map[routeKey]route)
 	ctx.SetDer(true, false)
 	return ctx
 }
 
+// NewChild returns a new Context that inherits the settings and the
+// registrations of ctx, so the configuration shared by several protocol layers
+// is registered once, while each layer adds its own:
+//
+//	transport := asn1.NewContext()
+//	transport.AddChoice("payload", ...)
+//	app := transport.NewChild()
+//	app.AddChoice("payload", ...) // Adds alternatives for the application
+//	app.AddCodec("gzip", ...)     // Replaces the inherited codec
+//
+// The child gets a copy of the registrations of ctx at the time it's created:
+// later changes of ctx are not seen by the child and registrations made in the
+// child don't change ctx. Registrations of sets, such as the alternatives of a
+// choice, the element types, the values of an enum and the constraints of a
+// type, are extended by the child, while named registrations, such as the
+// constraints, codecs, options, extension types, handlers and enum names, can
+// be replaced instead of returning an error. Preserved encodings are not inherited.
+func (ctx *Context) NewChild() *Context {
+	child := *ctx
+	child.choices = make(map[string][]choiceEntry, len(ctx.choices))
+	for name, entries := range ctx.choices {
+		child.choices[name] = append([]choiceEntry(nil), entries...)
+	}
+	child.lazyChoices = make(map[string]func() ([]Choice, error), len(ctx.lazyChoices))
+	for name, define := range ctx.lazyChoices {
+		child.lazyChoices[name] = define
+	}
+	child.elementTypes = append([]choiceEntry(nil), ctx.elementTypes...)
+	child.typeConstraints = make(map[reflect.Type][]Constraint, len(ctx.typeConstraints))
+	for t, constraints := range ctx.typeConstraints {
+		child.typeConstraints[t] = append([]Constraint(nil), constraints...)
+	}
+	child.enums = make(map[reflect.Type]map[int64]bool, len(ctx.enums))
+	for t, values := range ctx.enums {
+		known := make(map[int64]bool, len(values))
+		for v := range values {
+			known[v] = true
+		}
+		child.enums[t] = known
+	}
+	child.structOptions = make(map[reflect.Type][]*fieldOptions)
+	if ctx.preserved != nil {
+		child.SetPreserveEncoding(true)
+	}
+
+	child.inherited = make(map[string]bool)
+	child.namedConstraints = make(map[string]Constraint, len(ctx.namedConstraints))
+	for name, constraint := range ctx.namedConstraints {
+		child.namedConstraints[name] = constraint
+		child.inherited["constraint:"+name] = true
+	}
+	child.codecs = make(map[string]Codec, len(ctx.codecs))
+	for name, codec := range ctx.codecs {
+		child.codecs[name] = codec
+		child.inherited["codec:"+name] = true
+	}
+	child.options = make(map[string]OptionFunc, len(ctx.options))
+	for name, handler := range ctx.options {
+		child.options[name] = handler
+		child.inherited["option:"+name] = true
+	}
+	child.extensionTypes = make(map[string]extensionType, len(ctx.extensionTypes))
+	for key, entry := range ctx.extensionTypes {
+		child.extensionTypes[key] = entry
+		child.inherited["extension:"+key] = true
+	}
+	child.routes = make(map[routeKey]route, len(ctx.routes))
+	for key, r := range ctx.routes {
+		child.routes[key] = r
+		child.inherited["handler:"+TagString(key.class, key.tag)] = true
+	}
+	child.enumNames = make(map[reflect.Type]map[int64]string, len(ctx.enumNames))
+	for t, names := range ctx.enumNames {
+		child.enumNames[t] = names
+	}
+	if ctx.maxStringLengths != nil {
+		child.maxStringLengths = make(map[uint]int, len(ctx.maxStringLengths))
+		for tag, max := range ctx.maxStringLengths {
+			child.maxStringLengths[tag] = max
+		}
+	}
+	return &child
+}
+
+// replaceInherited reports whether a named registration can be replaced
+// because it was inherited from the parent Context. The registration is no
+// longer inherited afterwards.
+func (ctx *Context) replaceInherited(kind string, name string) bool {
+	key := kind + ":" + name
+	if !ctx.inherited[key] {
+		return false
+	}
+	delete(ctx.inherited, key)
+	return true
+}
+
 // getChoices returns a list of choices for a given name.
 func (ctx *Context) getChoices(choice string) ([]choiceEntry, error) {
+	if define, ok := ctx.lazyChoices[choice]; ok {
+		if err := ctx.resolveChoice(choice, define); err != nil {
+			return nil, err
+		}
+	}
 	entries := ctx.choices[choice]
 	if entries == nil {
 		return nil, syntaxError("invalid choice '%s'", choice)
@@ -85,23 +254,32 @@ func (ctx *Context) getChoiceByTag(choice string, class, tag uint) (entry choice
 	}
 
 	for _, current := range entries {
-		if current.class == class && current.tag == tag {
+		if current.class == class && current.hasTag(tag) {
 			entry = current
 			return
 		}
 	}
-	// TODO convert tag to text
-	err = syntaxError("invalid tag [%d,%d] for choice '%s'", class, tag, choice)
+	err = syntaxError("invalid tag %s for choice '%s'", TagString(class, tag), choice)
 	return
 }
 
 // addChoiceEntry adds a single choice to the list associated to a given name.
 func (ctx *Context) addChoiceEntry(choice string, entry choiceEntry) error {
 	for _, current := range ctx.choices[choice] {
-		if current.class == entry.class && current.tag == entry.tag {
-			return fmt.Errorf(
-				"choice already registered: %s{%d, %d}",
-				choice, entry.class, entry.tag)
+		if current.typ == entry.typ {
+			// The Go type selects the alternative when encoding
+			return syntaxError("choice '%s' has two alternatives of Go type '%s'",
+				choice, entry.typ)
+		}
+		if current.class != entry.class {
+			continue
+		}
+		for _, tag := range append([]uint{entry.tag}, entry.alternatives...) {
+			if current.hasTag(tag) {
+				return fmt.Errorf(
+					"choice already registered: %s{%d, %d}",
+					choice, entry.class, tag)
+			}
 		}
 	}
 	ctx.choices[choice] = append(ctx.choices[choice], entry)
@@ -159,13 +337,130 @@ func (ctx *Context) addChoiceEntry(choice string, entry choiceEntry) error {
 // 4. Since both errors use the same encoding type, ASN.1 says they must have
 // distinguished tags. For that, the appropriate tag is defined for each type.
 //
+// 5. An alternative can be enclosed in its own explicit tag, as in
+// "tag:4,explicit" for the directoryName of a GeneralName, and the choice
+// field can be enclosed in another one, as in "tag:0,explicit,choice:value".
+// Several fields of a struct can use the same choice.
+//
+// 6. Alternatives without a tag keep the universal tag of their types, as in
+// an untagged CHOICE. The alternative is selected by the Go type when
+// encoding and by the universal tag found when decoding:
+//
+//	// Time ::= CHOICE { utcTime UTCTime, generalTime GeneralizedTime }
+//	ctx.AddChoice("time", []asn1.Choice{
+//		{Type: reflect.TypeOf(asn1.UTCTime{})},
+//		{Type: reflect.TypeOf(asn1.GeneralizedTime{})},
+//	})
+//
 // To encode a choice value, all that is necessary is to set the choice field
 // with the proper object. To decode a choice value, a type switch can be used
 // to determine which type was used.
 //
 func (ctx *Context) AddChoice(choice string, entries []Choice) error {
-	for _, e := range entries {
-		opts, err := parseOptions(e.Options)
+	return ctx.addChoice(choice, entries, nil)
+}
+
+// AddChoiceFromStruct registers the alternatives of a choice defined by the
+// fields of the struct def. The type and the tag of each field are used as the
+// Type and the Options of a Choice, while the name of the field, or its option
+// "name", identifies the alternative in the value notation. The example of
+// AddChoice can be written as:
+//
+//	ctx.AddChoiceFromStruct("value", struct {
+//		Code    int
+//		Simple  SimpleError   `asn1:"tag:1"`
+//		Complex ComplextError `asn1:"tag:2"`
+//	}{})
+//
+// Unexported fields and fields with the tag "-" are ignored. Since the Go
+// type of a value selects its alternative when encoding, the fields must have
+// different types: alternatives of the same ASN.1 type, such as the strings of
+// a GeneralName, need types of their own (ie: "type DNSName string").
+func (ctx *Context) AddChoiceFromStruct(choice string, def interface{}) error {
+	t := reflect.TypeOf(def)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return syntaxError("invalid Go type '%v' for choice definition, expecting a struct", t)
+	}
+	var entries []Choice
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !isFieldExported(field) {
+			continue
+		}
+		opts, err := ctx.parseFieldOptions(t, i)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Choice{field.Type, field.Tag.Get(tagKey)})
+		names = append(names, componentIdentifier(field, opts))
+	}
+	if len(entries) == 0 {
+		return syntaxError("choice definition '%s' has no alternatives", t)
+	}
+	return ctx.addChoice(choice, entries, names)
+}
+
+// AddChoiceFunc registers a choice whose alternatives are given by define,
+// which is called the first time the choice is used instead of when it's
+// registered. Choices whose alternatives refer to themselves or to each
+// other, such as the Filter of LDAP, can then be registered in any order:
+//
+//	// Filter ::= CHOICE { and [0] SET OF Filter, not [2] Filter, ... }
+//	ctx.AddChoiceFunc("filter", func() ([]asn1.Choice, error) {
+//		return []asn1.Choice{
+//			{reflect.TypeOf(And{}), "tag:0,set,choices:filter"},
+//			{reflect.TypeOf(Not{}), "tag:2,explicit"},
+//			...
+//		}, nil
+//	})
+//
+// where And is a slice of interfaces and Not a struct with a field of option
+// "choice:filter". The alternatives are
+// checked as in AddChoice when define is called, and an error returned by
+// define or by the checks is returned by the method that used the choice.
+// The first use registers the alternatives, so it must not be concurrent with
+// other uses of ctx, unless the choice was used by CheckType or RegisterType
+// beforehand.
+func (ctx *Context) AddChoiceFunc(choice string, define func() ([]Choice, error)) error {
+	if define == nil {
+		return syntaxError("invalid nil definition for choice '%s'", choice)
+	}
+	if _, ok := ctx.lazyChoices[choice]; ok || ctx.choices[choice] != nil {
+		return syntaxError("choice already registered: %s", choice)
+	}
+	ctx.lazyChoices[choice] = define
+	return nil
+}
+
+// resolveChoice registers the alternatives of a choice added by
+// AddChoiceFunc. The choice is registered without alternatives while they are
+// checked, so they can refer to the choice.
+func (ctx *Context) resolveChoice(choice string, define func() ([]Choice, error)) error {
+	delete(ctx.lazyChoices, choice)
+	ctx.choices[choice] = []choiceEntry{}
+	entries, err := define()
+	if err == nil {
+		err = ctx.addChoice(choice, entries, nil)
+	}
+	if err != nil {
+		delete(ctx.choices, choice)
+		ctx.lazyChoices[choice] = define
+	}
+	return err
+}
+
+// addChoice registers a list of types as options to a given choice. names
+// optionally identifies each alternative.
+func (ctx *Context) addChoice(choice string, entries []Choice, names []string) error {
+	if _, ok := ctx.lazyChoices[choice]; ok {
+		return syntaxError("choice already registered: %s", choice)
+	}
+	for i, e := range entries {
+		opts, err := ctx.parseOptions(e.Options)
 		if err != nil {
 			return err
 		}
@@ -179,6 +474,14 @@ func (ctx *Context) AddChoice(choice string, entries []Choice) error {
 				"nested choices are not allowed: '%s' inside '%s'",
 				*opts.choice, choice)
 		}
+		name := ""
+		if names != nil {
+			name = names[i]
+		}
+		err = ctx.checkType(e.Type, opts, make(map[reflect.Type][]*fieldOptions))
+		if err != nil {
+			return err
+		}
 		raw := rawValue{}
 		elem, err := ctx.getExpectedElement(&raw, e.Type, opts)
 		if err != nil {
@@ -188,6 +491,7 @@ func (ctx *Context) AddChoice(choice string, entries []Choice) error {
 			expectedElement: elem,
 			typ:             e.Type,
 			opts:            opts,
+			name:            name,
 		})
 		if err != nil {
 			return err
@@ -196,6 +500,56 @@ func (ctx *Context) AddChoice(choice string, entries []Choice) error {
 	return nil
 }
 
+// AddElementType registers a type that can be used as an element of slices
+// of interfaces without the option "choices". The options define how values
+// of the type are encoded, usually with a tag that distinguishes it from the
+// other registered types:
+//
+//	type Payload struct {
+//		Items []interface{}
+//	}
+//	ctx.AddElementType(reflect.TypeOf(""), "tag:0")
+//	ctx.AddElementType(reflect.TypeOf(int(0)), "tag:1")
+//
+// The registered types are shared by all slices of interfaces of the Context.
+// Slices with the option "choices" use only the types of the given choice.
+func (ctx *Context) AddElementType(t reflect.Type, options string) error {
+	opts, err := ctx.parseOptions(options)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		return syntaxError("element type '%s' cannot be ignored", t)
+	}
+	if opts.choice != nil {
+		return syntaxError("element type '%s' cannot be a choice", t)
+	}
+	err = ctx.checkType(t, opts, make(map[reflect.Type][]*fieldOptions))
+	if err != nil {
+		return err
+	}
+	elem, err := ctx.getExpectedElement(&rawValue{}, t, opts)
+	if err != nil {
+		return err
+	}
+	for _, current := range ctx.elementTypes {
+		if current.typ == t {
+			return syntaxError("element type already registered: %s", t)
+		}
+		if current.any || elem.any ||
+			(current.class == elem.class && current.tag == elem.tag) {
+			return syntaxError("element type '%s' has the same tag of '%s'",
+				t, current.typ)
+		}
+	}
+	ctx.elementTypes = append(ctx.elementTypes, choiceEntry{
+		expectedElement: elem,
+		typ:             t,
+		opts:            opts,
+	})
+	return nil
+}
+
 // defaultLogger returns the default Logger. It's used to initialize a new context
 // or when the logger is set to nil.
 func defaultLogger() *log.Logger {
@@ -210,8 +564,158 @@ func (ctx *Context) SetLogger(logger *log.Logger) {
 	ctx.log = logger
 }
 
-// SetDer sets DER mode for encofing and decoding.
+// SetDer sets DER mode for encofing and decoding. It replaces the rules
+// selected by SetRules.
 func (ctx *Context) SetDer(encoding bool, decoding bool) {
 	ctx.der.encoding = encoding
 	ctx.der.decoding = decoding
+	ctx.rules = nil
+}
+
+// SetStrictOrder enables or disables the verification of the order of the
+// elements of a SEQUENCE during decoding.
+//
+// By default, elements that can't be matched to a struct field, such as
+// duplicated OPTIONAL elements or elements that appear out of order, are
+// silently ignored. When the strict order is enabled, a ParseError describing
+// the unexpected element is returned instead.
+func (ctx *Context) SetStrictOrder(strict bool) {
+	ctx.strictOrder = strict
+}
+
+// SetStrictFields enables or disables the strict handling of the struct
+// fields that are ignored because they are unexported.
+//
+// By default, unexported fields and embedded fields of unexported types are
+// silently ignored when encoding and decoding. When strict fields are enabled,
+// a SyntaxError is returned for an embedded field of an unexported type and
+// for an unexported field with an asn1 tag other than "-", since those are
+// usually mistakes. Unexported fields without tags are still ignored.
+func (ctx *Context) SetStrictFields(strict bool) {
+	ctx.strictFields = strict
+}
+
+// SetRejectDuplicates enables or disables the rejection of SETs containing
+// more than one element with the same tag when decoding a struct marked with
+// "set".
+//
+// By default, only the first of the duplicated elements is decoded. Since
+// different parsers may pick different elements, it's recommended to reject
+// such SETs when the decoded data is used for security decisions.
+func (ctx *Context) SetRejectDuplicates(reject bool) {
+	ctx.rejectDuplicates = reject
+}
+
+// SetPreserveSetOrder enables or disables the preservation of the order of
+// the elements of a SET OF in DER encoding.
+//
+// By default, the elements of a SET OF, given by a slice or array marked with
+// "set", are sorted by their encodings when encoding in DER, as DER requires.
+// So a decoded value is encoded again in the canonical order, even if the
+// original data was not. When the order is preserved, the elements are
+// encoded in the order of the slice, which allows data to be re-encoded
+// bit-exactly, such as signed attributes whose signature would be broken
+// otherwise.
+func (ctx *Context) SetPreserveSetOrder(preserve bool) {
+	ctx.preserveSetOrder = preserve
+}
+
+// SetNullAsAbsent enables or disables the decoding of a NULL as an absent
+// OPTIONAL field whose value is constructed, such as a SEQUENCE, for legacy
+// senders that encode missing values as NULL instead of omitting them.
+//
+// By default, such a NULL is not matched to the field, so it's ignored or
+// rejected as any other unexpected element. When enabled, the NULL is consumed
+// and the field is left empty, as if it was absent, and a warning is
+// reported.
+func (ctx *Context) SetNullAsAbsent(enabled bool) {
+	ctx.nullAsAbsent = enabled
+}
+
+// SetLengthOctets forces the lengths of the encoded elements to use the long
+// form with the given number of octets after the first length octet, as
+// required by some HSMs and legacy parsers (ie: 4 for lengths such as
+// 84 00 00 00 05). It can be overridden by the option "length-octets" of a
+// field. Lengths that don't fit cause an error and indefinite lengths are not
+// affected. Zero restores the minimum number of octets, which is the default
+// and the only form allowed by DER.
+func (ctx *Context) SetLengthOctets(octets int) {
+	ctx.lengthOctets = octets
+}
+
+// SetLongForm forces the lengths of the encoded elements to use the long form
+// with the minimum number of octets, even when the short form fits (ie:
+// 81 05 instead of 05), for vendor parsers that mishandle short lengths. It's
+// usually enabled by a compatibility profile and can be set for single fields
+// with the option "longform". SetLengthOctets takes precedence when both are
+// used. DER doesn't allow this form.
+func (ctx *Context) SetLongForm(longForm bool) {
+	ctx.longForm = longForm
+}
+
+// defaultLengthOctets returns the number of length octets of the encoded
+// elements that have no option changing it.
+func (ctx *Context) defaultLengthOctets() int {
+	if ctx.lengthOctets == 0 && ctx.longForm {
+		return longFormOctets
+	}
+	return ctx.lengthOctets
+}
+
+// SetMaxLengthOctets limits the number of octets of the lengths in the long
+// form accepted when decoding, not counting the first length octet. A
+// ParseError is returned for longer lengths before their content is read.
+// Zero, the default, doesn't limit the number of octets, although lengths
+// greater than the remaining data are still rejected before the content is
+// allocated.
+func (ctx *Context) SetMaxLengthOctets(octets int) {
+	ctx.maxLengthOctets = octets
+}
+
+// DefaultMaxTagNumber is the greatest tag number accepted when decoding,
+// unless another limit is set by (*Context).SetMaxTagNumber.
+const DefaultMaxTagNumber = 1<<31 - 1
+
+// SetMaxTagNumber sets the greatest tag number accepted when decoding, which
+// is DefaultMaxTagNumber by default. A ParseError is returned for elements
+// with greater tag numbers before their content is read. Specifications
+// rarely use tag numbers above a few hundreds, so a lower limit makes absurd
+// tags found in malformed data easier to identify. Zero restores the default.
+func (ctx *Context) SetMaxTagNumber(max uint) {
+	ctx.maxTagNumber = max
+}
+
+// getMaxTagNumber returns the greatest tag number accepted when decoding.
+func (ctx *Context) getMaxTagNumber() uint {
+	if ctx.maxTagNumber == 0 {
+		return DefaultMaxTagNumber
+	}
+	return ctx.maxTagNumber
+}
+
+// SetAudit enables or disables the audit of encodings.
+//
+// When the audit is enabled, each value encoded by EncodeWithOptions is
+// decoded using DER and encoded again. An AuditError is returned if both
+// encodings differ, which indicates that the value could not be encoded in a
+// canonical form. It doubles the cost of encoding, so it's intended for tests
+// and continuous integration of services that produce signed data.
+func (ctx *Context) SetAudit(audit bool) {
+	ctx.audit = audit
+}
+
+// SetValidation enables or disables the calls to the Validate and AfterDecode
+// methods of decoded values, which are enabled by default. See Validator and
+// AfterDecoder.
+func (ctx *Context) SetValidation(enabled bool) {
+	ctx.skipValidation = !enabled
+}
+
+// SetWarningHandler defines a function called for each non-fatal anomaly
+// found during decoding, such as lengths that are not encoded in the minimum
+// number of octets, elements that are skipped or fields present with their
+// default value. The decoding continues after the handler returns. A nil
+// handler disables the warnings, which is the default.
+func (ctx *Context) SetWarningHandler(handler func(Warning)) {
+	ctx.warningHandler = handler
 }
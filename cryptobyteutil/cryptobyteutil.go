@@ -0,0 +1,59 @@
+// Package cryptobyteutil provides adapters between the asn1 package and
+// golang.org/x/crypto/cryptobyte, so both can be used to parse and build
+// different parts of the same message.
+package cryptobyteutil
+
+import (
+	"github.com/pipistrellka/asn1"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// ReadValue decodes the element at the beginning of s into obj using ctx and
+// the given options, as (*asn1.Context).DecodeWithOptions does, and advances s
+// past the element. s is left untouched if an error is returned.
+func ReadValue(s *cryptobyte.String, ctx *asn1.Context, obj interface{}, options string) error {
+	rest, err := ctx.DecodeWithOptions(*s, obj, options)
+	if err != nil {
+		return err
+	}
+	*s = rest
+	return nil
+}
+
+// ReadElement reads the complete element at the beginning of s, including its
+// header, and advances s past the element. Unlike
+// (*cryptobyte.String).ReadAnyASN1Element, BER encodings with the indefinite
+// length form are accepted.
+func ReadElement(s *cryptobyte.String, out *cryptobyte.String) error {
+	rest, err := asn1.SkipValue(*s)
+	if err != nil {
+		return err
+	}
+	n := len(*s) - len(rest)
+	*out = (*s)[:n]
+	*s = rest
+	return nil
+}
+
+// AddValue encodes obj using ctx and the given options, as
+// (*asn1.Context).EncodeWithOptions does, and appends the result to b. Errors
+// are reported by (*cryptobyte.Builder).Bytes.
+func AddValue(b *cryptobyte.Builder, ctx *asn1.Context, obj interface{}, options string) {
+	b.AddValue(value{ctx, obj, options})
+}
+
+// value implements cryptobyte.MarshalingValue for an encodable object.
+type value struct {
+	ctx     *asn1.Context
+	obj     interface{}
+	options string
+}
+
+func (v value) Marshal(b *cryptobyte.Builder) error {
+	data, err := v.ctx.EncodeWithOptions(v.obj, v.options)
+	if err != nil {
+		return err
+	}
+	b.AddBytes(data)
+	return nil
+}
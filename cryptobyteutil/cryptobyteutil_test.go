@@ -0,0 +1,78 @@
+package cryptobyteutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pipistrellka/asn1"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+type message struct {
+	Version int
+	Name    string
+}
+
+func TestMixed(t *testing.T) {
+	ctx := asn1.NewContext()
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(7)
+		AddValue(b, ctx, message{1, "abc"}, "tag:0")
+		AddValue(b, ctx, true, "")
+	})
+	data, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := cryptobyte.String(data)
+	var seq cryptobyte.String
+	if !s.ReadASN1(&seq, cbasn1.SEQUENCE) || !s.Empty() {
+		t.Fatal("failed to read SEQUENCE")
+	}
+	var n int64
+	if !seq.ReadASN1Integer(&n) || n != 7 {
+		t.Fatalf("invalid integer: %d", n)
+	}
+	var m message
+	if err := ReadValue(&seq, ctx, &m, "tag:0"); err != nil {
+		t.Fatal(err)
+	}
+	if m != (message{1, "abc"}) {
+		t.Fatalf("invalid message: %+v", m)
+	}
+	var elem cryptobyte.String
+	if err := ReadElement(&seq, &elem); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(elem, []byte{0x01, 0x01, 0xff}) || !seq.Empty() {
+		t.Fatalf("invalid element: %x", []byte(elem))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := asn1.NewContext()
+
+	var b cryptobyte.Builder
+	AddValue(&b, ctx, make(chan int), "")
+	if _, err := b.Bytes(); err == nil {
+		t.Fatal("expected encoding error")
+	}
+
+	s := cryptobyte.String([]byte{0x02, 0x01, 0x01})
+	var str string
+	if err := ReadValue(&s, ctx, &str, ""); err == nil {
+		t.Fatal("expected decoding error")
+	}
+	if len(s) != 3 {
+		t.Fatal("string was advanced after an error")
+	}
+	s = cryptobyte.String([]byte{0x30, 0x80, 0x02, 0x01})
+	var elem cryptobyte.String
+	if err := ReadElement(&s, &elem); err == nil {
+		t.Fatal("expected error for truncated element")
+	}
+}
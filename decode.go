@@ -13,6 +13,44 @@ type expectedElement struct {
 	class   uint
 	tag     uint
 	decoder decoderFunction
+	// any indicates that elements of any class and tag are accepted.
+	any bool
+	// full indicates that the decoder receives the complete encoding of the
+	// element instead of only its content.
+	full bool
+	// alternatives are other tags of the same class that are accepted, as by
+	// the untagged choice of asn1.Time.
+	alternatives []uint
+}
+
+// matches checks if raw has the expected class and tag.
+func (elem expectedElement) matches(raw *rawValue) bool {
+	return elem.any || (raw.Class == elem.class && elem.hasTag(raw.Tag))
+}
+
+// hasTag checks if tag is the expected tag or one of its alternatives.
+func (elem expectedElement) hasTag(tag uint) bool {
+	if tag == elem.tag {
+		return true
+	}
+	for _, alternative := range elem.alternatives {
+		if tag == alternative {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRaw calls the element decoder with the data of raw.
+func (elem expectedElement) decodeRaw(raw *rawValue, value reflect.Value) error {
+	if !elem.full {
+		return elem.decoder(raw.Content, value)
+	}
+	data, err := raw.encode()
+	if err != nil {
+		return err
+	}
+	return elem.decoder(data, value)
 }
 
 // Expected values for fields
@@ -20,6 +58,10 @@ type expectedFieldElement struct {
 	expectedElement
 	value reflect.Value
 	opts  *fieldOptions
+	name  string
+	// missingGroup sets the fields of a group to their default values when
+	// the group is not present. It's nil for other elements.
+	missingGroup func() error
 }
 
 // Decode parses the given data into obj. The argument obj should be a reference
@@ -37,6 +79,11 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 //
 // It uses the reflect package to inspect obj and because of that only exported
 // struct fields (those that start with a capital letter) are considered.
+// Unexported fields are ignored, as well as embedded fields of unexported
+// types, unless the Context has strict fields (see SetStrictFields). Embedded
+// fields of exported types, either structs or not, are regular components
+// named after their types: their fields are not promoted to the enclosing
+// struct.
 //
 // The Context object defines the decoding rules (BER or DER) and the types
 // available for CHOICE types.
@@ -50,13 +97,56 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 //	bool                   | BOOLEAN
 //	All int and uint types | INTEGER
 //	*big.Int               | INTEGER
+//	asn1.Number            | INTEGER
+//	float32 and float64    | REAL
 //	string                 | OCTET STRING
 //	[]byte                 | OCTET STRING
+//	io.Reader              | OCTET STRING
+//	io.WriterTo            | OCTET STRING (encoding only)
+//	io.Writer              | OCTET STRING (decoding only)
 //	asn1.Oid               | OBJECT INDETIFIER
 //	asn1.Null              | NULL
+//	asn1.UTCTime           | UTCTime
+//	asn1.GeneralizedTime   | GeneralizedTime
+//	asn1.Time              | UTCTime or GeneralizedTime
+//	asn1.ISOTime           | TIME
 //	Any array or slice     | SEQUENCE OF
 //	Any struct             | SEQUENCE
 //
+// The types ObjectIdentifier, BitString, Enumerated and RawValue from the
+// standard library encoding/asn1 package are also supported, which allows
+// mixing structs written for both packages. Similarly to the standard library,
+// a RawValue accepts an element of any tag when decoding and its FullBytes, if
+// set, are used verbatim when encoding. Slice types that implement SetOf are
+// mapped to SET OF, so they can be used as elements of other slices.
+//
+// Interface types are only mapped when used as the static type of a struct
+// field or of the decoded value. The value of an io.Reader or io.WriterTo is
+// read only when the encoding is written, as by EncodeHash, through its
+// WriteTo method if it has one. When it implements io.Seeker, such as an
+// *os.File, its content goes from its current position to its end and its
+// position is restored afterwards, so the same value can be encoded again.
+// Otherwise its length is unknown, so it's encoded as a constructed OCTET
+// STRING with the indefinite length form and segments of 1000 octets, as in
+// CER, which is not allowed in DER. Such a value is consumed as it's written,
+// so it can be encoded only once.
+//
+// Decoding is not streamed: the whole encoding is read before the value is
+// decoded. Decoding into an io.Reader sets a reader for the decoded content,
+// which is not copied. When decoding into an io.Writer, the writer must be
+// already set and the decoded content is written to it. Both accept the
+// primitive and the constructed forms.
+//
+// Pointers are mapped using the type they point to. When decoding, a new
+// value is allocated to hold the decoded data. When encoding, nil pointers are
+// absent values, which are only accepted for "optional" elements, so types can
+// refer to themselves through pointers or slices. Encoding a value that
+// contains itself returns a SyntaxError.
+//
+// After a value of a type implementing Validator or AfterDecoder is decoded,
+// their methods are called and an error returned by them stops the decoding.
+// The calls can be disabled with (*Context).SetValidation.
+//
 // Arrays and slices are decoded using different rules. A slice is always
 // appended while an array requires an exact number of elements, otherwise a
 // ParseError is returned.
@@ -65,6 +155,13 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 // options (for the root value) or via struct tags for struct fields. Struct
 // tags use the namei space "asn1".
 //
+// Every option accepted by struct tags can also be given for the root value,
+// including tags of any class. For example, a Kerberos AS-REQ, defined as
+// [APPLICATION 10] EXPLICIT KDC-REQ, is encoded and decoded with the options
+// "application,tag:10,explicit" (or "tag:a10,explicit"). When decoding, empty
+// data is accepted for a root value marked as "optional" or "default", which
+// is then handled as a missing element.
+//
 // The available options for encoding and decoding are:
 //
 //	tag
@@ -72,7 +169,10 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 // This option requires an numeric argument (ie: "tag:1") and indicates that a
 // element is encoded and decoded as a context specific element with the given
 // tag number. The context specific class can be overridden with the options
-// "application" or "universal".
+// "application", "universal" or "private", or with a class prefix in the
+// argument, written as in specifications or abbreviated to its first letter:
+// "tag:APPLICATION 5", "tag:[APPLICATION 5]" and "tag:a5" are equivalent to
+// "application,tag:5", and "tag:p17" is equivalent to "private,tag:17".
 //
 //	universal
 //
@@ -82,11 +182,21 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 //
 // Sets the tag class to application. Requires "tag".
 //
+//	private
+//
+// Sets the tag class to private. Requires "tag".
+//
 //	explicit
 //
 // Indicates the element is encoded with an enclosing tag. It's usually
 // used in conjunction with "tag".
 //
+//	implicit
+//
+// Indicates the tag replaces the tag of the element, which is the default. It
+// only documents the intent, as the IMPLICIT keyword of specifications, and
+// can't be used with "explicit".
+//
 //	optional
 //
 // Indicates that an element can be suppressed.
@@ -101,7 +211,8 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 //	default
 //
 // This option is handled similarly to the "optional" option but requires a
-// numeric argument (ie: "default:1").
+// numeric argument (ie: "default:1"). It can't be used with "optional", which
+// it implies.
 //
 // A missing element that is marked with "default" is set to the given default
 // value during decoding.
@@ -115,6 +226,21 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 // This option is used only during encoding and causes a constructed element to
 // be encoded using the indefinite form.
 //
+//	length-octets
+//
+// This option is used only during encoding and requires the number of octets
+// of the length of the element in the long form, not counting the first one
+// (ie: "length-octets:4" encodes a length of 5 as 84 00 00 00 05). It
+// overrides (*Context).SetLengthOctets for the element, but not for its
+// content.
+//
+//	longform
+//
+// This option is used only during encoding and writes the length of the
+// element in the long form with the minimum number of octets, even if the
+// short form fits (ie: 81 05 instead of 05). It overrides
+// (*Context).SetLongForm for the element, but not for its content.
+//
 //	choice
 //
 // Indicates that an element can be of one of several types as defined by
@@ -133,9 +259,160 @@ func (ctx *Context) Decode(data []byte, obj interface{}) (rest []byte, err error
 // Similarly, a struct marked with "set" always enforces that same order when
 // decoding in DER.
 //
+// The elements of an array or slice marked with "set" are sorted by their
+// encodings when encoding in DER, unless (*Context).SetPreserveSetOrder is
+// used.
+//
+//	tag2, explicit2
+//
+// Encloses the element, with all the other options applied, in a second
+// explicit context specific tag (ie: "tag:1,explicit,tag2:3,explicit2"
+// encodes [3] EXPLICIT [1] EXPLICIT). It avoids declaring a wrapper struct
+// for values enclosed in two tags. Both options must be used together.
+//
+//	constraint
+//
+// Requires the name of a constraint registered with (*Context).AddConstraint
+// (ie: "constraint:hex"). The value is checked against the constraint after
+// it's decoded and before it's encoded. The option can be repeated to apply
+// several constraints. Constraints registered with
+// (*Context).AddTypeConstraint are applied to every value of the given type.
+//
+//	extensible
+//
+// Indicates that values of an ENUMERATED type not registered with
+// (*Context).AddEnum are accepted, as in an ENUMERATED type with an extension
+// marker.
+//
+//	alphabet
+//
+// Requires the permitted characters of a string (ie: "alphabet:0-9A-F"),
+// given as single characters and ranges. A '-' is taken literally when it's
+// the first or last character. The option can be used with string and []byte
+// values and it's checked during encoding and decoding.
+//
+//	compress
+//
+// Requires the name of a codec (ie: "compress:gzip") that transforms the
+// content of an OCTET STRING when it's encoded and restores it when it's
+// decoded. The codec "gzip" is available by default and others can be
+// registered with (*Context).AddCodec. The length of the restored content is
+// limited by (*Context).SetMaxCodecLength and the memory budget.
+//
+//	encrypt
+//
+// Encrypts the encoding of the value with the FieldCipher set by
+// (*Context).SetFieldCipher and encodes the ciphertext as an OCTET STRING
+// with the tag options of the field. An optional argument identifies the key
+// (ie: "encrypt:k1"). The ciphertext is decrypted and decoded when decoding.
+//
+//	timelayout
+//
+// Requires a layout of the time package (ie: "timelayout:20060102150405")
+// used to encode and decode a time.Time as a string, for timestamps of vendor
+// formats. The string is a GeneralizedTime unless the tag is given by other
+// options, such as "universal,tag:4" for an OCTET STRING. The layout can't
+// contain commas. Strings that don't match the layout are rejected when
+// decoding, and values that the layout can't represent when encoding.
+//
+//	sensitive
+//
+// Marks a field holding sensitive data, such as keys and subscriber
+// identities. It's encoded and decoded normally, but its content is masked
+// by (*Context).Dump and errors found in it don't include its content.
+//
+//	absent
+//
+// Marks a field that must never be present, such as a deprecated field that a
+// profile forbids (ie: "tag:1,absent" for an issuerUniqueID that must be
+// absent). The field is never encoded, whatever its value, and an element
+// that matches it is rejected when decoding.
+//
+//	version-field, minver, maxver
+//
+// Gate fields by the version of the message. "version-field" marks the
+// integer field of the struct that holds the version, and "minver" and
+// "maxver" give the first and the last versions in which a field is valid
+// (ie: "minver:2").
+// Fields that are not valid in the version of the value are not encoded, and
+// a ParseError is returned when decoding if they are present.
+//
+//	requires, excludes
+//
+// Require the name of another field of the struct (ie: "requires:Version")
+// that must be present, or absent with "excludes", when the field is present,
+// for fields whose presence depends on each other, such as extensions that
+// only exist in a version of a protocol. When encoding, a field is present
+// when its value is not empty, and when decoding, when its element was found.
+// The rules are verified before encoding and after decoding a struct, and
+// each option can be given several times.
+//
+//	compute
+//
+// Requires the name of a method of the struct (ie: "compute:Checksum") that
+// returns the value of the field when the struct is encoded, with the
+// signature "func() T" or "func() (T, error)", where T is assignable to the
+// field type. It's meant for values derived from other fields, such as
+// lengths, checksums and counters, which are not kept in the field. The
+// option is ignored when decoding.
+//
+//	name
+//
+// Requires an ASN.1 identifier (ie: "name:serial-number") used for the
+// component in the value notation and by (*Context).Describe, instead of the
+// identifier derived from the name of the field, which is the name with its
+// first letter in lower case. It's similar to the names of json tags and
+// allows identifiers that Go names can't hold, such as the ones with hyphens.
+//
+//	group
+//
+// Requires a name (ie: "group:extra") and encodes the adjacent fields with the
+// same group in a nested SEQUENCE, which is OPTIONAL and omitted when none of
+// its fields is encoded, such as when all of them are optional and empty:
+//
+//	type Request struct {
+//		ID       int
+//		Priority int    `asn1:"optional,group:extra"`
+//		Comment  string `asn1:"optional,group:extra"`
+//	}
+//
+// corresponds to the type Request ::= SEQUENCE { id INTEGER, extra SEQUENCE {
+// priority INTEGER OPTIONAL, comment OCTET STRING OPTIONAL } OPTIONAL }
+// without a Go type for the nested SEQUENCE. When the group is absent, its
+// fields with the option "default" are set to their default values.
+//
+//	per-constrained, per-extensible
+//
+// Declare the PER-visible constraint of a field (ie: "per-constrained:0..255"
+// or "per-constrained:1..MAX,per-extensible"): the value range of an integer
+// or the size range of a string, byte slice or list, with MIN and MAX for
+// unbounded limits. "per-extensible" marks the constraint with an extension
+// marker. They are kept for the Packed Encoding Rules and shown by
+// (*Context).Describe, but don't change BER and DER encodings.
+//
+// Contradictory options, such as two tag classes, "implicit" with "explicit"
+// or "choice" with "set", cause a SyntaxError, as well as options that don't
+// apply to the type of the element.
+//
+// The names of the options are case insensitive, and "opt", "app", "priv" and
+// "ext" are accepted as short names for "optional", "application", "private"
+// and "extensible". The error returned for an unknown option suggests the
+// closest option when it looks like a typo.
+//
+// Additional options can be defined with (*Context).AddOption.
+//
 func (ctx *Context) DecodeWithOptions(data []byte, obj interface{}, options string) (rest []byte, err error) {
+	if ctx.rules != nil {
+		return ctx.decodeWithRules(data, obj, options)
+	}
+	if ctx.memory == nil && (ctx.memoryBudget > 0 || ctx.metricsHandler != nil) {
+		return ctx.decodeAccounted(data, obj, options)
+	}
+	if ctx.collectErrors && ctx.collector == nil {
+		return ctx.decodeCollecting(data, obj, options)
+	}
 
-	opts, err := parseOptions(options)
+	opts, err := ctx.parseOptions(options)
 	if err != nil {
 		return nil, err
 	}
@@ -154,6 +431,14 @@ func (ctx *Context) DecodeWithOptions(data []byte, obj interface{}, options stri
 		return nil, syntaxError("go type '%s' is read-only", value.Type())
 	}
 
+	// An absent root value is handled as a missing field
+	if len(data) == 0 && (opts.optional || opts.defaultValue != nil) {
+		if opts.defaultValue != nil {
+			err = ctx.setDefaultValue(value, opts)
+		}
+		return data, err
+	}
+
 	reader := bytes.NewBuffer(data)
 	err = ctx.decode(reader, value, opts)
 	if err != nil {
@@ -167,7 +452,7 @@ func (ctx *Context) DecodeWithOptions(data []byte, obj interface{}, options stri
 func (ctx *Context) decode(reader io.Reader, value reflect.Value, opts *fieldOptions) error {
 
 	// Parse an Asn.1 element
-	raw, err := decodeRawValue(reader)
+	raw, err := ctx.readRawValue(reader)
 	if err != nil {
 		return err
 	}
@@ -181,13 +466,13 @@ func (ctx *Context) decode(reader io.Reader, value reflect.Value, opts *fieldOpt
 	}
 
 	// And tag must match
-	if raw.Class != elem.class || raw.Tag != elem.tag {
+	if !elem.matches(raw) {
 		ctx.log.Printf("%#v\n", opts)
 		return parseError("expected tag (%d,%d) but found (%d,%d)",
 			elem.class, elem.tag, raw.Class, raw.Tag)
 	}
 
-	return elem.decoder(raw.Content, value)
+	return ctx.decodeElement(elem, raw, value, "")
 }
 
 // getExpectedElement returns the expected element for a given type. raw is only
@@ -195,38 +480,53 @@ func (ctx *Context) decode(reader io.Reader, value reflect.Value, opts *fieldOpt
 // TODO: consider replacing raw for class and tag number.
 func (ctx *Context) getExpectedElement(raw *rawValue, elemType reflect.Type, opts *fieldOptions) (elem expectedElement, err error) {
 
+	// The second tag encloses the element with all the other options
+	if opts.tag2 != nil {
+		inner := *opts
+		inner.tag2 = nil
+		inner.explicit2 = false
+		elem = expectedElement{class: ClassContextSpecific, tag: uint(*opts.tag2)}
+		return ctx.getExplicitElement(elem, &inner), nil
+	}
+
 	// Get the expected universal tag and its decoder for the given Go type
-	elem, err = ctx.getUniversalTag(elemType, opts)
+	if opts.encrypt != nil {
+		elem, err = ctx.getEncryptedElement(opts)
+	} else {
+		elem, err = ctx.getUniversalTag(elemType, opts)
+	}
 	if err != nil {
 		return
 	}
 
 	// Modify the expected tag and decoder function based on the given options
 	if opts.tag != nil {
-		elem.class = classContextSpecific
+		if elem.alternatives != nil && !opts.explicit {
+			err = syntaxError("Go type '%s' is a CHOICE and its tag must be explicit", elemType)
+			return
+		}
+		elem.class = opts.tagClass()
 		elem.tag = uint(*opts.tag)
-	}
-	if opts.universal {
-		elem.class = classUniversal
-	}
-	if opts.application {
-		elem.class = classApplication
+		elem.any = false
 	}
 
 	if opts.explicit {
-		elem.decoder = func(data []byte, value reflect.Value) error {
-			// Unset previous flags
-			opts.explicit = false
-			opts.tag = nil
-			opts.application = false
-			// Parse child
-			reader := bytes.NewBuffer(data)
-			return ctx.decode(reader, value, opts)
+		if opts.tag == nil {
+			err = syntaxError(
+				"invalid flag 'explicit' without tag on Go type '%s'", elemType)
+			return
 		}
-		return
+		// The inner element uses the same options without the enclosing tag
+		inner := *opts
+		inner.explicit = false
+		inner.tag = nil
+		inner.universal = false
+		inner.application = false
+		inner.private = false
+		return ctx.getExplicitElement(elem, &inner), nil
 	}
 
-	if opts.choice != nil {
+	if opts.choice != nil && opts.encrypt == nil {
 		// Get the registered choices
 		var entry choiceEntry
 		entry, err = ctx.getChoiceByTag(*opts.choice, raw.Class, raw.Tag)
@@ -236,10 +536,17 @@ func (ctx *Context) getExpectedElement(raw *rawValue, elemType reflect.Type, opt
 
 		// Get the decoder for the new value
 		elem.class, elem.tag = raw.Class, raw.Tag
+		elem.any, elem.full, elem.alternatives = false, entry.full, nil
 		elem.decoder = func(data []byte, value reflect.Value) error {
 			// Allocate a new value and set to the current one
 			nestedValue := reflect.New(entry.typ).Elem()
-			err = entry.decoder(data, nestedValue)
+			// The decoder of the entry is bound to the Context where the
+			// choice was added, so it's resolved again with the current one
+			nested, err := ctx.getExpectedElement(raw, entry.typ, entry.opts)
+			if err != nil {
+				return err
+			}
+			err = nested.decoder(data, nestedValue)
 			if err != nil {
 				return err
 			}
@@ -251,47 +558,159 @@ func (ctx *Context) getExpectedElement(raw *rawValue, elemType reflect.Type, opt
 	// At this point a decoder function already be found
 	if elem.decoder == nil {
 		err = parseError("go type not supported '%s'", elemType)
+		return
+	}
+	if opts.encrypt != nil {
+		// The options are applied to the decrypted value
+		return
 	}
+	elem.decoder, err = ctx.codecDecoder(elem.decoder, opts)
+	if err != nil {
+		return
+	}
+	elem.decoder = ctx.constrainedDecoder(elem.decoder, opts)
 	return
 }
 
+// getExplicitElement returns an element that decodes the content of an
+// explicit tag as a complete element using the options inner. elem has the
+// class and tag of the enclosing element.
+func (ctx *Context) getExplicitElement(elem expectedElement, inner *fieldOptions) expectedElement {
+	elem.any, elem.full, elem.alternatives = false, false, nil
+	elem.decoder = func(data []byte, value reflect.Value) error {
+		reader := bytes.NewBuffer(data)
+		if err := ctx.decode(reader, value, inner); err != nil {
+			return err
+		}
+		if reader.Len() > 0 {
+			return parseError("trailing data inside explicit tag %s",
+				TagString(elem.class, elem.tag))
+		}
+		return nil
+	}
+	return elem
+}
+
 // getUniversalTag maps an type to a Asn.1 universal type.
 func (ctx *Context) getUniversalTag(objType reflect.Type, opts *fieldOptions) (elem expectedElement, err error) {
 
-	elem.class = classUniversal
+	elem.class = ClassUniversal
 
 	// Special types:
 	switch objType {
 	case bigIntType:
-		elem.tag = tagInteger
+		elem.tag = TagInteger
 		elem.decoder = ctx.decodeBigInt
 	case bitStringType:
-		elem.tag = tagBitString
+		elem.tag = TagBitString
 		elem.decoder = ctx.decodeBitString
 	case oidType:
-		elem.tag = tagOid
+		elem.tag = TagOid
 		elem.decoder = ctx.decodeOid
+	case bigOidType:
+		elem.tag = TagOid
+		elem.decoder = ctx.decodeBigOid
 	case nullType:
-		elem.tag = tagNull
+		elem.tag = TagNull
 		elem.decoder = ctx.decodeNull
 	case enumType:
-		elem.tag = tagEnum
+		elem.tag = TagEnum
 		elem.decoder = ctx.decodeInt
 	case utcTimeType:
-		elem.tag = tagUtcTime
+		elem.tag = TagUtcTime
 		elem.decoder = ctx.decodeUTCTime
+	case isoTimeType:
+		elem.tag = TagTime
+		elem.decoder = ctx.decodeISOTime
+	case generalizedTimeType:
+		elem.tag = TagGeneralizedTime
+		elem.decoder = ctx.decodeGeneralizedTime
+	case goTimeType:
+		if opts.timeLayout != nil {
+			elem.tag = TagGeneralizedTime
+			elem.decoder = ctx.layoutTimeDecoder(*opts.timeLayout)
+			break
+		}
+		elem.tag = TagUtcTime
+		elem.alternatives = []uint{TagGeneralizedTime}
+		elem.full = true
+		elem.decoder = ctx.decodeTime
+	case timeType:
+		elem.tag = TagUtcTime
+		elem.alternatives = []uint{TagGeneralizedTime}
+		elem.full = true
+		elem.decoder = ctx.decodeTime
+	case readerType:
+		elem.tag = TagOctetString
+		elem.full = true
+		elem.decoder = ctx.decodeReader
+	case writerType:
+		elem.tag = TagOctetString
+		elem.full = true
+		elem.decoder = ctx.decodeWriter
+	case rawValueType:
+		elem.any, elem.full = true, true
+		elem.decoder = ctx.decodeRawElement
+	case stdRawValueType:
+		elem.any, elem.full = true, true
+		elem.decoder = ctx.decodeStdRawValue
+	case stdOidType:
+		elem.tag = TagOid
+		elem.decoder = ctx.decodeStdOid
+	case stdBitStringType:
+		elem.tag = TagBitString
+		elem.decoder = ctx.decodeStdBitString
+	case stdEnumType:
+		elem.tag = TagEnum
+		elem.decoder = ctx.decodeInt
 	default:
+		if objType.Kind() == reflect.Ptr {
+			return ctx.getUniversalTagOfPtr(objType, opts)
+		}
+		if isNumberType(objType) {
+			elem.tag = TagInteger
+			elem.decoder = ctx.decodeNumber
+			break
+		}
 		// Generic types:
 		elem = ctx.getUniversalTagByKind(objType, opts)
+		if elem.tag == TagInteger && ctx.enumNames[objType] != nil {
+			elem.tag = TagEnum
+		}
+		if elem.tag == TagSequence && isSetOfMarked(objType) {
+			elem.tag = TagSet
+		}
 	}
 
 	// Check options for universal types
 	if opts.set {
-		if elem.tag != tagSequence {
+		if elem.tag != TagSequence && elem.tag != TagSet {
 			err = syntaxError(
 				"'set' cannot be used with Go type '%s'", objType)
 		}
-		elem.tag = tagSet
+		elem.tag = TagSet
+	}
+	if elem.decoder != nil && hasDecodeHooks(objType) {
+		elem.decoder = ctx.validatingDecoder(elem.decoder)
+	}
+	return
+}
+
+// getUniversalTagOfPtr uses the type pointed by objType to define the
+// decoder. The decoded value is stored in a newly allocated value.
+func (ctx *Context) getUniversalTagOfPtr(objType reflect.Type, opts *fieldOptions) (elem expectedElement, err error) {
+	elem, err = ctx.getUniversalTag(objType.Elem(), opts)
+	if err != nil || elem.decoder == nil {
+		return
+	}
+	decoder := elem.decoder
+	elem.decoder = func(data []byte, value reflect.Value) error {
+		ptr := reflect.New(objType.Elem())
+		if err := decoder(data, ptr.Elem()); err != nil {
+			return err
+		}
+		value.Set(ptr)
+		return nil
 	}
 	return
 }
@@ -301,23 +720,27 @@ func (ctx *Context) getUniversalTagByKind(objType reflect.Type, opts *fieldOptio
 
 	switch objType.Kind() {
 	case reflect.Bool:
-		elem.tag = tagBoolean
+		elem.tag = TagBoolean
 		elem.decoder = ctx.decodeBool
 
 	case reflect.String:
-		elem.tag = tagOctetString
+		elem.tag = TagOctetString
 		elem.decoder = ctx.decodeString
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		elem.tag = tagInteger
+		elem.tag = TagInteger
 		elem.decoder = ctx.decodeInt
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		elem.tag = tagInteger
+		elem.tag = TagInteger
 		elem.decoder = ctx.decodeUint
 
+	case reflect.Float32, reflect.Float64:
+		elem.tag = TagReal
+		elem.decoder = ctx.decodeReal
+
 	case reflect.Struct:
-		elem.tag = tagSequence
+		elem.tag = TagSequence
 		elem.decoder = ctx.decodeStruct
 		if opts.set {
 			elem.decoder = ctx.decodeStructAsSet
@@ -325,23 +748,27 @@ func (ctx *Context) getUniversalTagByKind(objType reflect.Type, opts *fieldOptio
 
 	case reflect.Array:
 		if objType.Elem().Kind() == reflect.Uint8 {
-			elem.tag = tagOctetString
+			elem.tag = TagOctetString
 			elem.decoder = ctx.decodeOctetString
 		} else {
-			elem.tag = tagSequence
+			elem.tag = TagSequence
 			elem.decoder = ctx.decodeArray
 		}
 
 	case reflect.Slice:
 		switch objType.Elem().Kind() {
 		case reflect.Uint8:
-			elem.tag = tagOctetString
+			elem.tag = TagOctetString
 			elem.decoder = ctx.decodeOctetString
 		case reflect.Interface:
-			elem.tag = tagSequence
-			elem.decoder = ctx.decodeChoices(*opts.choices)
+			elem.tag = TagSequence
+			if opts.choices != nil {
+				elem.decoder = ctx.decodeChoices(*opts.choices)
+			} else if len(ctx.elementTypes) > 0 {
+				elem.decoder = ctx.decodeElementTypes
+			}
 		default:
-			elem.tag = tagSequence
+			elem.tag = TagSequence
 			elem.decoder = ctx.decodeSlice
 		}
 	}
@@ -349,13 +776,22 @@ func (ctx *Context) getUniversalTagByKind(objType reflect.Type, opts *fieldOptio
 }
 
 //
-func (ctx *Context) getExpectedFieldElements(value reflect.Value) ([]expectedFieldElement, error) {
+func (ctx *Context) getExpectedFieldElements(value reflect.Value, present map[string]bool) ([]expectedFieldElement, error) {
+	return ctx.getExpectedFieldRange(value, 0, value.NumField(), true, present)
+}
+
+// getExpectedFieldRange returns the expected elements of the fields of a
+// struct value from start to end. If grouping is set, the fields of each group
+// are expected in a nested SEQUENCE. The names of the fields found when
+// decoding are added to present.
+func (ctx *Context) getExpectedFieldRange(value reflect.Value, start, end int, grouping bool, present map[string]bool) ([]expectedFieldElement, error) {
 	expectedValues := []expectedFieldElement{}
-	for i := 0; i < value.NumField(); i++ {
+	for i := start; i < end; i++ {
 		if value.CanSet() {
 			// Get field and options
 			field := value.Field(i)
-			opts, err := parseOptions(value.Type().Field(i).Tag.Get(tagKey))
+			name := value.Type().Field(i).Name
+			opts, err := ctx.getFieldOptions(value.Type(), i)
 			if err != nil {
 				return nil, err
 			}
@@ -363,6 +799,15 @@ func (ctx *Context) getExpectedFieldElements(value reflect.Value) ([]expectedFie
 			if opts == nil {
 				continue
 			}
+			if opts.group != nil && grouping {
+				groupEnd, err := ctx.getGroupEnd(value.Type(), i, *opts.group)
+				if err != nil {
+					return nil, err
+				}
+				expectedValues = append(expectedValues, ctx.getExpectedGroup(value, i, groupEnd, *opts.group, present))
+				i = groupEnd - 1
+				continue
+			}
 			// Expand choices
 			raw := &rawValue{}
 			if opts.choice == nil {
@@ -371,7 +816,7 @@ func (ctx *Context) getExpectedFieldElements(value reflect.Value) ([]expectedFie
 					return nil, err
 				}
 				expectedValues = append(expectedValues,
-					expectedFieldElement{elem, field, opts})
+					expectedFieldElement{elem, field, opts, name, nil})
 			} else {
 				entries, err := ctx.getChoices(*opts.choice)
 				if err != nil {
@@ -379,13 +824,15 @@ func (ctx *Context) getExpectedFieldElements(value reflect.Value) ([]expectedFie
 				}
 				for _, entry := range entries {
 					raw.Class = entry.class
-					raw.Tag = entry.tag
-					elem, err := ctx.getExpectedElement(raw, field.Type(), opts)
-					if err != nil {
-						return nil, err
+					for _, tag := range append([]uint{entry.tag}, entry.alternatives...) {
+						raw.Tag = tag
+						elem, err := ctx.getExpectedElement(raw, field.Type(), opts)
+						if err != nil {
+							return nil, err
+						}
+						expectedValues = append(expectedValues,
+							expectedFieldElement{elem, field, opts, name, nil})
 					}
-					expectedValues = append(expectedValues,
-						expectedFieldElement{elem, field, opts})
 				}
 			}
 		}
@@ -393,14 +840,65 @@ func (ctx *Context) getExpectedFieldElements(value reflect.Value) ([]expectedFie
 	return expectedValues, nil
 }
 
+// getExpectedGroup returns the expected element of the group of fields of a
+// struct value from start to end, which is an optional SEQUENCE.
+func (ctx *Context) getExpectedGroup(value reflect.Value, start, end int, group string, present map[string]bool) expectedFieldElement {
+	decoder := func(data []byte, _ reflect.Value) error {
+		expectedValues, err := ctx.getExpectedFieldRange(value, start, end, false, present)
+		if err != nil {
+			return err
+		}
+		rawValues, err := ctx.getRawValuesFromBytes(data, len(expectedValues))
+		if err != nil {
+			return err
+		}
+		return ctx.matchExpectedValues(expectedValues, rawValues, present)
+	}
+	return expectedFieldElement{
+		expectedElement: expectedElement{
+			class:   ClassUniversal,
+			tag:     TagSequence,
+			decoder: decoder,
+		},
+		// The fields are set by the decoder, so the element has no value
+		// of its own to preserve or account.
+		value: reflect.ValueOf(struct{}{}),
+		opts:  &fieldOptions{optional: true, group: &group},
+		name:  group,
+		missingGroup: func() error {
+			return ctx.setMissingGroup(value, start, end)
+		},
+	}
+}
+
+// setMissingGroup sets the fields of a group that is not present to their
+// default values.
+func (ctx *Context) setMissingGroup(value reflect.Value, start, end int) error {
+	for i := start; i < end; i++ {
+		opts, err := ctx.getFieldOptions(value.Type(), i)
+		if err != nil {
+			return err
+		}
+		if opts != nil && opts.defaultValue != nil {
+			if err := ctx.setDefaultValue(value.Field(i), opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // getRawValuesFromBytes reads up to max values from the byte sequence.
 func (ctx *Context) getRawValuesFromBytes(data []byte, max int) ([]*rawValue, error) {
 	// Raw values
 	rawValues := []*rawValue{}
+	if len(data) == 0 {
+		return rawValues, nil
+	}
 	reader := bytes.NewBuffer(data)
 	for i := 0; i < max; i++ {
 		// Parse an Asn.1 element
-		raw, err := decodeRawValue(reader)
+		raw, err := ctx.readRawValue(reader)
 		if err != nil {
 			return nil, err
 		}
@@ -413,10 +911,12 @@ func (ctx *Context) getRawValuesFromBytes(data []byte, max int) ([]*rawValue, er
 }
 
 // matchExpectedValues tries to decode a sequence of raw values based on the
-// expected elements.
-func (ctx *Context) matchExpectedValues(eValues []expectedFieldElement, rValues []*rawValue) error {
+// expected elements. The names of the fields whose elements are found are
+// added to present.
+func (ctx *Context) matchExpectedValues(eValues []expectedFieldElement, rValues []*rawValue, present map[string]bool) error {
 	// Try to match expected and raw values
 	rIndex := 0
+	found := make([]bool, len(eValues))
 	for eIndex := 0; eIndex < len(eValues); eIndex++ {
 		e := eValues[eIndex]
 		// Using nil decoder to skip matched choices
@@ -427,23 +927,49 @@ func (ctx *Context) matchExpectedValues(eValues []expectedFieldElement, rValues
 		missing := true
 		if rIndex < len(rValues) {
 			raw := rValues[rIndex]
-			if e.class == raw.Class && e.tag == raw.Tag {
-				err := e.decoder(raw.Content, e.value)
+			if e.matches(raw) {
+				collected := ctx.collected()
+				var err error
+				if e.opts.absent {
+					err = fieldError("element %s must be absent", TagString(raw.Class, raw.Tag))
+				} else {
+					err = ctx.decodeElement(e.expectedElement, raw, e.value, e.name)
+				}
 				if err != nil {
-					return err
+					if e.opts.sensitive {
+						err = redactError(err)
+					}
+					if !ctx.collect(err) {
+						return addFieldPath(err, e.name)
+					}
+				}
+				ctx.addCollectedPath(collected, e.name, e.opts.sensitive)
+				if err == nil && e.opts.defaultValue != nil {
+					if err := ctx.checkDefaultValuePresent(e); err != nil {
+						return err
+					}
 				}
 				// Mark as found and advance raw values index
 				missing = false
+				found[eIndex] = true
+				if e.missingGroup == nil {
+					present[e.name] = true
+				}
 				rIndex++
-				// Remove other options for the matched choice
+				// Remove the other alternatives of the matched choice field.
+				// Other fields may use the same choice, with the alternatives
+				// enclosed in their own explicit tags.
 				if e.opts.choice != nil {
 					for i := eIndex + 1; i < len(eValues); i++ {
-						c := eValues[i].opts.choice
-						if c != nil && *c == *e.opts.choice {
+						if eValues[i].name == e.name {
 							eValues[i].decoder = nil
 						}
 					}
 				}
+			} else if ctx.isNullAsAbsent(e, raw) {
+				ctx.warn(WarningNullAsAbsent,
+					"NULL was decoded as absent field '%s'", e.name)
+				rIndex++
 			}
 		}
 
@@ -451,14 +977,97 @@ func (ctx *Context) matchExpectedValues(eValues []expectedFieldElement, rValues
 			if err := ctx.setMissingFieldValue(e); err != nil {
 				return err
 			}
+			if isMissingChoice(eValues, found, eIndex) {
+				return parseError("missing value for choice field '%s'", e.name)
+			}
 		}
 	}
+
+	// Remaining values are ignored unless the strict order is enabled
+	if rIndex < len(rValues) && ctx.strictOrder {
+		return unmatchedValueError(eValues, found, rValues[rIndex])
+	}
+	for _, raw := range rValues[rIndex:] {
+		ctx.warn(WarningIgnoredElement, "element %s was ignored",
+			TagString(raw.Class, raw.Tag))
+	}
+	return nil
+}
+
+// isNullAsAbsent checks if raw is a NULL that stands for the absent value of
+// an OPTIONAL field whose value is constructed.
+func (ctx *Context) isNullAsAbsent(e expectedFieldElement, raw *rawValue) bool {
+	if !ctx.nullAsAbsent || !e.opts.optional || e.opts.choice != nil {
+		return false
+	}
+	if raw.Class != ClassUniversal || raw.Tag != TagNull || raw.Constructed || len(raw.Content) > 0 {
+		return false
+	}
+	if e.missingGroup != nil {
+		return true
+	}
+	elem, err := ctx.getUniversalTag(e.value.Type(), e.opts)
+	return err == nil && (elem.tag == TagSequence || elem.tag == TagSet)
+}
+
+// isMissingChoice checks if eIndex is the last alternative of a choice field
+// that is not optional and none of its alternatives were found.
+func isMissingChoice(eValues []expectedFieldElement, found []bool, eIndex int) bool {
+	e := eValues[eIndex]
+	if e.opts.choice == nil || e.opts.optional || e.opts.absent || e.opts.defaultValue != nil {
+		return false
+	}
+	for i, other := range eValues {
+		if other.name != e.name {
+			continue
+		}
+		// The alternatives may not be adjacent in a SET
+		if found[i] || i > eIndex {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDefaultValuePresent reports a warning if the decoded value of a field
+// is equal to its default value.
+func (ctx *Context) checkDefaultValuePresent(e expectedFieldElement) error {
+	if ctx.warningHandler == nil {
+		return nil
+	}
+	defaultValue, err := ctx.newDefaultValue(e.value.Type(), e.opts)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(e.value.Interface(), defaultValue.Interface()) {
+		ctx.warn(WarningDefaultValuePresent,
+			"field '%s' is present with its default value", e.name)
+	}
 	return nil
 }
 
+// unmatchedValueError returns an error describing why a raw value could not
+// be matched to any expected element.
+func unmatchedValueError(eValues []expectedFieldElement, found []bool, raw *rawValue) error {
+	for i, e := range eValues {
+		if e.class == raw.Class && e.tag == raw.Tag {
+			if found[i] {
+				return parseError("duplicated element (%d,%d) for field '%s'",
+					raw.Class, raw.Tag, e.name)
+			}
+			return parseError("element (%d,%d) for field '%s' is out of order",
+				raw.Class, raw.Tag, e.name)
+		}
+	}
+	return parseError("unexpected element (%d,%d)", raw.Class, raw.Tag)
+}
+
 // setMissingFieldValue uses opts values to set the default value.
 func (ctx *Context) setMissingFieldValue(e expectedFieldElement) error {
-	if e.opts.optional || e.opts.choice != nil {
+	if e.missingGroup != nil {
+		return e.missingGroup()
+	}
+	if e.opts.optional || e.opts.absent || e.opts.choice != nil {
 		return nil
 	}
 	if e.opts.defaultValue != nil {
@@ -474,7 +1083,8 @@ func (ctx *Context) setMissingFieldValue(e expectedFieldElement) error {
 // decodeStruct decodes struct fields in order
 func (ctx *Context) decodeStruct(data []byte, value reflect.Value) error {
 
-	expectedValues, err := ctx.getExpectedFieldElements(value)
+	present := make(map[string]bool)
+	expectedValues, err := ctx.getExpectedFieldElements(value, present)
 	if err != nil {
 		return err
 	}
@@ -484,7 +1094,13 @@ func (ctx *Context) decodeStruct(data []byte, value reflect.Value) error {
 		return err
 	}
 
-	return ctx.matchExpectedValues(expectedValues, rawValues)
+	if err := ctx.matchExpectedValues(expectedValues, rawValues, present); err != nil {
+		return err
+	}
+	if err := ctx.checkPresence(value, present); err != nil {
+		return err
+	}
+	return ctx.checkVersion(value, present)
 }
 
 // Decode a struct as an Asn.1 Set.
@@ -495,7 +1111,8 @@ func (ctx *Context) decodeStruct(data []byte, value reflect.Value) error {
 func (ctx *Context) decodeStructAsSet(data []byte, value reflect.Value) error {
 
 	// Get the expected values
-	expectedElements, err := ctx.getExpectedFieldElements(value)
+	present := make(map[string]bool)
+	expectedElements, err := ctx.getExpectedFieldElements(value, present)
 	if err != nil {
 		return err
 	}
@@ -516,22 +1133,51 @@ func (ctx *Context) decodeStructAsSet(data []byte, value reflect.Value) error {
 	if err != nil {
 		return err
 	}
+	if ctx.rejectDuplicates {
+		if err := checkDuplicatedRawValues(rawValues); err != nil {
+			return err
+		}
+	}
 	if !ctx.der.decoding {
 		sort.Sort(rawValueSlice(rawValues))
 	}
 
-	return ctx.matchExpectedValues(expectedElements, rawValues)
+	if err := ctx.matchExpectedValues(expectedElements, rawValues, present); err != nil {
+		return err
+	}
+	if err := ctx.checkPresence(value, present); err != nil {
+		return err
+	}
+	return ctx.checkVersion(value, present)
+}
+
+// checkDuplicatedRawValues returns an error if two raw values have the same
+// tag.
+func checkDuplicatedRawValues(rawValues []*rawValue) error {
+	type elementTag struct {
+		class, tag uint
+	}
+	seen := make(map[elementTag]bool)
+	for _, raw := range rawValues {
+		key := elementTag{raw.Class, raw.Tag}
+		if seen[key] {
+			return parseError("duplicated element (%d,%d) in SET", raw.Class, raw.Tag)
+		}
+		seen[key] = true
+	}
+	return nil
 }
 
 // decodeSlice decodes a SET(OF) as a slice
 func (ctx *Context) decodeSlice(data []byte, value reflect.Value) error {
 	slice := reflect.New(value.Type()).Elem()
 	var err error
-	for len(data) > 0 {
+	for i := 0; len(data) > 0; i++ {
 		elem := reflect.New(value.Type().Elem()).Elem()
+		ctx.setTraceItem(i)
 		data, err = ctx.DecodeWithOptions(data, elem.Addr().Interface(), "")
 		if err != nil {
-			return err
+			return addFieldPath(err, fmt.Sprintf("[%d]", i))
 		}
 		slice.Set(reflect.Append(slice, elem))
 	}
@@ -544,11 +1190,12 @@ func (ctx *Context) decodeChoices(choiceName string) func([]byte, reflect.Value)
 	return func(data []byte, value reflect.Value) error {
 		slice := reflect.New(value.Type()).Elem()
 		var err error
-		for len(data) > 0 {
+		for i := 0; len(data) > 0; i++ {
 			elem := reflect.New(value.Type().Elem()).Elem()
+			ctx.setTraceItem(i)
 			data, err = ctx.DecodeWithOptions(data, elem.Addr().Interface(), fmt.Sprintf("choice:%s", choiceName))
 			if err != nil {
-				return err
+				return addFieldPath(err, fmt.Sprintf("[%d]", i))
 			}
 			slice.Set(reflect.Append(slice, elem))
 		}
@@ -557,6 +1204,44 @@ func (ctx *Context) decodeChoices(choiceName string) func([]byte, reflect.Value)
 	}
 }
 
+// decodeElementTypes decodes a slice of interface using the element types
+// registered in the Context.
+func (ctx *Context) decodeElementTypes(data []byte, value reflect.Value) error {
+	slice := reflect.New(value.Type()).Elem()
+	reader := bytes.NewBuffer(data)
+	for i := 0; reader.Len() > 0; i++ {
+		raw, err := ctx.readRawValue(reader)
+		if err != nil {
+			return err
+		}
+		var entry *choiceEntry
+		for j := range ctx.elementTypes {
+			if ctx.elementTypes[j].matches(raw) {
+				entry = &ctx.elementTypes[j]
+				break
+			}
+		}
+		if entry == nil {
+			return parseError("no element type registered for tag %s",
+				TagString(raw.Class, raw.Tag))
+		}
+		// The stored element is bound to the Context where the type was
+		// registered, so it's resolved again with the current one
+		expected, err := ctx.getExpectedElement(raw, entry.typ, entry.opts)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(entry.typ).Elem()
+		ctx.setTraceItem(i)
+		if err := ctx.decodeElement(expected, raw, elem, ""); err != nil {
+			return addFieldPath(err, fmt.Sprintf("[%d]", i))
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	value.Set(slice)
+	return nil
+}
+
 // decodeArray decodes a SET(OF) as an array
 func (ctx *Context) decodeArray(data []byte, value reflect.Value) error {
 	var err error
@@ -565,9 +1250,10 @@ func (ctx *Context) decodeArray(data []byte, value reflect.Value) error {
 			return parseError("missing elements")
 		}
 		elem := reflect.New(value.Type().Elem()).Elem()
+		ctx.setTraceItem(i)
 		data, err = ctx.DecodeWithOptions(data, elem.Addr().Interface(), "")
 		if err != nil {
-			return err
+			return addFieldPath(err, fmt.Sprintf("[%d]", i))
 		}
 		value.Index(i).Set(elem)
 	}
@@ -576,3 +1262,56 @@ func (ctx *Context) decodeArray(data []byte, value reflect.Value) error {
 	}
 	return nil
 }
+
+// DecodeSequenceOf parses a SEQUENCE OF (or SET OF) element and calls callback
+// for each of its items, without allocating a slice to hold all of them.
+//
+// The argument callback must be a function with the signature:
+//
+//	func(elem T) error
+//
+// where T is any type supported by DecodeWithOptions. Each item is decoded
+// into a new value of type T. If callback returns an error, the parsing stops
+// and the error is returned.
+func (ctx *Context) DecodeSequenceOf(data []byte, callback interface{}) (rest []byte, err error) {
+
+	fn := reflect.ValueOf(callback)
+	if !fn.IsValid() || (fn.Kind() == reflect.Func && fn.IsNil()) {
+		return nil, syntaxError("invalid nil callback")
+	}
+	fnType := fn.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 ||
+		fnType.NumOut() != 1 || fnType.Out(0) != errorType {
+		return nil, syntaxError(
+			"invalid callback type '%s', expecting 'func(T) error'", fnType)
+	}
+	elemType := fnType.In(0)
+
+	reader := bytes.NewBuffer(data)
+	raw, err := ctx.readRawValue(reader)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.der.decoding && raw.Indefinite {
+		return nil, parseError("indefinite length form is not supported by DER mode")
+	}
+	if raw.Class != ClassUniversal ||
+		(raw.Tag != TagSequence && raw.Tag != TagSet) {
+		return nil, parseError("expected SEQUENCE OF or SET OF but found (%d,%d)",
+			raw.Class, raw.Tag)
+	}
+
+	content := raw.Content
+	for len(content) > 0 {
+		elem := reflect.New(elemType)
+		content, err = ctx.DecodeWithOptions(content, elem.Interface(), "")
+		if err != nil {
+			return nil, err
+		}
+		out := fn.Call([]reflect.Value{elem.Elem()})
+		if !out[0].IsNil() {
+			return nil, out[0].Interface().(error)
+		}
+	}
+	return reader.Bytes(), nil
+}
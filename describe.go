@@ -0,0 +1,252 @@
+package asn1
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Describe returns the ASN.1 definition of the type of obj, as it's encoded
+// and decoded by the Context, such as:
+//
+//	Certificate ::= SEQUENCE {
+//	  version [0] EXPLICIT INTEGER DEFAULT 0,
+//	  serialNumber INTEGER,
+//	  extensions [3] EXPLICIT SEQUENCE OF Extension OPTIONAL
+//	}
+//
+//	Extension ::= SEQUENCE {
+//	  ...
+//	}
+//
+// Named struct types are defined separately and referenced by their names,
+// while other types are described where they are used. Tags are always
+// followed by IMPLICIT or EXPLICIT, so the description does not depend on the
+// default tagging of a module. It's intended for protocol documentation that
+// is generated from the code. An error is returned if the type is invalid, as
+// CheckType does.
+func (ctx *Context) Describe(obj interface{}) (string, error) {
+	if err := ctx.CheckType(obj); err != nil {
+		return "", err
+	}
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr && t != bigIntType {
+		t = t.Elem()
+	}
+	d := describer{ctx: ctx, defined: make(map[reflect.Type]bool)}
+	d.defined[t] = true
+	d.pending = []reflect.Type{t}
+	for i := 0; i < len(d.pending); i++ {
+		t := d.pending[i]
+		name := typeReference(t)
+		if name == "" {
+			name = "Value"
+		}
+		desc, err := d.describeBase(t, &fieldOptions{}, 0, true)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			d.buf.WriteString("\n")
+		}
+		d.buf.WriteString(name + " ::= " + desc + "\n")
+	}
+	return d.buf.String(), nil
+}
+
+// describer writes the description of types.
+type describer struct {
+	ctx     *Context
+	buf     bytes.Buffer
+	defined map[reflect.Type]bool
+	pending []reflect.Type
+}
+
+// typeReference returns the ASN.1 type reference for a named Go type, which
+// must start with an upper case letter.
+func typeReference(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// describeType describes a type with the given options.
+func (d *describer) describeType(t reflect.Type, opts *fieldOptions, indent int) (string, error) {
+	prefix := ""
+	if opts.tag2 != nil {
+		prefix += fmt.Sprintf("[%d] EXPLICIT ", *opts.tag2)
+	}
+	if opts.tag != nil {
+		tag := TagString(opts.tagClass(), uint(*opts.tag))
+		if opts.universal {
+			tag = fmt.Sprintf("[UNIVERSAL %d]", *opts.tag)
+		}
+		mode := "IMPLICIT"
+		if opts.explicit {
+			mode = "EXPLICIT"
+		}
+		prefix += tag + " " + mode + " "
+	}
+	if opts.choice != nil {
+		entries, err := d.ctx.getChoices(*opts.choice)
+		if err != nil {
+			return "", err
+		}
+		desc, err := d.describeChoice(entries, indent)
+		return prefix + desc, err
+	}
+	desc, err := d.describeBase(t, opts, indent, false)
+	if err != nil {
+		return "", err
+	}
+	if c := opts.perConstraint; c != nil {
+		constraint := c.String()
+		if opts.perExtensible {
+			constraint += ", ..."
+		}
+		for t.Kind() == reflect.Ptr && t != bigIntType {
+			t = t.Elem()
+		}
+		if kind := t.Kind(); kind == reflect.String || kind == reflect.Slice || kind == reflect.Array {
+			constraint = "SIZE (" + constraint + ")"
+		}
+		desc += " (" + constraint + ")"
+	}
+	return prefix + desc, nil
+}
+
+// describeBase describes a type without its tags. Named structs are only
+// expanded when define is set, otherwise they are referenced by name.
+func (d *describer) describeBase(t reflect.Type, opts *fieldOptions, indent int, define bool) (string, error) {
+	for t.Kind() == reflect.Ptr && t != bigIntType {
+		t = t.Elem()
+	}
+	elem, err := d.ctx.getUniversalTag(t, &fieldOptions{set: opts.set})
+	if err != nil {
+		return "", err
+	}
+	if elem.any {
+		return "ANY", nil
+	}
+	if t == timeType || t == goTimeType {
+		return "CHOICE { utcTime UTCTime, generalTime GeneralizedTime }", nil
+	}
+	isSequence := elem.class == ClassUniversal && (elem.tag == TagSequence || elem.tag == TagSet)
+	if !isSequence {
+		if names := d.ctx.enumNames[t]; names != nil {
+			return d.describeEnum(names), nil
+		}
+		return TagString(elem.class, elem.tag), nil
+	}
+
+	keyword := "SEQUENCE"
+	if opts.set || elem.tag == TagSet {
+		keyword = "SET"
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if !define && !opts.set && t.Name() != "" {
+			if !d.defined[t] {
+				d.defined[t] = true
+				d.pending = append(d.pending, t)
+			}
+			return typeReference(t), nil
+		}
+		return d.describeStruct(t, keyword, indent)
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Interface {
+			entries := d.ctx.elementTypes
+			if opts.choices != nil {
+				entries, err = d.ctx.getChoices(*opts.choices)
+				if err != nil {
+					return "", err
+				}
+			}
+			desc, err := d.describeChoice(entries, indent)
+			return keyword + " OF " + desc, err
+		}
+		desc, err := d.describeType(t.Elem(), &fieldOptions{}, indent)
+		return keyword + " OF " + desc, err
+	}
+	return keyword, nil
+}
+
+// describeStruct describes the components of a struct.
+func (d *describer) describeStruct(t reflect.Type, keyword string, indent int) (string, error) {
+	lines := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !isFieldExported(field) {
+			continue
+		}
+		opts, err := d.ctx.getFieldOptions(t, i)
+		if err != nil {
+			return "", err
+		}
+		if opts == nil {
+			continue
+		}
+		desc, err := d.describeType(field.Type, opts, indent+1)
+		if err != nil {
+			return "", err
+		}
+		line := componentIdentifier(field, opts) + " " + desc
+		if opts.defaultValue != nil {
+			line += fmt.Sprintf(" DEFAULT %d", *opts.defaultValue)
+		} else if opts.optional || opts.absent {
+			line += " OPTIONAL"
+		}
+		lines = append(lines, line)
+	}
+	return d.block(keyword, lines, indent), nil
+}
+
+// describeChoice describes the alternatives of a choice.
+func (d *describer) describeChoice(entries []choiceEntry, indent int) (string, error) {
+	lines := []string{}
+	for i, entry := range entries {
+		identifier := entry.identifier()
+		if identifier == "" {
+			identifier = fmt.Sprintf("alternative%d", i+1)
+		}
+		desc, err := d.describeType(entry.typ, entry.opts, indent+1)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, identifier+" "+desc)
+	}
+	return d.block("CHOICE", lines, indent), nil
+}
+
+// describeEnum describes the identifiers of an ENUMERATED type registered by
+// AddNamedEnum, in the order of their values.
+func (d *describer) describeEnum(names map[int64]string) string {
+	values := make([]int64, 0, len(names))
+	for v := range names {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = fmt.Sprintf("%s(%d)", names[v], v)
+	}
+	return "ENUMERATED { " + strings.Join(items, ", ") + " }"
+}
+
+// block formats a list of components enclosed by braces.
+func (d *describer) block(keyword string, lines []string, indent int) string {
+	if len(lines) == 0 {
+		return keyword + " {}"
+	}
+	inner := strings.Repeat("  ", indent+1)
+	return keyword + " {\n" + inner + strings.Join(lines, ",\n"+inner) + "\n" +
+		strings.Repeat("  ", indent) + "}"
+}
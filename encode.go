@@ -2,9 +2,9 @@ package asn1
 
 import (
 	"fmt"
+	"hash"
 	"reflect"
 	"sort"
-	"unicode"
 )
 
 // Encode returns the ASN.1 encoding of obj.
@@ -19,8 +19,26 @@ func (ctx *Context) Encode(obj interface{}) (data []byte, err error) {
 // See (*Context).DecodeWithOptions() for further details regarding types and
 // options.
 func (ctx *Context) EncodeWithOptions(obj interface{}, options string) (data []byte, err error) {
+	data, err = ctx.encodeWithOptions(obj, options)
+	if err != nil {
+		return
+	}
+	if ctx.audit {
+		err = ctx.auditEncoding(data, obj, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ctx.rules != nil && data != nil {
+		data, err = ctx.applyRules(data)
+	}
+	return
+}
 
-	opts, err := parseOptions(options)
+// encodeWithOptions implements EncodeWithOptions without the audit.
+func (ctx *Context) encodeWithOptions(obj interface{}, options string) (data []byte, err error) {
+
+	opts, err := ctx.parseOptions(options)
 	if err != nil {
 		return nil, err
 	}
@@ -38,12 +56,122 @@ func (ctx *Context) EncodeWithOptions(obj interface{}, options string) (data []b
 	return
 }
 
+// EncodedLen returns the number of octets of the encoding of obj, as returned
+// by EncodeWithOptions with the same options, without assembling the
+// encoding. It allows enforcing a size limit, such as the MTU of a transport,
+// or preallocating a buffer before the encoding is written.
+//
+// The lengths of constructed values are computed from the lengths of their
+// elements, so their contents are never built. Primitive values are encoded
+// on their own, although byte slices are not copied. Compressed and
+// encrypted fields, as well as the elements of a SET OF in DER, are encoded
+// in full, since their lengths depend on their encodings. The audit, if
+// enabled, is not performed. The length of an io.Reader or io.WriterTo that
+// can't seek is unknown, so a SyntaxError is returned for it.
+func (ctx *Context) EncodedLen(obj interface{}, options string) (int, error) {
+	opts, err := ctx.parseOptions(options)
+	if err != nil {
+		return 0, err
+	}
+	// The ignore tag produces no encoding
+	if opts == nil {
+		return 0, nil
+	}
+	if ctx.rules != nil {
+		data, err := ctx.encodeWithOptions(obj, options)
+		if err == nil {
+			data, err = ctx.applyRules(data)
+		}
+		return len(data), err
+	}
+	raw, err := ctx.encode(reflect.ValueOf(obj), opts)
+	if err != nil {
+		return 0, err
+	}
+	return raw.encodedLen()
+}
+
+// EncodeHash writes the DER encoding of obj to h, such as the digest of a
+// structure that is signed, as in:
+//
+//	h := sha256.New()
+//	err := ctx.EncodeHash(tbsCertificate, h)
+//	signature, err := key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+//
+// The encoding is written element by element and the contents of
+// constructed values are never assembled, so the encoding is not held in
+// memory. Primitive values are encoded on their own, although byte slices
+// are not copied, and compressed and encrypted fields, as well as the
+// elements of a SET OF, which are sorted by their encodings, are encoded in
+// full. The encoding uses DER whatever the rules set by SetDer, but unchanged
+// values kept by SetPreserveEncoding keep their original encodings.
+func (ctx *Context) EncodeHash(obj interface{}, h hash.Hash) error {
+	derCtx := *ctx
+	derCtx.der.encoding = true
+	raw, err := derCtx.encode(reflect.ValueOf(obj), &fieldOptions{})
+	if err != nil {
+		return err
+	}
+	return raw.writeTo(h)
+}
+
+// encodeState keeps the values being encoded to detect cycles.
+type encodeState struct {
+	visiting map[visitKey]bool
+}
+
+// visitKey identifies a pointer or slice being encoded.
+type visitKey struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
 // Main encode function
 func (ctx *Context) encode(value reflect.Value, opts *fieldOptions) (*rawValue, error) {
 
+	// Each encoding uses its own state, kept by a copy of the Context
+	if ctx.encoding == nil {
+		encodeCtx := *ctx
+		encodeCtx.encoding = &encodeState{visiting: make(map[visitKey]bool)}
+		return encodeCtx.encode(value, opts)
+	}
+
+	// Nil pointers and interfaces are absent values
+	if isNilValue(value) {
+		if opts.optional || opts.defaultValue != nil {
+			return nil, nil
+		}
+		if !value.IsValid() {
+			return nil, syntaxError("cannot encode a nil value")
+		}
+		return nil, syntaxError("nil value of Go type '%s' is not optional", value.Type())
+	}
+
+	// Detect values that contain themselves
+	if key, ok := getVisitKey(value); ok {
+		if ctx.encoding.visiting[key] {
+			return nil, syntaxError("cycle found: value of Go type '%s' contains itself", value.Type())
+		}
+		ctx.encoding.visiting[key] = true
+		defer delete(ctx.encoding.visiting, key)
+	}
+
+	// Unchanged decoded values keep their original encoding
+	if ctx.preserved != nil {
+		raw, err := ctx.encodePreserved(value)
+		if raw != nil || err != nil {
+			return raw, err
+		}
+	}
+
 	// Skip the interface type
 	value = getActualType(value)
 
+	if opts.encrypt != nil {
+		return ctx.encodeEncrypted(value, opts)
+	}
+
 	// If a value is missing the default value is used
 	empty := isEmpty(value)
 	if opts.defaultValue != nil {
@@ -57,22 +185,40 @@ func (ctx *Context) encode(value reflect.Value, opts *fieldOptions) (*rawValue,
 		}
 	}
 
+	// Since the empty flag is already calculated, check if it's optional
+	omitted := (opts.optional || opts.defaultValue != nil) && empty
+	if !omitted {
+		err := constraintError(ctx.checkConstraints(value, opts), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Encode data
 	raw, err := ctx.encodeValue(value, opts)
 	if err != nil {
 		return nil, err
 	}
-
-	// Since the empty flag is already calculated, check if it's optional
-	if (opts.optional || opts.defaultValue != nil) && empty {
+	if omitted {
 		return nil, nil
 	}
+	if err := ctx.applyCodec(raw, opts); err != nil {
+		return nil, err
+	}
 
 	// Modify the data generated based on the given tags
+	raw.lengthOctets = ctx.defaultLengthOctets()
 	raw, err = ctx.applyOptions(value, raw, opts)
 	if err != nil {
 		return nil, err
 	}
+	if !ctx.validateUTF8(raw) {
+		return nil, syntaxError("invalid UTF-8 in UTF8String of Go type '%s'", value.Type())
+	}
+	if length, max := ctx.checkStringLength(raw); max > 0 {
+		return nil, syntaxError("%s of %d characters exceeds the maximum length of %d",
+			TagString(raw.Class, raw.Tag), length, max)
+	}
 
 	return raw, nil
 }
@@ -81,90 +227,205 @@ func (ctx *Context) encodeValue(value reflect.Value, opts *fieldOptions) (raw *r
 
 	raw = &rawValue{}
 	encoder := encoderFunction(nil)
+	childrenEncoder := childrenEncoderFunction(nil)
 
 	// Special types:
 	objType := value.Type()
 	switch objType {
 	case bigIntType:
-		raw.Tag = tagInteger
+		raw.Tag = TagInteger
 		encoder = ctx.encodeBigInt
 	case bitStringType:
-		raw.Tag = tagBitString
+		raw.Tag = TagBitString
 		encoder = ctx.encodeBitString
 	case oidType:
-		raw.Tag = tagOid
+		raw.Tag = TagOid
 		encoder = ctx.encodeOid
+	case bigOidType:
+		raw.Tag = TagOid
+		encoder = ctx.encodeBigOid
 	case nullType:
-		raw.Tag = tagNull
+		raw.Tag = TagNull
 		encoder = ctx.encodeNull
 	case enumType:
-		raw.Tag = tagEnum
+		raw.Tag = TagEnum
 		encoder = ctx.encodeInt
 	case utcTimeType:
-		raw.Tag = tagUtcTime
+		raw.Tag = TagUtcTime
 		encoder = ctx.encodeUTCTime
+	case isoTimeType:
+		raw.Tag = TagTime
+		encoder = ctx.encodeISOTime
+	case generalizedTimeType:
+		raw.Tag = TagGeneralizedTime
+		encoder = ctx.encodeGeneralizedTime
+	case timeType:
+		raw.Tag, encoder = ctx.getTimeEncoder(value)
+	case goTimeType:
+		if opts.timeLayout != nil {
+			raw.Tag = TagGeneralizedTime
+			encoder = ctx.layoutTimeEncoder(*opts.timeLayout)
+			break
+		}
+		raw.Tag, encoder = ctx.getTimeEncoder(value)
+	case readerType, writerToType:
+		raw.Tag = TagOctetString
+		source, err := ctx.newReaderSource(value)
+		if source != nil {
+			raw.setSource(source)
+		}
+		return raw, err
+	case rawValueType:
+		return ctx.encodeRawElement(value)
+	case stdRawValueType:
+		return ctx.encodeStdRawValue(value)
+	case stdOidType:
+		raw.Tag = TagOid
+		encoder = ctx.encodeStdOid
+	case stdBitStringType:
+		raw.Tag = TagBitString
+		encoder = ctx.encodeStdBitString
+	case stdEnumType:
+		raw.Tag = TagEnum
+		encoder = ctx.encodeInt
+	}
+
+	if encoder == nil && isNumberType(objType) {
+		raw.Tag = TagInteger
+		encoder = ctx.encodeNumber
 	}
 
 	if encoder == nil {
 		// Generic types:
 		switch value.Kind() {
 		case reflect.Bool:
-			raw.Tag = tagBoolean
+			raw.Tag = TagBoolean
 			encoder = ctx.encodeBool
 
 		case reflect.String:
-			raw.Tag = tagOctetString
+			raw.Tag = TagOctetString
 			encoder = ctx.encodeString
 
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			raw.Tag = tagInteger
+			raw.Tag = TagInteger
 			encoder = ctx.encodeInt
+			if ctx.enumNames[objType] != nil {
+				raw.Tag = TagEnum
+			}
 
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			raw.Tag = tagInteger
+			raw.Tag = TagInteger
 			encoder = ctx.encodeUint
+			if ctx.enumNames[objType] != nil {
+				raw.Tag = TagEnum
+			}
+
+		case reflect.Float32, reflect.Float64:
+			raw.Tag = TagReal
+			encoder = ctx.encodeReal
 
 		case reflect.Struct:
-			raw.Tag = tagSequence
+			raw.Tag = TagSequence
 			raw.Constructed = true
-			encoder = ctx.encodeStruct
+			childrenEncoder = ctx.encodeStruct
 			if opts.set {
-				encoder = ctx.encodeStructAsSet
+				childrenEncoder = ctx.encodeStructAsSet
 			}
 
 		case reflect.Array, reflect.Slice:
 			switch objType.Elem().Kind() {
 			case reflect.Uint8:
-				raw.Tag = tagOctetString
+				raw.Tag = TagOctetString
 				encoder = ctx.encodeOctetString
 			case reflect.Interface:
-				raw.Tag = tagSequence
+				raw.Tag = TagSequence
 				raw.Constructed = true
-				encoder = ctx.encodeChoices(*opts.choices)
+				choices, err := ctx.getElementChoices(value, opts)
+				if err != nil {
+					return nil, err
+				}
+				if choices != nil {
+					childrenEncoder = ctx.encodeChoices(*choices)
+				} else if len(ctx.elementTypes) > 0 {
+					childrenEncoder = ctx.encodeElementTypes
+				}
 			default:
-				raw.Tag = tagSequence
+				raw.Tag = TagSequence
+				if isSetOfMarked(objType) {
+					raw.Tag = TagSet
+				}
 				raw.Constructed = true
-				encoder = ctx.encodeSlice
+				childrenEncoder = ctx.encodeSlice
 			}
 		}
 	}
 
-	if encoder == nil {
+	switch {
+	case childrenEncoder != nil:
+		var children []*rawValue
+		children, err = childrenEncoder(value)
+		if err == nil {
+			err = raw.setChildren(children)
+		}
+	case encoder != nil:
+		raw.Content, err = encoder(value)
+	default:
 		return nil, syntaxError("invalid Go type: %s", value.Type())
 	}
-	raw.Content, err = encoder(value)
+	if err == nil && ctx.der.encoding && !ctx.preserveSetOrder && isSetOfType(objType, opts) {
+		// The elements are sorted by their encodings, which are built
+		if err = raw.build(); err == nil {
+			raw.Content, err = sortSetOfContent(raw.Content)
+		}
+	}
 	return
 }
 
+// getElementChoices returns the name of the choice of the elements of a slice
+// of interfaces, which is given by the options of the alternative when the
+// slice is itself an alternative of a choice.
+func (ctx *Context) getElementChoices(value reflect.Value, opts *fieldOptions) (*string, error) {
+	if opts.choices != nil || opts.choice == nil {
+		return opts.choices, nil
+	}
+	entry, err := ctx.getChoiceByType(*opts.choice, value.Type())
+	if err != nil {
+		return nil, err
+	}
+	return entry.opts.choices, nil
+}
+
+// isSetOfType checks if values of type t are encoded as a SET OF with the
+// given options.
+func isSetOfType(t reflect.Type, opts *fieldOptions) bool {
+	kind := t.Kind()
+	if (kind != reflect.Slice && kind != reflect.Array) || t.Elem().Kind() == reflect.Uint8 {
+		return false
+	}
+	return opts.set || isSetOfMarked(t)
+}
+
 // applyOptions modifies a raw value based on the given options.
 func (ctx *Context) applyOptions(value reflect.Value, raw *rawValue, opts *fieldOptions) (*rawValue, error) {
 
+	// Enclose the element with all the other options in a second tag
+	if opts.tag2 != nil {
+		inner := *opts
+		inner.tag2 = nil
+		inner.explicit2 = false
+		raw, err := ctx.applyOptions(value, raw, &inner)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.applyExplicitTag(value, raw, &fieldOptions{tag: opts.tag2})
+	}
+
 	// Change sequence to set
 	if opts.set {
-		if raw.Class != classUniversal || raw.Tag != tagSequence {
+		if raw.Class != ClassUniversal || (raw.Tag != TagSequence && raw.Tag != TagSet) {
 			return nil, syntaxError("Go type '%s' does not accept the flag 'set'", value.Type())
 		}
-		raw.Tag = tagSet
+		raw.Tag = TagSet
 	}
 
 	// Check if this type is an Asn.1 choice
@@ -174,37 +435,27 @@ func (ctx *Context) applyOptions(value reflect.Value, raw *rawValue, opts *field
 			return nil, err
 		}
 		raw, err = ctx.applyOptions(value, raw, entry.opts)
+		if err != nil {
+			return nil, err
+		}
 		raw.Class = entry.class
 		raw.Tag = entry.tag
 	}
 
 	// Add an enclosing tag
 	if opts.explicit {
-		if opts.tag == nil {
-			return nil, syntaxError(
-				"invalid flag 'explicit' without tag on Go type '%s'",
-				value.Type())
-		}
-		content, err := raw.encode()
-		if err != nil {
-			return nil, err
-		}
-		raw = &rawValue{}
-		raw.Constructed = true
-		raw.Content = content
+		return ctx.applyExplicitTag(value, raw, opts)
 	}
 
-	// Change tag
+	// Change tag and class
 	if opts.tag != nil {
-		raw.Class = classContextSpecific
+		if value.Type() == timeType || (value.Type() == goTimeType && opts.timeLayout == nil) {
+			return nil, syntaxError("Go type '%s' is a CHOICE and its tag must be explicit", value.Type())
+		}
+		raw.Class = opts.tagClass()
 		raw.Tag = uint(*opts.tag)
-	}
-	// Change class
-	if opts.universal {
-		raw.Class = classUniversal
-	}
-	if opts.application {
-		raw.Class = classApplication
+		// The original encoding has the previous tag
+		raw.encoded = nil
 	}
 
 	// Use the indefinite length encoding
@@ -216,50 +467,258 @@ func (ctx *Context) applyOptions(value reflect.Value, raw *rawValue, opts *field
 		}
 		raw.Indefinite = true
 	}
+	if opts.longForm {
+		raw.lengthOctets = longFormOctets
+	}
+	if opts.lengthOctets != nil {
+		raw.lengthOctets = *opts.lengthOctets
+	}
 
 	return raw, nil
 }
 
+// applyExplicitTag encloses raw in a constructed element with the tag and
+// class given by opts. The inner element is kept unchanged.
+func (ctx *Context) applyExplicitTag(value reflect.Value, raw *rawValue, opts *fieldOptions) (*rawValue, error) {
+	if opts.tag == nil {
+		return nil, syntaxError(
+			"invalid flag 'explicit' without tag on Go type '%s'",
+			value.Type())
+	}
+	outer := &rawValue{
+		Class:       opts.tagClass(),
+		Tag:         uint(*opts.tag),
+		Constructed: true,
+		Indefinite:  opts.indefinite,
+	}
+	if err := outer.setChildren([]*rawValue{raw}); err != nil {
+		return nil, err
+	}
+	outer.lengthOctets = ctx.defaultLengthOctets()
+	if opts.longForm {
+		outer.lengthOctets = longFormOctets
+	}
+	if opts.lengthOctets != nil {
+		outer.lengthOctets = *opts.lengthOctets
+	}
+	return outer, nil
+}
+
+// isNilValue checks if a value is a nil pointer or interface that would be
+// dereferenced by getActualType.
+func isNilValue(value reflect.Value) bool {
+	for value.IsValid() {
+		switch value.Type() {
+		case bigIntType, readerType, writerToType:
+			return false
+		}
+		switch value.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if value.IsNil() {
+				return true
+			}
+			value = value.Elem()
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// getVisitKey returns the key used to detect cycles for pointers and
+// non-empty slices.
+func getVisitKey(value reflect.Value) (visitKey, bool) {
+	for value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		return visitKey{value.Pointer(), 0, value.Type()}, true
+	case reflect.Slice:
+		if value.Len() > 0 {
+			return visitKey{value.Pointer(), value.Len(), value.Type()}, true
+		}
+	}
+	return visitKey{}, false
+}
+
 // isEmpty checks is a value is empty.
 func isEmpty(value reflect.Value) bool {
 	defaultValue := reflect.Zero(value.Type())
 	return reflect.DeepEqual(value.Interface(), defaultValue.Interface())
 }
 
-// isFieldExported checks is the field name starts with a capital letter.
+// isFieldExported checks if the field name starts with a capital letter. An
+// embedded field is exported if its type is.
 func isFieldExported(field reflect.StructField) bool {
-	return unicode.IsUpper([]rune(field.Name)[0])
+	return field.PkgPath == ""
 }
 
 // getRawValuesFromFields encodes each valid field ofa struct value and returns
 // a slice of raw values.
 func (ctx *Context) getRawValuesFromFields(value reflect.Value) ([]*rawValue, error) {
+	if err := ctx.checkPresence(value, nil); err != nil {
+		return nil, err
+	}
+	return ctx.getRawValuesFromFieldRange(value, 0, value.NumField(), true)
+}
+
+// getRawValuesFromFieldRange encodes the fields of a struct value from start
+// to end. If grouping is set, the fields of each group are encoded in a
+// nested SEQUENCE.
+func (ctx *Context) getRawValuesFromFieldRange(value reflect.Value, start, end int, grouping bool) ([]*rawValue, error) {
 	// Encode each child to a raw value
 	children := []*rawValue{}
-	for i := 0; i < value.NumField(); i++ {
+	for i := start; i < end; i++ {
 		fieldValue := value.Field(i)
 		fieldStruct := value.Type().Field(i)
-		// Ignore field that are not exported (that starts with lowercase)
-		if isFieldExported(fieldStruct) {
-			tag := fieldStruct.Tag.Get(tagKey)
-			opts, err := parseOptions(tag)
+		opts, err := ctx.getFieldOptions(value.Type(), i)
+		if err != nil {
+			return nil, err
+		}
+		// Skip unexported fields and fields with the ignore tag
+		if opts == nil || opts.absent {
+			continue
+		}
+		if opts.group != nil && grouping {
+			groupEnd, err := ctx.getGroupEnd(value.Type(), i, *opts.group)
 			if err != nil {
 				return nil, err
 			}
-			// Skip if the ignore tag is given
-			if opts == nil {
+			raw, err := ctx.encodeGroup(value, i, groupEnd)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, raw)
+			i = groupEnd - 1
+			continue
+		}
+		if opts.isVersioned() {
+			version, err := ctx.getVersion(value)
+			if err != nil {
+				return nil, err
+			}
+			if !opts.allowsVersion(version) {
 				continue
 			}
-			raw, err := ctx.encode(fieldValue, opts)
+		}
+		if opts.compute != nil {
+			fieldValue, err = computeField(value, fieldStruct, *opts.compute)
 			if err != nil {
 				return nil, err
 			}
-			children = append(children, raw)
 		}
+		raw, err := ctx.encode(fieldValue, opts)
+		if err != nil {
+			if opts.sensitive {
+				return nil, syntaxError("field %s.%s: %s", value.Type().Name(),
+					fieldStruct.Name, redactError(err))
+			}
+			return nil, err
+		}
+		children = append(children, raw)
 	}
 	return children, nil
 }
 
+// getGroupEnd returns the index after the last field of the group that starts
+// at the field start of the struct type t. The fields of a group must be
+// adjacent, although fields ignored by the encoding can be among them.
+func (ctx *Context) getGroupEnd(t reflect.Type, start int, group string) (int, error) {
+	end := start + 1
+	for ; end < t.NumField(); end++ {
+		opts, err := ctx.getFieldOptions(t, end)
+		if err != nil {
+			return 0, err
+		}
+		if opts != nil && (opts.group == nil || *opts.group != group) {
+			break
+		}
+	}
+	for i := end; i < t.NumField(); i++ {
+		opts, err := ctx.getFieldOptions(t, i)
+		if err != nil {
+			return 0, err
+		}
+		if opts != nil && opts.group != nil && *opts.group == group {
+			return 0, syntaxError("fields of group '%s' of type '%s' must be adjacent", group, t)
+		}
+	}
+	return end, nil
+}
+
+// encodeGroup encodes the fields of a struct value from start to end in a
+// SEQUENCE, which is omitted if none of the fields is encoded.
+func (ctx *Context) encodeGroup(value reflect.Value, start, end int) (*rawValue, error) {
+	members, err := ctx.getRawValuesFromFieldRange(value, start, end, false)
+	if err != nil {
+		return nil, err
+	}
+	empty := true
+	for _, raw := range members {
+		if raw != nil {
+			empty = false
+		}
+	}
+	if empty {
+		return nil, nil
+	}
+	raw := &rawValue{
+		Class:        ClassUniversal,
+		Tag:          TagSequence,
+		Constructed:  true,
+		lengthOctets: ctx.defaultLengthOctets(),
+	}
+	if err := raw.setChildren(members); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// getComputeMethod returns the method of the struct type t that computes the
+// value of field, which must have one of the signatures:
+//
+//	func() T
+//	func() (T, error)
+//
+// where T is assignable to the type of the field.
+func getComputeMethod(t reflect.Type, field reflect.StructField, name string) (reflect.Method, error) {
+	method, ok := reflect.PtrTo(t).MethodByName(name)
+	if !ok {
+		return method, syntaxError("field %s.%s: method '%s' not found", t.Name(), field.Name, name)
+	}
+	mt := method.Type
+	valid := mt.NumIn() == 1 && (mt.NumOut() == 1 ||
+		(mt.NumOut() == 2 && mt.Out(1) == errorType))
+	if !valid || !mt.Out(0).AssignableTo(field.Type) {
+		return method, syntaxError(
+			"field %s.%s: method '%s' must have the signature 'func() %s' or 'func() (%s, error)'",
+			t.Name(), field.Name, name, field.Type, field.Type)
+	}
+	return method, nil
+}
+
+// computeField calls the method of a struct value that computes the value of
+// one of its fields.
+func computeField(value reflect.Value, field reflect.StructField, name string) (reflect.Value, error) {
+	method, err := getComputeMethod(value.Type(), field, name)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if !value.CanAddr() {
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		value = ptr.Elem()
+	}
+	out := method.Func.Call([]reflect.Value{value.Addr()})
+	if len(out) == 2 && !out[1].IsNil() {
+		return reflect.Value{}, out[1].Interface().(error)
+	}
+	result := reflect.New(field.Type).Elem()
+	result.Set(out[0])
+	return result, nil
+}
+
 // encodeRawValues is a helper function to encode raw value in sequence.
 func (ctx *Context) encodeRawValues(values ...*rawValue) ([]byte, error) {
 	content := []byte{}
@@ -274,18 +733,13 @@ func (ctx *Context) encodeRawValues(values ...*rawValue) ([]byte, error) {
 }
 
 // encodeStruct encodes structs fields in order.
-func (ctx *Context) encodeStruct(value reflect.Value) ([]byte, error) {
-	// Encode each child to a raw value
-	children, err := ctx.getRawValuesFromFields(value)
-	if err != nil {
-		return nil, err
-	}
-	return ctx.encodeRawValues(children...)
+func (ctx *Context) encodeStruct(value reflect.Value) ([]*rawValue, error) {
+	return ctx.getRawValuesFromFields(value)
 }
 
 // encodeStructAsSet works similarly to encodeStruct, but in Der mode the
 // fields are encoded in ascending order of their tags.
-func (ctx *Context) encodeStructAsSet(value reflect.Value) ([]byte, error) {
+func (ctx *Context) encodeStructAsSet(value reflect.Value) ([]*rawValue, error) {
 	// Encode each child to a raw value
 	children, err := ctx.getRawValuesFromFields(value)
 	if err != nil {
@@ -295,35 +749,67 @@ func (ctx *Context) encodeStructAsSet(value reflect.Value) ([]byte, error) {
 	if ctx.der.encoding {
 		sort.Sort(rawValueSlice(children))
 	}
-	return ctx.encodeRawValues(children...)
+	return children, nil
 }
 
 // encodeSlice encodes a slice or array as a sequence of values.
-func (ctx *Context) encodeSlice(value reflect.Value) ([]byte, error) {
-	content := []byte{}
+func (ctx *Context) encodeSlice(value reflect.Value) ([]*rawValue, error) {
+	children := []*rawValue{}
 	for i := 0; i < value.Len(); i++ {
 		itemValue := value.Index(i)
-		childBytes, err := ctx.EncodeWithOptions(itemValue.Interface(), "")
+		raw, err := ctx.encode(reflect.ValueOf(itemValue.Interface()), &fieldOptions{})
 		if err != nil {
 			return nil, err
 		}
-		content = append(content, childBytes...)
+		children = append(children, raw)
 	}
-	return content, nil
+	return children, nil
 }
 
 // encodeChoices encodes a slice of interface which represent choice.
-func (ctx *Context) encodeChoices(choiceName string) func(reflect.Value) ([]byte, error) {
-	return func(value reflect.Value) ([]byte, error) {
-		content := []byte{}
+func (ctx *Context) encodeChoices(choiceName string) childrenEncoderFunction {
+	return func(value reflect.Value) ([]*rawValue, error) {
+		opts, err := ctx.parseOptions(fmt.Sprintf("choice:%s", choiceName))
+		if err != nil {
+			return nil, err
+		}
+		children := []*rawValue{}
 		for i := 0; i < value.Len(); i++ {
 			itemValue := value.Index(i)
-			childBytes, err := ctx.EncodeWithOptions(itemValue.Interface(), fmt.Sprintf("choice:%s", choiceName))
+			raw, err := ctx.encode(reflect.ValueOf(itemValue.Interface()), opts)
 			if err != nil {
 				return nil, err
 			}
-			content = append(content, childBytes...)
+			children = append(children, raw)
 		}
-		return content, nil
+		return children, nil
 	}
 }
+
+// encodeElementTypes encodes a slice of interface using the element types
+// registered in the Context.
+func (ctx *Context) encodeElementTypes(value reflect.Value) ([]*rawValue, error) {
+	children := []*rawValue{}
+	for i := 0; i < value.Len(); i++ {
+		if value.Index(i).IsNil() {
+			return nil, syntaxError("nil element in Go type '%s'", value.Type())
+		}
+		itemValue := getActualType(value.Index(i))
+		var entry *choiceEntry
+		for j := range ctx.elementTypes {
+			if ctx.elementTypes[j].typ == itemValue.Type() {
+				entry = &ctx.elementTypes[j]
+				break
+			}
+		}
+		if entry == nil {
+			return nil, syntaxError("element type not registered: %s", itemValue.Type())
+		}
+		raw, err := ctx.encode(itemValue, entry.opts)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, raw)
+	}
+	return children, nil
+}
@@ -0,0 +1,114 @@
+package asn1
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// FieldCipher encrypts and decrypts the fields marked with the option
+// "encrypt". The plaintext is the complete encoding of the value of the
+// field, as its universal type, and the ciphertext is encoded as an OCTET
+// STRING, which receives the tag options of the field. For instance, a field
+// with "tag:1,encrypt:k1" is encoded as [1] IMPLICIT OCTET STRING holding
+// the ciphertext of its encoding.
+//
+// keyID is the argument of the option, or an empty string if none is given,
+// and it allows different keys for different fields.
+type FieldCipher interface {
+	Encrypt(keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// SetFieldCipher defines the FieldCipher used for the fields marked with the
+// option "encrypt". Encoding and decoding such fields fails if no cipher is
+// set, which is the default.
+func (ctx *Context) SetFieldCipher(cipher FieldCipher) {
+	ctx.cipher = cipher
+}
+
+// splitEncryptOptions returns the options applied to the ciphertext of an
+// encrypted value and the options used to encode its plaintext.
+func splitEncryptOptions(opts *fieldOptions) (outer, inner *fieldOptions) {
+	outer = &fieldOptions{
+		universal:    opts.universal,
+		application:  opts.application,
+		private:      opts.private,
+		explicit:     opts.explicit,
+		indefinite:   opts.indefinite,
+		optional:     opts.optional,
+		tag:          opts.tag,
+		tag2:         opts.tag2,
+		explicit2:    opts.explicit2,
+		defaultValue: opts.defaultValue,
+		encrypt:      opts.encrypt,
+		lengthOctets: opts.lengthOctets,
+		longForm:     opts.longForm,
+	}
+	plain := *opts
+	plain.universal, plain.application, plain.private = false, false, false
+	plain.explicit, plain.indefinite, plain.optional = false, false, false
+	plain.tag, plain.tag2, plain.explicit2 = nil, nil, false
+	plain.defaultValue, plain.encrypt, plain.lengthOctets = nil, nil, nil
+	plain.longForm = false
+	return outer, &plain
+}
+
+// getCipher returns the FieldCipher of the Context.
+func (ctx *Context) getCipher() (FieldCipher, error) {
+	if ctx.cipher == nil {
+		return nil, syntaxError("option 'encrypt' requires a FieldCipher")
+	}
+	return ctx.cipher, nil
+}
+
+// encodeEncrypted encodes a value with the option "encrypt".
+func (ctx *Context) encodeEncrypted(value reflect.Value, opts *fieldOptions) (*rawValue, error) {
+	outer, inner := splitEncryptOptions(opts)
+	if (opts.optional || opts.defaultValue != nil) && isEmpty(value) {
+		return nil, nil
+	}
+	cipher, err := ctx.getCipher()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := ctx.encode(value, inner)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := plain.encode()
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := cipher.Encrypt(*opts.encrypt, plaintext)
+	if err != nil {
+		return nil, syntaxError("encryption failed: %s", err)
+	}
+	raw := &rawValue{Class: ClassUniversal, Tag: TagOctetString, Content: ciphertext}
+	return ctx.applyOptions(value, raw, outer)
+}
+
+// getEncryptedElement returns the element of a value with the option
+// "encrypt", without the tag options.
+func (ctx *Context) getEncryptedElement(opts *fieldOptions) (expectedElement, error) {
+	_, inner := splitEncryptOptions(opts)
+	cipher, err := ctx.getCipher()
+	if err != nil {
+		return expectedElement{}, err
+	}
+	elem := expectedElement{class: ClassUniversal, tag: TagOctetString}
+	elem.decoder = func(data []byte, value reflect.Value) error {
+		plaintext, err := cipher.Decrypt(*opts.encrypt, data)
+		if err != nil {
+			return fieldError("decryption failed: %s", err)
+		}
+		reader := bytes.NewBuffer(plaintext)
+		if err := ctx.decode(reader, value, inner); err != nil {
+			return err
+		}
+		if reader.Len() > 0 {
+			return fieldError("trailing data after decrypted value")
+		}
+		return nil
+	}
+	return elem, nil
+}
@@ -0,0 +1,144 @@
+package asn1
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AddEnum registers the values of an ENUMERATED type. The type t must be an
+// integer type, such as Enum or any type derived from an integer type.
+//
+// Values of type t not registered are rejected during encoding and decoding,
+// unless the option "extensible" is given. The option corresponds to an
+// ENUMERATED type with an extension marker ("...") where values added by
+// later versions of a specification are kept as is. IsKnownEnum can be used
+// to check if a decoded value is one of the registered ones.
+func (ctx *Context) AddEnum(t reflect.Type, values ...int64) error {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return syntaxError("invalid Go type '%s' for ENUMERATED", t)
+	}
+	known := ctx.enums[t]
+	if known == nil {
+		known = make(map[int64]bool)
+		ctx.enums[t] = known
+	}
+	for _, v := range values {
+		known[v] = true
+	}
+	return nil
+}
+
+// AddNamedEnum registers a Go type derived from an integer type, usually with
+// a set of constants, as an ENUMERATED type with the given identifiers:
+//
+//	type Version int
+//
+//	const (
+//		V1 Version = iota
+//		V2
+//		V3
+//	)
+//
+//	ctx.AddNamedEnum(reflect.TypeOf(Version(0)), map[int64]string{
+//		int64(V1): "v1",
+//		int64(V2): "v2",
+//		int64(V3): "v3",
+//	})
+//
+// The names can also be given by a table generated with go:generate. Values
+// of the type are encoded and decoded as ENUMERATED instead of INTEGER, the
+// values are registered as AddEnum does and the identifiers are used by the
+// value notation, Describe and EnumName.
+func (ctx *Context) AddNamedEnum(t reflect.Type, names map[int64]string) error {
+	if len(names) == 0 {
+		return syntaxError("no names given for ENUMERATED type '%s'", t)
+	}
+	known := make(map[int64]string, len(names))
+	seen := make(map[string]bool, len(names))
+	values := make([]int64, 0, len(names))
+	for v, name := range names {
+		if !isNotationIdentifier(name) {
+			return syntaxError("invalid name '%s' for ENUMERATED type '%s'", name, t)
+		}
+		if seen[name] {
+			return syntaxError("duplicated name '%s' for ENUMERATED type '%s'", name, t)
+		}
+		seen[name] = true
+		known[v] = name
+		values = append(values, v)
+	}
+	if err := ctx.AddEnum(t, values...); err != nil {
+		return err
+	}
+	ctx.enumNames[t] = known
+	return nil
+}
+
+// EnumName returns the identifier of an enum value registered by
+// AddNamedEnum. It returns false if the type or the value was not registered.
+func (ctx *Context) EnumName(value interface{}) (string, bool) {
+	names := ctx.enumNames[reflect.TypeOf(value)]
+	if names == nil {
+		return "", false
+	}
+	n, ok := enumValue(reflect.ValueOf(value))
+	if !ok {
+		return "", false
+	}
+	name, ok := names[n]
+	return name, ok
+}
+
+// enumValueByName returns the value of an identifier of a type registered by
+// AddNamedEnum.
+func (ctx *Context) enumValueByName(t reflect.Type, name string) (int64, bool) {
+	for v, n := range ctx.enumNames[t] {
+		if n == name {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// IsKnownEnum reports whether value is one of the values registered by
+// AddEnum for its type. It returns false if the type was not registered.
+func (ctx *Context) IsKnownEnum(value interface{}) bool {
+	known := ctx.enums[reflect.TypeOf(value)]
+	if known == nil {
+		return false
+	}
+	n, ok := enumValue(reflect.ValueOf(value))
+	return ok && known[n]
+}
+
+// enumValue returns the integer value of an enum.
+func enumValue(value reflect.Value) (int64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := value.Uint()
+		return int64(n), int64(n) >= 0
+	}
+	return 0, false
+}
+
+// checkEnum checks if value is a registered value of its type.
+func (ctx *Context) checkEnum(value reflect.Value, opts *fieldOptions) error {
+	if opts.extensible || len(ctx.enums) == 0 {
+		return nil
+	}
+	known := ctx.enums[value.Type()]
+	if known == nil {
+		return nil
+	}
+	n, ok := enumValue(value)
+	if !ok || !known[n] {
+		return fmt.Errorf("unknown value %v for ENUMERATED type '%s'",
+			value.Interface(), value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package asn1
+
+import (
+	"reflect"
+)
+
+// Extension is an extension of a certificate or of any message that follows
+// the pattern of X.509:
+//
+//	Extension ::= SEQUENCE {
+//		extnID    OBJECT IDENTIFIER,
+//		critical  BOOLEAN DEFAULT FALSE,
+//		extnValue OCTET STRING }
+//
+// Value holds the encoding of the value of the extension, which is usually
+// handled with the methods of Extensions.
+type Extension struct {
+	ID       Oid    `asn1:"name:extnID"`
+	Critical bool   `asn1:"optional"`
+	Value    []byte `asn1:"name:extnValue"`
+}
+
+// Extensions is a list of extensions, encoded as a SEQUENCE OF Extension.
+// The values of the extensions are encoded and decoded by Add and Get with
+// the types registered with (*Context).AddExtensionType:
+//
+//	ctx.AddExtensionType(oidBasicConstraints, reflect.TypeOf(BasicConstraints{}), "")
+//	...
+//	var bc BasicConstraints
+//	found, err := cert.Extensions.Get(ctx, oidBasicConstraints, &bc)
+type Extensions []Extension
+
+// extensionType is the type of the value of an extension registered in a
+// Context.
+type extensionType struct {
+	typ     reflect.Type
+	options string
+}
+
+// AddExtensionType registers the Go type of the value of the extension
+// identified by id and the options used to encode and decode it, so the
+// values are converted by Extensions.Add, Get and Value without repeating
+// them.
+func (ctx *Context) AddExtensionType(id Oid, t reflect.Type, options string) error {
+	if len(id) == 0 || t == nil {
+		return syntaxError("invalid extension type for '%s'", id)
+	}
+	key := id.String()
+	if _, ok := ctx.extensionTypes[key]; ok && !ctx.replaceInherited("extension", key) {
+		return syntaxError("extension type already registered: %s", id)
+	}
+	opts, err := ctx.parseOptions(options)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		return syntaxError("invalid options '%s' for extension '%s'", options, id)
+	}
+	if err := ctx.checkType(t, opts, make(map[reflect.Type][]*fieldOptions)); err != nil {
+		return err
+	}
+	ctx.extensionTypes[key] = extensionType{t, options}
+	return nil
+}
+
+// getExtensionOptions returns the options of the value of the extension id
+// and checks that t is its registered type. Unregistered extensions don't
+// have options.
+func (ctx *Context) getExtensionOptions(id Oid, t reflect.Type) (string, error) {
+	entry, ok := ctx.extensionTypes[id.String()]
+	if !ok {
+		return "", nil
+	}
+	if t != entry.typ {
+		return "", syntaxError("invalid Go type '%s' for extension '%s', expecting '%s'",
+			t, id, entry.typ)
+	}
+	return entry.options, nil
+}
+
+// Lookup returns the extension identified by id.
+func (e Extensions) Lookup(id Oid) (Extension, bool) {
+	for _, ext := range e {
+		if ext.ID.Cmp(id) == 0 {
+			return ext, true
+		}
+	}
+	return Extension{}, false
+}
+
+// Get decodes the value of the extension identified by id into obj, which
+// must be a pointer to the registered type of the extension, if any. It
+// returns false if the extension is not present.
+func (e Extensions) Get(ctx *Context, id Oid, obj interface{}) (bool, error) {
+	ext, ok := e.Lookup(id)
+	if !ok {
+		return false, nil
+	}
+	ptr := reflect.ValueOf(obj)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return false, syntaxError("invalid Go type '%T' for extension '%s', expecting a pointer", obj, id)
+	}
+	options, err := ctx.getExtensionOptions(id, ptr.Type().Elem())
+	if err != nil {
+		return false, err
+	}
+	rest, err := ctx.DecodeWithOptions(ext.Value, obj, options)
+	if err != nil {
+		return false, err
+	}
+	if len(rest) > 0 {
+		return false, parseError("trailing data in extension '%s'", id)
+	}
+	return true, nil
+}
+
+// Value decodes the value of the extension identified by id into a new value
+// of its registered type. It returns nil if the extension is not present.
+func (e Extensions) Value(ctx *Context, id Oid) (interface{}, error) {
+	entry, ok := ctx.extensionTypes[id.String()]
+	if !ok {
+		return nil, syntaxError("extension type not registered: %s", id)
+	}
+	value := reflect.New(entry.typ)
+	found, err := e.Get(ctx, id, value.Interface())
+	if err != nil || !found {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// Add encodes value, which must be of the registered type of the extension
+// identified by id, if any, and appends the extension. An extension can't be
+// added twice.
+func (e *Extensions) Add(ctx *Context, id Oid, critical bool, value interface{}) error {
+	if _, ok := e.Lookup(id); ok {
+		return syntaxError("extension already present: %s", id)
+	}
+	if value == nil {
+		return syntaxError("invalid nil value for extension '%s'", id)
+	}
+	options, err := ctx.getExtensionOptions(id, reflect.TypeOf(value))
+	if err != nil {
+		return err
+	}
+	data, err := ctx.EncodeWithOptions(value, options)
+	if err != nil {
+		return err
+	}
+	*e = append(*e, Extension{ID: id, Critical: critical, Value: data})
+	return nil
+}
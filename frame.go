@@ -0,0 +1,190 @@
+package asn1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Framing identifies how messages are delimited in a stream.
+type Framing int
+
+// Framings supported by FrameReader and FrameWriter.
+const (
+	// FramingNone delimits messages by the headers of the ASN.1 elements.
+	FramingNone Framing = iota
+	// FramingLength16 prefixes each message with its length in 2 octets,
+	// in big endian order.
+	FramingLength16
+	// FramingLength32 prefixes each message with its length in 4 octets,
+	// in big endian order.
+	FramingLength32
+	// FramingTPKT uses the TPKT header defined by RFC 1006: the version 3,
+	// a reserved octet and the length of the packet, including the header,
+	// in 2 octets.
+	FramingTPKT
+)
+
+// tpktVersion is the version of the TPKT header.
+const tpktVersion = 3
+
+// headerSize returns the number of octets of the frame header.
+func (f Framing) headerSize() int {
+	switch f {
+	case FramingLength16:
+		return 2
+	case FramingLength32, FramingTPKT:
+		return 4
+	}
+	return 0
+}
+
+// FrameReader reads complete top-level ASN.1 elements from a stream.
+//
+// Most stream based protocols, such as LDAP, send their messages as a sequence
+// of BER encoded elements without any additional framing. FrameReader uses the
+// element headers to find where each message ends, including elements encoded
+// with the indefinite length form. Protocols that prefix messages with their
+// lengths are supported by NewFramedReader.
+type FrameReader struct {
+	reader  io.Reader
+	framing Framing
+	maxSize int
+}
+
+// NewFrameReader creates a FrameReader that reads from reader.
+func NewFrameReader(reader io.Reader) *FrameReader {
+	return &FrameReader{reader: reader}
+}
+
+// NewFramedReader creates a FrameReader that reads messages delimited by the
+// given framing.
+func NewFramedReader(reader io.Reader, framing Framing) *FrameReader {
+	return &FrameReader{reader: reader, framing: framing}
+}
+
+// SetMaxFrameSize limits the size of the messages read. Larger messages
+// result in an error before their content is read, or as soon as the limit is
+// reached for elements in the indefinite length form. Zero, the default,
+// means no limit.
+func (r *FrameReader) SetMaxFrameSize(size int) {
+	r.maxSize = size
+}
+
+// ReadFrame returns the next complete element, including its identifier and
+// length octets. The returned bytes can be decoded with Decode or
+// DecodeWithOptions. When a framing with a length prefix is used, the message
+// is returned without the prefix.
+//
+// ReadFrame returns io.EOF if the stream ends at an element boundary and
+// io.ErrUnexpectedEOF if the stream ends in the middle of an element.
+func (r *FrameReader) ReadFrame() ([]byte, error) {
+	if r.framing != FramingNone {
+		return r.readPrefixedFrame()
+	}
+	buffer := &bytes.Buffer{}
+	reader := r.reader
+	var limited *io.LimitedReader
+	if r.maxSize > 0 {
+		limited = &io.LimitedReader{R: r.reader, N: int64(r.maxSize)}
+		reader = limited
+	}
+	_, err := decodeLimitedRawValue(io.TeeReader(reader, buffer),
+		rawLimits{maxContentLength: r.maxSize})
+	if err != nil {
+		if limited != nil && limited.N == 0 && buffer.Len() > 0 {
+			return nil, parseError("frame exceeds the limit of %d octets", r.maxSize)
+		}
+		if err == io.EOF && buffer.Len() > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// readPrefixedFrame reads a message with a length prefix.
+func (r *FrameReader) readPrefixedFrame() ([]byte, error) {
+	size := r.framing.headerSize()
+	if size == 0 {
+		return nil, syntaxError("invalid framing: %d", r.framing)
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return nil, err
+	}
+
+	var length int
+	switch r.framing {
+	case FramingLength16:
+		length = int(binary.BigEndian.Uint16(header))
+	case FramingLength32:
+		length = int(binary.BigEndian.Uint32(header))
+		if length < 0 {
+			return nil, parseError("frame length too big")
+		}
+	case FramingTPKT:
+		if header[0] != tpktVersion {
+			return nil, parseError("invalid TPKT version: %d", header[0])
+		}
+		length = int(binary.BigEndian.Uint16(header[2:])) - size
+		if length < 0 {
+			return nil, parseError("invalid TPKT length: %d", length+size)
+		}
+	}
+	if r.maxSize > 0 && length > r.maxSize {
+		return nil, parseError("frame of %d octets exceeds the limit of %d", length, r.maxSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// FrameWriter writes messages to a stream with a length prefix.
+type FrameWriter struct {
+	writer  io.Writer
+	framing Framing
+}
+
+// NewFrameWriter creates a FrameWriter that writes messages to writer
+// delimited by the given framing.
+func NewFrameWriter(writer io.Writer, framing Framing) *FrameWriter {
+	return &FrameWriter{writer, framing}
+}
+
+// WriteFrame writes a message, usually an encoded ASN.1 element, preceded by
+// the header of the framing. The header and the message are written in a
+// single call to the underlying writer.
+func (w *FrameWriter) WriteFrame(data []byte) error {
+	size := w.framing.headerSize()
+	frame := make([]byte, size, size+len(data))
+	switch w.framing {
+	case FramingNone:
+	case FramingLength16:
+		if len(data) > 0xffff {
+			return syntaxError("frame of %d octets is too big", len(data))
+		}
+		binary.BigEndian.PutUint16(frame, uint16(len(data)))
+	case FramingLength32:
+		if uint64(len(data)) > 0xffffffff {
+			return syntaxError("frame of %d octets is too big", len(data))
+		}
+		binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	case FramingTPKT:
+		if len(data)+size > 0xffff {
+			return syntaxError("frame of %d octets is too big", len(data))
+		}
+		frame[0] = tpktVersion
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(data)+size))
+	default:
+		return syntaxError("invalid framing: %d", w.framing)
+	}
+	_, err := w.writer.Write(append(frame, data...))
+	return err
+}
@@ -0,0 +1,87 @@
+package asn1
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ISOTime is used to encode and decode the ASN.1 TIME type, which holds time
+// values in the ISO 8601 representation.
+//
+// ISO 8601 allows values that can't be represented by time.Time, such as
+// intervals, durations and recurrences. When one of those values is decoded,
+// Time is left as the zero value and the original string is kept in Raw.
+//
+// A value without a time zone is a local time whose offset from UTC is not
+// known. It's decoded into Time in UTC with Local set, and it's encoded
+// without a time zone while Local is set.
+type ISOTime struct {
+	time.Time
+	// Raw holds the ISO 8601 string when it can't be parsed. If set, it's
+	// encoded instead of Time.
+	Raw string
+	// Local is set when the value has no time zone.
+	Local bool
+}
+
+// isoTimeLayouts are the ISO 8601 layouts accepted when decoding, in both the
+// extended and the basic formats.
+var isoTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"20060102T150405.999999999Z0700",
+	"20060102T150405.999999999",
+	"20060102T1504Z0700",
+	"20060102T1504",
+	"20060102",
+}
+
+// isoTimeLocalLayout is the layout used to encode values without a time
+// zone.
+const isoTimeLocalLayout = "2006-01-02T15:04:05.999999999"
+
+// parseISOTime parses an ISO 8601 date and time. Values without a time zone
+// are returned in UTC and reported as local.
+func parseISOTime(s string) (t time.Time, local bool, ok bool) {
+	for _, layout := range isoTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, !strings.HasSuffix(layout, "07:00") && !strings.HasSuffix(layout, "0700"), true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+func (ctx *Context) encodeISOTime(value reflect.Value) ([]byte, error) {
+	isoTime, ok := value.Interface().(ISOTime)
+	if !ok {
+		return nil, wrongType(isoTimeType.String(), value)
+	}
+	if isoTime.Raw != "" {
+		return []byte(isoTime.Raw), nil
+	}
+	if isoTime.Local {
+		return []byte(isoTime.Format(isoTimeLocalLayout)), nil
+	}
+	return []byte(isoTime.Format(time.RFC3339Nano)), nil
+}
+
+func (ctx *Context) decodeISOTime(data []byte, value reflect.Value) error {
+	if len(data) == 0 {
+		return parseError("empty TIME value")
+	}
+	s := string(data)
+	var isoTime ISOTime
+	if t, local, ok := parseISOTime(s); ok {
+		isoTime.Time = t
+		isoTime.Local = local
+	} else {
+		isoTime.Raw = s
+	}
+	value.Set(reflect.ValueOf(isoTime))
+	return nil
+}
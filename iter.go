@@ -0,0 +1,52 @@
+//go:build go1.23
+
+package asn1
+
+import (
+	"bytes"
+	"iter"
+)
+
+// Elements returns an iterator over the consecutive elements encoded in data,
+// which can be used with the range-over-func syntax:
+//
+//	for elem, err := range ctx.Elements(data) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The elements are parsed lazily, one per iteration, so breaking the loop
+// skips the rest of data. The items of a SEQUENCE OF, or of any nested
+// constructed element, are iterated by calling Elements with the Content of
+// the element. FullBytes is a slice of data.
+//
+// If an element can't be parsed, the error is yielded with an empty RawValue
+// and the iteration stops.
+func (ctx *Context) Elements(data []byte) iter.Seq2[RawValue, error] {
+	return func(yield func(RawValue, error) bool) {
+		reader := bytes.NewBuffer(data)
+		for reader.Len() > 0 {
+			start := len(data) - reader.Len()
+			raw, err := ctx.readRawValue(reader)
+			if err == nil && ctx.der.decoding && raw.Indefinite {
+				err = parseError("indefinite length form is not supported by DER mode")
+			}
+			if err != nil {
+				yield(RawValue{}, err)
+				return
+			}
+			elem := RawValue{
+				Class:       raw.Class,
+				Tag:         raw.Tag,
+				Constructed: raw.Constructed,
+				Content:     raw.Content,
+				FullBytes:   data[start : len(data)-reader.Len()],
+			}
+			if !yield(elem, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build go1.23
+
+package asn1
+
+import (
+	"testing"
+)
+
+func TestElements(t *testing.T) {
+	ctx := NewContext()
+	data, err := ctx.Encode([][]int{{1, 2}, {3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outer []RawValue
+	for elem, err := range ctx.Elements(data) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		outer = append(outer, elem)
+	}
+	if len(outer) != 1 || outer[0].Tag != TagSequence || !outer[0].Constructed {
+		t.Fatalf("unexpected elements %v", outer)
+	}
+	checkEqual(t, outer[0].FullBytes, data)
+
+	// Nested SEQUENCE OF
+	var values []int
+	for seq, err := range ctx.Elements(outer[0].Content) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for item, err := range ctx.Elements(seq.Content) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			if _, err := ctx.Decode(item.FullBytes, &n); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, n)
+		}
+	}
+	checkEqual(t, values, []int{1, 2, 3})
+
+	// Breaking the loop stops the parsing, including of invalid data
+	count := 0
+	for _, err := range ctx.Elements([]byte{0x02, 0x01, 0x01, 0x02, 0x05}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("got %d elements, expected 1", count)
+	}
+
+	// Errors stop the iteration
+	var errs []error
+	for _, err := range ctx.Elements([]byte{0x02, 0x01, 0x01, 0x02, 0x05}) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 2 || errs[0] != nil || errs[1] == nil {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
@@ -0,0 +1,92 @@
+package asn1
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// ParseOid parses the dotted representation of an OBJECT IDENTIFIER, such as
+// "1.2.840.113549". A leading dot, as produced by Oid.String, is accepted.
+func ParseOid(s string) (Oid, error) {
+	s = strings.TrimPrefix(s, ".")
+	if s == "" {
+		return Oid{}, nil
+	}
+	arcs := strings.Split(s, ".")
+	oid := make(Oid, len(arcs))
+	for i, arc := range arcs {
+		n, err := strconv.ParseUint(arc, 10, intBits)
+		if err != nil {
+			return nil, parseError("invalid OBJECT IDENTIFIER '%s'", s)
+		}
+		oid[i] = uint(n)
+	}
+	return oid, nil
+}
+
+// MarshalJSON encodes oid as a JSON string in the dotted form without the
+// leading dot, such as "1.2.840.113549".
+func (oid Oid) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.TrimPrefix(oid.String(), "."))
+}
+
+// UnmarshalJSON decodes an Oid from a JSON string in the dotted form.
+func (oid *Oid) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseOid(s)
+	if err != nil {
+		return err
+	}
+	*oid = parsed
+	return nil
+}
+
+// jsonBitString is the JSON representation of a BitString.
+type jsonBitString struct {
+	Hex       string `json:"hex"`
+	BitLength int    `json:"bitLength"`
+}
+
+// MarshalJSON encodes b as a JSON object with the bits in hexadecimal and
+// the number of bits, such as {"hex":"a0","bitLength":3}.
+func (b BitString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonBitString{hex.EncodeToString(b.Bytes), b.BitLength})
+}
+
+// UnmarshalJSON decodes a BitString from the JSON object produced by
+// MarshalJSON.
+func (b *BitString) UnmarshalJSON(data []byte) error {
+	var obj jsonBitString
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	bytes, err := hex.DecodeString(obj.Hex)
+	if err != nil {
+		return err
+	}
+	if obj.BitLength < 0 || obj.BitLength > len(bytes)*8 ||
+		obj.BitLength <= (len(bytes)-1)*8 {
+		return parseError("invalid bit length %d for %d bytes", obj.BitLength, len(bytes))
+	}
+	b.Bytes = bytes
+	b.BitLength = obj.BitLength
+	return nil
+}
+
+// MarshalJSON encodes Null as the JSON null.
+func (Null) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON accepts only the JSON null.
+func (*Null) UnmarshalJSON(data []byte) error {
+	if string(data) != "null" {
+		return parseError("invalid JSON value for NULL: %s", data)
+	}
+	return nil
+}
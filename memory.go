@@ -0,0 +1,125 @@
+package asn1
+
+import (
+	"math/big"
+	"math/bits"
+	"reflect"
+)
+
+// DecodeMetrics describes the resources used by a call to DecodeWithOptions,
+// as reported to the handler set with (*Context).SetMetricsHandler.
+type DecodeMetrics struct {
+	// Elements is the number of elements read, including nested ones.
+	Elements int
+	// Allocated is an estimate of the number of bytes allocated: the content
+	// of the elements read, which is copied for each nesting level, and the
+	// memory referenced by the decoded values, such as strings, slices,
+	// integers of arbitrary precision and the values allocated for pointers.
+	Allocated int64
+	// Err is the error returned by the decoding, if any.
+	Err error
+}
+
+// SetMetricsHandler sets a function called at the end of each call to
+// DecodeWithOptions, and the functions based on it, with the resources used
+// by the decoding, which allows capacity planning and per-tenant accounting.
+// The handler is called even if the decoding fails. Decodings made while
+// decoding, such as the content of encrypted fields, are accounted in the
+// enclosing decoding. A nil handler disables the reports.
+func (ctx *Context) SetMetricsHandler(handler func(DecodeMetrics)) {
+	ctx.metricsHandler = handler
+}
+
+// SetMemoryBudget limits the number of bytes that a single call to
+// DecodeWithOptions can allocate, as estimated by DecodeMetrics.Allocated. A
+// ParseError is returned as soon as the budget is exceeded, and elements
+// whose content doesn't fit in the remaining budget are rejected before their
+// content is read. Zero, the default, disables the limit.
+//
+// The budget bounds the memory that a single message can consume in a decoder
+// shared by several tenants, which the length of the data alone does not,
+// since nested elements multiply the memory used.
+func (ctx *Context) SetMemoryBudget(bytes int64) {
+	ctx.memoryBudget = bytes
+}
+
+// memoryAccount keeps the resources used by a decoding.
+type memoryAccount struct {
+	metrics DecodeMetrics
+	budget  int64
+}
+
+// decodeAccounted decodes data with a new memoryAccount and reports its
+// metrics.
+func (ctx *Context) decodeAccounted(data []byte, obj interface{}, options string) ([]byte, error) {
+	accountCtx := *ctx
+	account := &memoryAccount{budget: ctx.memoryBudget}
+	accountCtx.memory = account
+	rest, err := accountCtx.DecodeWithOptions(data, obj, options)
+	if ctx.metricsHandler != nil {
+		account.metrics.Err = err
+		ctx.metricsHandler(account.metrics)
+	}
+	return rest, err
+}
+
+// remaining returns the number of bytes left in the budget, or 0 if there is
+// no budget.
+func (a *memoryAccount) remaining() int {
+	if a.budget <= 0 {
+		return 0
+	}
+	left := a.budget - a.metrics.Allocated
+	if left < 1 {
+		// Zero would disable the limit
+		left = 1
+	}
+	if left > int64(maxInt) {
+		return maxInt
+	}
+	return int(left)
+}
+
+// maxInt is the greatest value of an int.
+const maxInt = int(^uint(0) >> 1)
+
+// exceeded checks if the budget is exceeded.
+func (a *memoryAccount) exceeded() bool {
+	return a.budget > 0 && a.metrics.Allocated > a.budget
+}
+
+// charge adds n allocated bytes and returns an error if they exceed the
+// budget.
+func (a *memoryAccount) charge(n int64) error {
+	a.metrics.Allocated += n
+	if a.budget > 0 && a.metrics.Allocated > a.budget {
+		return parseError("decoding exceeds the memory budget of %d bytes", a.budget)
+	}
+	return nil
+}
+
+// chargeValue charges the memory referenced by a decoded value. Only the
+// memory directly referenced by the value is counted, since its nested values
+// are charged when they are decoded.
+func (a *memoryAccount) chargeValue(value reflect.Value) error {
+	var n int64
+	switch value.Kind() {
+	case reflect.String:
+		n = int64(value.Len())
+	case reflect.Slice:
+		n = int64(value.Cap()) * int64(value.Type().Elem().Size())
+	case reflect.Ptr:
+		if value.IsNil() {
+			break
+		}
+		n = int64(value.Type().Elem().Size())
+		if value.Type() == bigIntType {
+			n += int64(len(value.Interface().(*big.Int).Bits())) * bits.UintSize / 8
+		}
+	case reflect.Interface:
+		if !value.IsNil() {
+			n = int64(value.Elem().Type().Size())
+		}
+	}
+	return a.charge(n)
+}
@@ -0,0 +1,878 @@
+package asn1
+
+import (
+	"bytes"
+	stdasn1 "encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ToValueNotation returns obj in the ASN.1 value notation defined by X.680,
+// such as:
+//
+//	{ version 2, serialNumber 1234, subject "example" }
+//
+// It's intended for human review of values and for comparing them with the
+// examples of specifications. The names of the components of a SEQUENCE or
+// SET are the names of the Go fields with the first letter in lower case.
+// The alternatives of a CHOICE are written as "identifier : value", where the
+// identifier is the name of the Go type of the value with the first letter
+// in lower case, or the name of the field for choices registered with
+// AddChoiceFromStruct. OPTIONAL and DEFAULT components are omitted when they
+// would not be encoded.
+//
+// Time values are written as the strings used in their encodings. ENUMERATED
+// values are written as numbers, unless their type was registered with
+// AddNamedEnum. REAL values are written as decimal numbers, such as 2.5 or
+// 1E-3, or as PLUS-INFINITY, MINUS-INFINITY and NOT-A-NUMBER.
+func (ctx *Context) ToValueNotation(obj interface{}) (string, error) {
+	w := notationWriter{ctx: ctx}
+	if err := w.write(reflect.ValueOf(obj), &fieldOptions{}); err != nil {
+		return "", err
+	}
+	return w.buf.String(), nil
+}
+
+// EncodeGSER returns obj encoded with the Generic String Encoding Rules
+// defined by RFC 3641, used by LDAP and directory tools, such as:
+//
+//	{ version 2, serialNumber 1234, signature { algorithm 1.2.840.113549.1.1.11 } }
+//
+// GSER differs from the value notation written by ToValueNotation in the
+// OBJECT IDENTIFIERs, which use the dotted form, and in the alternatives of
+// CHOICEs, written as "identifier:value". Names of components and
+// alternatives follow the same rules of ToValueNotation.
+func (ctx *Context) EncodeGSER(obj interface{}) (string, error) {
+	w := notationWriter{ctx: ctx, gser: true}
+	if err := w.write(reflect.ValueOf(obj), &fieldOptions{}); err != nil {
+		return "", err
+	}
+	return w.buf.String(), nil
+}
+
+// Dump returns obj in the value notation written by ToValueNotation, with the
+// content of the fields marked with the option "sensitive" replaced by
+// <redacted>. It's intended for logs of decoded or encoded messages.
+func (ctx *Context) Dump(obj interface{}) (string, error) {
+	w := notationWriter{ctx: ctx, redact: true}
+	if err := w.write(reflect.ValueOf(obj), &fieldOptions{}); err != nil {
+		return "", err
+	}
+	return w.buf.String(), nil
+}
+
+// redacted replaces the content of sensitive fields written by Dump.
+const redacted = "<redacted>"
+
+// notationWriter writes values in the value notation or in GSER.
+type notationWriter struct {
+	ctx    *Context
+	gser   bool
+	redact bool
+	buf    bytes.Buffer
+}
+
+// write writes a single value.
+func (w *notationWriter) write(value reflect.Value, opts *fieldOptions) error {
+	if !value.IsValid() {
+		return syntaxError("cannot write a nil value")
+	}
+	if opts.choice != nil {
+		return w.writeChoice(value, opts.choice)
+	}
+
+	// Special types:
+	switch value.Type() {
+	case bigIntType:
+		num := value.Interface().(*big.Int)
+		if num == nil {
+			num = new(big.Int)
+		}
+		w.buf.WriteString(num.String())
+		return nil
+	case bitStringType:
+		w.buf.WriteString(value.Interface().(BitString).String())
+		return nil
+	case stdBitStringType:
+		data, err := w.ctx.encodeStdBitString(value)
+		if err != nil {
+			return err
+		}
+		bitString := BitString{Bytes: data[1:], BitLength: (len(data)-1)*8 - int(data[0])}
+		w.buf.WriteString(bitString.String())
+		return nil
+	case oidType, stdOidType, bigOidType:
+		separator := " "
+		if w.gser {
+			separator = "."
+		} else {
+			w.buf.WriteString("{ ")
+		}
+		for i := 0; i < value.Len(); i++ {
+			if i > 0 {
+				w.buf.WriteString(separator)
+			}
+			if n, ok := value.Index(i).Interface().(*big.Int); ok {
+				w.buf.WriteString(n.String())
+				continue
+			}
+			w.buf.WriteString(strconv.FormatInt(value.Index(i).Convert(reflect.TypeOf(int64(0))).Int(), 10))
+		}
+		if !w.gser {
+			w.buf.WriteString(" }")
+		}
+		return nil
+	case nullType:
+		w.buf.WriteString("NULL")
+		return nil
+	case utcTimeType:
+		return w.writeEncodedString(w.ctx.encodeUTCTime(value))
+	case isoTimeType:
+		return w.writeEncodedString(w.ctx.encodeISOTime(value))
+	case generalizedTimeType:
+		return w.writeEncodedString(w.ctx.encodeGeneralizedTime(value))
+	case timeType, goTimeType:
+		_, encoder := w.ctx.getTimeEncoder(value)
+		return w.writeEncodedString(encoder(value))
+	}
+
+	if isNumberType(value.Type()) {
+		data, err := w.ctx.encodeNumber(value)
+		if err != nil {
+			return err
+		}
+		w.buf.WriteString(parseBigInt(data).String())
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if value.IsNil() {
+			return syntaxError("cannot write a nil value of Go type '%s'", value.Type())
+		}
+		return w.write(value.Elem(), opts)
+
+	case reflect.Bool:
+		if value.Bool() {
+			w.buf.WriteString("TRUE")
+		} else {
+			w.buf.WriteString("FALSE")
+		}
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if name, ok := w.ctx.EnumName(value.Interface()); ok {
+			w.buf.WriteString(name)
+			return nil
+		}
+		w.buf.WriteString(strconv.FormatInt(value.Int(), 10))
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if name, ok := w.ctx.EnumName(value.Interface()); ok {
+			w.buf.WriteString(name)
+			return nil
+		}
+		w.buf.WriteString(strconv.FormatUint(value.Uint(), 10))
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		w.buf.WriteString(formatReal(value.Float(), value.Type().Bits()))
+		return nil
+
+	case reflect.String:
+		w.writeString(value.String())
+		return nil
+
+	case reflect.Struct:
+		return w.writeStruct(value)
+
+	case reflect.Slice, reflect.Array:
+		switch value.Type().Elem().Kind() {
+		case reflect.Uint8:
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			w.buf.WriteString("'" + strings.ToUpper(hex.EncodeToString(data)) + "'H")
+			return nil
+		case reflect.Interface:
+			if opts.choices == nil && len(w.ctx.elementTypes) == 0 {
+				break
+			}
+			return w.writeList(value, func(item reflect.Value) error {
+				return w.writeChoice(item, opts.choices)
+			})
+		default:
+			return w.writeList(value, func(item reflect.Value) error {
+				return w.write(item, &fieldOptions{})
+			})
+		}
+	}
+	return syntaxError("invalid Go type: %s", value.Type())
+}
+
+// writeString writes a quoted string. Quotation marks are doubled.
+func (w *notationWriter) writeString(s string) {
+	w.buf.WriteString(`"` + strings.Replace(s, `"`, `""`, -1) + `"`)
+}
+
+// writeEncodedString writes the result of an encoder as a quoted string.
+func (w *notationWriter) writeEncodedString(data []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	w.writeString(string(data))
+	return nil
+}
+
+// writeStruct writes a SEQUENCE or SET value.
+func (w *notationWriter) writeStruct(value reflect.Value) error {
+	first := true
+	w.buf.WriteString("{")
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !isFieldExported(field) {
+			continue
+		}
+		opts, err := w.ctx.getFieldOptions(value.Type(), i)
+		if err != nil {
+			return err
+		}
+		if opts == nil || opts.absent {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if (opts.optional || opts.defaultValue != nil) && isEmpty(fieldValue) {
+			continue
+		}
+		if !first {
+			w.buf.WriteString(",")
+		}
+		first = false
+		w.buf.WriteString(" " + componentIdentifier(field, opts) + " ")
+		if w.redact && opts.sensitive {
+			w.buf.WriteString(redacted)
+			continue
+		}
+		if err := w.write(fieldValue, opts); err != nil {
+			return err
+		}
+	}
+	if !first {
+		w.buf.WriteString(" ")
+	}
+	w.buf.WriteString("}")
+	return nil
+}
+
+// writeList writes a SEQUENCE OF or SET OF value using writeItem for each
+// item.
+func (w *notationWriter) writeList(value reflect.Value, writeItem func(reflect.Value) error) error {
+	w.buf.WriteString("{")
+	for i := 0; i < value.Len(); i++ {
+		if i > 0 {
+			w.buf.WriteString(",")
+		}
+		w.buf.WriteString(" ")
+		if err := writeItem(value.Index(i)); err != nil {
+			return err
+		}
+	}
+	if value.Len() > 0 {
+		w.buf.WriteString(" ")
+	}
+	w.buf.WriteString("}")
+	return nil
+}
+
+// writeChoice writes a CHOICE value with the identifier of its alternative.
+// A nil choice refers to the element types of the Context.
+func (w *notationWriter) writeChoice(value reflect.Value, choice *string) error {
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return syntaxError("cannot write a nil value of Go type '%s'", value.Type())
+		}
+		value = value.Elem()
+	}
+	entry, err := w.ctx.getAlternative(choice, value.Type())
+	if err != nil {
+		return err
+	}
+	identifier := entry.identifier()
+	if identifier == "" {
+		return syntaxError("alternative of Go type '%s' has no name", entry.typ)
+	}
+	w.buf.WriteString(identifier)
+	if w.gser {
+		w.buf.WriteString(":")
+	} else {
+		w.buf.WriteString(" : ")
+	}
+	if w.redact && entry.opts.sensitive {
+		w.buf.WriteString(redacted)
+		return nil
+	}
+	return w.write(value, entry.opts)
+}
+
+// getAlternative returns the entry of a choice for the Go type t. A nil choice
+// refers to the element types of the Context.
+func (ctx *Context) getAlternative(choice *string, t reflect.Type) (choiceEntry, error) {
+	if choice != nil {
+		return ctx.getChoiceByType(*choice, t)
+	}
+	for _, entry := range ctx.elementTypes {
+		if entry.typ == t {
+			return entry, nil
+		}
+	}
+	return choiceEntry{}, syntaxError("element type not registered: %s", t)
+}
+
+// notationIdentifier returns the identifier used in the value notation for a
+// Go name.
+func notationIdentifier(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+// componentIdentifier returns the identifier of a struct field in the value
+// notation, which is given by the option "name" or derived from the field name.
+func componentIdentifier(field reflect.StructField, opts *fieldOptions) string {
+	if opts != nil && opts.name != nil {
+		return *opts.name
+	}
+	return notationIdentifier(field.Name)
+}
+
+// isNotationIdentifier checks if s is a valid identifier: a lower case letter
+// followed by letters, digits and single hyphens, not ending in a hyphen.
+func isNotationIdentifier(s string) bool {
+	if s == "" || s[0] < 'a' || s[0] > 'z' || strings.HasSuffix(s, "-") ||
+		strings.Contains(s, "--") {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') &&
+			!(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseValueNotation parses text in the ASN.1 value notation into obj, which
+// should be a reference to the value that will hold the parsed data. The
+// notation is the same used by ToValueNotation, so test fixtures can be
+// written as in the examples of specifications:
+//
+//	var cert Certificate
+//	err := ctx.ParseValueNotation(`{ version 2, serialNumber 1234 }`, &cert)
+//
+// Components missing from a SEQUENCE or SET are set to their DEFAULT value or
+// left unset if they are OPTIONAL. OBJECT IDENTIFIERs accept the forms
+// "{ 1 2 3 }" and "{ iso(1) member-body(2) 3 }". BIT STRINGs and OCTET
+// STRINGs accept bstrings, such as '101'B, and hstrings, such as 'A0'H.
+func (ctx *Context) ParseValueNotation(text string, obj interface{}) error {
+	value := reflect.ValueOf(obj)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		value = value.Elem()
+	}
+	if !value.CanSet() {
+		return syntaxError("go type '%s' is read-only", value.Type())
+	}
+	p := notationParser{ctx: ctx, text: text}
+	if err := p.parse(value, &fieldOptions{}); err != nil {
+		return err
+	}
+	if token := p.next(); token != "" {
+		return p.errorf("unexpected '%s' after value", token)
+	}
+	return nil
+}
+
+// notationParser parses values in the value notation.
+type notationParser struct {
+	ctx  *Context
+	text string
+	pos  int
+}
+
+// errorf returns a ParseError with the current position.
+func (p *notationParser) errorf(msg string, args ...interface{}) error {
+	return parseError("value notation at offset %d: %s", p.pos,
+		fmt.Sprintf(msg, args...))
+}
+
+// next reads the next token: a punctuation character, a quoted string, a
+// bstring or hstring, or a word. An empty string is returned at the end of
+// the text.
+func (p *notationParser) next() string {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+	if p.pos >= len(p.text) {
+		return ""
+	}
+	start := p.pos
+	switch c := p.text[p.pos]; c {
+	case '{', '}', ',', ':':
+		p.pos++
+	case '"':
+		p.pos++
+		for p.pos < len(p.text) {
+			if p.text[p.pos] == '"' {
+				// Doubled quotation marks are part of the string
+				if p.pos+1 < len(p.text) && p.text[p.pos+1] == '"' {
+					p.pos += 2
+					continue
+				}
+				break
+			}
+			p.pos++
+		}
+		p.pos++
+	case '\'':
+		p.pos++
+		for p.pos < len(p.text) && p.text[p.pos] != '\'' {
+			p.pos++
+		}
+		// Include the closing quote and the letter B or H
+		p.pos += 2
+	default:
+		for p.pos < len(p.text) && !strings.ContainsRune("{},:\"' \t\r\n", rune(p.text[p.pos])) {
+			p.pos++
+		}
+	}
+	if p.pos > len(p.text) {
+		p.pos = len(p.text)
+	}
+	return p.text[start:p.pos]
+}
+
+// peek returns the next token without consuming it.
+func (p *notationParser) peek() string {
+	pos := p.pos
+	token := p.next()
+	p.pos = pos
+	return token
+}
+
+// expect consumes the next token, which must be the given one.
+func (p *notationParser) expect(expected string) error {
+	if token := p.next(); token != expected {
+		return p.errorf("expected '%s' but found '%s'", expected, token)
+	}
+	return nil
+}
+
+// nextString reads a quoted string.
+func (p *notationParser) nextString() (string, error) {
+	token := p.next()
+	if len(token) < 2 || token[0] != '"' || token[len(token)-1] != '"' {
+		return "", p.errorf("expected a string but found '%s'", token)
+	}
+	return strings.Replace(token[1:len(token)-1], `""`, `"`, -1), nil
+}
+
+// nextBitString reads a bstring or a hstring.
+func (p *notationParser) nextBitString() (BitString, error) {
+	token := p.next()
+	if !strings.HasPrefix(token, "'") {
+		return BitString{}, p.errorf("expected a bstring or hstring but found '%s'", token)
+	}
+	b, err := parseBitString(strings.Join(strings.Fields(token), ""))
+	if err != nil {
+		return BitString{}, p.errorf("%s", err)
+	}
+	return b, nil
+}
+
+// parse parses a single value.
+func (p *notationParser) parse(value reflect.Value, opts *fieldOptions) error {
+	if opts.choice != nil {
+		return p.parseChoice(value, opts.choice)
+	}
+
+	// Special types:
+	switch value.Type() {
+	case bigIntType:
+		token := p.next()
+		num, ok := new(big.Int).SetString(token, 10)
+		if !ok {
+			return p.errorf("invalid INTEGER '%s'", token)
+		}
+		value.Set(reflect.ValueOf(num))
+		return nil
+	case bitStringType, stdBitStringType:
+		b, err := p.nextBitString()
+		if err != nil {
+			return err
+		}
+		if value.Type() == stdBitStringType {
+			value.Set(reflect.ValueOf(stdasn1.BitString{Bytes: b.Bytes, BitLength: b.BitLength}))
+		} else {
+			value.Set(reflect.ValueOf(b))
+		}
+		return nil
+	case oidType, stdOidType, bigOidType:
+		return p.parseOid(value)
+	case nullType:
+		return p.expect("NULL")
+	case utcTimeType, isoTimeType, generalizedTimeType, timeType, goTimeType:
+		s, err := p.nextString()
+		if err != nil {
+			return err
+		}
+		switch value.Type() {
+		case utcTimeType:
+			return p.ctx.decodeUTCTime([]byte(s), value)
+		case generalizedTimeType:
+			return p.ctx.decodeGeneralizedTime([]byte(s), value)
+		case timeType, goTimeType:
+			// The UTCTime form is tried first, since a UTCTime may also
+			// be parsed as a GeneralizedTime in a different century
+			t, err := parseUTCTime([]byte(s))
+			if err != nil {
+				t, err = p.ctx.parseGeneralizedTime(s)
+			}
+			if err != nil {
+				return p.errorf("invalid Time '%s'", s)
+			}
+			setTime(value, t)
+			return nil
+		}
+		return p.ctx.decodeISOTime([]byte(s), value)
+	}
+
+	if isNumberType(value.Type()) {
+		token := p.next()
+		num, ok := new(big.Int).SetString(token, 10)
+		if !ok {
+			return p.errorf("invalid INTEGER '%s'", token)
+		}
+		return p.ctx.setNumber(numberOf(value), num, value.Type())
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return p.parse(value.Elem(), opts)
+
+	case reflect.Bool:
+		switch token := p.next(); token {
+		case "TRUE":
+			value.SetBool(true)
+		case "FALSE":
+			value.SetBool(false)
+		default:
+			return p.errorf("invalid BOOLEAN '%s'", token)
+		}
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		token := p.next()
+		if n, ok := p.ctx.enumValueByName(value.Type(), token); ok {
+			value.SetInt(n)
+			return nil
+		}
+		n, err := strconv.ParseInt(token, 10, value.Type().Bits())
+		if err != nil {
+			return p.errorf("invalid INTEGER '%s' for Go type '%s'", token, value.Type())
+		}
+		value.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		token := p.next()
+		if n, ok := p.ctx.enumValueByName(value.Type(), token); ok {
+			value.SetUint(uint64(n))
+			return nil
+		}
+		n, err := strconv.ParseUint(token, 10, value.Type().Bits())
+		if err != nil {
+			return p.errorf("invalid INTEGER '%s' for Go type '%s'", token, value.Type())
+		}
+		value.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		token := p.next()
+		f, err := parseReal(token, value.Type().Bits())
+		if err != nil {
+			return p.errorf("invalid REAL '%s' for Go type '%s'", token, value.Type())
+		}
+		value.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		s, err := p.nextString()
+		if err != nil {
+			return err
+		}
+		value.SetString(s)
+		return nil
+
+	case reflect.Struct:
+		return p.parseStruct(value)
+
+	case reflect.Slice, reflect.Array:
+		switch value.Type().Elem().Kind() {
+		case reflect.Uint8:
+			b, err := p.nextBitString()
+			if err != nil {
+				return err
+			}
+			if b.BitLength%8 != 0 {
+				return p.errorf("OCTET STRING with %d bits", b.BitLength)
+			}
+			return setBytes(value, b.Bytes)
+		case reflect.Interface:
+			if opts.choices == nil && len(p.ctx.elementTypes) == 0 {
+				break
+			}
+			return p.parseList(value, func(item reflect.Value) error {
+				return p.parseChoice(item, opts.choices)
+			})
+		default:
+			return p.parseList(value, func(item reflect.Value) error {
+				return p.parse(item, &fieldOptions{})
+			})
+		}
+	}
+	return syntaxError("invalid Go type: %s", value.Type())
+}
+
+// formatReal formats a REAL value as a realnumber or as one of the special
+// values of the value notation. The exponent has no plus sign, which the
+// notation doesn't allow.
+func formatReal(f float64, bitSize int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "PLUS-INFINITY"
+	case math.IsInf(f, -1):
+		return "MINUS-INFINITY"
+	case math.IsNaN(f):
+		return "NOT-A-NUMBER"
+	}
+	return strings.Replace(strconv.FormatFloat(f, 'G', -1, bitSize), "E+", "E", 1)
+}
+
+// parseReal parses a REAL value written by formatReal.
+func parseReal(token string, bitSize int) (float64, error) {
+	switch token {
+	case "PLUS-INFINITY":
+		return math.Inf(1), nil
+	case "MINUS-INFINITY":
+		return math.Inf(-1), nil
+	case "NOT-A-NUMBER":
+		return math.NaN(), nil
+	}
+	// Special values of strconv are not realnumbers
+	if token == "" || strings.ContainsAny(token, "nNiIxXpP_") {
+		return 0, fmt.Errorf("invalid realnumber")
+	}
+	return strconv.ParseFloat(token, bitSize)
+}
+
+// setBytes sets a byte slice or array.
+func setBytes(value reflect.Value, data []byte) error {
+	if value.Kind() == reflect.Array {
+		if value.Len() != len(data) {
+			return parseError("expected %d octets but found %d", value.Len(), len(data))
+		}
+		reflect.Copy(value, reflect.ValueOf(data))
+		return nil
+	}
+	slice := reflect.MakeSlice(value.Type(), len(data), len(data))
+	reflect.Copy(slice, reflect.ValueOf(data))
+	value.Set(slice)
+	return nil
+}
+
+// parseOid parses an OBJECT IDENTIFIER. Components can be given as numbers or
+// in the name and number form.
+func (p *notationParser) parseOid(value reflect.Value) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	oid := reflect.MakeSlice(value.Type(), 0, 0)
+	for {
+		token := p.next()
+		if token == "}" {
+			break
+		}
+		if i := strings.IndexByte(token, '('); i > 0 && strings.HasSuffix(token, ")") {
+			token = token[i+1 : len(token)-1]
+		}
+		item, ok := parseOidComponent(token, value.Type().Elem())
+		if !ok {
+			return p.errorf("invalid OBJECT IDENTIFIER component '%s'", token)
+		}
+		oid = reflect.Append(oid, item)
+	}
+	value.Set(oid)
+	return nil
+}
+
+// parseOidComponent parses a component of an OBJECT IDENTIFIER given as a
+// number into an element of the given type.
+func parseOidComponent(token string, elemType reflect.Type) (reflect.Value, bool) {
+	if elemType == bigIntType {
+		n, ok := new(big.Int).SetString(token, 10)
+		if !ok || n.Sign() < 0 {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(n), true
+	}
+	bits := elemType.Bits()
+	if elemType.Kind() == reflect.Int {
+		bits--
+	}
+	n, err := strconv.ParseUint(token, 10, bits)
+	if err != nil {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(n).Convert(elemType), true
+}
+
+// parseStruct parses a SEQUENCE or SET value.
+func (p *notationParser) parseStruct(value reflect.Value) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	fields := make(map[string]int)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !isFieldExported(field) {
+			continue
+		}
+		opts, err := p.ctx.getFieldOptions(value.Type(), i)
+		if err != nil {
+			return err
+		}
+		fields[componentIdentifier(field, opts)] = i
+	}
+	found := make(map[int]bool)
+	for first := true; ; first = false {
+		token := p.next()
+		if token == "}" {
+			break
+		}
+		if !first {
+			if token != "," {
+				return p.errorf("expected ',' or '}' but found '%s'", token)
+			}
+			token = p.next()
+		}
+		i, ok := fields[token]
+		if !ok {
+			return p.errorf("unknown component '%s' in Go type '%s'", token, value.Type())
+		}
+		opts, err := p.ctx.getFieldOptions(value.Type(), i)
+		if err != nil {
+			return err
+		}
+		if opts == nil || found[i] {
+			return p.errorf("unexpected component '%s'", token)
+		}
+		found[i] = true
+		if err := p.parse(value.Field(i), opts); err != nil {
+			return err
+		}
+	}
+
+	// Set the missing components
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if found[i] || !isFieldExported(field) {
+			continue
+		}
+		opts, err := p.ctx.getFieldOptions(value.Type(), i)
+		if err != nil {
+			return err
+		}
+		switch {
+		case opts == nil || opts.optional || opts.absent:
+		case opts.defaultValue != nil:
+			if err := p.ctx.setDefaultValue(value.Field(i), opts); err != nil {
+				return err
+			}
+		default:
+			return p.errorf("missing component '%s' in Go type '%s'",
+				componentIdentifier(field, opts), value.Type())
+		}
+	}
+	return nil
+}
+
+// parseList parses a SEQUENCE OF or SET OF value using parseItem for each
+// item.
+func (p *notationParser) parseList(value reflect.Value, parseItem func(reflect.Value) error) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(value.Type().Elem()), 0, 0)
+	for first := true; ; first = false {
+		if p.peek() == "}" {
+			p.next()
+			break
+		}
+		if !first {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+		}
+		item := reflect.New(value.Type().Elem()).Elem()
+		if err := parseItem(item); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, item)
+	}
+	if value.Kind() == reflect.Array {
+		if value.Len() != slice.Len() {
+			return p.errorf("expected %d items but found %d", value.Len(), slice.Len())
+		}
+		reflect.Copy(value, slice)
+		return nil
+	}
+	value.Set(slice)
+	return nil
+}
+
+// parseChoice parses a CHOICE value given as "identifier : value". A nil
+// choice refers to the element types of the Context.
+func (p *notationParser) parseChoice(value reflect.Value, choice *string) error {
+	identifier := p.next()
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	entries := p.ctx.elementTypes
+	if choice != nil {
+		var err error
+		entries, err = p.ctx.getChoices(*choice)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if entry.identifier() == identifier {
+			nested := reflect.New(entry.typ).Elem()
+			if err := p.parse(nested, entry.opts); err != nil {
+				return err
+			}
+			value.Set(nested)
+			return nil
+		}
+	}
+	return p.errorf("unknown alternative '%s'", identifier)
+}
@@ -0,0 +1,91 @@
+package asn1
+
+import (
+	"math/big"
+	"reflect"
+)
+
+// Number is implemented by custom integer types, such as decimal or money
+// types, which are encoded and decoded as INTEGER without being converted to
+// and from big.Int by the callers. The methods can be implemented with
+// pointer receivers.
+//
+// Bytes returns the value as a big-endian two's complement integer, which
+// allows values of any size, or nil if the value is given by Int64. Decoded
+// values that fit in an int64 are set by SetInt64. Larger values are rejected
+// unless the type also implements:
+//
+//	SetBytes(data []byte) error
+//
+// which receives the value as a big-endian two's complement integer.
+type Number interface {
+	Int64() int64
+	SetInt64(n int64)
+	Bytes() []byte
+}
+
+// numberBytesSetter is implemented by Numbers that accept values larger than
+// an int64.
+type numberBytesSetter interface {
+	SetBytes(data []byte) error
+}
+
+var numberType = reflect.TypeOf((*Number)(nil)).Elem()
+
+// isNumberType checks if values of type t, or pointers to them, implement
+// Number.
+func isNumberType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		return false
+	}
+	return t.Implements(numberType) || reflect.PtrTo(t).Implements(numberType)
+}
+
+// numberOf returns the Number implemented by value or by its address.
+func numberOf(value reflect.Value) Number {
+	if value.Type().Implements(numberType) {
+		return value.Interface().(Number)
+	}
+	if !value.CanAddr() {
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		value = ptr.Elem()
+	}
+	return value.Addr().Interface().(Number)
+}
+
+func (ctx *Context) encodeNumber(value reflect.Value) ([]byte, error) {
+	n := numberOf(value)
+	data := n.Bytes()
+	if data == nil {
+		return ctx.encodeInt(reflect.ValueOf(n.Int64()))
+	}
+	if len(data) == 0 {
+		return []byte{0x00}, nil
+	}
+	return removeIntLeadingBytes(append([]byte{}, data...)), nil
+}
+
+func (ctx *Context) decodeNumber(data []byte, value reflect.Value) error {
+	if err := checkInt(ctx, data); err != nil {
+		return err
+	}
+	return ctx.setNumber(numberOf(value), parseBigInt(data), value.Type())
+}
+
+// setNumber sets the value of a Number.
+func (ctx *Context) setNumber(n Number, num *big.Int, t reflect.Type) error {
+	if num.IsInt64() {
+		n.SetInt64(num.Int64())
+		return nil
+	}
+	setter, ok := n.(numberBytesSetter)
+	if !ok {
+		return fieldError("integer %s overflows Go type '%s'", num, t)
+	}
+	data, err := ctx.encodeBigInt(reflect.ValueOf(num))
+	if err != nil {
+		return err
+	}
+	return setter.SetBytes(data)
+}
@@ -1,21 +1,49 @@
 package asn1
 
 import (
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type fieldOptions struct {
 	universal    bool
 	application  bool
+	private      bool
 	explicit     bool
+	implicit     bool
 	indefinite   bool
 	optional     bool
 	set          bool
+	extensible   bool
 	tag          *int
+	tag2         *int
+	explicit2    bool
 	defaultValue *int
 	choice       *string
 	choices      *string
+	constraints  []string
+	alphabet     alphabet
+	compute      *string
+	sensitive    bool
+	compress     *string
+	encrypt      *string
+	lengthOctets *int
+	longForm     bool
+	timeLayout   *string
+	name         *string
+	group        *string
+	absent       bool
+	presence     []presenceRule
+	versionField bool
+	minVersion   *int
+	maxVersion   *int
+
+	// PER-visible constraints, which don't change BER and DER encodings
+	perConstraint *perConstraint
+	perExtensible bool
 }
 
 // validate returns an error if any option is invalid.
@@ -30,38 +58,311 @@ func (opts *fieldOptions) validate() error {
 	if opts.application && opts.tag == nil {
 		return tagError("application")
 	}
+	if opts.private && opts.tag == nil {
+		return tagError("private")
+	}
+	// Contradictory options
+	exclusive := []struct {
+		a, b string
+		both bool
+	}{
+		{"universal", "application", opts.universal && opts.application},
+		{"universal", "private", opts.universal && opts.private},
+		{"application", "private", opts.application && opts.private},
+		{"implicit", "explicit", opts.implicit && opts.explicit},
+		{"optional", "default", opts.optional && opts.defaultValue != nil},
+		{"choice", "choices", opts.choice != nil && opts.choices != nil},
+		{"choice", "set", opts.choice != nil && opts.set},
+		{"indefinite", "length-octets", opts.indefinite && opts.lengthOctets != nil},
+		{"indefinite", "longform", opts.indefinite && opts.longForm},
+		{"longform", "length-octets", opts.longForm && opts.lengthOctets != nil},
+		{"absent", "default", opts.absent && opts.defaultValue != nil},
+		{"absent", "compute", opts.absent && opts.compute != nil},
+		{"version-field", "minver", opts.versionField && opts.minVersion != nil},
+		{"version-field", "maxver", opts.versionField && opts.maxVersion != nil},
+	}
+	for _, e := range exclusive {
+		if e.both {
+			return syntaxError("'%s' and '%s' cannot be used together", e.a, e.b)
+		}
+	}
 	if opts.tag != nil && *opts.tag < 0 {
 		return syntaxError("'tag' cannot be negative: %d", *opts.tag)
 	}
+	if opts.tag2 != nil && *opts.tag2 < 0 {
+		return syntaxError("'tag2' cannot be negative: %d", *opts.tag2)
+	}
+	if (opts.tag2 != nil) != opts.explicit2 {
+		return syntaxError("'tag2' and 'explicit2' must be used together")
+	}
 	if opts.choice != nil && *opts.choice == "" {
 		return syntaxError("'choice' cannot be empty")
 	}
+	if opts.group != nil && *opts.group == "" {
+		return syntaxError("'group' cannot be empty")
+	}
+	if opts.minVersion != nil && opts.maxVersion != nil && *opts.minVersion > *opts.maxVersion {
+		return syntaxError("'minver' cannot be greater than 'maxver': %d > %d",
+			*opts.minVersion, *opts.maxVersion)
+	}
+	if opts.compute != nil && *opts.compute == "" {
+		return syntaxError("'compute' cannot be empty")
+	}
+	if opts.encrypt != nil && (opts.compress != nil || opts.choice != nil) {
+		return syntaxError("'encrypt' cannot be used with 'compress' or 'choice'")
+	}
+	if opts.lengthOctets != nil && (*opts.lengthOctets < 1 || *opts.lengthOctets > maxLengthOctets) {
+		return syntaxError("'length-octets' must be between 1 and %d: %d",
+			maxLengthOctets, *opts.lengthOctets)
+	}
+	if opts.timeLayout != nil {
+		reference := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		if _, err := time.Parse(*opts.timeLayout, reference.Format(*opts.timeLayout)); err != nil {
+			return syntaxError("invalid 'timelayout' %q: %s", *opts.timeLayout, err)
+		}
+	}
+	if opts.name != nil && !isNotationIdentifier(*opts.name) {
+		return syntaxError("invalid 'name' '%s', expecting an ASN.1 identifier", *opts.name)
+	}
+	if opts.perExtensible && opts.perConstraint == nil {
+		return syntaxError("'per-constrained' must be specified when 'per-extensible' is used")
+	}
+	return nil
+}
+
+// tagClass returns the class of the tag given by the options.
+func (opts *fieldOptions) tagClass() uint {
+	switch {
+	case opts.universal:
+		return ClassUniversal
+	case opts.application:
+		return ClassApplication
+	case opts.private:
+		return ClassPrivate
+	}
+	return ClassContextSpecific
+}
+
+// maxOptionDepth limits the expansion of custom options that use other
+// custom options.
+const maxOptionDepth = 8
+
+// OptionFunc handles a custom option registered with (*Context).AddOption.
+// It receives the argument of the option, or an empty string if none is
+// given, and returns the options it stands for using the same syntax of
+// struct tags.
+type OptionFunc func(arg string) (string, error)
+
+// AddOption registers a custom option. When the option is found in a struct
+// tag or in the options given to EncodeWithOptions and DecodeWithOptions, it's
+// replaced by the options returned by handler, which can include other custom
+// options. It allows packages built on top of this one to define options for
+// their own types, for instance:
+//
+//	ctx.AddOption("snmp", func(arg string) (string, error) {
+//		switch arg {
+//		case "counter32":
+//			return "application,tag:1", nil
+//		case "gauge32":
+//			return "application,tag:2", nil
+//		}
+//		return "", fmt.Errorf("invalid SNMP type '%s'", arg)
+//	})
+//
+// Built-in options can't be replaced.
+func (ctx *Context) AddOption(name string, handler OptionFunc) error {
+	if name == "" || strings.ContainsAny(name, ",:") {
+		return syntaxError("invalid option name '%s'", name)
+	}
+	if known, _ := parseBuiltinOption(&fieldOptions{}, []string{name}); known {
+		return syntaxError("option '%s' is a built-in option", name)
+	}
+	if _, ok := ctx.options[name]; ok && !ctx.replaceInherited("option", name) {
+		return syntaxError("option already registered: %s", name)
+	}
+	ctx.options[name] = handler
 	return nil
 }
 
-// parseOption returns a parsed fieldOptions or an error. Returns nil for the ignore tag "-".
-func parseOptions(s string) (*fieldOptions, error) {
+// parseOptions returns a parsed fieldOptions or an error, expanding the
+// custom options registered in ctx. Returns nil for the ignore tag "-".
+func (ctx *Context) parseOptions(s string) (*fieldOptions, error) {
 	if s == "-" {
 		return nil, nil
 	}
 	var opts fieldOptions
+	if err := parseTokens(&opts, s, ctx.options, 0); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+// parseFieldOptions parses the options in the tag of the i-th field of the
+// struct type t. Errors include the name of the field. It returns nil if the
+// field is ignored, such as an unexported field.
+func (ctx *Context) parseFieldOptions(t reflect.Type, i int) (*fieldOptions, error) {
+	field := t.Field(i)
+	name := t.Name()
+	if name == "" {
+		name = t.String()
+	}
+	tag, tagged := field.Tag.Lookup(tagKey)
+	if !isFieldExported(field) {
+		if ctx.strictFields {
+			switch {
+			case field.Anonymous:
+				return nil, syntaxError("field %s.%s: embedded field of unexported type is ignored",
+					name, field.Name)
+			case tagged && tag != "-":
+				return nil, syntaxError("field %s.%s: unexported field with options is ignored",
+					name, field.Name)
+			}
+		}
+		return nil, nil
+	}
+	opts, err := ctx.parseOptions(tag)
+	if err != nil {
+		return nil, syntaxError("field %s.%s: %s", name, field.Name, err)
+	}
+	return opts, nil
+}
+
+// parseTokens parses a comma separated list of options, expanding the custom
+// ones.
+func parseTokens(opts *fieldOptions, s string, custom map[string]OptionFunc, depth int) error {
 	for _, token := range strings.Split(s, ",") {
 		args := strings.Split(strings.TrimSpace(token), ":")
-		err := parseOption(&opts, args)
+		handler, ok := custom[args[0]]
+		if !ok {
+			if err := parseOption(opts, args, custom); err != nil {
+				return err
+			}
+			continue
+		}
+		if depth >= maxOptionDepth {
+			return syntaxError("too many nested custom options in '%s'", args[0])
+		}
+		expanded, err := handler(strings.Join(args[1:], ":"))
 		if err != nil {
-			return nil, err
+			return syntaxError("option '%s': %s", args[0], err)
+		}
+		if err := parseTokens(opts, expanded, custom, depth+1); err != nil {
+			return err
 		}
 	}
-	if err := opts.validate(); err != nil {
-		return nil, err
+	return nil
+}
+
+// parseOption parse a single option. The error of an unknown option suggests
+// the closest built-in or custom option, if any.
+func parseOption(opts *fieldOptions, args []string, custom map[string]OptionFunc) error {
+	known, err := parseBuiltinOption(opts, args)
+	if !known {
+		var others []string
+		for name := range optionAliases {
+			others = append(others, name)
+		}
+		for name := range custom {
+			others = append(others, name)
+		}
+		sort.Strings(others)
+		names := append(append([]string{}, builtinOptions...), others...)
+		if suggestion := closestOption(args[0], names); suggestion != "" {
+			return syntaxError("invalid option '%s', did you mean '%s'?", args[0], suggestion)
+		}
+		return syntaxError("invalid option '%s'", args[0])
 	}
-	return &opts, nil
+	return err
 }
 
-// parseOption parse a single option.
-func parseOption(opts *fieldOptions, args []string) error {
-	var err error
-	switch args[0] {
+// builtinOptions lists the names of the built-in options.
+var builtinOptions = []string{
+	"universal", "application", "private", "explicit", "implicit",
+	"indefinite", "optional", "set", "extensible", "tag", "tag2", "explicit2",
+	"default", "choice", "choices", "constraint", "alphabet", "sensitive",
+	"encrypt", "compress", "compute", "length-octets", "longform", "timelayout",
+	"name", "group", "absent", "requires", "excludes", "version-field",
+	"minver", "maxver",
+	"per-constrained", "per-extensible",
+}
+
+// optionAliases maps the short names accepted for some built-in options to
+// their names.
+var optionAliases = map[string]string{
+	"opt":  "optional",
+	"app":  "application",
+	"priv": "private",
+	"ext":  "extensible",
+}
+
+// closestOption returns the name closest to the unknown option s, or an empty
+// string if none is close enough to be a typo. Ties are broken by the order of
+// names.
+func closestOption(s string, names []string) string {
+	s = strings.ToLower(s)
+	best := ""
+	bestDistance := 3
+	if len(s) <= 3 {
+		bestDistance = 2
+	}
+	for _, name := range names {
+		if d := editDistance(s, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and
+// transpositions of adjacent characters that turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// min3 returns the smallest of three integers.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// parseBuiltinOption parses a single built-in option, whose name is case
+// insensitive and can be one of optionAliases. It returns false if the option
+// is unknown.
+func parseBuiltinOption(opts *fieldOptions, args []string) (known bool, err error) {
+	known = true
+	name := strings.ToLower(args[0])
+	if alias, ok := optionAliases[name]; ok {
+		name = alias
+	}
+	switch name {
 	case "":
 		// ignore
 
@@ -71,9 +372,15 @@ func parseOption(opts *fieldOptions, args []string) error {
 	case "application":
 		opts.application, err = parseBoolOption(args)
 
+	case "private":
+		opts.private, err = parseBoolOption(args)
+
 	case "explicit":
 		opts.explicit, err = parseBoolOption(args)
 
+	case "implicit":
+		opts.implicit, err = parseBoolOption(args)
+
 	case "indefinite":
 		opts.indefinite, err = parseBoolOption(args)
 
@@ -83,8 +390,17 @@ func parseOption(opts *fieldOptions, args []string) error {
 	case "set":
 		opts.set, err = parseBoolOption(args)
 
+	case "extensible":
+		opts.extensible, err = parseBoolOption(args)
+
 	case "tag":
-		opts.tag, err = parseIntOption(args)
+		err = parseTagOption(opts, args)
+
+	case "tag2":
+		opts.tag2, err = parseIntOption(args)
+
+	case "explicit2":
+		opts.explicit2, err = parseBoolOption(args)
 
 	case "default":
 		opts.defaultValue, err = parseIntOption(args)
@@ -95,10 +411,89 @@ func parseOption(opts *fieldOptions, args []string) error {
 	case "choices":
 		opts.choices, err = parseStringOption(args)
 
+	case "constraint":
+		var name *string
+		name, err = parseStringOption(args)
+		if err == nil {
+			opts.constraints = append(opts.constraints, *name)
+		}
+
+	case "alphabet":
+		var spec *string
+		spec, err = parseStringOption(args)
+		if err == nil {
+			opts.alphabet, err = parseAlphabet(*spec)
+		}
+
+	case "sensitive":
+		opts.sensitive, err = parseBoolOption(args)
+
+	case "absent":
+		opts.absent, err = parseBoolOption(args)
+
+	case "version-field":
+		opts.versionField, err = parseBoolOption(args)
+
+	case "minver":
+		opts.minVersion, err = parseIntOption(args)
+
+	case "maxver":
+		opts.maxVersion, err = parseIntOption(args)
+
+	case "requires", "excludes":
+		var field *string
+		field, err = parseStringOption(args)
+		if err == nil {
+			opts.presence = append(opts.presence, presenceRule{*field, name == "requires"})
+		}
+
+	case "encrypt":
+		if len(args) == 1 {
+			opts.encrypt = new(string)
+		} else {
+			opts.encrypt, err = parseStringOption(args)
+		}
+
+	case "compress":
+		opts.compress, err = parseStringOption(args)
+
+	case "compute":
+		opts.compute, err = parseStringOption(args)
+
+	case "group":
+		opts.group, err = parseStringOption(args)
+
+	case "length-octets":
+		opts.lengthOctets, err = parseIntOption(args)
+
+	case "longform":
+		opts.longForm, err = parseBoolOption(args)
+
+	case "timelayout":
+		// The layout can contain colons
+		if len(args) < 2 || args[1] == "" {
+			return true, syntaxError("option 'timelayout' requires a layout")
+		}
+		layout := strings.Join(args[1:], ":")
+		opts.timeLayout = &layout
+
+	case "name":
+		opts.name, err = parseStringOption(args)
+
+	case "per-constrained":
+		var spec *string
+		spec, err = parseStringOption(args)
+		if err == nil {
+			opts.perConstraint, err = parsePerConstraint(*spec)
+		}
+
+	case "per-extensible":
+		opts.perExtensible, err = parseBoolOption(args)
+
 	default:
-		err = syntaxError("Invalid option: %s", args[0])
+		known = false
 	}
-	return err
+	return
 }
 
 // parseBoolOption just checks if no arguments were given.
@@ -123,6 +518,115 @@ func parseIntOption(args []string) (*int, error) {
 	return &num, nil
 }
 
+// tagClassPrefixes are the class prefixes accepted in the value of the tag
+// option, in the long form used by specifications and in a short form.
+var tagClassPrefixes = []struct {
+	long  string
+	short string
+	class uint
+}{
+	{"UNIVERSAL", "u", ClassUniversal},
+	{"APPLICATION", "a", ClassApplication},
+	{"PRIVATE", "p", ClassPrivate},
+	{"CONTEXT", "c", ClassContextSpecific},
+}
+
+// parseTagOption parses the tag option. Its value can include the class of
+// the tag, as in "tag:APPLICATION 5", "tag:[APPLICATION 5]" or "tag:a5",
+// which replaces the options universal, application and private.
+func parseTagOption(opts *fieldOptions, args []string) error {
+	if len(args) != 2 {
+		return syntaxError("option does not have arguments.")
+	}
+	value := strings.TrimSpace(args[1])
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	class, hasClass := uint(ClassContextSpecific), false
+	for _, prefix := range tagClassPrefixes {
+		if strings.HasPrefix(value, prefix.long+" ") {
+			value = strings.TrimSpace(value[len(prefix.long):])
+		} else if strings.HasPrefix(value, prefix.short) {
+			value = value[len(prefix.short):]
+		} else {
+			continue
+		}
+		class, hasClass = prefix.class, true
+		break
+	}
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		return syntaxError("invalid value '%s' for option '%s'.", args[1], args[0])
+	}
+	opts.tag = &num
+	if hasClass {
+		opts.universal = class == ClassUniversal
+		opts.application = class == ClassApplication
+		opts.private = class == ClassPrivate
+	}
+	return nil
+}
+
+// perConstraint is a PER-visible value constraint of an INTEGER or a size
+// constraint of a string or list. Unbounded limits, given as MIN or MAX, are
+// nil.
+type perConstraint struct {
+	lower *int64
+	upper *int64
+}
+
+// parsePerConstraint parses a constraint given as a single value, such as
+// "8", or as a range, such as "0..255", "1..MAX" or "MIN..0".
+func parsePerConstraint(spec string) (*perConstraint, error) {
+	parseLimit := func(s, unbounded string) (*int64, error) {
+		s = strings.TrimSpace(s)
+		if s == unbounded {
+			return nil, nil
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, syntaxError("invalid PER constraint '%s'", spec)
+		}
+		return &n, nil
+	}
+	bounds := strings.Split(spec, "..")
+	var c perConstraint
+	var err error
+	switch len(bounds) {
+	case 1:
+		c.lower, err = parseLimit(bounds[0], "")
+		c.upper = c.lower
+	case 2:
+		c.lower, err = parseLimit(bounds[0], "MIN")
+		if err == nil {
+			c.upper, err = parseLimit(bounds[1], "MAX")
+		}
+	default:
+		err = syntaxError("invalid PER constraint '%s'", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.lower != nil && c.upper != nil && *c.lower > *c.upper {
+		return nil, syntaxError("invalid PER constraint '%s': lower bound is greater than upper bound", spec)
+	}
+	return &c, nil
+}
+
+// String returns the constraint in the ASN.1 notation.
+func (c *perConstraint) String() string {
+	limit := func(n *int64, unbounded string) string {
+		if n == nil {
+			return unbounded
+		}
+		return strconv.FormatInt(*n, 10)
+	}
+	if c.lower != nil && c.upper != nil && *c.lower == *c.upper {
+		return limit(c.lower, "")
+	}
+	return limit(c.lower, "MIN") + ".." + limit(c.upper, "MAX")
+}
+
 // parseStringOption parses a string argument.
 func parseStringOption(args []string) (*string, error) {
 	if len(args) != 2 {
@@ -0,0 +1,104 @@
+package asn1
+
+import (
+	"bytes"
+)
+
+// Patch returns a copy of data with the element found at the given offset and
+// with the given length replaced by replacement, which must be a single
+// complete element. The lengths of the enclosing elements are updated and
+// every other octet is kept as it is, so the siblings of the element are not
+// encoded again and keep their original encodings. It allows updating a part
+// of a signed structure, such as inserting a timestamp before signing it
+// again.
+//
+// The offset and the length are usually taken from the trace returned by
+// DecodeWithTrace, see (*DecodeTrace).Patch. An error is returned if they do
+// not match the boundaries of an element of data.
+func Patch(data []byte, offset int, length int, replacement []byte) ([]byte, error) {
+	if offset < 0 || length <= 0 || offset+length > len(data) {
+		return nil, syntaxError("invalid range of %d octets at offset %d for data of %d octets",
+			length, offset, len(data))
+	}
+	reader := bytes.NewReader(replacement)
+	if _, err := decodeRawValue(reader); err != nil {
+		return nil, err
+	}
+	if reader.Len() > 0 {
+		return nil, syntaxError("replacement must be a single element")
+	}
+	return patchElements(data, offset, length, replacement)
+}
+
+// Patch replaces the encoding of the field with the given path in data, which
+// must be the data given to DecodeWithTrace. See Patch for details. The trace
+// is not updated, so the positions of the fields after the patched one are
+// not valid for the returned data.
+func (t *DecodeTrace) Patch(data []byte, path string, replacement []byte) ([]byte, error) {
+	field, ok := t.Lookup(path)
+	if !ok {
+		return nil, syntaxError("field '%s' not found in the trace", path)
+	}
+	return Patch(data, field.Offset, field.Length, replacement)
+}
+
+// patchElements replaces an element found in a sequence of elements. offset
+// is relative to the beginning of data.
+func patchElements(data []byte, offset int, length int, replacement []byte) ([]byte, error) {
+	for pos := 0; pos < len(data) && pos <= offset; {
+		reader := bytes.NewReader(data[pos:])
+		_, _, constructed, err := decodeIdentifier(reader)
+		if err != nil {
+			return nil, err
+		}
+		identifier := data[pos : len(data)-reader.Len()]
+		_, indefinite, err := decodeLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		header := len(data) - pos - reader.Len()
+
+		// Find the end of the element
+		reader = bytes.NewReader(data[pos:])
+		if _, err := decodeRawValue(reader); err != nil {
+			return nil, err
+		}
+		end := len(data) - reader.Len()
+
+		if pos == offset && end == offset+length {
+			return concatBytes(data[:pos], replacement, data[end:]), nil
+		}
+		if constructed && offset >= pos+header && offset+length <= end {
+			contentEnd := end
+			if indefinite {
+				// End of contents octets
+				contentEnd -= 2
+			}
+			content, err := patchElements(data[pos+header:contentEnd], offset-pos-header,
+				length, replacement)
+			if err != nil {
+				return nil, err
+			}
+			if indefinite {
+				return concatBytes(data[:pos+header], content, data[contentEnd:]), nil
+			}
+			return concatBytes(data[:pos], identifier, encodeLength(uint(len(content))),
+				content, data[end:]), nil
+		}
+		pos = end
+	}
+	return nil, parseError("no element found at offset %d with length %d", offset, length)
+}
+
+// concatBytes returns a new slice with the concatenation of the given slices.
+func concatBytes(slices ...[]byte) []byte {
+	n := 0
+	for _, s := range slices {
+		n += len(s)
+	}
+	buf := make([]byte, 0, n)
+	for _, s := range slices {
+		buf = append(buf, s...)
+	}
+	return buf
+}
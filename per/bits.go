@@ -0,0 +1,184 @@
+// Package per provides the bit-level writer and reader used by the Packed
+// Encoding Rules (PER) defined in ITU-T X.691, where values are encoded in
+// fields of any number of bits and octet alignment is explicit.
+//
+// It's the groundwork for a PER backend of the asn1 package and it can be used
+// to hand-code PER fragments, for instance:
+//
+//	var w per.Writer
+//	w.PutBit(true)          // presence bitmap
+//	w.PutBits(5, 3)         // INTEGER (0..7)
+//	w.Align()               // octet-aligned field follows in ALIGNED PER
+//	w.PutBytes([]byte("a")) // OCTET STRING (SIZE (1))
+//	data := w.Bytes()
+package per
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writer writes bit fields, most significant bit first. The zero value is an
+// empty Writer ready to use.
+type Writer struct {
+	buf  []byte
+	bits int
+}
+
+// Len returns the number of bits written.
+func (w *Writer) Len() int {
+	return w.bits
+}
+
+// Bytes returns the written bits. The last octet is padded with zero bits.
+// The returned slice is only valid until the next write.
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+// PutBit writes a single bit.
+func (w *Writer) PutBit(bit bool) {
+	if w.bits%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 0x80 >> uint(w.bits%8)
+	}
+	w.bits++
+}
+
+// PutBits writes the n least significant bits of v, with n from 0 to 64. An
+// error is returned if v does not fit in n bits.
+func (w *Writer) PutBits(v uint64, n int) error {
+	if n < 0 || n > 64 {
+		return fmt.Errorf("invalid number of bits: %d", n)
+	}
+	if n < 64 && v>>uint(n) != 0 {
+		return fmt.Errorf("value %d does not fit in %d bits", v, n)
+	}
+	for n > 0 {
+		// Fill the free bits of the last octet at once
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		free := 8 - w.bits%8
+		count := free
+		if n < count {
+			count = n
+		}
+		chunk := byte(v>>uint(n-count)) & byte(0xff>>uint(8-count))
+		w.buf[len(w.buf)-1] |= chunk << uint(free-count)
+		w.bits += count
+		n -= count
+	}
+	return nil
+}
+
+// PutBytes writes the bits of data starting at the current position, which
+// doesn't need to be aligned.
+func (w *Writer) PutBytes(data []byte) {
+	if w.bits%8 == 0 {
+		w.buf = append(w.buf, data...)
+		w.bits += 8 * len(data)
+		return
+	}
+	for _, b := range data {
+		w.PutBits(uint64(b), 8)
+	}
+}
+
+// Align writes zero bits up to the next octet boundary.
+func (w *Writer) Align() {
+	if r := w.bits % 8; r != 0 {
+		w.bits += 8 - r
+	}
+}
+
+// Reader reads bit fields written by a Writer.
+type Reader struct {
+	data []byte
+	pos  int
+}
+
+// NewReader returns a Reader of the bits in data.
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+// Offset returns the number of bits read.
+func (r *Reader) Offset() int {
+	return r.pos
+}
+
+// Remaining returns the number of bits that were not read.
+func (r *Reader) Remaining() int {
+	return 8*len(r.data) - r.pos
+}
+
+// ReadBit reads a single bit.
+func (r *Reader) ReadBit() (bool, error) {
+	if r.Remaining() < 1 {
+		return false, io.ErrUnexpectedEOF
+	}
+	bit := r.data[r.pos/8]&(0x80>>uint(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// ReadBits reads n bits, with n from 0 to 64, as an unsigned number. The
+// position is not changed if an error is returned.
+func (r *Reader) ReadBits(n int) (uint64, error) {
+	if n < 0 || n > 64 {
+		return 0, fmt.Errorf("invalid number of bits: %d", n)
+	}
+	if r.Remaining() < n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := uint64(0)
+	for n > 0 {
+		used := r.pos % 8
+		count := 8 - used
+		if n < count {
+			count = n
+		}
+		chunk := r.data[r.pos/8] >> uint(8-used-count) & byte(0xff>>uint(8-count))
+		v = v<<uint(count) | uint64(chunk)
+		r.pos += count
+		n -= count
+	}
+	return v, nil
+}
+
+// ReadBytes reads n octets starting at the current position, which doesn't
+// need to be aligned.
+func (r *Reader) ReadBytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid number of bytes: %d", n)
+	}
+	if r.Remaining() < 8*n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if r.pos%8 == 0 {
+		start := r.pos / 8
+		r.pos += 8 * n
+		return append([]byte{}, r.data[start:start+n]...), nil
+	}
+	data := make([]byte, n)
+	for i := range data {
+		b, _ := r.ReadBits(8)
+		data[i] = byte(b)
+	}
+	return data, nil
+}
+
+// Align skips the bits up to the next octet boundary.
+func (r *Reader) Align() error {
+	if rem := r.pos % 8; rem != 0 {
+		r.pos += 8 - rem
+	}
+	if r.pos > 8*len(r.data) {
+		r.pos = 8 * len(r.data)
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
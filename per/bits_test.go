@@ -0,0 +1,96 @@
+package per
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var w Writer
+	w.PutBit(true)
+	if err := w.PutBits(5, 3); err != nil {
+		t.Fatal(err)
+	}
+	w.Align()
+	w.PutBytes([]byte{0xab})
+	w.PutBit(false)
+	if err := w.PutBits(0x1ff, 9); err != nil {
+		t.Fatal(err)
+	}
+	w.PutBytes([]byte{0x81, 0x42})
+	if err := w.PutBits(1<<63|1, 64); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0xd0, 0xab, 0x7f, 0xe0, 0x50, 0xa0, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40,
+	}
+	if !bytes.Equal(w.Bytes(), expected) {
+		t.Fatalf("Invalid bits.\n  got: %x\n  expected: %x", w.Bytes(), expected)
+	}
+	if w.Len() != 106 {
+		t.Fatalf("Invalid length: %d", w.Len())
+	}
+
+	for _, test := range []struct {
+		v uint64
+		n int
+	}{{8, 3}, {1, 0}, {0, 65}, {0, -1}} {
+		if err := w.PutBits(test.v, test.n); err == nil {
+			t.Fatalf("Writing %d in %d bits should have failed.", test.v, test.n)
+		}
+	}
+	if w.Len() != 106 {
+		t.Fatalf("Invalid length after errors: %d", w.Len())
+	}
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader([]byte{
+		0xd0, 0xab, 0x7f, 0xe0, 0x50, 0xa0, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40,
+	})
+	bit, err := r.ReadBit()
+	if err != nil || !bit {
+		t.Fatalf("Invalid bit: %v %v", bit, err)
+	}
+	check := func(n int, expected uint64) {
+		t.Helper()
+		v, err := r.ReadBits(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Fatalf("Invalid value: got %x, expected %x", v, expected)
+		}
+	}
+	check(3, 5)
+	if err := r.Align(); err != nil {
+		t.Fatal(err)
+	}
+	check(8, 0xab)
+	check(1, 0)
+	check(9, 0x1ff)
+	data, err := r.ReadBytes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0x81, 0x42}) {
+		t.Fatalf("Invalid bytes: %x", data)
+	}
+	check(64, 1<<63|1)
+	if r.Offset() != 106 || r.Remaining() != 6 {
+		t.Fatalf("Invalid position: %d, %d", r.Offset(), r.Remaining())
+	}
+	if _, err := r.ReadBits(7); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+	if _, err := r.ReadBytes(1); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+	check(6, 0)
+	if _, err := r.ReadBit(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+}
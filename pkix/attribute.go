@@ -0,0 +1,274 @@
+package pkix
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pipistrellka/asn1"
+)
+
+// AttributeTypeAndValue is a single valued attribute, as used by the relative
+// distinguished names of X.501 names:
+//
+//	AttributeTypeAndValue ::= SEQUENCE {
+//		type  OBJECT IDENTIFIER,
+//		value ANY DEFINED BY type }
+type AttributeTypeAndValue struct {
+	Type  asn1.Oid
+	Value asn1.RawValue
+}
+
+// NewAttributeTypeAndValue returns an AttributeTypeAndValue with the encoding
+// of value, as NewAttribute does for each of its values.
+func NewAttributeTypeAndValue(attributeType asn1.Oid, value interface{}) (AttributeTypeAndValue, error) {
+	raw, err := encodeAttributeValue(value)
+	if err != nil {
+		return AttributeTypeAndValue{}, err
+	}
+	return AttributeTypeAndValue{attributeType, raw}, nil
+}
+
+// GetString returns the value as a string. It must be one of the ASN.1
+// character string types.
+func (atv AttributeTypeAndValue) GetString() (string, error) {
+	return decodeAttributeString(atv.Type, atv.Value)
+}
+
+// GetOid returns the value as an OBJECT IDENTIFIER.
+func (atv AttributeTypeAndValue) GetOid() (asn1.Oid, error) {
+	return decodeAttributeOid(atv.Type, atv.Value)
+}
+
+// GetTime returns the value as a time, encoded as UTCTime or GeneralizedTime.
+func (atv AttributeTypeAndValue) GetTime() (time.Time, error) {
+	return decodeAttributeTime(atv.Type, atv.Value)
+}
+
+// Attribute is an attribute with a set of values, as used by CSRs (PKCS #10)
+// and by the signed attributes of CMS:
+//
+//	Attribute ::= SEQUENCE {
+//		type   OBJECT IDENTIFIER,
+//		values SET OF ANY DEFINED BY type }
+type Attribute struct {
+	Type   asn1.Oid
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// NewAttribute returns an Attribute with the encodings of the given values.
+// Values of type string are encoded as UTF8String, values of type time.Time
+// are encoded as asn1.Time and asn1.RawValue values are used as
+// they are. Other values are encoded with the default Context of the asn1
+// package.
+func NewAttribute(attributeType asn1.Oid, values ...interface{}) (Attribute, error) {
+	attr := Attribute{Type: attributeType}
+	for _, value := range values {
+		raw, err := encodeAttributeValue(value)
+		if err != nil {
+			return Attribute{}, err
+		}
+		attr.Values = append(attr.Values, raw)
+	}
+	return attr, nil
+}
+
+// value returns the value of a single valued attribute.
+func (attr Attribute) value() (asn1.RawValue, error) {
+	if len(attr.Values) != 1 {
+		return asn1.RawValue{}, &asn1.ParseError{Msg: fmt.Sprintf(
+			"attribute %s has %d values instead of one", attr.Type, len(attr.Values))}
+	}
+	return attr.Values[0], nil
+}
+
+// GetString returns the value of a single valued attribute as a string.
+func (attr Attribute) GetString() (string, error) {
+	value, err := attr.value()
+	if err != nil {
+		return "", err
+	}
+	return decodeAttributeString(attr.Type, value)
+}
+
+// GetOid returns the value of a single valued attribute as an OBJECT
+// IDENTIFIER.
+func (attr Attribute) GetOid() (asn1.Oid, error) {
+	value, err := attr.value()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAttributeOid(attr.Type, value)
+}
+
+// GetTime returns the value of a single valued attribute as a time.
+func (attr Attribute) GetTime() (time.Time, error) {
+	value, err := attr.value()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return decodeAttributeTime(attr.Type, value)
+}
+
+// Attributes is a set of attributes keyed by their types:
+//
+//	Attributes ::= SET OF Attribute
+//
+// Fields of this type need the option "set", usually with a tag, as in
+// `asn1:"tag:0,set"` for the attributes of a CSR.
+type Attributes []Attribute
+
+// Get returns the attribute of the given type.
+func (attrs Attributes) Get(attributeType asn1.Oid) (Attribute, bool) {
+	for _, attr := range attrs {
+		if attr.Type.Cmp(attributeType) == 0 {
+			return attr, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// find returns the attribute of the given type or an error if it's missing.
+func (attrs Attributes) find(attributeType asn1.Oid) (Attribute, error) {
+	attr, ok := attrs.Get(attributeType)
+	if !ok {
+		return Attribute{}, &asn1.ParseError{Msg: fmt.Sprintf(
+			"attribute %s not found", attributeType)}
+	}
+	return attr, nil
+}
+
+// GetString returns the value of the attribute of the given type as a
+// string.
+func (attrs Attributes) GetString(attributeType asn1.Oid) (string, error) {
+	attr, err := attrs.find(attributeType)
+	if err != nil {
+		return "", err
+	}
+	return attr.GetString()
+}
+
+// GetOid returns the value of the attribute of the given type as an OBJECT
+// IDENTIFIER.
+func (attrs Attributes) GetOid(attributeType asn1.Oid) (asn1.Oid, error) {
+	attr, err := attrs.find(attributeType)
+	if err != nil {
+		return nil, err
+	}
+	return attr.GetOid()
+}
+
+// GetTime returns the value of the attribute of the given type as a time.
+func (attrs Attributes) GetTime(attributeType asn1.Oid) (time.Time, error) {
+	attr, err := attrs.find(attributeType)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return attr.GetTime()
+}
+
+// Set replaces the values of the attribute of the given type, or adds the
+// attribute if it's missing. The values are encoded as in NewAttribute.
+func (attrs *Attributes) Set(attributeType asn1.Oid, values ...interface{}) error {
+	attr, err := NewAttribute(attributeType, values...)
+	if err != nil {
+		return err
+	}
+	for i := range *attrs {
+		if (*attrs)[i].Type.Cmp(attributeType) == 0 {
+			(*attrs)[i] = attr
+			return nil
+		}
+	}
+	*attrs = append(*attrs, attr)
+	return nil
+}
+
+// encodeAttributeValue returns the raw value of an attribute value.
+func encodeAttributeValue(value interface{}) (asn1.RawValue, error) {
+	var data []byte
+	var err error
+	switch v := value.(type) {
+	case asn1.RawValue:
+		return v, nil
+	case string:
+		data, err = asn1.EncodeWithOptions(v, "universal,tag:12")
+	case time.Time:
+		data, err = asn1.Encode(asn1.Time{Time: v})
+	default:
+		data, err = asn1.Encode(value)
+	}
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	var raw asn1.RawValue
+	_, err = asn1.Decode(data, &raw)
+	return raw, err
+}
+
+// decodeAttributeString decodes a value of one of the character string
+// types.
+func decodeAttributeString(attributeType asn1.Oid, value asn1.RawValue) (string, error) {
+	if value.Class == asn1.ClassUniversal && !value.Constructed {
+		switch value.Tag {
+		case asn1.TagUtf8String, asn1.TagPrintableString, asn1.TagIA5String,
+			asn1.TagNumericString, asn1.TagVisibleString, asn1.TagT61String:
+			if utf8.Valid(value.Content) {
+				return string(value.Content), nil
+			}
+		case asn1.TagBmpString:
+			if len(value.Content)%2 == 0 {
+				units := make([]uint16, len(value.Content)/2)
+				for i := range units {
+					units[i] = uint16(value.Content[2*i])<<8 | uint16(value.Content[2*i+1])
+				}
+				return string(utf16.Decode(units)), nil
+			}
+		case asn1.TagUniversalString:
+			if len(value.Content)%4 == 0 {
+				runes := make([]rune, len(value.Content)/4)
+				for i := range runes {
+					b := value.Content[4*i:]
+					runes[i] = rune(b[0])<<24 | rune(b[1])<<16 | rune(b[2])<<8 | rune(b[3])
+				}
+				return string(runes), nil
+			}
+		}
+	}
+	return "", &asn1.ParseError{Msg: fmt.Sprintf(
+		"value of attribute %s is not a valid string: %s", attributeType,
+		asn1.TagString(value.Class, value.Tag))}
+}
+
+// decodeAttributeOid decodes an OBJECT IDENTIFIER value.
+func decodeAttributeOid(attributeType asn1.Oid, value asn1.RawValue) (asn1.Oid, error) {
+	var oid asn1.Oid
+	if err := decodeAttributeValue(attributeType, value, &oid); err != nil {
+		return nil, err
+	}
+	return oid, nil
+}
+
+// decodeAttributeTime decodes a UTCTime or GeneralizedTime value.
+func decodeAttributeTime(attributeType asn1.Oid, value asn1.RawValue) (time.Time, error) {
+	var t asn1.Time
+	if err := decodeAttributeValue(attributeType, value, &t); err != nil {
+		return time.Time{}, err
+	}
+	return t.Time, nil
+}
+
+// decodeAttributeValue decodes a value with the default Context of the asn1
+// package.
+func decodeAttributeValue(attributeType asn1.Oid, value asn1.RawValue, obj interface{}) error {
+	data, err := asn1.Encode(value)
+	if err == nil {
+		_, err = asn1.Decode(data, obj)
+	}
+	if err != nil {
+		return &asn1.ParseError{Msg: fmt.Sprintf(
+			"invalid value of attribute %s: %s", attributeType, err)}
+	}
+	return nil
+}
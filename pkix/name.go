@@ -0,0 +1,277 @@
+package pkix
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pipistrellka/asn1"
+)
+
+// Object identifiers of the attribute types with short names in RFC 4514.
+var (
+	OidCommonName         = asn1.Oid{2, 5, 4, 3}
+	OidSerialNumber       = asn1.Oid{2, 5, 4, 5}
+	OidCountry            = asn1.Oid{2, 5, 4, 6}
+	OidLocality           = asn1.Oid{2, 5, 4, 7}
+	OidProvince           = asn1.Oid{2, 5, 4, 8}
+	OidStreetAddress      = asn1.Oid{2, 5, 4, 9}
+	OidOrganization       = asn1.Oid{2, 5, 4, 10}
+	OidOrganizationalUnit = asn1.Oid{2, 5, 4, 11}
+	OidDomainComponent    = asn1.Oid{0, 9, 2342, 19200300, 100, 1, 25}
+	OidUserID             = asn1.Oid{0, 9, 2342, 19200300, 100, 1, 1}
+)
+
+// attributeTypeNames are the short names of attribute types.
+var attributeTypeNames = []struct {
+	name string
+	oid  asn1.Oid
+}{
+	{"CN", OidCommonName},
+	{"L", OidLocality},
+	{"ST", OidProvince},
+	{"O", OidOrganization},
+	{"OU", OidOrganizationalUnit},
+	{"C", OidCountry},
+	{"STREET", OidStreetAddress},
+	{"DC", OidDomainComponent},
+	{"UID", OidUserID},
+}
+
+// RelativeDistinguishedNameSET is a set of attributes that identifies an
+// entry among its siblings, usually with a single attribute:
+//
+//	RelativeDistinguishedName ::= SET SIZE (1..MAX) OF AttributeTypeAndValue
+//
+// It implements asn1.SetOf, so it's encoded as a SET OF when it's an element
+// of an RDNSequence.
+type RelativeDistinguishedNameSET []AttributeTypeAndValue
+
+// SetOf marks the type as a SET OF.
+func (RelativeDistinguishedNameSET) SetOf() {}
+
+// RDNSequence is an X.501 distinguished name, as used by the issuer and
+// subject of certificates:
+//
+//	Name ::= CHOICE { rdnSequence RDNSequence }
+//	RDNSequence ::= SEQUENCE OF RelativeDistinguishedName
+//
+// The first RDN is the most significant one, such as the country.
+type RDNSequence []RelativeDistinguishedNameSET
+
+// String returns the RFC 4514 representation of the name, such as
+// "CN=example.com,O=Example,C=BR". The RDNs are written in the reverse order
+// of the sequence, the attributes of multi-valued RDNs are separated by '+',
+// attribute types without a short name are written as OIDs and values that
+// aren't strings are written as '#' followed by their hex encoding.
+func (seq RDNSequence) String() string {
+	var b strings.Builder
+	for i := len(seq) - 1; i >= 0; i-- {
+		if i < len(seq)-1 {
+			b.WriteByte(',')
+		}
+		for j, atv := range seq[i] {
+			if j > 0 {
+				b.WriteByte('+')
+			}
+			b.WriteString(attributeTypeName(atv.Type))
+			b.WriteByte('=')
+			b.WriteString(formatAttributeValue(atv))
+		}
+	}
+	return b.String()
+}
+
+// attributeTypeName returns the short name of an attribute type or its dotted
+// representation.
+func attributeTypeName(oid asn1.Oid) string {
+	for _, t := range attributeTypeNames {
+		if t.oid.Cmp(oid) == 0 {
+			return t.name
+		}
+	}
+	// Without the leading dot of the SNMP form returned by String
+	return strings.TrimPrefix(oid.String(), ".")
+}
+
+// formatAttributeValue returns the escaped string representation of a value.
+func formatAttributeValue(atv AttributeTypeAndValue) string {
+	s, err := atv.GetString()
+	if err != nil {
+		data, err := asn1.Encode(atv.Value)
+		if err != nil {
+			return "#"
+		}
+		return "#" + hex.EncodeToString(data)
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '+' || c == ',' || c == ';' || c == '<' || c == '>' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case (c == ' ' || c == '#') && i == 0, c == ' ' && i == len(s)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ParseRDNSequence parses the RFC 4514 representation of a name, as returned
+// by (RDNSequence).String. Attribute types are given by their short names,
+// which are case insensitive, or by OIDs. String values are encoded as
+// PrintableString for the country and the serial number, as IA5String for
+// domain components and as UTF8String otherwise, following RFC 5280.
+func ParseRDNSequence(s string) (RDNSequence, error) {
+	seq := RDNSequence{}
+	if strings.TrimSpace(s) == "" {
+		return seq, nil
+	}
+	rdns, err := splitEscaped(s, ',')
+	if err != nil {
+		return nil, err
+	}
+	for i := len(rdns) - 1; i >= 0; i-- {
+		atvs, err := splitEscaped(rdns[i], '+')
+		if err != nil {
+			return nil, err
+		}
+		rdn := RelativeDistinguishedNameSET{}
+		for _, atv := range atvs {
+			parsed, err := parseAttributeTypeAndValue(atv)
+			if err != nil {
+				return nil, err
+			}
+			rdn = append(rdn, parsed)
+		}
+		seq = append(seq, rdn)
+	}
+	return seq, nil
+}
+
+// splitEscaped splits s at the occurrences of sep that are not escaped.
+func splitEscaped(s string, sep byte) ([]string, error) {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i >= len(s) {
+				return nil, nameError("escape at the end of '%s'", s)
+			}
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:]), nil
+}
+
+// parseAttributeTypeAndValue parses a single "type=value" pair.
+func parseAttributeTypeAndValue(s string) (AttributeTypeAndValue, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq < 0 {
+		return AttributeTypeAndValue{}, nameError("missing '=' in '%s'", s)
+	}
+	name := strings.TrimSpace(s[:eq])
+	value := strings.TrimLeft(s[eq+1:], " ")
+	oid, err := parseAttributeType(name)
+	if err != nil {
+		return AttributeTypeAndValue{}, err
+	}
+	atv := AttributeTypeAndValue{Type: oid}
+	if strings.HasPrefix(value, "#") {
+		data, err := hex.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return AttributeTypeAndValue{}, nameError("invalid hex value of %s: %s", name, err)
+		}
+		rest, err := asn1.Decode(data, &atv.Value)
+		if err != nil || len(rest) > 0 {
+			return AttributeTypeAndValue{}, nameError("invalid encoded value of %s", name)
+		}
+		return atv, nil
+	}
+	text, err := unescapeAttributeValue(value)
+	if err != nil {
+		return AttributeTypeAndValue{}, err
+	}
+	tag := uint(asn1.TagUtf8String)
+	switch {
+	case oid.Cmp(OidCountry) == 0, oid.Cmp(OidSerialNumber) == 0:
+		tag = asn1.TagPrintableString
+	case oid.Cmp(OidDomainComponent) == 0:
+		tag = asn1.TagIA5String
+	}
+	atv.Value = asn1.RawValue{Tag: tag, Content: []byte(text)}
+	return atv, nil
+}
+
+// parseAttributeType parses a short name or an OID, optionally prefixed by
+// "OID.".
+func parseAttributeType(name string) (asn1.Oid, error) {
+	for _, t := range attributeTypeNames {
+		if strings.EqualFold(t.name, name) {
+			return t.oid, nil
+		}
+	}
+	dotted := name
+	if len(dotted) > 4 && strings.EqualFold(dotted[:4], "OID.") {
+		dotted = dotted[4:]
+	}
+	if dotted == "" || dotted[0] < '0' || dotted[0] > '9' {
+		return nil, nameError("unknown attribute type '%s'", name)
+	}
+	oid, err := asn1.ParseOid(dotted)
+	if err != nil {
+		return nil, nameError("invalid attribute type '%s'", name)
+	}
+	return oid, nil
+}
+
+// unescapeAttributeValue removes the escapes of a string value, which are
+// either a backslash followed by a special character or by two hex digits.
+func unescapeAttributeValue(s string) (string, error) {
+	// Trailing spaces are only kept when escaped
+	end := len(s)
+	for end > 0 && s[end-1] == ' ' && (end < 2 || s[end-2] != '\\') {
+		end--
+	}
+	s = s[:end]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 < len(s) && isHexDigit(s[i+1]) && isHexDigit(s[i+2]) {
+			data, _ := hex.DecodeString(s[i+1 : i+3])
+			b.Write(data)
+			i += 2
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", nameError("escape at the end of '%s'", s)
+		}
+		b.WriteByte(s[i+1])
+		i++
+	}
+	return b.String(), nil
+}
+
+// isHexDigit checks if c is a hexadecimal digit.
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// nameError returns a ParseError for an invalid string representation of a
+// name.
+func nameError(msg string, args ...interface{}) error {
+	return &asn1.ParseError{Msg: "invalid name: " + fmt.Sprintf(msg, args...)}
+}
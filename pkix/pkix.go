@@ -0,0 +1,149 @@
+// Package pkix provides types of the X.509 public key infrastructure (RFC
+// 5280) and related standards, such as PKCS and CMS, for use with the asn1
+// package.
+package pkix
+
+import (
+	"fmt"
+
+	"github.com/pipistrellka/asn1"
+)
+
+// Object identifiers of common algorithms.
+var (
+	OidRSAEncryption   = asn1.Oid{1, 2, 840, 113549, 1, 1, 1}
+	OidSHA1WithRSA     = asn1.Oid{1, 2, 840, 113549, 1, 1, 5}
+	OidRSASSAPSS       = asn1.Oid{1, 2, 840, 113549, 1, 1, 10}
+	OidSHA256WithRSA   = asn1.Oid{1, 2, 840, 113549, 1, 1, 11}
+	OidSHA384WithRSA   = asn1.Oid{1, 2, 840, 113549, 1, 1, 12}
+	OidSHA512WithRSA   = asn1.Oid{1, 2, 840, 113549, 1, 1, 13}
+	OidECPublicKey     = asn1.Oid{1, 2, 840, 10045, 2, 1}
+	OidECDSAWithSHA256 = asn1.Oid{1, 2, 840, 10045, 4, 3, 2}
+	OidECDSAWithSHA384 = asn1.Oid{1, 2, 840, 10045, 4, 3, 3}
+	OidECDSAWithSHA512 = asn1.Oid{1, 2, 840, 10045, 4, 3, 4}
+	OidEd25519         = asn1.Oid{1, 3, 101, 112}
+	OidEd448           = asn1.Oid{1, 3, 101, 113}
+	OidSHA256          = asn1.Oid{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	OidSHA384          = asn1.Oid{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	OidSHA512          = asn1.Oid{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// nullParameterFamilies are the arcs of the algorithms that require NULL
+// parameters.
+var nullParameterFamilies = []asn1.Oid{
+	// PKCS #1 algorithms, except RSASSA-PSS
+	{1, 2, 840, 113549, 1, 1},
+}
+
+// nullParameters is the encoding of NULL.
+var nullParameters = []byte{0x05, 0x00}
+
+// AlgorithmIdentifier identifies an algorithm and its parameters:
+//
+//	AlgorithmIdentifier ::= SEQUENCE {
+//		algorithm  OBJECT IDENTIFIER,
+//		parameters ANY DEFINED BY algorithm OPTIONAL }
+//
+// The parameters are kept in their encoded form and are absent when
+// Parameters is nil. Some algorithms distinguish absent parameters from
+// present NULL parameters: RSA algorithms require NULL parameters (RFC 3279
+// and RFC 4055), while ECDSA and EdDSA algorithms require them to be absent
+// (RFC 5758 and RFC 8410). NewAlgorithmIdentifier chooses the right form and
+// Equal considers both forms equal.
+type AlgorithmIdentifier struct {
+	Algorithm  asn1.Oid
+	Parameters *asn1.RawValue `asn1:"optional"`
+}
+
+// NewAlgorithmIdentifier returns an AlgorithmIdentifier for an algorithm
+// without parameters. The parameters are NULL for the PKCS #1 algorithms that
+// require it, such as rsaEncryption and sha256WithRSAEncryption, and absent
+// otherwise.
+func NewAlgorithmIdentifier(algorithm asn1.Oid) AlgorithmIdentifier {
+	id := AlgorithmIdentifier{Algorithm: algorithm}
+	if requiresNullParameters(algorithm) {
+		id.Parameters = &asn1.RawValue{
+			Tag:       asn1.TagNull,
+			Content:   []byte{},
+			FullBytes: nullParameters,
+		}
+	}
+	return id
+}
+
+// requiresNullParameters checks if the parameters of an algorithm must be
+// NULL when it has no other parameters.
+func requiresNullParameters(algorithm asn1.Oid) bool {
+	if algorithm.Cmp(OidRSASSAPSS) == 0 {
+		return false
+	}
+	for _, family := range nullParameterFamilies {
+		if len(algorithm) == len(family)+1 && family.Cmp(algorithm[:len(family)]) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParametersAbsent checks if the parameters are absent.
+func (id AlgorithmIdentifier) ParametersAbsent() bool {
+	return id.Parameters == nil
+}
+
+// HasNullParameters checks if the parameters are present and NULL.
+func (id AlgorithmIdentifier) HasNullParameters() bool {
+	p := id.Parameters
+	return p != nil && p.Class == asn1.ClassUniversal && p.Tag == asn1.TagNull &&
+		!p.Constructed && len(p.Content) == 0
+}
+
+// Equal checks if two identifiers have the same algorithm and parameters.
+// Absent and NULL parameters are considered equal.
+func (id AlgorithmIdentifier) Equal(other AlgorithmIdentifier) bool {
+	if id.Algorithm.Cmp(other.Algorithm) != 0 {
+		return false
+	}
+	noParameters := func(id AlgorithmIdentifier) bool {
+		return id.ParametersAbsent() || id.HasNullParameters()
+	}
+	if noParameters(id) || noParameters(other) {
+		return noParameters(id) && noParameters(other)
+	}
+	return id.Parameters.Class == other.Parameters.Class &&
+		id.Parameters.Tag == other.Parameters.Tag &&
+		string(id.Parameters.Content) == string(other.Parameters.Content)
+}
+
+// SetParameters encodes obj with ctx and sets it as the parameters.
+func (id *AlgorithmIdentifier) SetParameters(ctx *asn1.Context, obj interface{}) error {
+	data, err := ctx.Encode(obj)
+	if err != nil {
+		return err
+	}
+	var parameters asn1.RawValue
+	if _, err := ctx.Decode(data, &parameters); err != nil {
+		return err
+	}
+	id.Parameters = &parameters
+	return nil
+}
+
+// ParseParameters decodes the parameters into obj with ctx. An error is
+// returned if the parameters are absent.
+func (id AlgorithmIdentifier) ParseParameters(ctx *asn1.Context, obj interface{}) error {
+	if id.Parameters == nil {
+		return &asn1.ParseError{Msg: fmt.Sprintf("parameters of algorithm %s are absent", id.Algorithm)}
+	}
+	data, err := ctx.Encode(*id.Parameters)
+	if err != nil {
+		return err
+	}
+	rest, err := ctx.Decode(data, obj)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return &asn1.ParseError{Msg: fmt.Sprintf("trailing data in parameters of algorithm %s", id.Algorithm)}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package pkix
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pipistrellka/asn1"
+)
+
+func TestAlgorithmIdentifier(t *testing.T) {
+	ctx := asn1.NewContext()
+	tests := []struct {
+		id       AlgorithmIdentifier
+		expected []byte
+	}{
+		{NewAlgorithmIdentifier(OidSHA256WithRSA), []byte{
+			0x30, 0x0d, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x01, 0x0b, 0x05, 0x00,
+		}},
+		{NewAlgorithmIdentifier(OidECDSAWithSHA256), []byte{
+			0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04, 0x03, 0x02,
+		}},
+		{NewAlgorithmIdentifier(OidEd25519), []byte{
+			0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x70,
+		}},
+	}
+	for _, test := range tests {
+		data, err := ctx.Encode(test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, test.expected) {
+			t.Fatalf("Unexpected encoding of %s: %#v", test.id.Algorithm, data)
+		}
+		var decoded AlgorithmIdentifier
+		if _, err := ctx.Decode(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Equal(test.id) ||
+			decoded.HasNullParameters() != test.id.HasNullParameters() ||
+			decoded.ParametersAbsent() != test.id.ParametersAbsent() {
+			t.Fatalf("Unexpected identifier decoded for %s: %+v", test.id.Algorithm, decoded)
+		}
+	}
+
+	// RSA without the NULL parameters is equal to the one with them
+	rsa := AlgorithmIdentifier{Algorithm: OidRSAEncryption}
+	if !rsa.Equal(NewAlgorithmIdentifier(OidRSAEncryption)) {
+		t.Fatal("Absent and NULL parameters should be equal.")
+	}
+
+	// Parameters of EC public keys identify the curve
+	p256 := asn1.Oid{1, 2, 840, 10045, 3, 1, 7}
+	ec := NewAlgorithmIdentifier(OidECPublicKey)
+	if err := ec.SetParameters(ctx, p256); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ctx.Encode(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded AlgorithmIdentifier
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var curve asn1.Oid
+	if err := decoded.ParseParameters(ctx, &curve); err != nil {
+		t.Fatal(err)
+	}
+	if curve.Cmp(p256) != 0 {
+		t.Fatalf("Unexpected curve: %s", curve)
+	}
+	if decoded.Equal(NewAlgorithmIdentifier(OidECPublicKey)) {
+		t.Fatal("Identifiers with different parameters should not be equal.")
+	}
+	if err := NewAlgorithmIdentifier(OidEd25519).ParseParameters(ctx, &curve); err == nil {
+		t.Fatal("Parsing absent parameters should have failed.")
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	type CertificationRequestInfo struct {
+		Version    int
+		Attributes Attributes `asn1:"tag:0,set"`
+	}
+	oidChallengePassword := asn1.Oid{1, 2, 840, 113549, 1, 9, 7}
+	oidContentType := asn1.Oid{1, 2, 840, 113549, 1, 9, 3}
+	oidSigningTime := asn1.Oid{1, 2, 840, 113549, 1, 9, 5}
+	oidData := asn1.Oid{1, 2, 840, 113549, 1, 7, 1}
+	signingTime := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var attrs Attributes
+	for _, err := range []error{
+		attrs.Set(oidChallengePassword, "secret"),
+		attrs.Set(oidContentType, oidData),
+		attrs.Set(oidSigningTime, signingTime),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := asn1.NewContext()
+	data, err := ctx.Encode(CertificationRequestInfo{0, attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CertificationRequestInfo
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := decoded.Attributes.GetString(oidChallengePassword); err != nil || s != "secret" {
+		t.Fatalf("Unexpected string: %q, %v", s, err)
+	}
+	if oid, err := decoded.Attributes.GetOid(oidContentType); err != nil || oid.Cmp(oidData) != 0 {
+		t.Fatalf("Unexpected OID: %s, %v", oid, err)
+	}
+	if tm, err := decoded.Attributes.GetTime(oidSigningTime); err != nil || !tm.Equal(signingTime) {
+		t.Fatalf("Unexpected time: %s, %v", tm, err)
+	}
+	if _, err := decoded.Attributes.GetTime(oidContentType); err == nil {
+		t.Fatal("Getting an OID as a time should have failed.")
+	}
+	if _, err := decoded.Attributes.GetString(asn1.Oid{2, 5, 4, 3}); err == nil {
+		t.Fatal("Getting a missing attribute should have failed.")
+	}
+
+	// Values of other string types
+	bmp := AttributeTypeAndValue{Value: asn1.RawValue{Tag: asn1.TagBmpString, Content: []byte{0x00, 'h', 0x00, 0xe9}}}
+	if s, err := bmp.GetString(); err != nil || s != "hé" {
+		t.Fatalf("Unexpected string: %q, %v", s, err)
+	}
+	printable, err := NewAttributeTypeAndValue(asn1.Oid{2, 5, 4, 6},
+		asn1.RawValue{Tag: asn1.TagPrintableString, Content: []byte("BR")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := printable.GetString(); err != nil || s != "BR" {
+		t.Fatalf("Unexpected string: %q, %v", s, err)
+	}
+}
+
+func TestRDNSequence(t *testing.T) {
+	s := `CN=Jane Doe+UID=jdoe,OU=R\2cD\, Labs,O=Example\+Co,DC=example,C=BR`
+	name, err := ParseRDNSequence(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(name) != 5 || len(name[4]) != 2 {
+		t.Fatalf("Unexpected RDNs: %v", name)
+	}
+	if ou, _ := name[3][0].GetString(); ou != "R,D, Labs" {
+		t.Fatalf("Unexpected organizational unit: %q", ou)
+	}
+	checkTag := func(atv AttributeTypeAndValue, tag uint) {
+		if atv.Value.Tag != tag {
+			t.Fatalf("Unexpected tag of %s: %d", atv.Type, atv.Value.Tag)
+		}
+	}
+	checkTag(name[0][0], asn1.TagPrintableString)
+	checkTag(name[1][0], asn1.TagIA5String)
+	checkTag(name[4][0], asn1.TagUtf8String)
+
+	// The name is encoded as a SEQUENCE OF SET OF
+	ctx := asn1.NewContext()
+	data, err := ctx.Encode(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0x30 || data[2] != 0x31 {
+		t.Fatalf("Unexpected encoding: %#v", data)
+	}
+	var decoded RDNSequence
+	if _, err := ctx.Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected := `CN=Jane Doe+UID=jdoe,OU=R\,D\, Labs,O=Example\+Co,DC=example,C=BR`
+	if decoded.String() != expected {
+		t.Fatalf("Unexpected string: %s", decoded.String())
+	}
+
+	// Other attribute types and values
+	name, err = ParseRDNSequence(`2.5.4.65=#0403616263,cn=\ x\ `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name.String() != `2.5.4.65=#0403616263,CN=\ x\ ` {
+		t.Fatalf("Unexpected string: %s", name.String())
+	}
+	for _, invalid := range []string{"CN", "XX=a", "CN=a\\", "2.5.4.65=#zz"} {
+		if _, err := ParseRDNSequence(invalid); err == nil {
+			t.Fatalf("Parsing %q should have failed.", invalid)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package asn1
+
+import (
+	"reflect"
+)
+
+// presenceRule is a rule given by the options "requires" and "excludes".
+type presenceRule struct {
+	field    string
+	requires bool
+}
+
+// getPresenceTarget returns the index of the field of the struct type t that
+// is referenced by the option "requires" or "excludes" of field.
+func (ctx *Context) getPresenceTarget(t reflect.Type, field reflect.StructField, rule presenceRule) (int, error) {
+	option := "excludes"
+	if rule.requires {
+		option = "requires"
+	}
+	target, ok := t.FieldByName(rule.field)
+	if !ok || len(target.Index) != 1 || target.Name == field.Name {
+		return 0, syntaxError("field %s.%s: invalid field '%s' for option '%s'",
+			t.Name(), field.Name, rule.field, option)
+	}
+	opts, err := ctx.getFieldOptions(t, target.Index[0])
+	if err != nil {
+		return 0, err
+	}
+	if opts == nil || opts.absent {
+		return 0, syntaxError("field %s.%s: field '%s' of option '%s' is never encoded",
+			t.Name(), field.Name, rule.field, option)
+	}
+	return target.Index[0], nil
+}
+
+// isFieldPresent checks if a field is encoded with a value. When decoding,
+// present holds the names of the fields whose elements were found instead.
+func isFieldPresent(value reflect.Value, i int, opts *fieldOptions, present map[string]bool) bool {
+	if present != nil {
+		return present[value.Type().Field(i).Name]
+	}
+	return opts != nil && !opts.absent && !isEmpty(value.Field(i))
+}
+
+// checkPresence verifies the options "requires" and "excludes" of the fields
+// of a struct value. present is nil when encoding, and holds the names of the
+// fields found when decoding. The errors are ParseErrors when decoding and
+// SyntaxErrors when encoding.
+func (ctx *Context) checkPresence(value reflect.Value, present map[string]bool) error {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		opts, err := ctx.getFieldOptions(t, i)
+		if err != nil {
+			return err
+		}
+		if opts == nil || len(opts.presence) == 0 || !isFieldPresent(value, i, opts, present) {
+			continue
+		}
+		field := t.Field(i)
+		for _, rule := range opts.presence {
+			target, err := ctx.getPresenceTarget(t, field, rule)
+			if err != nil {
+				return err
+			}
+			targetOpts, err := ctx.getFieldOptions(t, target)
+			if err != nil {
+				return err
+			}
+			if isFieldPresent(value, target, targetOpts, present) == rule.requires {
+				continue
+			}
+			msg := "field '%s' must be absent"
+			if rule.requires {
+				msg = "field '%s' must be present"
+			}
+			if present != nil {
+				return addFieldPath(fieldError(msg, rule.field), field.Name)
+			}
+			return syntaxError("field %s.%s: "+msg, t.Name(), field.Name, rule.field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package asn1
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+// preservedKey identifies a decoded value by its address and type, since a
+// struct and its first field share the same address.
+type preservedKey struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// preservedEncoding is the original encoding of a decoded value and a copy of
+// the value as it was decoded.
+type preservedEncoding struct {
+	data  []byte
+	value reflect.Value
+}
+
+// preservedEncodings keeps the original encodings of the decoded values when
+// the Context preserves encodings.
+type preservedEncodings struct {
+	mu      sync.Mutex
+	entries map[preservedKey]preservedEncoding
+}
+
+// SetPreserveEncoding enables or disables the preservation of the original
+// encodings of decoded values, which is disabled by default.
+//
+// When enabled, the Context keeps the encoding of every element it decodes
+// along with a copy of the decoded value. When the same value is encoded again
+// and it's unchanged, the original encoding is used as it is, even if it's not
+// the encoding that the Context would produce, e.g. BER with indefinite
+// lengths. This guarantees a bit-exact passthrough of messages that are only
+// inspected, such as signed messages, while the modified parts are encoded
+// again:
+//
+//	ctx.SetPreserveEncoding(true)
+//	ctx.Decode(data, &msg)
+//	msg.Header.Hop++
+//	data, err := ctx.Encode(&msg) // The signed body is kept as it was
+//
+// Values are identified by their addresses, so they must be encoded through a
+// pointer and with the same options they were decoded with. The elements of
+// slices and arrays are decoded into temporary values, so they are only
+// preserved as part of the whole slice or array.
+//
+// The data given to Decode is referenced by the Context and must not be
+// modified. Disabling the preservation releases the kept encodings.
+func (ctx *Context) SetPreserveEncoding(preserve bool) {
+	ctx.preserved = nil
+	if preserve {
+		ctx.preserved = &preservedEncodings{entries: make(map[preservedKey]preservedEncoding)}
+	}
+}
+
+// store keeps the original encoding of a decoded value.
+func (p *preservedEncodings) store(value reflect.Value, data []byte) {
+	if !value.CanAddr() || !value.CanInterface() || data == nil {
+		return
+	}
+	snapshot := reflect.New(value.Type()).Elem()
+	snapshot.Set(copyValue(value))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries[preservedKey{value.UnsafeAddr(), value.Type()}] = preservedEncoding{data, snapshot}
+}
+
+// lookup returns the original encoding of a value, or of the value it points
+// to, if the value is unchanged since it was decoded.
+func (p *preservedEncodings) lookup(value reflect.Value) []byte {
+	for {
+		if value.CanAddr() && value.CanInterface() {
+			p.mu.Lock()
+			entry, ok := p.entries[preservedKey{value.UnsafeAddr(), value.Type()}]
+			p.mu.Unlock()
+			if ok && reflect.DeepEqual(value.Interface(), entry.value.Interface()) {
+				return entry.data
+			}
+		}
+		switch value.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if value.IsNil() {
+				return nil
+			}
+			value = value.Elem()
+		default:
+			return nil
+		}
+	}
+}
+
+// encodePreserved returns the original encoding of value as a rawValue, or
+// nil if there is none.
+func (ctx *Context) encodePreserved(value reflect.Value) (*rawValue, error) {
+	data := ctx.preserved.lookup(value)
+	if data == nil {
+		return nil, nil
+	}
+	raw, err := decodeRawValue(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw.encoded = data
+	return raw, nil
+}
+
+// copyValue returns a deep copy of value. The unexported fields of structs are
+// copied as they are.
+func copyValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return value
+		}
+		if value.Type() == bigIntType {
+			return reflect.ValueOf(new(big.Int).Set(value.Interface().(*big.Int)))
+		}
+		copied := reflect.New(value.Type().Elem())
+		copied.Elem().Set(copyValue(value.Elem()))
+		return copied
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(copyValue(value.Elem()))
+		return copied
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			reflect.Copy(copied, value)
+			return copied
+		}
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(copyValue(value.Index(i)))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(value.Type()).Elem()
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(copyValue(value.Index(i)))
+		}
+		return copied
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(copyValue(value.Field(i)))
+			}
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,66 @@
+package asn1
+
+import (
+	"sort"
+	"sync"
+)
+
+// Profile configures a Context for the interoperability with a family of
+// peers, such as the strict or lax settings required by a library or a
+// device. Profiles are registered with RegisterProfile and applied by name
+// with (*Context).UseProfile, so the settings are kept together instead of
+// being scattered in the code that creates the Contexts.
+type Profile func(ctx *Context)
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{
+		// Canonical encodings in both directions.
+		"der": func(ctx *Context) {
+			ctx.SetDer(true, true)
+		},
+	}
+)
+
+// RegisterProfile registers a profile that Contexts can apply with
+// UseProfile. Registering an existing name replaces its profile, including
+// the built-in "der", which enables DER encoding and decoding. Profiles are
+// shared by all the Contexts.
+func RegisterProfile(name string, profile Profile) error {
+	if name == "" {
+		return syntaxError("profile name cannot be empty")
+	}
+	if profile == nil {
+		return syntaxError("invalid nil profile '%s'", name)
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[name] = profile
+	return nil
+}
+
+// Profiles returns the names of the registered profiles in alphabetical order.
+func Profiles() []string {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UseProfile applies the settings of the profile registered with the given
+// name. The settings the profile doesn't change are kept, and each of them
+// can still be changed afterwards with its own method.
+func (ctx *Context) UseProfile(name string) error {
+	profilesMu.RLock()
+	profile, ok := profiles[name]
+	profilesMu.RUnlock()
+	if !ok {
+		return syntaxError("unknown profile '%s'", name)
+	}
+	profile(ctx)
+	return nil
+}
@@ -2,334 +2,558 @@ package asn1
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"reflect"
 	"strconv"
+
+	"github.com/pipistrellka/asn1/tlv"
 )
 
 // ASN.1 class tags.
 const (
-	classUniversal       = 0x00
-	classApplication     = 0x01
-	classContextSpecific = 0x02
-	classPrivate         = 0x03
+	ClassUniversal       = 0x00
+	ClassApplication     = 0x01
+	ClassContextSpecific = 0x02
+	ClassPrivate         = 0x03
 )
 
 // ASN.1 universal tag numbers.
 const (
-	tagEoc             = 0x00
-	tagBoolean         = 0x01
-	tagInteger         = 0x02
-	tagBitString       = 0x03
-	tagOctetString     = 0x04
-	tagNull            = 0x05
-	tagOid             = 0x06
-	tagEnum            = 0x0a  // treat as Int
-	tagSequence        = 0x10
-	tagSet             = 0x11
-	tagPrintableString = 0x13
-	tagT61String       = 0x14
-	tagIA5String       = 0x16
-	tagUtcTime         = 0x17
+	TagEoc              = 0x00
+	TagBoolean          = 0x01
+	TagInteger          = 0x02
+	TagBitString        = 0x03
+	TagOctetString      = 0x04
+	TagNull             = 0x05
+	TagOid              = 0x06
+	TagObjectDescriptor = 0x07
+	TagExternal         = 0x08
+	TagReal             = 0x09
+	TagEnum             = 0x0a // treat as Int
+	TagEmbeddedPdv      = 0x0b
+	TagUtf8String       = 0x0c
+	TagRelativeOid      = 0x0d
+	TagTime             = 0x0e
+	TagSequence         = 0x10
+	TagSet              = 0x11
+	TagNumericString    = 0x12
+	TagPrintableString  = 0x13
+	TagT61String        = 0x14
+	TagVideotexString   = 0x15
+	TagIA5String        = 0x16
+	TagUtcTime          = 0x17
+	TagGeneralizedTime  = 0x18
+	TagGraphicString    = 0x19
+	TagVisibleString    = 0x1a
+	TagGeneralString    = 0x1b
+	TagUniversalString  = 0x1c
+	TagCharacterString  = 0x1d
+	TagBmpString        = 0x1e
+	TagDate             = 0x1f
+	TagTimeOfDay        = 0x20
+	TagDateTime         = 0x21
+	TagDuration         = 0x22
 )
 
+// Names of the universal types.
+var universalTagNames = map[uint]string{
+	TagEoc:              "END-OF-CONTENTS",
+	TagBoolean:          "BOOLEAN",
+	TagInteger:          "INTEGER",
+	TagBitString:        "BIT STRING",
+	TagOctetString:      "OCTET STRING",
+	TagNull:             "NULL",
+	TagOid:              "OBJECT IDENTIFIER",
+	TagObjectDescriptor: "ObjectDescriptor",
+	TagExternal:         "EXTERNAL",
+	TagReal:             "REAL",
+	TagEnum:             "ENUMERATED",
+	TagEmbeddedPdv:      "EMBEDDED PDV",
+	TagUtf8String:       "UTF8String",
+	TagRelativeOid:      "RELATIVE-OID",
+	TagTime:             "TIME",
+	TagSequence:         "SEQUENCE",
+	TagSet:              "SET",
+	TagNumericString:    "NumericString",
+	TagPrintableString:  "PrintableString",
+	TagT61String:        "T61String",
+	TagVideotexString:   "VideotexString",
+	TagIA5String:        "IA5String",
+	TagUtcTime:          "UTCTime",
+	TagGeneralizedTime:  "GeneralizedTime",
+	TagGraphicString:    "GraphicString",
+	TagVisibleString:    "VisibleString",
+	TagGeneralString:    "GeneralString",
+	TagUniversalString:  "UniversalString",
+	TagCharacterString:  "CHARACTER STRING",
+	TagBmpString:        "BMPString",
+	TagDate:             "DATE",
+	TagTimeOfDay:        "TIME-OF-DAY",
+	TagDateTime:         "DATE-TIME",
+	TagDuration:         "DURATION",
+}
+
+// TagString returns a human readable name for a class and tag number pair.
+// Known universal tags are represented by the name of their types, such as
+// "INTEGER", while other tags use the ASN.1 notation, such as "[APPLICATION 5]"
+// or "[3]" for context specific tags.
+func TagString(class, tag uint) string {
+	switch class {
+	case ClassUniversal:
+		if name, ok := universalTagNames[tag]; ok {
+			return name
+		}
+		return fmt.Sprintf("[UNIVERSAL %d]", tag)
+	case ClassApplication:
+		return fmt.Sprintf("[APPLICATION %d]", tag)
+	case ClassContextSpecific:
+		return fmt.Sprintf("[%d]", tag)
+	case ClassPrivate:
+		return fmt.Sprintf("[PRIVATE %d]", tag)
+	}
+	return fmt.Sprintf("[CLASS(%d) %d]", class, tag)
+}
+
 // Internal consts
 const (
-	intBits  = strconv.IntSize
-	intBytes = intBits / 8
+	intBits = strconv.IntSize
 )
 
-type rawValue struct {
+// RawValue is an element whose content is not decoded, as returned by
+// (*Context).Elements.
+//
+// A field of type RawValue accepts an element of any tag, and a field of type
+// []RawValue the elements of a SEQUENCE OF ANY, such as lists of extensions
+// or attributes of unknown types. Decoded elements are encoded again exactly
+// as they were, since FullBytes is written as it is when it's set.
+type RawValue struct {
 	Class       uint
 	Tag         uint
 	Constructed bool
-	Indefinite  bool
-	Content     []byte
+	// Content holds the content octets, without the end-of-contents octets
+	// when the indefinite length form is used. The elements of a constructed
+	// value can be read from it with (*Context).Elements.
+	Content []byte
+	// FullBytes is the complete encoding of the element, including its
+	// identifier and length octets.
+	FullBytes []byte
 }
 
-func (raw *rawValue) encode() ([]byte, error) {
-
-	if raw == nil {
-		return []byte{}, nil
-	}
-
-	buf, err := encodeIdentifier(raw)
-	if err != nil {
-		return nil, err
+// encodeRawElement encodes a RawValue. FullBytes is written as it is when it's
+// set, which requires it to hold a single element.
+func (ctx *Context) encodeRawElement(value reflect.Value) (*rawValue, error) {
+	rv, ok := value.Interface().(RawValue)
+	if !ok {
+		return nil, wrongType(rawValueType.String(), value)
 	}
-
-	// Add length information and raw data
-	if !raw.Indefinite {
-		length := uint(len(raw.Content))
-		buf = append(buf, encodeLength(length)...)
-		buf = append(buf, raw.Content...)
-	} else {
-		// Indefinite length uses 0x80, data..., 0x00, 0x00
-		if !raw.Constructed {
-			return nil, syntaxError("indefinite length is only allowed to constructed types")
+	if len(rv.FullBytes) > 0 {
+		reader := bytes.NewBuffer(rv.FullBytes)
+		raw, err := decodeRawValue(reader)
+		if err != nil {
+			return nil, err
+		}
+		if reader.Len() > 0 {
+			return nil, syntaxError("trailing data in RawValue.FullBytes")
 		}
-		buf = append(buf, 0x80)
-		buf = append(buf, raw.Content...)
-		buf = append(buf, 0x00, 0x00)
+		raw.encoded = rv.FullBytes
+		return raw, nil
 	}
-
-	return buf, nil
+	if rv.Class > ClassPrivate {
+		return nil, syntaxError("invalid RawValue class %d", rv.Class)
+	}
+	return &rawValue{
+		Class:       rv.Class,
+		Tag:         rv.Tag,
+		Constructed: rv.Constructed,
+		Content:     rv.Content,
+	}, nil
 }
 
-func encodeIdentifier(node *rawValue) ([]byte, error) {
-
-	if node.Class > 0x03 {
-		return nil, syntaxError("invalid class value: %d", node.Class)
+// decodeRawElement decodes the complete encoding of an element into a
+// RawValue. The octets are copied, so the RawValue doesn't keep the decoded
+// data.
+func (ctx *Context) decodeRawElement(data []byte, value reflect.Value) error {
+	raw, err := decodeRawValue(bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	fullBytes := append([]byte{}, data...)
+	start := len(fullBytes) - len(raw.Content)
+	if raw.Indefinite {
+		// Skip the end of contents octets
+		start -= 2
 	}
+	value.Set(reflect.ValueOf(RawValue{
+		Class:       raw.Class,
+		Tag:         raw.Tag,
+		Constructed: raw.Constructed,
+		Content:     fullBytes[start : start+len(raw.Content)],
+		FullBytes:   fullBytes,
+	}))
+	return nil
+}
 
-	identifier := []byte{0x00}
+type rawValue struct {
+	Class       uint
+	Tag         uint
+	Constructed bool
+	Indefinite  bool
+	Content     []byte
 
-	// Class (bits 7 and 6) + primitive/constructed (1 bit) + tag (5 bits)
-	identifier[0] += byte((node.Class & 0x03) << 6)
+	// nonMinimalLength is set by decodeRawValue when the length was not
+	// encoded in the minimum number of octets.
+	nonMinimalLength bool
+	// Position of the element and of its content in the decoded data, set
+	// only when decoding with a trace.
+	offset        int
+	length        int
+	contentOffset int
+	// lengthOctets is the number of octets that follow the first length
+	// octet when encoding, zero for the minimum number of octets, or
+	// longFormOctets.
+	lengthOctets int
+	// encoded is the original encoding of the element, set when it's read
+	// from a buffer or given by the FullBytes of a RawValue. encode returns
+	// it as it is.
+	encoded []byte
+	// children are the elements of the content of a constructed element
+	// built by the encoder, which replace Content when set. The content is
+	// written from them, so it's only assembled when it's needed as a whole.
+	children []*rawValue
+	// source is the reader of the content of an OCTET STRING built by the
+	// encoder, which replaces Content when set. It's read when the content
+	// is written.
+	source *readerSource
+	// contentLength is the length of the content given by children or by
+	// source.
+	contentLength int
+	// unknownLength is set when the content is given by a source that can't
+	// seek, or by children with such a source, which is only known as it's
+	// written. These values use the constructed indefinite length form.
+	unknownLength bool
+}
 
-	// Primitive/constructed (bit 5)
-	if node.Constructed {
-		identifier[0] += byte(1 << 5)
-	}
+// String returns the tag of raw followed by its content in hexadecimal.
+func (raw *rawValue) String() string {
+	return fmt.Sprintf("%s %X", TagString(raw.Class, raw.Tag), raw.Content)
+}
 
-	// Tag (bits 4 to 0)
-	if node.Tag <= 30 {
-		identifier[0] += byte(0x1f & node.Tag)
-	} else {
-		identifier[0] += 0x1f
-		identifier = append(identifier, encodeMultiByteTag(node.Tag)...)
+// node returns the tlv.Node of raw.
+func (raw *rawValue) node() *tlv.Node {
+	return &tlv.Node{
+		Class:        raw.Class,
+		Tag:          raw.Tag,
+		Constructed:  raw.Constructed,
+		Indefinite:   raw.Indefinite,
+		Content:      raw.Content,
+		LengthOctets: raw.lengthOctets,
 	}
-	return identifier, nil
 }
 
-func encodeMultiByteTag(tag uint) []byte {
-
-	// A tag is encoded in a big endian sequence of octets each one holding a 7 bit value.
-	// The most significant bit of each octet must be 1, with the exception of the last octet that must be zero.
-	// Example:  1xxxxxxx 1xxxxxxx ... 0xxxxxxx
-
-	// An int32 needs 5 octets and an int64 needs 10:
-	bufLen := (intBits-1)/7 + 1
-	buf := make([]byte, bufLen)
-
-	for i := range buf {
-		shift := uint(7 * (len(buf) - i - 1))
-		mask := uint(0x7f << shift)
-		buf[i] = byte((tag & mask) >> shift)
-		// Only the last byte is not marked with 0x80
-		if i != len(buf)-1 {
-			buf[i] |= 0x80
+func (raw *rawValue) encode() ([]byte, error) {
+	if raw == nil {
+		return []byte{}, nil
+	}
+	if raw.encoded != nil {
+		return raw.encoded, nil
+	}
+	if !raw.isDeferred() {
+		buf, err := raw.node().Encode()
+		return buf, syntaxErrorFromTLV(err)
+	}
+	buf := &bytes.Buffer{}
+	if !raw.unknownLength {
+		n, err := raw.encodedLen()
+		if err != nil {
+			return nil, err
 		}
+		buf.Grow(n)
 	}
-	// Discard leading zero values
-	return removeLeadingBytes(buf, 0x80)
+	if err := raw.writeTo(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-func encodeLength(length uint) []byte {
-
-	// The first bit indicates if length is encoded in a single byte
-	if length < 0x80 {
-		return []byte{byte(length)}
+// writeTo writes the encoding returned by encode to w without building it.
+func (raw *rawValue) writeTo(w io.Writer) error {
+	if raw == nil {
+		return nil
 	}
-
-	// Multi byte length follow the rules:
-	// - First byte: 0x80 + N (number of following bytes where length is encoded).
-	// - N bytes
-
-	// A byte slice length is an int. So we just need at most 4 bytes
-	buf := make([]byte, intBytes)
-	for i := range buf {
-		shift := uint((intBytes - i - 1) * 8)
-		mask := uint(0xff << shift)
-		buf[i] = byte((mask & length) >> shift)
+	if raw.encoded != nil {
+		_, err := w.Write(raw.encoded)
+		return err
 	}
-
-	// Ignore leading zeros
-	buf = removeLeadingBytes(buf, 0x00)
-
-	// Add leading byte with the number of following bytes
-	buf = append([]byte{0x80 + byte(len(buf))}, buf...)
-	return buf
-}
-
-func removeLeadingBytes(buf []byte, target byte) []byte {
-	start := 0
-	for start < len(buf)-1 && buf[start] == target {
-		start++
+	if !raw.isDeferred() {
+		_, err := raw.node().WriteTo(w)
+		return syntaxErrorFromTLV(err)
 	}
-	return buf[start:]
-}
-
-func decodeRawValue(reader io.Reader) (*rawValue, error) {
-
-	class, tag, constructed, err := decodeIdentifier(reader)
+	header, err := raw.header()
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	length, indefinite, err := decodeLength(reader)
-	if err != nil {
-		return nil, err
+	if _, err := w.Write(header); err != nil {
+		return err
 	}
-	if indefinite && !constructed {
-		return nil, parseError("primitive node with indefinite length")
+	if err := raw.writeContentTo(w); err != nil {
+		return err
 	}
-
-	// Indefinite form
-	var content []byte
-	if !indefinite {
-		content = make([]byte, length)
-		_, err = io.ReadFull(reader, content)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		buffer := bytes.NewBuffer([]byte{})
-		childrenReader := io.TeeReader(reader, buffer)
-		err := readEoc(childrenReader)
-		if err != nil {
-			return nil, err
-		}
-		// At this point, buffer also contains the EoC bytes
-		content = buffer.Bytes()
-		content = content[:len(content)-2]
+	if raw.Indefinite {
+		_, err = w.Write([]byte{0x00, 0x00})
 	}
+	return err
+}
 
-	raw := rawValue{class, tag, constructed, indefinite, content}
-	return &raw, nil
+// encodedLen returns the length of the encoding returned by encode without
+// building it.
+func (raw *rawValue) encodedLen() (int, error) {
+	if raw == nil {
+		return 0, nil
+	}
+	if raw.encoded != nil {
+		return len(raw.encoded), nil
+	}
+	if !raw.isDeferred() {
+		n, err := raw.node().EncodedLen()
+		return n, syntaxErrorFromTLV(err)
+	}
+	if raw.unknownLength {
+		return 0, syntaxError("length of %s is unknown until its content is read",
+			TagString(raw.Class, raw.Tag))
+	}
+	header, err := raw.header()
+	if err != nil {
+		return 0, err
+	}
+	n := len(header) + raw.contentLength
+	if raw.Indefinite {
+		n += 2
+	}
+	return n, nil
 }
 
-func readEoc(reader io.Reader) error {
+// isDeferred checks if the content of raw is given by its children or by its
+// source instead of Content.
+func (raw *rawValue) isDeferred() bool {
+	return raw.children != nil || raw.source != nil
+}
 
-	for {
-		class, tag, constructed, err := decodeIdentifier(reader)
-		if err != nil {
+// writeContentTo writes the content given by the children or the source of
+// raw to w.
+func (raw *rawValue) writeContentTo(w io.Writer) error {
+	if raw.source != nil {
+		return raw.source.writeTo(w)
+	}
+	for _, child := range raw.children {
+		if err := child.writeTo(w); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		length, indefinite, err := decodeLength(reader)
-		if err != nil {
-			return err
-		}
+// header returns the identifier and length octets of a raw value whose
+// content is given by its children or by its source.
+func (raw *rawValue) header() ([]byte, error) {
+	buf, err := tlv.EncodeHeader(raw.Class, raw.Tag, raw.Constructed, raw.Indefinite,
+		uint(raw.contentLength), raw.lengthOctets)
+	return buf, syntaxErrorFromTLV(err)
+}
 
-		if indefinite && !constructed {
-			return parseError("primitive node with indefinite length")
-		}
+// setSource sets the source of the content of raw, which switches it to the
+// constructed indefinite length form when its length is unknown.
+func (raw *rawValue) setSource(source *readerSource) {
+	raw.source = source
+	if source.length < 0 {
+		raw.Constructed, raw.Indefinite, raw.unknownLength = true, true, true
+		return
+	}
+	raw.contentLength = int(source.length)
+}
 
-		if class == 0 && tag == 0 && indefinite == false && length == 0 {
-			break
+// setChildren sets the elements of the content of raw. Absent elements are
+// nil and they are skipped. When the length of an element is unknown, raw
+// uses the indefinite length form.
+func (raw *rawValue) setChildren(children []*rawValue) error {
+	raw.children = make([]*rawValue, 0, len(children))
+	raw.contentLength = 0
+	for _, child := range children {
+		if child == nil {
+			continue
 		}
-
-		if indefinite {
-			err = readEoc(reader)
-		} else {
-			err = skipBytes(reader, int64(length))
+		if child.unknownLength {
+			raw.children = append(raw.children, child)
+			raw.Indefinite, raw.unknownLength = true, true
+			continue
 		}
+		n, err := child.encodedLen()
 		if err != nil {
 			return err
 		}
+		raw.children = append(raw.children, child)
+		raw.contentLength += n
 	}
+	raw.Content = nil
 	return nil
 }
 
-func decodeMultiByteTag(reader io.Reader) (uint, error) {
-	// Tag is encoded in one or more following bytes
-	tag := uint(0)
-	for {
-		// Read a byte
-		b, err := readByte(reader)
-		if err != nil {
-			return 0, err
-		}
-		// if we need to shift out non zeros bits, so the tag is too big for an uint
-		msb := uint64(0xfe) << (intBits - 8) // 7 most significant bits
-		if uint64(tag)&msb != 0 {
-			return 0, parseError("multi byte tag too big")
-		}
-		// Shift the previous value and add the new 7 bits
-		tag = (tag << 7) | uint(b&0x7f)
-		// The last byte is indicated by the most significant bit equals to zero
-		if b&0x80 == 0 {
-			break
-		}
+// build assembles the content of raw from its children or reads it from its
+// source, for the cases where the content is needed as a whole.
+func (raw *rawValue) build() error {
+	if !raw.isDeferred() {
+		return nil
 	}
-	return tag, nil
+	buf := bytes.NewBuffer(make([]byte, 0, raw.contentLength))
+	if err := raw.writeContentTo(buf); err != nil {
+		return err
+	}
+	raw.Content = buf.Bytes()
+	raw.contentLength = len(raw.Content)
+	raw.children = nil
+	raw.source = nil
+	raw.unknownLength = false
+	return nil
 }
 
-func decodeIdentifier(reader io.Reader) (class uint, tag uint, constructed bool, err error) {
-
-	b, err := readByte(reader)
-	if err != nil {
-		return
+// syntaxErrorFromTLV converts a tlv.Error returned when encoding into a
+// SyntaxError.
+func syntaxErrorFromTLV(err error) error {
+	if e, ok := err.(*tlv.Error); ok {
+		return syntaxError("%s", e.Msg)
 	}
+	return err
+}
 
-	// Read class and constructed flag
-	class = uint((b & 0xc0) >> 6)
-	if b&0x20 != 0 {
-		constructed = true
+// parseErrorFromTLV converts a tlv.Error returned when parsing into a
+// ParseError.
+func parseErrorFromTLV(err error) error {
+	if e, ok := err.(*tlv.Error); ok {
+		return parseError("%s", e.Msg)
 	}
+	return err
+}
 
-	// Read the tag number
-	tag = uint(b & 0x1f)
-	if tag == 0x1f {
-		// Tag is encoded in one or more following bytes
-		tag, err = decodeMultiByteTag(reader)
-		if err != nil {
-			return
-		}
-	}
-	return
+func encodeIdentifier(node *rawValue) ([]byte, error) {
+	buf, err := tlv.EncodeIdentifier(node.Class, node.Tag, node.Constructed)
+	return buf, syntaxErrorFromTLV(err)
 }
 
-func decodeLength(reader io.Reader) (length uint, indefinite bool, err error) {
+func encodeMultiByteTag(tag uint) []byte {
+	return tlv.EncodeBase128(tag)
+}
+
+func encodeLength(length uint) []byte {
+	return tlv.EncodeLength(length)
+}
 
-	// Read length
-	b, err := readByte(reader)
+// maxLengthOctets is the maximum number of octets of a length in the long form
+// that can be forced when encoding.
+const maxLengthOctets = tlv.MaxLengthOctets
+
+// longFormOctets is the number of length octets that selects the long form
+// with the minimum number of octets, even for lengths that fit in the short
+// form.
+const longFormOctets = tlv.LongForm
+
+// encodeLengthOctets encodes a length in the long form with the given number
+// of octets after the first one, in the minimum number of octets if octets
+// is zero, or in the long form with the minimum number of octets if octets is
+// longFormOctets.
+func encodeLengthOctets(length uint, octets int) ([]byte, error) {
+	buf, err := tlv.EncodeLengthOctets(length, octets)
+	return buf, syntaxErrorFromTLV(err)
+}
+
+func decodeRawValue(reader io.Reader) (*rawValue, error) {
+	return decodeLimitedRawValue(reader, rawLimits{})
+}
+
+// rawLimits are the limits checked by decodeLimitedRawValue. Zero values
+// disable the limits.
+type rawLimits struct {
+	// maxTagNumber is the greatest tag number accepted.
+	maxTagNumber uint
+	// maxLengthOctets is the maximum number of octets after the first one
+	// of a length in the long form.
+	maxLengthOctets int
+	// maxContentLength is the greatest length of the content of an element
+	// in the definite form.
+	maxContentLength int
+}
+
+// decodeLimitedRawValue works like decodeRawValue and rejects the elements
+// that exceed the given limits before reading their content.
+func decodeLimitedRawValue(reader io.Reader, limits rawLimits) (*rawValue, error) {
+	h, err := tlv.ReadHeader(reader)
 	if err != nil {
-		return
+		return nil, parseErrorFromTLV(err)
 	}
-
-	// Short form
-	if b&0x80 == 0 {
-		length = uint(b)
-		return
+	if limits.maxTagNumber > 0 && h.Tag > limits.maxTagNumber {
+		return nil, parseError("tag number %d is greater than the maximum of %d",
+			h.Tag, limits.maxTagNumber)
 	}
-
-	// Indefinite form
-	if b == 0x80 {
-		indefinite = true
-		return
+	if limits.maxLengthOctets > 0 && h.LengthOctets > limits.maxLengthOctets {
+		return nil, parseError("length of element %s uses %d octets, more than the maximum of %d",
+			TagString(h.Class, h.Tag), h.LengthOctets, limits.maxLengthOctets)
 	}
-
-	// Long form
-	if b == 0xff {
-		err = parseError("invalid number of length octets: %x", b)
-		return
+	if limits.maxContentLength > 0 && !h.Indefinite && h.Length > uint(limits.maxContentLength) {
+		return nil, parseError("content of element %s has %d octets, more than the maximum of %d",
+			TagString(h.Class, h.Tag), h.Length, limits.maxContentLength)
 	}
-	octets := make([]byte, int(b&0x7f))
-	_, err = io.ReadFull(reader, octets)
+
+	node, err := tlv.ReadContent(reader, h)
 	if err != nil {
-		return
+		return nil, parseErrorFromTLV(err)
 	}
-	for _, b = range octets {
-		msb := uint64(0xff) << (intBits - 8)
-		if uint64(length)&msb != 0 {
-			err = parseError("multi byte length too big")
-			return
-		}
-		length = (length << 8) | uint(b)
+	raw := rawValue{
+		Class:       node.Class,
+		Tag:         node.Tag,
+		Constructed: node.Constructed,
+		Indefinite:  node.Indefinite,
+		Content:     node.Content,
 	}
+	raw.nonMinimalLength = !h.MinimalLength()
+	return &raw, nil
+}
 
+// ParseHeader parses the identifier and length octets of the element at the
+// beginning of data. It returns the class, tag number and constructed flag of
+// the element, the length of its content and the number of octets used by the
+// header. The length is -1 when the indefinite length form is used.
+//
+// Only the header is parsed, so data doesn't need to contain the whole
+// element.
+func ParseHeader(data []byte) (class uint, tag uint, constructed bool, length int, headerLen int, err error) {
+	class, tag, constructed, length, headerLen, err = tlv.ParseHeader(data)
+	err = parseErrorFromTLV(err)
 	return
 }
 
-func readByte(reader io.Reader) (byte, error) {
-	buf := []byte{0x00}
-	_, err := io.ReadFull(reader, buf)
-	return buf[0], err
+// SkipValue skips the complete element at the beginning of data and returns
+// the remaining bytes. Elements using the indefinite length form are skipped
+// up to their matching end-of-contents octets.
+//
+// The content of the element is not parsed, with the exception of the nested
+// elements of indefinite length elements.
+func SkipValue(data []byte) (rest []byte, err error) {
+	rest, err = tlv.Skip(data)
+	return rest, parseErrorFromTLV(err)
 }
 
-func skipBytes(reader io.Reader, count int64) error {
-	_, err := io.CopyN(ioutil.Discard, reader, count)
-	return err
+func decodeMultiByteTag(reader io.Reader) (uint, error) {
+	tag, err := tlv.ReadBase128(reader)
+	return tag, parseErrorFromTLV(err)
+}
+
+func decodeIdentifier(reader io.Reader) (class uint, tag uint, constructed bool, err error) {
+	class, tag, constructed, err = tlv.ReadIdentifier(reader)
+	err = parseErrorFromTLV(err)
+	return
+}
+
+func decodeLength(reader io.Reader) (length uint, indefinite bool, err error) {
+	length, indefinite, _, err = tlv.ReadLength(reader)
+	err = parseErrorFromTLV(err)
+	return
 }
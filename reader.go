@@ -0,0 +1,215 @@
+package asn1
+
+import (
+	"bytes"
+	"io"
+)
+
+// SequenceState is the position of a SequenceReader in its SEQUENCE. It only
+// has exported fields of basic types, so it can be persisted, for instance as
+// JSON, and given to (*Context).ResumeSequence to continue reading after a
+// restart.
+type SequenceState struct {
+	// Offset is the position of the next element, counted from the first
+	// octet of the SEQUENCE.
+	Offset int64
+	// Index is the number of elements read.
+	Index int
+	// Remaining is the number of content octets not read yet, or -1 when
+	// the SEQUENCE uses the indefinite length form.
+	Remaining int64
+	// Done is set when the end of the SEQUENCE is reached.
+	Done bool
+}
+
+// SequenceReader reads the elements of a SEQUENCE OF from a stream one at a
+// time, such as the files written by SequenceWriter, without reading the whole
+// SEQUENCE in memory:
+//
+//	r, err := ctx.NewSequenceReader(file, "")
+//	for {
+//		var record Record
+//		err := r.ReadElement(&record)
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//		saveState(r.State())
+//	}
+//
+// The state returned by State allows resuming the reading from another
+// process with (*Context).ResumeSequence.
+type SequenceReader struct {
+	ctx    *Context
+	reader io.Reader
+	state  SequenceState
+}
+
+// NewSequenceReader reads the header of a SEQUENCE from r and returns a
+// SequenceReader for its elements. The options can give the expected tag of
+// the SEQUENCE (ie: "application,tag:1") or mark it as a SET with "set".
+func (ctx *Context) NewSequenceReader(r io.Reader, options string) (*SequenceReader, error) {
+	opts, err := ctx.parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil || opts.explicit || opts.choice != nil || opts.encrypt != nil || opts.compress != nil {
+		return nil, syntaxError("invalid options '%s' for a SequenceReader", options)
+	}
+	expected := rawValue{Class: ClassUniversal, Tag: TagSequence}
+	if opts.set {
+		expected.Tag = TagSet
+	}
+	if opts.tag != nil {
+		expected.Class = opts.tagClass()
+		expected.Tag = uint(*opts.tag)
+	}
+
+	counter := &countingReader{reader: r}
+	class, tag, constructed, err := decodeIdentifier(counter)
+	if err != nil {
+		return nil, err
+	}
+	if class != expected.Class || tag != expected.Tag || !constructed {
+		return nil, parseError("expected constructed %s but found %s",
+			TagString(expected.Class, expected.Tag), TagString(class, tag))
+	}
+	length, indefinite, err := decodeLength(counter)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.der.decoding && indefinite {
+		return nil, parseError("indefinite length form is not supported by DER mode")
+	}
+	state := SequenceState{Offset: counter.n, Remaining: int64(length)}
+	if indefinite {
+		state.Remaining = -1
+	}
+	return ctx.ResumeSequence(r, state), nil
+}
+
+// ResumeSequence returns a SequenceReader that continues reading a SEQUENCE
+// from the given state, as returned by (*SequenceReader).State. The reader r
+// must be positioned at the offset of the state, which usually requires
+// seeking to the position of the SEQUENCE in the stream plus state.Offset.
+func (ctx *Context) ResumeSequence(r io.Reader, state SequenceState) *SequenceReader {
+	return &SequenceReader{ctx: ctx, reader: r, state: state}
+}
+
+// State returns the current position of the reader.
+func (sr *SequenceReader) State() SequenceState {
+	return sr.state
+}
+
+// ReadElement decodes the next element of the SEQUENCE into obj, as
+// (*Context).Decode does. It returns io.EOF when there are no more elements,
+// after which the reader of the stream is positioned after the SEQUENCE. An
+// element that can't be decoded is skipped, so the error can be logged and the
+// reading continued.
+func (sr *SequenceReader) ReadElement(obj interface{}) error {
+	if sr.state.Done {
+		return io.EOF
+	}
+	if sr.state.Remaining == 0 {
+		sr.state.Done = true
+		return io.EOF
+	}
+
+	reader := sr.reader
+	if sr.state.Remaining > 0 {
+		reader = io.LimitReader(reader, sr.state.Remaining)
+	}
+	buffer := &bytes.Buffer{}
+	raw, err := sr.ctx.readRawValue(io.TeeReader(reader, buffer))
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	n := int64(buffer.Len())
+	if sr.state.Remaining < 0 && raw.Class == ClassUniversal && raw.Tag == 0 &&
+		!raw.Constructed && len(raw.Content) == 0 {
+		// End of contents
+		sr.state.Offset += n
+		sr.state.Done = true
+		return io.EOF
+	}
+
+	sr.state.Offset += n
+	sr.state.Index++
+	if sr.state.Remaining > 0 {
+		sr.state.Remaining -= n
+	}
+	_, err = sr.ctx.Decode(buffer.Bytes(), obj)
+	return err
+}
+
+// countingReader counts the octets read from reader.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+// Read reads from the underlying reader.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// DecodeFrom reads a single element from r and decodes it into obj, as
+// (*Context).Decode does. See DecodeFromWithOptions for further details.
+func (ctx *Context) DecodeFrom(r io.ByteReader, obj interface{}) error {
+	return ctx.DecodeFromWithOptions(r, obj, "")
+}
+
+// DecodeFromWithOptions reads a single element from r and decodes it into
+// obj, as (*Context).DecodeWithOptions does. The octets are read as they come,
+// without seeking or knowing the length of the input, and no octet after the
+// element is read, so the messages of a connection can be decoded directly
+// from a bufio.Reader:
+//
+//	r := bufio.NewReader(conn)
+//	for {
+//		var msg Message
+//		if err := ctx.DecodeFrom(r, &msg); err != nil {
+//			...
+//		}
+//	}
+//
+// If r is also an io.Reader, the contents are read in blocks instead of one
+// octet at a time. It returns io.EOF if r ends before the element and
+// io.ErrUnexpectedEOF if it ends in the middle of the element.
+func (ctx *Context) DecodeFromWithOptions(r io.ByteReader, obj interface{}, options string) error {
+	reader, ok := r.(io.Reader)
+	if !ok {
+		reader = byteReader{r}
+	}
+	buffer := &bytes.Buffer{}
+	if _, err := ctx.readRawValue(io.TeeReader(reader, buffer)); err != nil {
+		if err == io.EOF && buffer.Len() > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	_, err := ctx.DecodeWithOptions(buffer.Bytes(), obj, options)
+	return err
+}
+
+// byteReader reads from an io.ByteReader one octet at a time.
+type byteReader struct {
+	reader io.ByteReader
+}
+
+// Read reads len(p) octets unless the underlying reader fails.
+func (b byteReader) Read(p []byte) (int, error) {
+	for i := range p {
+		c, err := b.reader.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		p[i] = c
+	}
+	return len(p), nil
+}
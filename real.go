@@ -0,0 +1,276 @@
+package asn1
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RealFormat controls how REAL values, given by float32 and float64, are
+// encoded. The zero value encodes them in the binary form with base 2, which
+// is the canonical form of DER.
+type RealFormat struct {
+	// Decimal encodes values in the decimal form NR3 of ISO 6093 instead of
+	// the binary form.
+	Decimal bool
+	// Digits is the number of significant digits of decimal values, whose
+	// mantissa is written with one digit before the decimal mark (ie:
+	// 1.500E+01 with 4 digits). Zero writes the mantissa as an integer
+	// without trailing zeros and with the fewest digits that represent the
+	// value (ie: 15.E-1), which is the form required by DER.
+	Digits int
+	// ExponentDigits is the minimum number of digits of the exponent of
+	// decimal values, which is padded with zeros and always written with its
+	// sign when it's not zero (ie: 1.5E+01 with 2 digits). Zero writes the
+	// fewest digits and only the minus sign, except for a zero exponent which
+	// is written as E+0.
+	ExponentDigits int
+}
+
+// SetRealFormat sets the form of the encoded REAL values. The decimal form is
+// always written with a period as the decimal mark and an upper case E,
+// whatever the locale, so values round-trip with the exact textual form that
+// some receivers expect. All the forms are accepted when decoding.
+func (ctx *Context) SetRealFormat(format RealFormat) {
+	ctx.realFormat = format
+}
+
+// REAL special values and forms (X.690 8.5)
+const (
+	realBinary        = 0x80
+	realSpecial       = 0x40
+	realPlusInfinity  = 0x40
+	realMinusInfinity = 0x41
+	realNaN           = 0x42
+	realMinusZero     = 0x43
+	realNR1           = 0x01
+	realNR2           = 0x02
+	realNR3           = 0x03
+)
+
+func (ctx *Context) encodeReal(value reflect.Value) ([]byte, error) {
+	var f float64
+	bitSize := 64
+	switch value.Kind() {
+	case reflect.Float32:
+		bitSize = 32
+		f = value.Float()
+	case reflect.Float64:
+		f = value.Float()
+	default:
+		return nil, wrongType("float64", value)
+	}
+
+	switch {
+	case math.IsInf(f, 1):
+		return []byte{realPlusInfinity}, nil
+	case math.IsInf(f, -1):
+		return []byte{realMinusInfinity}, nil
+	case math.IsNaN(f):
+		return []byte{realNaN}, nil
+	case f == 0 && math.Signbit(f):
+		return []byte{realMinusZero}, nil
+	case f == 0:
+		return []byte{}, nil
+	}
+	if ctx.realFormat.Decimal {
+		return encodeDecimalReal(f, bitSize, ctx.realFormat), nil
+	}
+	return encodeBinaryReal(f), nil
+}
+
+// encodeBinaryReal encodes a finite value other than zero in the binary form
+// with base 2, a scale factor of zero and an odd mantissa.
+func encodeBinaryReal(f float64) []byte {
+	first := byte(realBinary)
+	if f < 0 {
+		first |= 0x40
+		f = -f
+	}
+	frac, exp := math.Frexp(f)
+	mantissa := uint64(math.Ldexp(frac, 53))
+	exp -= 53
+	shift := bits.TrailingZeros64(mantissa)
+	mantissa >>= uint(shift)
+	exp += shift
+
+	// The exponent of a float64 always fits in two octets
+	var exponent []byte
+	if exp >= math.MinInt8 && exp <= math.MaxInt8 {
+		exponent = []byte{byte(exp)}
+	} else {
+		first |= 0x01
+		exponent = []byte{byte(exp >> 8), byte(exp)}
+	}
+	buf := append([]byte{first}, exponent...)
+	return append(buf, new(big.Int).SetUint64(mantissa).Bytes()...)
+}
+
+// encodeDecimalReal encodes a finite value other than zero in the decimal form
+// NR3.
+func encodeDecimalReal(f float64, bitSize int, format RealFormat) []byte {
+	var mantissa string
+	var exp int
+	if format.Digits > 0 {
+		s := strconv.FormatFloat(f, 'E', format.Digits-1, bitSize)
+		i := strings.IndexByte(s, 'E')
+		mantissa = s[:i]
+		exp, _ = strconv.Atoi(s[i+1:])
+	} else {
+		// Integer mantissa without trailing zeros
+		s := strconv.FormatFloat(f, 'E', -1, bitSize)
+		i := strings.IndexByte(s, 'E')
+		exp, _ = strconv.Atoi(s[i+1:])
+		digits := strings.Replace(s[:i], ".", "", 1)
+		exp -= len(strings.TrimPrefix(digits, "-")) - 1
+		for strings.HasSuffix(digits, "0") {
+			digits = digits[:len(digits)-1]
+			exp++
+		}
+		mantissa = digits + "."
+	}
+
+	var buf strings.Builder
+	buf.WriteByte(realNR3)
+	buf.WriteString(mantissa)
+	buf.WriteByte('E')
+	switch {
+	case exp < 0:
+		buf.WriteByte('-')
+		exp = -exp
+	case exp > 0 && format.ExponentDigits > 0, exp == 0:
+		buf.WriteByte('+')
+	}
+	digits := strconv.Itoa(exp)
+	for i := len(digits); i < format.ExponentDigits; i++ {
+		buf.WriteByte('0')
+	}
+	buf.WriteString(digits)
+	return []byte(buf.String())
+}
+
+func (ctx *Context) decodeReal(data []byte, value reflect.Value) error {
+	f, err := ctx.parseReal(data)
+	if err != nil {
+		return err
+	}
+	switch value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if value.OverflowFloat(f) {
+			return parseError("REAL value %g does not fit in Go type '%s'", f, value.Type())
+		}
+		value.SetFloat(f)
+		return nil
+	}
+	return syntaxError("invalid Go type '%s' for REAL", value.Type())
+}
+
+// parseReal parses the content of a REAL value.
+func (ctx *Context) parseReal(data []byte) (float64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	first := data[0]
+	switch {
+	case first&realBinary != 0:
+		return ctx.parseBinaryReal(data)
+	case first&realSpecial != 0:
+		if len(data) != 1 {
+			return 0, parseError("invalid REAL special value")
+		}
+		switch first {
+		case realPlusInfinity:
+			return math.Inf(1), nil
+		case realMinusInfinity:
+			return math.Inf(-1), nil
+		case realNaN:
+			return math.NaN(), nil
+		case realMinusZero:
+			return math.Copysign(0, -1), nil
+		}
+		return 0, parseError("invalid REAL special value 0x%02x", first)
+	}
+	return parseDecimalReal(data)
+}
+
+// parseBinaryReal parses a REAL value in the binary form.
+func (ctx *Context) parseBinaryReal(data []byte) (float64, error) {
+	first := data[0]
+	data = data[1:]
+
+	var exponentLen int
+	switch first & 0x03 {
+	case 0x03:
+		if len(data) == 0 {
+			return 0, parseError("missing REAL exponent length")
+		}
+		exponentLen = int(data[0])
+		data = data[1:]
+		if exponentLen == 0 {
+			return 0, parseError("invalid REAL exponent length")
+		}
+	default:
+		exponentLen = int(first&0x03) + 1
+	}
+	if len(data) < exponentLen {
+		return 0, parseError("truncated REAL exponent")
+	}
+	exponent := parseBigInt(data[:exponentLen])
+	mantissa := new(big.Int).SetBytes(data[exponentLen:])
+	if !exponent.IsInt64() || exponent.Int64() > math.MaxInt32 || exponent.Int64() < math.MinInt32 {
+		return 0, parseError("REAL exponent is out of range")
+	}
+	exp := int(exponent.Int64())
+
+	switch (first >> 4) & 0x03 {
+	case 0x00:
+	case 0x01:
+		exp *= 3
+	case 0x02:
+		exp *= 4
+	default:
+		return 0, parseError("invalid REAL base")
+	}
+	exp += int((first >> 2) & 0x03)
+
+	if ctx.der.decoding {
+		if first&0x3c != 0 || (mantissa.Sign() != 0 && mantissa.Bit(0) == 0) {
+			return 0, parseError("REAL is not in the binary form with base 2 and odd mantissa required by DER")
+		}
+	}
+
+	f, _ := new(big.Float).SetMantExp(new(big.Float).SetInt(mantissa), exp).Float64()
+	if math.IsInf(f, 0) {
+		return 0, parseError("REAL value is out of range")
+	}
+	if first&0x40 != 0 {
+		f = -f
+	}
+	return f, nil
+}
+
+// parseDecimalReal parses a REAL value in the decimal form of ISO 6093, which
+// accepts a comma as the decimal mark and leading spaces.
+func parseDecimalReal(data []byte) (float64, error) {
+	form := data[0] & 0x3f
+	if form != realNR1 && form != realNR2 && form != realNR3 {
+		return 0, parseError("invalid REAL decimal form %d", form)
+	}
+	s := strings.TrimLeft(string(data[1:]), " ")
+	s = strings.Replace(s, ",", ".", 1)
+	if s == "" || strings.ContainsAny(s, "xXpPnN_iI") {
+		return 0, parseError("invalid REAL '%s'", data[1:])
+	}
+	if form == realNR1 && strings.ContainsAny(s, ".eE") ||
+		form == realNR2 && strings.ContainsAny(s, "eE") {
+		return 0, parseError("invalid REAL '%s' for NR%d", data[1:], form)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, parseError("invalid REAL '%s'", data[1:])
+	}
+	return f, nil
+}
@@ -0,0 +1,142 @@
+// Package replay decodes recorded protocol traffic for offline analysis. It
+// takes the byte streams of a capture, such as the TCP payloads of each
+// direction of a connection extracted from a pcap file, splits them into
+// messages with the framing reader of the asn1 package and decodes each
+// message, reporting the errors of each message separately.
+//
+//	r := replay.Replayer{
+//		Context: asn1.NewContext(),
+//		Framing: asn1.FramingTPKT,
+//		New:     func([]byte) interface{} { return &Message{} },
+//	}
+//	messages, err := r.DecodeAll(stream)
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pipistrellka/asn1"
+)
+
+// Message is a message read from a stream.
+type Message struct {
+	// Index is the position of the message in the stream, starting at 0.
+	Index int
+	// Offset is the position of the frame of the message in the stream,
+	// including its length prefix, if any.
+	Offset int64
+	// Data is the encoded message, without the length prefix.
+	Data []byte
+	// Value is the decoded message, as returned by New, or nil if the
+	// message could not be decoded.
+	Value interface{}
+	// Err is the error found decoding the message.
+	Err error
+}
+
+// Replayer splits streams into messages and decodes them.
+type Replayer struct {
+	// Context decodes the messages. The default Context of the asn1
+	// package is used if it's nil.
+	Context *asn1.Context
+	// Framing delimits the messages in the stream.
+	Framing asn1.Framing
+	// MaxFrameSize limits the size of the messages read from prefixed
+	// frames, as in (*asn1.FrameReader).SetMaxFrameSize.
+	MaxFrameSize int
+	// New returns a pointer to the value the message is decoded into. It
+	// receives the encoded message, so the type can be chosen by its tag.
+	// Messages are only split, and not decoded, if it's nil or returns nil.
+	New func(data []byte) interface{}
+	// Options are given to DecodeWithOptions.
+	Options string
+}
+
+// Replay reads the messages from reader and calls handler for each of them,
+// including the ones that could not be decoded. It stops at the end of the
+// stream, when the stream can't be split into messages, since the following
+// messages can't be found anymore, or when handler returns an error. That
+// error is returned and io.EOF is not.
+func (r *Replayer) Replay(reader io.Reader, handler func(Message) error) error {
+	counter := &countingReader{reader: reader}
+	frames := asn1.NewFramedReader(counter, r.Framing)
+	frames.SetMaxFrameSize(r.MaxFrameSize)
+	for i := 0; ; i++ {
+		offset := counter.count
+		data, err := frames.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("message %d at offset %d: %s", i, offset, err)
+		}
+		msg := r.decode(data)
+		msg.Index, msg.Offset = i, offset
+		if err := handler(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// DecodeAll splits a complete stream into messages and decodes them. The
+// messages read before an error that stops the replay are returned along
+// with the error.
+func (r *Replayer) DecodeAll(stream []byte) ([]Message, error) {
+	messages := []Message{}
+	err := r.Replay(bytes.NewReader(stream), func(msg Message) error {
+		messages = append(messages, msg)
+		return nil
+	})
+	return messages, err
+}
+
+// Errors returns the messages that could not be decoded.
+func Errors(messages []Message) []Message {
+	failed := []Message{}
+	for _, msg := range messages {
+		if msg.Err != nil {
+			failed = append(failed, msg)
+		}
+	}
+	return failed
+}
+
+// decode decodes a single message.
+func (r *Replayer) decode(data []byte) Message {
+	msg := Message{Data: data}
+	if r.New == nil {
+		return msg
+	}
+	obj := r.New(data)
+	if obj == nil {
+		return msg
+	}
+	decode := asn1.DecodeWithOptions
+	if r.Context != nil {
+		decode = r.Context.DecodeWithOptions
+	}
+	rest, err := decode(data, obj, r.Options)
+	if err == nil && len(rest) > 0 {
+		err = &asn1.ParseError{Msg: fmt.Sprintf("%d octets of trailing data", len(rest))}
+	}
+	if err != nil {
+		msg.Err = err
+		return msg
+	}
+	msg.Value = obj
+	return msg
+}
+
+// countingReader counts the octets read.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
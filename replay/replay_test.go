@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pipistrellka/asn1"
+)
+
+type message struct {
+	ID   int
+	Text string
+}
+
+func TestDecodeAll(t *testing.T) {
+	stream := []byte{
+		0x00, 0x08, 0x30, 0x06, 0x02, 0x01, 0x01, 0x04, 0x01, 'a',
+		// Not a message
+		0x00, 0x03, 0x02, 0x01, 0x02,
+		0x00, 0x08, 0x30, 0x06, 0x02, 0x01, 0x03, 0x04, 0x01, 'c',
+		// Truncated frame
+		0x00, 0x08, 0x30,
+	}
+	r := Replayer{
+		Context: asn1.NewContext(),
+		Framing: asn1.FramingLength16,
+		New:     func([]byte) interface{} { return &message{} },
+	}
+	messages, err := r.DecodeAll(stream)
+	if err == nil {
+		t.Error("expected an error for the truncated frame")
+	}
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, expected 3", len(messages))
+	}
+	if !reflect.DeepEqual(messages[2].Value, &message{3, "c"}) {
+		t.Errorf("got %#v", messages[2].Value)
+	}
+	if messages[2].Index != 2 || messages[2].Offset != 15 {
+		t.Errorf("got message %d at offset %d", messages[2].Index, messages[2].Offset)
+	}
+	failed := Errors(messages)
+	if len(failed) != 1 || failed[0].Index != 1 || failed[0].Value != nil {
+		t.Errorf("unexpected failed messages: %v", failed)
+	}
+	var parseError *asn1.ParseError
+	if !errors.As(failed[0].Err, &parseError) {
+		t.Errorf("expected a ParseError, got %v", failed[0].Err)
+	}
+}
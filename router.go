@@ -0,0 +1,101 @@
+package asn1
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// routeKey identifies the messages dispatched to a handler.
+type routeKey struct {
+	class uint
+	tag   uint
+}
+
+// route is a handler registered with AddHandler.
+type route struct {
+	typ     reflect.Type
+	options string
+	handler reflect.Value
+}
+
+// classOptions are the options that select each class of tags.
+var classOptions = []string{
+	ClassUniversal:       "universal,",
+	ClassApplication:     "application,",
+	ClassContextSpecific: "",
+	ClassPrivate:         "private,",
+}
+
+// AddHandler registers a handler for the messages whose outermost element has
+// the given class and tag, which are decoded and given to the handler by
+// Dispatch. The handler must be a function with the signature
+// "func(T) error", where T is the Go type of the messages, which is decoded
+// with the tag and the given options. For instance, the requests of LDAP can
+// be handled with:
+//
+//	ctx.AddHandler(asn1.ClassApplication, 0, "", func(req BindRequest) error {
+//		...
+//	})
+//	ctx.AddHandler(asn1.ClassApplication, 3, "", func(req SearchRequest) error {
+//		...
+//	})
+//
+// where the options "explicit" would be given for types enclosed in an
+// explicit tag. A class and a tag can only have one handler.
+func (ctx *Context) AddHandler(class, tag uint, options string, handler interface{}) error {
+	fn := reflect.ValueOf(handler)
+	if !fn.IsValid() {
+		return syntaxError("invalid nil handler for %s", TagString(class, tag))
+	}
+	fnType := fn.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 ||
+		fnType.NumOut() != 1 || fnType.Out(0) != errorType {
+		return syntaxError("invalid handler type '%s', expecting 'func(T) error'", fnType)
+	}
+	if class > ClassPrivate {
+		return syntaxError("invalid class %d", class)
+	}
+	key := routeKey{class, tag}
+	name := TagString(class, tag)
+	if _, ok := ctx.routes[key]; ok && !ctx.replaceInherited("handler", name) {
+		return syntaxError("handler already registered for %s", name)
+	}
+	tagOptions := fmt.Sprintf("%stag:%d", classOptions[class], tag)
+	if options != "" {
+		tagOptions += "," + options
+	}
+	opts, err := ctx.parseOptions(tagOptions)
+	if err != nil {
+		return err
+	}
+	if err := ctx.checkType(fnType.In(0), opts, make(map[reflect.Type][]*fieldOptions)); err != nil {
+		return err
+	}
+	ctx.routes[key] = route{fnType.In(0), tagOptions, fn}
+	return nil
+}
+
+// Dispatch decodes the message at the beginning of data with the Go type of
+// the handler registered for the class and tag of its outermost element, and
+// calls the handler with the decoded value. It returns the error returned by
+// the handler, if any, and the data after the message.
+func (ctx *Context) Dispatch(data []byte) (rest []byte, err error) {
+	class, tag, _, _, _, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := ctx.routes[routeKey{class, tag}]
+	if !ok {
+		return nil, parseError("no handler registered for %s", TagString(class, tag))
+	}
+	value := reflect.New(r.typ)
+	rest, err = ctx.DecodeWithOptions(data, value.Interface(), r.options)
+	if err != nil {
+		return nil, err
+	}
+	out := r.handler.Call([]reflect.Value{value.Elem()})
+	if !out[0].IsNil() {
+		return nil, out[0].Interface().(error)
+	}
+	return rest, nil
+}
@@ -0,0 +1,229 @@
+package asn1
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// RuleSet implements a set of encoding rules derived from BER, such as DER or
+// a proprietary variant. A RuleSet is registered with RegisterRules and used
+// by Transcode and by the Contexts where it's selected with SetRules, through
+// the returned Rules.
+//
+// BasicRules implements the BER and DER rule sets and can be embedded by rule
+// sets that only change some of the methods.
+type RuleSet interface {
+	// Allows reports whether the rules allow a construct of BER that DER
+	// forbids. Data whose constructs are not allowed is rejected when
+	// decoding with the rules, and the constructs are replaced by their
+	// canonical forms when encoding with them.
+	Allows(construct Construct) bool
+	// EncodeIdentifier returns the identifier octets of an element.
+	EncodeIdentifier(class, tag uint, constructed bool) ([]byte, error)
+	// EncodeLength returns the length octets of an element whose content
+	// has the given number of octets, or of the indefinite length form if
+	// length is negative.
+	EncodeLength(length int) ([]byte, error)
+	// SortSet sorts the encodings of the elements of a SET or SET OF in
+	// place. It's only called when UnsortedSet is not allowed.
+	SortSet(encodings [][]byte)
+}
+
+// BasicRules implements RuleSet for BER and DER. Identifiers and lengths are
+// encoded in the minimum number of octets and SETs are sorted by the
+// encodings of their elements, as DER requires.
+type BasicRules struct {
+	// Distinguished forbids every construct that DER does not allow.
+	Distinguished bool
+}
+
+var _ RuleSet = BasicRules{}
+
+// Allows allows every construct, unless the rules are distinguished.
+func (r BasicRules) Allows(construct Construct) bool {
+	return !r.Distinguished
+}
+
+// EncodeIdentifier encodes the identifier in the minimum number of octets.
+func (r BasicRules) EncodeIdentifier(class, tag uint, constructed bool) ([]byte, error) {
+	return encodeIdentifier(&rawValue{Class: class, Tag: tag, Constructed: constructed})
+}
+
+// EncodeLength encodes the length in the minimum number of octets.
+func (r BasicRules) EncodeLength(length int) ([]byte, error) {
+	if length < 0 {
+		return []byte{0x80}, nil
+	}
+	return encodeLength(uint(length)), nil
+}
+
+// SortSet sorts the encodings in ascending order.
+func (r BasicRules) SortSet(encodings [][]byte) {
+	sort.SliceStable(encodings, func(i, j int) bool {
+		return bytes.Compare(encodings[i], encodings[j]) < 0
+	})
+}
+
+// allConstructs lists the constructs that a RuleSet can forbid.
+var allConstructs = []Construct{
+	IndefiniteLength, NonMinimalLength, NonCanonicalBoolean,
+	NonMinimalInteger, ConstructedString, UnsortedSet, NonZeroUnusedBits,
+}
+
+// namedRules is a registered RuleSet.
+type namedRules struct {
+	name  string
+	rules RuleSet
+}
+
+var (
+	rulesMu sync.RWMutex
+	// registeredRules is indexed by Rules.
+	registeredRules = []namedRules{
+		BER: {"BER", BasicRules{}},
+		DER: {"DER", BasicRules{Distinguished: true}},
+	}
+)
+
+// RegisterRules registers a set of encoding rules and returns the value that
+// identifies it, which can be given to Transcode. The name is returned by the
+// String method of the Rules and must be unique. Rules are shared by all the
+// Contexts.
+func RegisterRules(name string, rules RuleSet) (Rules, error) {
+	if name == "" {
+		return 0, syntaxError("encoding rules name cannot be empty")
+	}
+	if rules == nil {
+		return 0, syntaxError("invalid nil encoding rules '%s'", name)
+	}
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	for _, registered := range registeredRules {
+		if registered.name == name {
+			return 0, syntaxError("encoding rules '%s' already registered", name)
+		}
+	}
+	registeredRules = append(registeredRules, namedRules{name, rules})
+	return Rules(len(registeredRules) - 1), nil
+}
+
+// SetRules selects the encoding rules used by EncodeWithOptions and
+// DecodeWithOptions, and by the functions based on them. BER and DER are the
+// same as SetDer(false, false) and SetDer(true, true).
+//
+// With rules registered by RegisterRules, values are encoded with DER and
+// then re-encoded with the RuleSet as by Transcode, so the identifiers, the
+// lengths and the order of the elements of SETs are given by the RuleSet and
+// the constructs it does not allow are replaced by their canonical forms.
+// Data is verified with the RuleSet before it's decoded, so a ParseError is
+// returned for the constructs it does not allow. EncodedLen encodes values in
+// full with these rules, while EncodeHash and the streaming readers and
+// writers keep using DER and BER.
+func (ctx *Context) SetRules(rules Rules) error {
+	named, ok := rules.lookup()
+	if !ok {
+		return syntaxError("invalid encoding rules: %s", rules)
+	}
+	switch rules {
+	case BER:
+		ctx.SetDer(false, false)
+	case DER:
+		ctx.SetDer(true, true)
+	default:
+		ctx.SetDer(true, false)
+		ctx.rules = &named
+	}
+	return nil
+}
+
+// applyRules re-encodes data with the rules selected by SetRules.
+func (ctx *Context) applyRules(data []byte) ([]byte, error) {
+	values, err := ctx.transcodeContent(data, ctx.rules.rules)
+	if err != nil {
+		return nil, err
+	}
+	encodings, err := encodeWithRules(ctx.rules.rules, values)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(encodings, nil), nil
+}
+
+// decodeWithRules verifies the element at the beginning of data with the
+// rules selected by SetRules and decodes it.
+func (ctx *Context) decodeWithRules(data []byte, obj interface{}, options string) ([]byte, error) {
+	if len(data) > 0 {
+		rest, err := SkipValue(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.verifyRules(data[:len(data)-len(rest)], *ctx.rules); err != nil {
+			return nil, err
+		}
+	}
+	rulesCtx := *ctx
+	rulesCtx.rules = nil
+	return rulesCtx.DecodeWithOptions(data, obj, options)
+}
+
+// lookup returns the registered rule set of r.
+func (r Rules) lookup() (namedRules, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	if r < 0 || int(r) >= len(registeredRules) {
+		return namedRules{}, false
+	}
+	return registeredRules[r], true
+}
+
+// verifyRules returns an error if data holds a construct that rules do not
+// allow.
+func (ctx *Context) verifyRules(data []byte, rules namedRules) error {
+	strict := false
+	for _, construct := range allConstructs {
+		if !rules.rules.Allows(construct) {
+			strict = true
+		}
+	}
+	if !strict {
+		return nil
+	}
+	report := &Report{Tags: make(map[string]int)}
+	a := analyzer{ctx: ctx, report: report}
+	if err := a.analyzeContent(data, 0, 1, false); err != nil {
+		return err
+	}
+	for i, construct := range a.constructs {
+		if !rules.rules.Allows(construct) {
+			return parseError("%s is not allowed by %s", report.Violations[i], rules.name)
+		}
+	}
+	return nil
+}
+
+// encodeWithRules encodes each value with the given rules.
+func encodeWithRules(rules RuleSet, values []*rawValue) ([][]byte, error) {
+	encodings := make([][]byte, len(values))
+	for i, raw := range values {
+		buf, err := rules.EncodeIdentifier(raw.Class, raw.Tag, raw.Constructed)
+		if err != nil {
+			return nil, err
+		}
+		length := len(raw.Content)
+		if raw.Indefinite {
+			length = -1
+		}
+		lengthOctets, err := rules.EncodeLength(length)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, lengthOctets...)
+		buf = append(buf, raw.Content...)
+		if raw.Indefinite {
+			buf = append(buf, 0x00, 0x00)
+		}
+		encodings[i] = buf
+	}
+	return encodings, nil
+}
@@ -1,6 +1,30 @@
 package asn1
 
-import "sort"
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// SetOf is implemented by slice and array types that are encoded as a SET OF
+// instead of a SEQUENCE OF wherever they are used, including as the elements
+// of other slices, where the option "set" can't be given:
+//
+//	type RelativeDistinguishedName []AttributeTypeAndValue
+//
+//	func (RelativeDistinguishedName) SetOf() {}
+type SetOf interface {
+	SetOf()
+}
+
+var setOfType = reflect.TypeOf((*SetOf)(nil)).Elem()
+
+// isSetOfMarked checks if t is a slice or array type that implements SetOf.
+func isSetOfMarked(t reflect.Type) bool {
+	kind := t.Kind()
+	return (kind == reflect.Slice || kind == reflect.Array) &&
+		t.Elem().Kind() != reflect.Uint8 && t.Implements(setOfType)
+}
 
 // isTagLessThan compares two tags (class + tag number)
 // TODO: maybe a common Tag type can simplify that.
@@ -32,3 +56,21 @@ func (s expectedFieldElementSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 func (s expectedFieldElementSlice) Less(i, j int) bool {
 	return isTagLessThan(s[i].class, s[i].tag, s[j].class, s[j].tag)
 }
+
+// sortSetOfContent sorts the encoded elements of a SET OF in the ascending
+// order of their encodings, as DER requires.
+func sortSetOfContent(content []byte) ([]byte, error) {
+	encodings := [][]byte{}
+	for rest := content; len(rest) > 0; {
+		next, err := SkipValue(rest)
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, rest[:len(rest)-len(next)])
+		rest = next
+	}
+	sort.SliceStable(encodings, func(i, j int) bool {
+		return bytes.Compare(encodings[i], encodings[j]) < 0
+	})
+	return bytes.Join(encodings, nil), nil
+}
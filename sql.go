@@ -0,0 +1,107 @@
+package asn1
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"strings"
+)
+
+// Value implements the driver.Valuer interface. An Oid is stored as a string
+// in the dotted form without the leading dot. A nil Oid is stored as NULL.
+func (oid Oid) Value() (driver.Value, error) {
+	if oid == nil {
+		return nil, nil
+	}
+	return strings.TrimPrefix(oid.String(), "."), nil
+}
+
+// Scan implements the sql.Scanner interface. It accepts a string or a []byte
+// in the dotted form.
+func (oid *Oid) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case nil:
+		*oid = nil
+		return nil
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return syntaxError("cannot scan '%T' into an Oid", src)
+	}
+	parsed, err := ParseOid(s)
+	if err != nil {
+		return err
+	}
+	*oid = parsed
+	return nil
+}
+
+// Value implements the driver.Valuer interface. A BitString is stored as a
+// string with its bit pattern, such as "101", which is the format used by SQL
+// BIT VARYING columns.
+func (b BitString) Value() (driver.Value, error) {
+	return b.bitPattern(), nil
+}
+
+// Scan implements the sql.Scanner interface. It accepts a string or a []byte
+// with a bit pattern, such as "101", or with the ASN.1 bstring and hstring
+// notations, such as "'101'B" and "'A0'H".
+func (b *BitString) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case nil:
+		*b = BitString{}
+		return nil
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return syntaxError("cannot scan '%T' into a BitString", src)
+	}
+	parsed, err := parseBitString(s)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// bitPattern returns the bits of b as a string of zeros and ones.
+func (b BitString) bitPattern() string {
+	var s strings.Builder
+	for i := 0; i < b.BitLength; i++ {
+		s.WriteByte(byte('0' + b.At(i)))
+	}
+	return s.String()
+}
+
+// parseBitString parses a bit pattern, a bstring ('101'B) or a hstring
+// ('A0'H).
+func parseBitString(s string) (BitString, error) {
+	if len(s) >= 3 && s[0] == '\'' && s[len(s)-2] == '\'' {
+		switch s[len(s)-1] {
+		case 'B', 'b':
+			s = s[1 : len(s)-2]
+		case 'H', 'h':
+			bytes, err := hex.DecodeString(s[1 : len(s)-2])
+			if err != nil {
+				return BitString{}, parseError("invalid hstring '%s'", s)
+			}
+			return BitString{bytes, len(bytes) * 8}, nil
+		}
+	}
+	b := BitString{Bytes: make([]byte, (len(s)+7)/8), BitLength: len(s)}
+	for i, c := range s {
+		switch c {
+		case '0':
+		case '1':
+			b.Bytes[i/8] |= 0x80 >> uint(i%8)
+		default:
+			return BitString{}, parseError("invalid bit string '%s'", s)
+		}
+	}
+	return b, nil
+}
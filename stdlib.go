@@ -0,0 +1,123 @@
+package asn1
+
+import (
+	"bytes"
+	stdasn1 "encoding/asn1"
+	"reflect"
+)
+
+// Types from the standard library encoding/asn1 package. They are accepted by
+// the encoder and decoder, so code can be migrated from the standard library
+// one struct at a time.
+var (
+	stdRawValueType  = reflect.TypeOf(stdasn1.RawValue{})
+	stdOidType       = reflect.TypeOf(stdasn1.ObjectIdentifier{})
+	stdBitStringType = reflect.TypeOf(stdasn1.BitString{})
+	stdEnumType      = reflect.TypeOf(stdasn1.Enumerated(0))
+)
+
+// encodeStdRawValue returns the raw value of an encoding/asn1.RawValue. As in
+// the standard library, FullBytes is used verbatim when it's set.
+func (ctx *Context) encodeStdRawValue(value reflect.Value) (*rawValue, error) {
+	rv, ok := value.Interface().(stdasn1.RawValue)
+	if !ok {
+		return nil, wrongType(stdRawValueType.String(), value)
+	}
+	if len(rv.FullBytes) > 0 {
+		reader := bytes.NewBuffer(rv.FullBytes)
+		raw, err := decodeRawValue(reader)
+		if err != nil {
+			return nil, err
+		}
+		if reader.Len() > 0 {
+			return nil, syntaxError("trailing data in RawValue.FullBytes")
+		}
+		raw.encoded = rv.FullBytes
+		return raw, nil
+	}
+	if rv.Class < ClassUniversal || rv.Class > ClassPrivate || rv.Tag < 0 {
+		return nil, syntaxError("invalid RawValue class or tag (%d,%d)", rv.Class, rv.Tag)
+	}
+	raw := &rawValue{
+		Class:       uint(rv.Class),
+		Tag:         uint(rv.Tag),
+		Constructed: rv.IsCompound,
+		Content:     rv.Bytes,
+	}
+	return raw, nil
+}
+
+// decodeStdRawValue decodes any element into an encoding/asn1.RawValue. It
+// receives the complete encoding of the element.
+func (ctx *Context) decodeStdRawValue(data []byte, value reflect.Value) error {
+	raw, err := decodeRawValue(bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	fullBytes := append([]byte{}, data...)
+	rv := stdasn1.RawValue{
+		Class:      int(raw.Class),
+		Tag:        int(raw.Tag),
+		IsCompound: raw.Constructed,
+		Bytes:      fullBytes[len(fullBytes)-len(raw.Content):],
+		FullBytes:  fullBytes,
+	}
+	if raw.Indefinite {
+		// Skip the end of contents octets
+		rv.Bytes = fullBytes[len(fullBytes)-len(raw.Content)-2 : len(fullBytes)-2]
+	}
+	value.Set(reflect.ValueOf(rv))
+	return nil
+}
+
+// encodeStdOid encodes an encoding/asn1.ObjectIdentifier.
+func (ctx *Context) encodeStdOid(value reflect.Value) ([]byte, error) {
+	stdOid, ok := value.Interface().(stdasn1.ObjectIdentifier)
+	if !ok {
+		return nil, wrongType(stdOidType.String(), value)
+	}
+	oid := make(Oid, len(stdOid))
+	for i, n := range stdOid {
+		if n < 0 {
+			return nil, syntaxError("invalid negative arc in OBJECT IDENTIFIER")
+		}
+		oid[i] = uint(n)
+	}
+	return ctx.encodeOid(reflect.ValueOf(oid))
+}
+
+// decodeStdOid decodes an encoding/asn1.ObjectIdentifier.
+func (ctx *Context) decodeStdOid(data []byte, value reflect.Value) error {
+	var oid Oid
+	if err := ctx.decodeOid(data, reflect.ValueOf(&oid).Elem()); err != nil {
+		return err
+	}
+	stdOid := make(stdasn1.ObjectIdentifier, len(oid))
+	for i, n := range oid {
+		if int(n) < 0 {
+			return parseError("OBJECT IDENTIFIER arc too large for Go type '%s'", value.Type())
+		}
+		stdOid[i] = int(n)
+	}
+	value.Set(reflect.ValueOf(stdOid))
+	return nil
+}
+
+// encodeStdBitString encodes an encoding/asn1.BitString.
+func (ctx *Context) encodeStdBitString(value reflect.Value) ([]byte, error) {
+	bitString, ok := value.Interface().(stdasn1.BitString)
+	if !ok {
+		return nil, wrongType(stdBitStringType.String(), value)
+	}
+	return ctx.encodeBitString(reflect.ValueOf(BitString(bitString)))
+}
+
+// decodeStdBitString decodes an encoding/asn1.BitString.
+func (ctx *Context) decodeStdBitString(data []byte, value reflect.Value) error {
+	var bitString BitString
+	if err := ctx.decodeBitString(data, reflect.ValueOf(&bitString).Elem()); err != nil {
+		return err
+	}
+	value.Set(reflect.ValueOf(stdasn1.BitString(bitString)))
+	return nil
+}
@@ -0,0 +1,75 @@
+package asn1
+
+import (
+	"unicode/utf8"
+)
+
+// characterStringTags are the universal types of character strings.
+var characterStringTags = map[uint]bool{
+	TagUtf8String:      true,
+	TagNumericString:   true,
+	TagPrintableString: true,
+	TagT61String:       true,
+	TagVideotexString:  true,
+	TagIA5String:       true,
+	TagGraphicString:   true,
+	TagVisibleString:   true,
+	TagGeneralString:   true,
+	TagUniversalString: true,
+	TagBmpString:       true,
+}
+
+// SetMaxStringLength limits the number of characters of the character
+// strings of a universal type, such as TagIA5String, for every field of every
+// message encoded or decoded with the Context. It enforces the limits of a
+// specification uniformly, in addition to the constraints of each field.
+// Longer strings cause a SyntaxError when encoding and a ParseError when
+// decoding. Zero removes the limit of the type.
+//
+// Characters are counted as code points in UTF8String and as units of 2 and
+// 4 octets in BMPString and UniversalString. The other types are counted in
+// octets.
+func (ctx *Context) SetMaxStringLength(tag uint, max int) error {
+	if !characterStringTags[tag] {
+		return syntaxError("%s is not a character string type", TagString(ClassUniversal, tag))
+	}
+	if max < 0 {
+		return syntaxError("invalid maximum length %d for %s", max, TagString(ClassUniversal, tag))
+	}
+	if max == 0 {
+		delete(ctx.maxStringLengths, tag)
+		return nil
+	}
+	if ctx.maxStringLengths == nil {
+		ctx.maxStringLengths = make(map[uint]int)
+	}
+	ctx.maxStringLengths[tag] = max
+	return nil
+}
+
+// checkStringLength returns the number of characters of raw and the maximum
+// of its type if raw is a character string longer than the maximum, or zeros
+// otherwise.
+func (ctx *Context) checkStringLength(raw *rawValue) (length int, max int) {
+	if raw.Class != ClassUniversal || len(ctx.maxStringLengths) == 0 {
+		return 0, 0
+	}
+	max, ok := ctx.maxStringLengths[raw.Tag]
+	if !ok {
+		return 0, 0
+	}
+	switch raw.Tag {
+	case TagUtf8String:
+		length = utf8.RuneCount(raw.Content)
+	case TagBmpString:
+		length = len(raw.Content) / 2
+	case TagUniversalString:
+		length = len(raw.Content) / 4
+	default:
+		length = len(raw.Content)
+	}
+	if length <= max {
+		return 0, 0
+	}
+	return length, max
+}
@@ -0,0 +1,512 @@
+// Package structgen infers Go types for the asn1 package from example
+// encodings of a message, which helps to write the types of undocumented
+// formats. For instance:
+//
+//	src, err := structgen.Generate("vendor", "Record", sample1, sample2)
+//
+// returns the source of a Go file declaring the struct Record and the types of
+// its nested elements. The more samples are given, the better the guesses:
+//
+//   - Elements missing from some samples are marked with "optional".
+//   - Constructed elements whose children have the same tag are slices, when
+//     their number of children varies or is greater than two, and structs
+//     otherwise.
+//   - Tagged constructed elements with a single child are explicit tags.
+//   - Consecutive optional elements of different types that are never found
+//     together are alternatives of a CHOICE, which is registered by a
+//     generated function.
+//
+// Implicitly tagged primitive elements are decoded as []byte, since their
+// types can't be known, and elements with no better type are decoded as
+// encoding/asn1.RawValue. The generated types are a starting point that
+// should be reviewed.
+package structgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/pipistrellka/asn1"
+)
+
+// node is a parsed element.
+type node struct {
+	key      nodeKey
+	content  []byte
+	children []*node
+}
+
+// nodeKey identifies the elements with the same tag and form.
+type nodeKey struct {
+	class       uint
+	tag         uint
+	constructed bool
+}
+
+// String returns the tag of the key as in specifications.
+func (k nodeKey) String() string {
+	return asn1.TagString(k.class, k.tag)
+}
+
+// goType is the Go type inferred for an element and the options of the
+// fields of that type.
+type goType struct {
+	expr string
+	opts []string
+}
+
+// hasTag checks if the options of a type give a tag.
+func (t goType) hasTag() bool {
+	for _, opt := range t.opts {
+		if strings.HasPrefix(opt, "tag:") {
+			return true
+		}
+	}
+	return false
+}
+
+// generator keeps the declarations generated.
+type generator struct {
+	decls   []string
+	names   map[string]bool
+	imports map[string]bool
+	choices []string
+}
+
+// Generate returns the source of a Go file of the given package declaring a
+// type with the given name, inferred from samples, which are encodings of
+// the same message. The types of nested structs are named after the type and
+// the fields that contain them.
+func Generate(pkg string, name string, samples ...[]byte) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("structgen: no samples")
+	}
+	roots := make([]*node, len(samples))
+	for i, sample := range samples {
+		root, size, err := parseNode(sample)
+		if err != nil {
+			return nil, fmt.Errorf("structgen: sample %d: %s", i, err)
+		}
+		if size != len(sample) {
+			return nil, fmt.Errorf("structgen: sample %d: trailing data", i)
+		}
+		if i > 0 && root.key != roots[0].key {
+			return nil, fmt.Errorf("structgen: sample %d is a %s instead of %s",
+				i, root.key, roots[0].key)
+		}
+		roots[i] = root
+	}
+
+	g := &generator{names: map[string]bool{}, imports: map[string]bool{}}
+	root := g.infer(name, roots)
+	if root.expr != name {
+		g.decls = append([]string{fmt.Sprintf("type %s %s", name, root.expr)}, g.decls...)
+	}
+	if len(root.opts) > 0 {
+		g.decls[0] = fmt.Sprintf("// %s is decoded with the options %q.\n%s",
+			name, strings.Join(root.opts, ","), g.decls[0])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Generated by structgen from %d samples. The types and options are\n", len(samples))
+	fmt.Fprintf(&buf, "// guesses and should be reviewed.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if len(g.choices) > 0 {
+		g.imports["reflect"] = true
+		g.imports["github.com/pipistrellka/asn1"] = true
+	}
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			imports = append(imports, path)
+		}
+		// The standard library first, then the asn1 package
+		sort.Slice(imports, func(i, j int) bool {
+			iStd, jStd := !strings.Contains(imports[i], "."), !strings.Contains(imports[j], ".")
+			if iStd != jStd {
+				return iStd
+			}
+			return imports[i] < imports[j]
+		})
+		buf.WriteString("import (\n")
+		for i, path := range imports {
+			if i > 0 && strings.Contains(path, ".") && !strings.Contains(imports[i-1], ".") {
+				buf.WriteString("\n")
+			}
+			if path == "encoding/asn1" {
+				buf.WriteString("stdasn1 ")
+			}
+			fmt.Fprintf(&buf, "%q\n", path)
+		}
+		buf.WriteString(")\n\n")
+	}
+	for _, decl := range g.decls {
+		buf.WriteString(decl)
+		buf.WriteString("\n\n")
+	}
+	if len(g.choices) > 0 {
+		fmt.Fprintf(&buf, "// Register%sChoices registers the CHOICEs used by %s.\n", name, name)
+		fmt.Fprintf(&buf, "func Register%sChoices(ctx *asn1.Context) error {\n", name)
+		for _, choice := range g.choices {
+			buf.WriteString(choice)
+		}
+		buf.WriteString("return nil\n}\n")
+	}
+	return format.Source(buf.Bytes())
+}
+
+// parseNode parses an element and its children. It returns the number of
+// octets of the element.
+func parseNode(data []byte) (*node, int, error) {
+	class, tag, constructed, length, header, err := asn1.ParseHeader(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	n := &node{key: nodeKey{class, tag, constructed}}
+	if length >= 0 {
+		if len(data)-header < length {
+			return nil, 0, fmt.Errorf("truncated %s", n.key)
+		}
+		n.content = data[header : header+length]
+		if constructed {
+			for rest := n.content; len(rest) > 0; {
+				child, size, err := parseNode(rest)
+				if err != nil {
+					return nil, 0, err
+				}
+				n.children = append(n.children, child)
+				rest = rest[size:]
+			}
+		}
+		return n, header + length, nil
+	}
+
+	// Indefinite length
+	pos := header
+	for {
+		if len(data)-pos >= 2 && data[pos] == 0 && data[pos+1] == 0 {
+			n.content = data[header:pos]
+			return n, pos + 2, nil
+		}
+		child, size, err := parseNode(data[pos:])
+		if err != nil {
+			return nil, 0, err
+		}
+		n.children = append(n.children, child)
+		pos += size
+	}
+}
+
+// universalTypes are the Go types of the primitive universal types.
+var universalTypes = map[uint]goType{
+	asn1.TagBoolean:         {expr: "bool"},
+	asn1.TagInteger:         {expr: "int64"},
+	asn1.TagBitString:       {expr: "asn1.BitString"},
+	asn1.TagOctetString:     {expr: "[]byte"},
+	asn1.TagNull:            {expr: "asn1.Null"},
+	asn1.TagOid:             {expr: "asn1.Oid"},
+	asn1.TagEnum:            {expr: "asn1.Enum"},
+	asn1.TagUtcTime:         {expr: "asn1.UTCTime"},
+	asn1.TagGeneralizedTime: {expr: "asn1.GeneralizedTime"},
+}
+
+// stringTags are the universal character string types, which are decoded
+// as strings.
+var stringTags = map[uint]bool{
+	asn1.TagUtf8String:      true,
+	asn1.TagNumericString:   true,
+	asn1.TagPrintableString: true,
+	asn1.TagT61String:       true,
+	asn1.TagIA5String:       true,
+	asn1.TagGraphicString:   true,
+	asn1.TagVisibleString:   true,
+	asn1.TagGeneralString:   true,
+}
+
+// infer returns the type of the given elements, which have the same key.
+func (g *generator) infer(name string, nodes []*node) goType {
+	key := nodes[0].key
+	if key.class == asn1.ClassUniversal {
+		if key.constructed && (key.tag == asn1.TagSequence || key.tag == asn1.TagSet) {
+			t := g.inferConstructed(name, nodes)
+			if key.tag == asn1.TagSet {
+				t.opts = append(t.opts, "set")
+			}
+			return t
+		}
+		if key.constructed {
+			return g.rawValue()
+		}
+		if stringTags[key.tag] {
+			return goType{"string", []string{"universal", fmt.Sprintf("tag:%d", key.tag)}}
+		}
+		t, ok := universalTypes[key.tag]
+		if !ok {
+			return g.rawValue()
+		}
+		if key.tag == asn1.TagInteger {
+			for _, n := range nodes {
+				if len(n.content) > 8 {
+					g.imports["math/big"] = true
+					return goType{expr: "*big.Int"}
+				}
+			}
+		}
+		if strings.HasPrefix(t.expr, "asn1.") {
+			g.imports["github.com/pipistrellka/asn1"] = true
+		}
+		return t
+	}
+
+	opts := tagOptions(key)
+	if !key.constructed {
+		return goType{"[]byte", opts}
+	}
+
+	// A single child is enclosed in an explicit tag
+	explicit := true
+	children := []*node{}
+	for _, n := range nodes {
+		if len(n.children) != 1 || n.children[0].key != nodes[0].children[0].key {
+			explicit = false
+			break
+		}
+		children = append(children, n.children[0])
+	}
+	if explicit {
+		inner := g.infer(name, children)
+		if !inner.hasTag() {
+			inner.opts = append(opts, append([]string{"explicit"}, inner.opts...)...)
+			return inner
+		}
+		if key.class == asn1.ClassContextSpecific {
+			inner.opts = append(inner.opts, fmt.Sprintf("tag2:%d", key.tag), "explicit2")
+			return inner
+		}
+		t := g.rawValue()
+		t.opts = append(opts, "explicit")
+		return t
+	}
+	t := g.inferConstructed(name, nodes)
+	t.opts = append(opts, t.opts...)
+	return t
+}
+
+// tagOptions returns the options of the tag of a key that is not universal.
+func tagOptions(key nodeKey) []string {
+	opts := []string{}
+	switch key.class {
+	case asn1.ClassApplication:
+		opts = append(opts, "application")
+	case asn1.ClassPrivate:
+		opts = append(opts, "private")
+	}
+	return append(opts, fmt.Sprintf("tag:%d", key.tag))
+}
+
+// rawValue returns the type used for elements with no better type.
+func (g *generator) rawValue() goType {
+	g.imports["encoding/asn1"] = true
+	return goType{expr: "stdasn1.RawValue"}
+}
+
+// inferConstructed returns a slice or a struct type for constructed elements.
+func (g *generator) inferConstructed(name string, nodes []*node) goType {
+	if isList(nodes) {
+		children := []*node{}
+		for _, n := range nodes {
+			children = append(children, n.children...)
+		}
+		elem := g.infer(name+"Item", children)
+		if len(elem.opts) > 0 {
+			// The elements of slices have no options
+			elem = g.rawValue()
+		}
+		return goType{expr: "[]" + elem.expr}
+	}
+	return goType{expr: g.declareStruct(name, nodes)}
+}
+
+// isList checks if the children of the elements are items of a list, which
+// is assumed when they have the same tag and their number varies or is
+// greater than two.
+func isList(nodes []*node) bool {
+	var key *nodeKey
+	counts := map[int]bool{}
+	for _, n := range nodes {
+		counts[len(n.children)] = true
+		for _, child := range n.children {
+			if key == nil {
+				key = &child.key
+			} else if *key != child.key {
+				return false
+			}
+		}
+	}
+	if key == nil {
+		return false
+	}
+	for count := range counts {
+		if count > 2 {
+			return true
+		}
+	}
+	return len(counts) > 1
+}
+
+// field is a field of a struct with the elements found for it.
+type field struct {
+	key   nodeKey
+	nodes []*node
+	// present tells which parent elements contain the field.
+	present map[int]bool
+}
+
+// alignFields matches the children of the given elements to the fields of a
+// struct, keeping the order they appear in.
+func alignFields(nodes []*node) []*field {
+	fields := []*field{}
+	for i, n := range nodes {
+		next := 0
+		for _, child := range n.children {
+			j := next
+			for j < len(fields) && (fields[j].key != child.key || fields[j].present[i]) {
+				j++
+			}
+			if j == len(fields) {
+				j = next
+				f := &field{key: child.key, present: map[int]bool{}}
+				fields = append(fields[:j], append([]*field{f}, fields[j:]...)...)
+			}
+			fields[j].nodes = append(fields[j].nodes, child)
+			fields[j].present[i] = true
+			next = j + 1
+		}
+	}
+	return fields
+}
+
+// declareStruct declares a struct for the given elements and returns its
+// name.
+func (g *generator) declareStruct(name string, nodes []*node) string {
+	for g.names[name] {
+		name += "_"
+	}
+	g.names[name] = true
+	fields := alignFields(nodes)
+
+	// The struct is declared before the types of its fields
+	index := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s struct {\n", name)
+	for i := 0; i < len(fields); {
+		fieldName := fmt.Sprintf("Field%d", i+1)
+		group := choiceGroup(fields[i:], len(nodes))
+		if len(group) > 1 {
+			if alternatives, ok := g.inferChoice(name+fieldName, group); ok {
+				choice := name + "." + fieldName
+				opts := []string{"choice:" + choice}
+				present := 0
+				tags := []string{}
+				for _, f := range group {
+					present += len(f.present)
+					tags = append(tags, f.key.String())
+				}
+				if present < len(nodes) {
+					opts = append(opts, "optional")
+				}
+				fmt.Fprintf(&buf, "// CHOICE of %s\n", strings.Join(tags, ", "))
+				fmt.Fprintf(&buf, "%s interface{} `asn1:%q`\n", fieldName, strings.Join(opts, ","))
+				g.addChoice(choice, alternatives)
+				i += len(group)
+				continue
+			}
+		}
+
+		f := fields[i]
+		t := g.infer(name+fieldName, f.nodes)
+		opts := t.opts
+		if len(f.present) < len(nodes) {
+			opts = append(opts, "optional")
+		}
+		fmt.Fprintf(&buf, "// %s found in %d of %d samples\n", f.key, len(f.present), len(nodes))
+		if len(opts) > 0 {
+			fmt.Fprintf(&buf, "%s %s `asn1:%q`\n", fieldName, t.expr, strings.Join(opts, ","))
+		} else {
+			fmt.Fprintf(&buf, "%s %s\n", fieldName, t.expr)
+		}
+		i++
+	}
+	buf.WriteString("}")
+	g.decls[index] = buf.String()
+	return name
+}
+
+// choiceGroup returns the longest run of optional fields at the beginning of
+// fields that are never found together.
+func choiceGroup(fields []*field, parents int) []*field {
+	seen := map[int]bool{}
+	group := []*field{}
+	for _, f := range fields {
+		if len(f.present) == parents {
+			break
+		}
+		for i := range f.present {
+			if seen[i] {
+				return group
+			}
+		}
+		for i := range f.present {
+			seen[i] = true
+		}
+		group = append(group, f)
+	}
+	return group
+}
+
+// inferChoice returns the types of the alternatives of a CHOICE, which must
+// be different.
+func (g *generator) inferChoice(name string, group []*field) ([]goType, bool) {
+	// Types are inferred in a new generator, so nothing is declared if the
+	// group is not a CHOICE
+	trial := &generator{names: map[string]bool{}, imports: map[string]bool{}}
+	for n := range g.names {
+		trial.names[n] = true
+	}
+	alternatives := []goType{}
+	seen := map[string]bool{}
+	for i, f := range group {
+		t := trial.infer(fmt.Sprintf("%sAlt%d", name, i+1), f.nodes)
+		if seen[t.expr] {
+			return nil, false
+		}
+		seen[t.expr] = true
+		alternatives = append(alternatives, t)
+	}
+	for n := range trial.names {
+		g.names[n] = true
+	}
+	for path := range trial.imports {
+		g.imports[path] = true
+	}
+	g.decls = append(g.decls, trial.decls...)
+	g.choices = append(g.choices, trial.choices...)
+	return alternatives, true
+}
+
+// addChoice adds the registration of a CHOICE.
+func (g *generator) addChoice(choice string, alternatives []goType) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "if err := ctx.AddChoice(%q, []asn1.Choice{\n", choice)
+	for _, t := range alternatives {
+		fmt.Fprintf(&buf, "{Type: reflect.TypeOf((*%s)(nil)).Elem(), Options: %q},\n",
+			t.expr, strings.Join(t.opts, ","))
+	}
+	buf.WriteString("}); err != nil {\nreturn err\n}\n")
+	g.choices = append(g.choices, buf.String())
+}
@@ -0,0 +1,71 @@
+package structgen
+
+import (
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	samples := [][]byte{
+		{
+			0x30, 0x19,
+			0x02, 0x01, 0x01,
+			0x0c, 0x01, 'a',
+			0xa0, 0x03, 0x02, 0x01, 0x05,
+			0x30, 0x09, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02, 0x02, 0x01, 0x03,
+			0x81, 0x01, 0xff,
+		},
+		{
+			0x30, 0x10,
+			0x02, 0x01, 0x02,
+			0x0c, 0x01, 'b',
+			0x30, 0x03, 0x02, 0x01, 0x01,
+			0xa2, 0x03, 0x01, 0x01, 0xff,
+		},
+	}
+	src, err := Generate("vendor", "Record", samples...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `// Generated by structgen from 2 samples. The types and options are
+// guesses and should be reviewed.
+
+package vendor
+
+import (
+	"reflect"
+
+	"github.com/pipistrellka/asn1"
+)
+
+type Record struct {
+	// INTEGER found in 2 of 2 samples
+	Field1 int64
+	// UTF8String found in 2 of 2 samples
+	Field2 string ` + "`asn1:\"universal,tag:12\"`" + `
+	// [0] found in 1 of 2 samples
+	Field3 int64 ` + "`asn1:\"tag:0,explicit,optional\"`" + `
+	// SEQUENCE found in 2 of 2 samples
+	Field4 []int64
+	// CHOICE of [2], [1]
+	Field5 interface{} ` + "`asn1:\"choice:Record.Field5\"`" + `
+}
+
+// RegisterRecordChoices registers the CHOICEs used by Record.
+func RegisterRecordChoices(ctx *asn1.Context) error {
+	if err := ctx.AddChoice("Record.Field5", []asn1.Choice{
+		{Type: reflect.TypeOf((*bool)(nil)).Elem(), Options: "tag:2,explicit"},
+		{Type: reflect.TypeOf((*[]byte)(nil)).Elem(), Options: "tag:1"},
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+`
+	if string(src) != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", src, expected)
+	}
+
+	if _, err := Generate("vendor", "Record", samples[0], []byte{0x02, 0x01, 0x00}); err == nil {
+		t.Error("expected an error for samples of different types")
+	}
+}
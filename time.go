@@ -0,0 +1,178 @@
+package asn1
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var generalizedTimeType = reflect.TypeOf(GeneralizedTime{})
+
+// GeneralizedTime ::= [UNIVERSAL 24] "YYYYMMDDhh[mm[ss[.fff]]]" followed by
+// "Z", "(+|-)hhmm" or nothing for local times.
+//
+// Values are encoded in UTC with seconds and without trailing zeros in the
+// fraction of seconds, as required by DER. Local times, without a time zone,
+// are decoded as UTC in BER and rejected in DER.
+type GeneralizedTime struct {
+	time.Time
+}
+
+// generalizedTimeLayouts are the layouts accepted when decoding in BER. A
+// fraction of seconds is accepted by time.Parse after the seconds.
+var generalizedTimeLayouts = []string{
+	"20060102150405Z0700",
+	"200601021504Z0700",
+	"2006010215Z0700",
+	"20060102150405",
+	"200601021504",
+	"2006010215",
+}
+
+// derGeneralizedTimeLayout is the only layout accepted when decoding in DER.
+const derGeneralizedTimeLayout = "20060102150405.999999999Z0700"
+
+func (ctx *Context) encodeGeneralizedTime(value reflect.Value) ([]byte, error) {
+	generalizedTime, ok := value.Interface().(GeneralizedTime)
+	if !ok {
+		return nil, wrongType(generalizedTimeType.String(), value)
+	}
+	return []byte(generalizedTime.UTC().Format(derGeneralizedTimeLayout)), nil
+}
+
+func (ctx *Context) decodeGeneralizedTime(data []byte, value reflect.Value) error {
+	t, err := ctx.parseGeneralizedTime(string(data))
+	if err != nil {
+		return err
+	}
+	value.Set(reflect.ValueOf(GeneralizedTime{t}))
+	return nil
+}
+
+// parseGeneralizedTime parses the content of a GeneralizedTime.
+func (ctx *Context) parseGeneralizedTime(s string) (time.Time, error) {
+	if ctx.der.decoding {
+		t, err := time.Parse(derGeneralizedTimeLayout, s)
+		if err != nil || !strings.HasSuffix(s, "Z") || t.Format(derGeneralizedTimeLayout) != s {
+			return time.Time{}, parseError("invalid GeneralizedTime in DER: %q", s)
+		}
+		return t, nil
+	}
+	for _, layout := range generalizedTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, parseError("invalid GeneralizedTime: %q", s)
+}
+
+var timeType = reflect.TypeOf(Time{})
+
+// Time ::= CHOICE { utcTime UTCTime, generalTime GeneralizedTime }
+//
+// Time is the time type used by X.509 certificates and CRLs (RFC 5280). As
+// required by DER, dates from 1950 through 2049 are encoded as UTCTime and
+// others as GeneralizedTime, both in UTC. Either type is accepted when
+// decoding.
+//
+// Since Time is an untagged CHOICE, a tag given in the options of a Time must
+// be explicit.
+//
+// Values of time.Time are encoded and decoded as Time too, and pointers to
+// them can be used for optional fields. The option "timelayout" encodes them
+// as strings in a layout of the time package instead, as a GeneralizedTime by
+// default, for timestamps of vendor formats (ie:
+// "timelayout:2006-01-02T15:04:05,universal,tag:4" for an OCTET STRING).
+type Time struct {
+	time.Time
+}
+
+// getTimeEncoder returns the tag and the encoder of a Time or time.Time.
+func (ctx *Context) getTimeEncoder(value reflect.Value) (uint, encoderFunction) {
+	var t Time
+	switch v := value.Interface().(type) {
+	case Time:
+		t = v
+	case time.Time:
+		t = Time{v}
+	default:
+		return TagUtcTime, func(value reflect.Value) ([]byte, error) {
+			return nil, wrongType(timeType.String(), value)
+		}
+	}
+	if year := t.UTC().Year(); year < 1950 || year >= 2050 {
+		return TagGeneralizedTime, func(reflect.Value) ([]byte, error) {
+			return ctx.encodeGeneralizedTime(reflect.ValueOf(GeneralizedTime{t.Time}))
+		}
+	}
+	return TagUtcTime, func(reflect.Value) ([]byte, error) {
+		return ctx.encodeUTCTime(reflect.ValueOf(UTCTime{t.UTC()}))
+	}
+}
+
+// decodeTime decodes a Time or time.Time from its complete encoding.
+func (ctx *Context) decodeTime(data []byte, value reflect.Value) error {
+	raw, err := decodeRawValue(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	var t time.Time
+	switch {
+	case raw.Class == ClassUniversal && raw.Tag == TagUtcTime:
+		t, err = parseUTCTime(raw.Content)
+	case raw.Class == ClassUniversal && raw.Tag == TagGeneralizedTime:
+		t, err = ctx.parseGeneralizedTime(string(raw.Content))
+	default:
+		err = parseError("expected UTCTime or GeneralizedTime but found %s",
+			TagString(raw.Class, raw.Tag))
+	}
+	if err != nil {
+		return err
+	}
+	setTime(value, t)
+	return nil
+}
+
+// setTime sets a Time or time.Time value.
+func setTime(value reflect.Value, t time.Time) {
+	if value.Type() == goTimeType {
+		value.Set(reflect.ValueOf(t))
+		return
+	}
+	value.Set(reflect.ValueOf(Time{t}))
+}
+
+var goTimeType = reflect.TypeOf(time.Time{})
+
+// layoutTimeEncoder returns an encoder of time.Time values with a layout of
+// the time package, given by the option "timelayout". The encoded string must
+// be parsed back by the layout, which catches values that the layout can't
+// represent, such as years with five digits.
+func (ctx *Context) layoutTimeEncoder(layout string) encoderFunction {
+	return func(value reflect.Value) ([]byte, error) {
+		t, ok := value.Interface().(time.Time)
+		if !ok {
+			return nil, wrongType(goTimeType.String(), value)
+		}
+		s := t.Format(layout)
+		if _, err := time.Parse(layout, s); err != nil {
+			return nil, syntaxError("time %s cannot be encoded with layout %q", t, layout)
+		}
+		return []byte(s), nil
+	}
+}
+
+// layoutTimeDecoder returns a decoder of time.Time values with a layout of
+// the time package.
+func (ctx *Context) layoutTimeDecoder(layout string) decoderFunction {
+	return func(data []byte, value reflect.Value) error {
+		t, err := time.Parse(layout, string(data))
+		if err != nil {
+			return parseError("invalid time %q for layout %q", data, layout)
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	}
+}
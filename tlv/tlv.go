@@ -0,0 +1,610 @@
+// Package tlv encodes and parses the identifier, length and content octets of
+// BER elements without mapping them to Go types. It's the low-level layer of
+// the asn1 package, which builds its reflection-based encoder and decoder on
+// it, and it can be used by tools that inspect or rewrite encodings, for
+// instance:
+//
+//	node, rest, err := tlv.Parse(data)
+//	children, err := node.Children()
+//	node.LengthOctets = 4 // 84 00 00 00 xx
+//	data, err = node.Encode()
+package tlv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// MaxLengthOctets is the maximum number of octets of a length in the long
+// form, not counting the first one, that can be forced when encoding.
+const MaxLengthOctets = 8
+
+// LongForm is the value of Node.LengthOctets that encodes the length in the
+// long form with the minimum number of octets, even for lengths that fit in
+// the short form.
+const LongForm = -1
+
+// Internal consts
+const (
+	intBits  = strconv.IntSize
+	intBytes = intBits / 8
+	// maxChunkLength is the greatest content length allocated before the
+	// content is read.
+	maxChunkLength = 64 * 1024
+)
+
+// Error describes malformed data or a value that can't be encoded. Errors of
+// the underlying readers, such as io.ErrUnexpectedEOF, are returned as they
+// are.
+type Error struct {
+	Msg string
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func newError(msg string, args ...interface{}) *Error {
+	return &Error{fmt.Sprintf(msg, args...)}
+}
+
+// Node is a BER element whose content is not decoded.
+type Node struct {
+	Class       uint
+	Tag         uint
+	Constructed bool
+	// Indefinite is set when the length uses the indefinite form. The
+	// content doesn't include the end-of-contents octets.
+	Indefinite bool
+	Content    []byte
+	// LengthOctets is the number of octets that follow the first length
+	// octet when encoding, zero for the minimum number of octets, or
+	// LongForm. Parse sets it when the length was not encoded in the
+	// minimum number of octets, so the element is encoded again as it was.
+	LengthOctets int
+}
+
+// Encode returns the encoding of the element.
+func (n *Node) Encode() ([]byte, error) {
+	header, err := n.header()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(header)+len(n.Content)+2)
+	buf = append(buf, header...)
+	buf = append(buf, n.Content...)
+	if n.Indefinite {
+		buf = append(buf, 0x00, 0x00)
+	}
+	return buf, nil
+}
+
+// WriteTo writes the encoding of the element to w without copying its
+// content.
+func (n *Node) WriteTo(w io.Writer) (int64, error) {
+	header, err := n.header()
+	if err != nil {
+		return 0, err
+	}
+	parts := [][]byte{header, n.Content}
+	if n.Indefinite {
+		parts = append(parts, []byte{0x00, 0x00})
+	}
+	var written int64
+	for _, part := range parts {
+		k, err := w.Write(part)
+		written += int64(k)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// EncodedLen returns the number of octets of the encoding of the element.
+func (n *Node) EncodedLen() (int, error) {
+	header, err := n.header()
+	if err != nil {
+		return 0, err
+	}
+	length := len(header) + len(n.Content)
+	if n.Indefinite {
+		length += 2
+	}
+	return length, nil
+}
+
+// header returns the identifier and length octets of the element.
+func (n *Node) header() ([]byte, error) {
+	return EncodeHeader(n.Class, n.Tag, n.Constructed, n.Indefinite,
+		uint(len(n.Content)), n.LengthOctets)
+}
+
+// EncodeHeader returns the identifier and length octets of an element with
+// content of the given length, which is ignored if the length is indefinite.
+// The length is encoded as by EncodeLengthOctets.
+func EncodeHeader(class, tag uint, constructed, indefinite bool, length uint, lengthOctets int) ([]byte, error) {
+	buf, err := EncodeIdentifier(class, tag, constructed)
+	if err != nil {
+		return nil, err
+	}
+	if indefinite {
+		if !constructed {
+			return nil, newError("indefinite length is only allowed to constructed types")
+		}
+		return append(buf, 0x80), nil
+	}
+	lengthBuf, err := EncodeLengthOctets(length, lengthOctets)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, lengthBuf...), nil
+}
+
+// Children parses the content of a constructed element.
+func (n *Node) Children() ([]*Node, error) {
+	if !n.Constructed {
+		return nil, newError("primitive element has no children")
+	}
+	children := []*Node{}
+	for rest := n.Content; len(rest) > 0; {
+		child, next, err := Parse(rest)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		rest = next
+	}
+	return children, nil
+}
+
+// EncodeIdentifier returns the identifier octets of an element.
+func EncodeIdentifier(class, tag uint, constructed bool) ([]byte, error) {
+
+	if class > 0x03 {
+		return nil, newError("invalid class value: %d", class)
+	}
+
+	identifier := []byte{0x00}
+
+	// Class (bits 7 and 6) + primitive/constructed (1 bit) + tag (5 bits)
+	identifier[0] += byte((class & 0x03) << 6)
+
+	// Primitive/constructed (bit 5)
+	if constructed {
+		identifier[0] += byte(1 << 5)
+	}
+
+	// Tag (bits 4 to 0)
+	if tag <= 30 {
+		identifier[0] += byte(0x1f & tag)
+	} else {
+		identifier[0] += 0x1f
+		identifier = append(identifier, EncodeBase128(tag)...)
+	}
+	return identifier, nil
+}
+
+// EncodeBase128 encodes a value in a big endian sequence of octets holding 7
+// bits each, as used by tag numbers and object identifiers.
+func EncodeBase128(value uint) []byte {
+
+	// The most significant bit of each octet must be 1, with the exception of the last octet that must be zero.
+	// Example:  1xxxxxxx 1xxxxxxx ... 0xxxxxxx
+
+	// An int32 needs 5 octets and an int64 needs 10:
+	bufLen := (intBits-1)/7 + 1
+	buf := make([]byte, bufLen)
+
+	for i := range buf {
+		shift := uint(7 * (len(buf) - i - 1))
+		mask := uint(0x7f << shift)
+		buf[i] = byte((value & mask) >> shift)
+		// Only the last byte is not marked with 0x80
+		if i != len(buf)-1 {
+			buf[i] |= 0x80
+		}
+	}
+	// Discard leading zero values
+	return removeLeadingBytes(buf, 0x80)
+}
+
+// EncodeLength returns the length octets of a content of the given length in
+// the minimum number of octets.
+func EncodeLength(length uint) []byte {
+
+	// The first bit indicates if length is encoded in a single byte
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+
+	// Multi byte length follow the rules:
+	// - First byte: 0x80 + N (number of following bytes where length is encoded).
+	// - N bytes
+
+	// A byte slice length is an int. So we just need at most 4 bytes
+	buf := make([]byte, intBytes)
+	for i := range buf {
+		shift := uint((intBytes - i - 1) * 8)
+		mask := uint(0xff << shift)
+		buf[i] = byte((mask & length) >> shift)
+	}
+
+	// Ignore leading zeros
+	buf = removeLeadingBytes(buf, 0x00)
+
+	// Add leading byte with the number of following bytes
+	buf = append([]byte{0x80 + byte(len(buf))}, buf...)
+	return buf
+}
+
+// EncodeLengthOctets encodes a length in the long form with the given number
+// of octets after the first one, in the minimum number of octets if octets
+// is zero, or in the long form with the minimum number of octets if octets is
+// LongForm.
+func EncodeLengthOctets(length uint, octets int) ([]byte, error) {
+	if octets == 0 {
+		return EncodeLength(length), nil
+	}
+	if octets == LongForm {
+		if length < 0x80 {
+			return []byte{0x81, byte(length)}, nil
+		}
+		return EncodeLength(length), nil
+	}
+	if octets < 0 || octets > MaxLengthOctets {
+		return nil, newError("invalid number of length octets: %d", octets)
+	}
+	if octets < intBytes && length>>(8*uint(octets)) != 0 {
+		return nil, newError("length %d does not fit in %d octets", length, octets)
+	}
+	buf := make([]byte, octets+1)
+	buf[0] = 0x80 + byte(octets)
+	for i := octets; i > 0 && length > 0; i-- {
+		buf[i] = byte(length)
+		length >>= 8
+	}
+	return buf, nil
+}
+
+func removeLeadingBytes(buf []byte, target byte) []byte {
+	start := 0
+	for start < len(buf)-1 && buf[start] == target {
+		start++
+	}
+	return buf[start:]
+}
+
+// Header holds the identifier and length octets of an element.
+type Header struct {
+	Class       uint
+	Tag         uint
+	Constructed bool
+	Indefinite  bool
+	// Length is the number of octets of the content, or zero when the
+	// indefinite form is used.
+	Length uint
+	// LengthOctets is the number of octets that follow the first length
+	// octet, which is zero for the short and the indefinite forms.
+	LengthOctets int
+}
+
+// MinimalLength reports whether the length is encoded in the minimum number
+// of octets, as DER requires.
+func (h Header) MinimalLength() bool {
+	return h.Indefinite || len(EncodeLength(h.Length)) == h.LengthOctets+1
+}
+
+// ReadHeader reads the identifier and length octets of an element. The
+// content can be read afterwards with ReadContent, so an application can
+// check the header, such as the length of the content, before reading it.
+func ReadHeader(reader io.Reader) (Header, error) {
+	var h Header
+	var err error
+	h.Class, h.Tag, h.Constructed, err = ReadIdentifier(reader)
+	if err != nil {
+		return h, err
+	}
+	h.Length, h.Indefinite, h.LengthOctets, err = ReadLength(reader)
+	if err != nil {
+		return h, err
+	}
+	if h.Indefinite && !h.Constructed {
+		return h, newError("primitive node with indefinite length")
+	}
+	return h, nil
+}
+
+// ReadContent reads the content of the element whose header was read by
+// ReadHeader. The content of an element in the indefinite form is read up to
+// its end-of-contents octets, which are discarded.
+func ReadContent(reader io.Reader, h Header) (*Node, error) {
+	var content []byte
+	if !h.Indefinite {
+		var err error
+		content, err = readFull(reader, h.Length)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		buffer := bytes.NewBuffer([]byte{})
+		childrenReader := io.TeeReader(reader, buffer)
+		err := readEoc(childrenReader)
+		if err != nil {
+			return nil, err
+		}
+		// At this point, buffer also contains the EoC bytes
+		content = buffer.Bytes()
+		content = content[:len(content)-2]
+	}
+
+	node := &Node{
+		Class:       h.Class,
+		Tag:         h.Tag,
+		Constructed: h.Constructed,
+		Indefinite:  h.Indefinite,
+		Content:     content,
+	}
+	if !h.MinimalLength() {
+		node.LengthOctets = h.LengthOctets
+	}
+	return node, nil
+}
+
+// Read reads a complete element.
+func Read(reader io.Reader) (*Node, error) {
+	h, err := ReadHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return ReadContent(reader, h)
+}
+
+// Parse parses the element at the beginning of data and returns the remaining
+// octets. The content of the returned Node is a copy.
+func Parse(data []byte) (node *Node, rest []byte, err error) {
+	reader := bytes.NewReader(data)
+	node, err = Read(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return node, data[len(data)-reader.Len():], nil
+}
+
+// ParseHeader parses the identifier and length octets of the element at the
+// beginning of data. It returns the class, tag number and constructed flag of
+// the element, the length of its content and the number of octets used by the
+// header. The length is -1 when the indefinite length form is used.
+//
+// Only the header is parsed, so data doesn't need to contain the whole
+// element.
+func ParseHeader(data []byte) (class uint, tag uint, constructed bool, length int, headerLen int, err error) {
+	reader := bytes.NewReader(data)
+	h, err := ReadHeader(reader)
+	if err != nil {
+		return
+	}
+	class, tag, constructed = h.Class, h.Tag, h.Constructed
+	headerLen = len(data) - reader.Len()
+	if h.Indefinite {
+		length = -1
+		return
+	}
+	length = int(h.Length)
+	if length < 0 {
+		err = newError("length too big: %d", h.Length)
+	}
+	return
+}
+
+// Skip skips the complete element at the beginning of data and returns the
+// remaining bytes. Elements using the indefinite length form are skipped up
+// to their matching end-of-contents octets.
+//
+// The content of the element is not parsed, with the exception of the nested
+// elements of indefinite length elements.
+func Skip(data []byte) (rest []byte, err error) {
+	_, _, _, length, headerLen, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	data = data[headerLen:]
+	if length >= 0 {
+		if length > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return data[length:], nil
+	}
+	// Skip nested elements up to the end-of-contents
+	for {
+		if len(data) >= 2 && data[0] == 0x00 && data[1] == 0x00 {
+			return data[2:], nil
+		}
+		data, err = Skip(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readEoc(reader io.Reader) error {
+
+	for {
+		class, tag, constructed, err := ReadIdentifier(reader)
+		if err != nil {
+			return err
+		}
+
+		length, indefinite, _, err := ReadLength(reader)
+		if err != nil {
+			return err
+		}
+
+		if indefinite && !constructed {
+			return newError("primitive node with indefinite length")
+		}
+
+		if class == 0 && tag == 0 && indefinite == false && length == 0 {
+			break
+		}
+
+		if indefinite {
+			err = readEoc(reader)
+		} else {
+			err = skipBytes(reader, int64(length))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBase128 reads a value encoded by EncodeBase128.
+func ReadBase128(reader io.Reader) (uint, error) {
+	value := uint(0)
+	for {
+		// Read a byte
+		b, err := readByte(reader)
+		if err != nil {
+			return 0, err
+		}
+		// Leading zeros would allow tags of any number of octets
+		if value == 0 && b == 0x80 {
+			return 0, newError("multi byte tag with leading zero octet")
+		}
+		// if we need to shift out non zeros bits, so the value is too big for an uint
+		msb := uint64(0xfe) << (intBits - 8) // 7 most significant bits
+		if uint64(value)&msb != 0 {
+			return 0, newError("multi byte tag too big")
+		}
+		// Shift the previous value and add the new 7 bits
+		value = (value << 7) | uint(b&0x7f)
+		// The last byte is indicated by the most significant bit equals to zero
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return value, nil
+}
+
+// ReadIdentifier reads the identifier octets of an element.
+func ReadIdentifier(reader io.Reader) (class uint, tag uint, constructed bool, err error) {
+
+	b, err := readByte(reader)
+	if err != nil {
+		return
+	}
+
+	// Read class and constructed flag
+	class = uint((b & 0xc0) >> 6)
+	if b&0x20 != 0 {
+		constructed = true
+	}
+
+	// Read the tag number
+	tag = uint(b & 0x1f)
+	if tag == 0x1f {
+		// Tag is encoded in one or more following bytes
+		tag, err = ReadBase128(reader)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ReadLength reads the length octets of an element. It also returns the
+// number of octets that follow the first one, which is zero for the short and
+// the indefinite forms.
+func ReadLength(reader io.Reader) (length uint, indefinite bool, octets int, err error) {
+
+	// Read length
+	b, err := readByte(reader)
+	if err != nil {
+		return
+	}
+
+	// Short form
+	if b&0x80 == 0 {
+		length = uint(b)
+		return
+	}
+
+	// Indefinite form
+	if b == 0x80 {
+		indefinite = true
+		return
+	}
+
+	// Long form
+	if b == 0xff {
+		err = newError("invalid number of length octets: %x", b)
+		return
+	}
+	buf := make([]byte, int(b&0x7f))
+	_, err = io.ReadFull(reader, buf)
+	if err != nil {
+		return
+	}
+	octets = len(buf)
+	for _, b = range buf {
+		msb := uint64(0xff) << (intBits - 8)
+		if uint64(length)&msb != 0 {
+			err = newError("multi byte length too big")
+			return
+		}
+		length = (length << 8) | uint(b)
+	}
+
+	return
+}
+
+// readFull reads length octets from reader. The length comes from the data, so
+// it's checked against the octets left in readers that know them, such as
+// bytes.Reader, and longer contents are read in chunks, so a length that is
+// not followed by the data doesn't allocate memory for it.
+func readFull(reader io.Reader, length uint) ([]byte, error) {
+	if r, ok := reader.(interface{ Len() int }); ok && length > uint(r.Len()) {
+		if r.Len() == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if length <= maxChunkLength {
+		content := make([]byte, length)
+		_, err := io.ReadFull(reader, content)
+		if err != nil {
+			return nil, err
+		}
+		return content, nil
+	}
+	if uint64(length) > math.MaxInt64 {
+		return nil, newError("length too big: %d", length)
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, maxChunkLength))
+	n, err := io.CopyN(buffer, reader, int64(length))
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func readByte(reader io.Reader) (byte, error) {
+	buf := []byte{0x00}
+	_, err := io.ReadFull(reader, buf)
+	return buf[0], err
+}
+
+func skipBytes(reader io.Reader, count int64) error {
+	_, err := io.CopyN(ioutil.Discard, reader, count)
+	return err
+}
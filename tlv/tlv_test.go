@@ -0,0 +1,157 @@
+package tlv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestParseEncode(t *testing.T) {
+	data := []byte{
+		0x30, 0x80, // SEQUENCE, indefinite
+		0x02, 0x01, 0x05,
+		0x04, 0x81, 0x02, 0x61, 0x62, // non-minimal length
+		0x9f, 0x1f, 0x00, // [31]
+		0x00, 0x00,
+		0xff, // trailing data
+	}
+	node, rest, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte{0xff}) {
+		t.Errorf("got rest %x, expected ff", rest)
+	}
+	if node.Class != 0 || node.Tag != 16 || !node.Constructed || !node.Indefinite {
+		t.Errorf("unexpected node %+v", node)
+	}
+	children, err := node.Children()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 3 {
+		t.Fatalf("got %d children, expected 3", len(children))
+	}
+	if children[1].LengthOctets != 1 || children[0].LengthOctets != 0 {
+		t.Errorf("unexpected length octets %d and %d", children[0].LengthOctets, children[1].LengthOctets)
+	}
+	if children[2].Class != 2 || children[2].Tag != 31 {
+		t.Errorf("unexpected node %+v", children[2])
+	}
+
+	// Elements are encoded as they were parsed
+	encoded, err := node.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, data[:len(data)-1]) {
+		t.Errorf("got %x, expected %x", encoded, data[:len(data)-1])
+	}
+	n, err := node.EncodedLen()
+	if err != nil || n != len(encoded) {
+		t.Errorf("got length %d (%v), expected %d", n, err, len(encoded))
+	}
+	var buf bytes.Buffer
+	if _, err := node.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), encoded) {
+		t.Errorf("got %x (%v), expected %x", buf.Bytes(), err, encoded)
+	}
+}
+
+func TestLengthOctets(t *testing.T) {
+	tests := []struct {
+		length   uint
+		octets   int
+		expected []byte
+	}{
+		{5, 0, []byte{0x05}},
+		{200, 0, []byte{0x81, 0xc8}},
+		{5, LongForm, []byte{0x81, 0x05}},
+		{300, LongForm, []byte{0x82, 0x01, 0x2c}},
+		{5, 4, []byte{0x84, 0x00, 0x00, 0x00, 0x05}},
+	}
+	for _, test := range tests {
+		got, err := EncodeLengthOctets(test.length, test.octets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, test.expected) {
+			t.Errorf("length %d with %d octets: got %x, expected %x",
+				test.length, test.octets, got, test.expected)
+		}
+		length, indefinite, octets, err := ReadLength(bytes.NewReader(got))
+		if err != nil || indefinite || length != test.length || octets != len(got)-1 {
+			t.Errorf("got length %d with %d octets (%v), expected %d", length, octets, err, test.length)
+		}
+	}
+	for _, octets := range []int{-2, MaxLengthOctets + 1} {
+		if _, err := EncodeLengthOctets(1, octets); err == nil {
+			t.Errorf("%d length octets should fail", octets)
+		}
+	}
+	if _, err := EncodeLengthOctets(256, 1); err == nil {
+		t.Error("length that doesn't fit should fail")
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	data := []byte{0x04, 0x82, 0x00, 0x03, 0x61, 0x62, 0x63}
+	reader := bytes.NewReader(data)
+	h, err := ReadHeader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Tag != 4 || h.Length != 3 || h.LengthOctets != 2 || h.MinimalLength() {
+		t.Errorf("unexpected header %+v", h)
+	}
+	if reader.Len() != 3 {
+		t.Errorf("content should not be read")
+	}
+	node, err := ReadContent(reader, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(node.Content) != "abc" {
+		t.Errorf("got content %q, expected \"abc\"", node.Content)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		isEOF bool
+	}{
+		{[]byte{0x04, 0x80}, false},                  // primitive and indefinite
+		{[]byte{0x04, 0xff}, false},                  // reserved length
+		{[]byte{0x1f, 0x80, 0x01, 0x00}, false},      // leading zero in tag
+		{[]byte{0x04, 0x02, 0x61}, true},             // truncated content
+		{[]byte{0x30, 0x80, 0x02, 0x01, 0x01}, true}, // missing end-of-contents
+		// length greater than the data
+		{[]byte{0x7d, 0x88, 0x04, 0x01, 0x41, 0x04, 0x01, 0x42, 0x00, 0x00}, true},
+	}
+	for _, test := range tests {
+		_, _, err := Parse(test.data)
+		if err == nil {
+			t.Errorf("parsing %x should fail", test.data)
+			continue
+		}
+		_, isError := err.(*Error)
+		isEOF := err == io.EOF || err == io.ErrUnexpectedEOF
+		if isEOF != test.isEOF || isError == test.isEOF {
+			t.Errorf("parsing %x: unexpected error %T: %v", test.data, err, err)
+		}
+	}
+	if _, err := EncodeIdentifier(4, 0, false); err == nil {
+		t.Error("invalid class should fail")
+	}
+	if _, err := (&Node{Indefinite: true}).Encode(); err == nil {
+		t.Error("primitive node with indefinite length should fail")
+	}
+	if _, err := Skip([]byte{0x30, 0x05, 0x01}); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+	// Readers that don't know their length are read in chunks
+	reader := io.MultiReader(bytes.NewReader([]byte{0x04, 0x84, 0x7f, 0xff, 0xff, 0xff, 0x61}))
+	if _, err := Read(reader); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,183 @@
+package asn1
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// FieldRange is the position of the encoding of a field in the data decoded
+// by DecodeWithTrace or encoded by EncodeWithTrace.
+type FieldRange struct {
+	// Path identifies the field from the decoded value, such as
+	// "Certificate.Version" or "Extensions[2].Critical".
+	Path string
+	// Offset is the position of the first octet of the element.
+	Offset int
+	// Length is the number of octets of the element, including its
+	// identifier and length octets.
+	Length int
+}
+
+// DecodeTrace maps the fields populated by DecodeWithTrace to the position of
+// their encodings.
+type DecodeTrace struct {
+	// Fields lists the fields in the order they were decoded.
+	Fields []FieldRange
+}
+
+// Lookup returns the position of the field with the given path.
+func (t *DecodeTrace) Lookup(path string) (FieldRange, bool) {
+	for _, field := range t.Fields {
+		if field.Path == path {
+			return field, true
+		}
+	}
+	return FieldRange{}, false
+}
+
+// DecodeWithTrace works like DecodeWithOptions and also returns the position
+// in data of each field populated. Fields of structs and items of slices and
+// arrays are traced. If an error occurs, the trace contains the fields
+// populated until the error was found.
+func (ctx *Context) DecodeWithTrace(data []byte, obj interface{}, options string) (rest []byte, trace *DecodeTrace, err error) {
+	trace = &DecodeTrace{}
+	traceCtx := *ctx
+	traceCtx.trace = &decodeTrace{
+		result: trace,
+		frames: []traceFrame{{length: len(data)}},
+	}
+	rest, err = traceCtx.DecodeWithOptions(data, obj, options)
+	return
+}
+
+// EncodeWithTrace works like EncodeWithOptions and also returns the position
+// in the returned data of each field encoded, so specific fields can be
+// located later without parsing the data again, for instance to sign or patch
+// a nonce. The trace is the one returned by DecodeWithTrace for the encoding
+// and it's obtained in the same way, by decoding the encoding with the
+// settings of the Context into a new value of the type of obj, which must
+// then be decodable. Fields that are not encoded, such as empty optional
+// fields, are not traced.
+func (ctx *Context) EncodeWithTrace(obj interface{}, options string) (data []byte, trace *DecodeTrace, err error) {
+	data, err = ctx.EncodeWithOptions(obj, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	traceCtx := *ctx
+	traceCtx.der.decoding = false
+	traceCtx.warningHandler = nil
+	traceCtx.metricsHandler = nil
+	traceCtx.memoryBudget = 0
+	traceCtx.collectErrors = false
+
+	objType := reflect.TypeOf(obj)
+	for objType.Kind() == reflect.Ptr && objType != bigIntType {
+		objType = objType.Elem()
+	}
+	_, trace, err = traceCtx.DecodeWithTrace(data, reflect.New(objType).Interface(), options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, trace, nil
+}
+
+// decodeTrace keeps the state of a traced decoding.
+type decodeTrace struct {
+	result *DecodeTrace
+	// frames holds the content of the elements being decoded. Elements are
+	// always read until the end of the enclosing content, so their position
+	// can be computed from the data remaining.
+	frames []traceFrame
+	// item is the name used for the next element decoded as a whole value,
+	// set for items of slices and arrays.
+	item string
+}
+
+// traceFrame is the content of an element being decoded.
+type traceFrame struct {
+	offset int
+	length int
+	path   string
+}
+
+// setTraceItem sets the name of the next element decoded as the i-th item of a
+// slice or array.
+func (ctx *Context) setTraceItem(i int) {
+	if ctx.trace != nil {
+		ctx.trace.item = fmt.Sprintf("[%d]", i)
+	}
+}
+
+// traceRawValue sets the position of raw, which was read from reader.
+// remaining is the number of bytes in reader before raw was read.
+func (ctx *Context) traceRawValue(raw *rawValue, reader *bytes.Buffer, remaining int) {
+	frame := ctx.trace.frames[len(ctx.trace.frames)-1]
+	raw.offset = frame.offset + frame.length - remaining
+	raw.length = remaining - reader.Len()
+	header := raw.length - len(raw.Content)
+	if raw.Indefinite {
+		// End of contents octets
+		header -= 2
+	}
+	raw.contentOffset = raw.offset + header
+}
+
+// decodeElement calls the decoder of elem with raw. When tracing, the element
+// is recorded with the given field name, or with the name of the current
+// item if name is empty.
+func (ctx *Context) decodeElement(elem expectedElement, raw *rawValue, value reflect.Value, name string) (err error) {
+	if !ctx.validateUTF8(raw) {
+		return parseError("invalid UTF-8 in UTF8String")
+	}
+	if length, max := ctx.checkStringLength(raw); max > 0 {
+		return fieldError("%s of %d characters exceeds the maximum length of %d",
+			TagString(raw.Class, raw.Tag), length, max)
+	}
+	if ctx.preserved != nil {
+		defer func() {
+			if err == nil {
+				ctx.preserved.store(value, raw.encoded)
+			}
+		}()
+	}
+	if ctx.memory != nil {
+		defer func() {
+			if err == nil {
+				err = ctx.memory.chargeValue(value)
+			}
+		}()
+	}
+	if ctx.trace == nil {
+		return elem.decodeRaw(raw, value)
+	}
+	trace := ctx.trace
+	if name == "" {
+		name, trace.item = trace.item, ""
+	}
+	path := trace.frames[len(trace.frames)-1].path
+	if name != "" {
+		path = joinTracePath(path, name)
+		trace.result.Fields = append(trace.result.Fields, FieldRange{
+			Path:   path,
+			Offset: raw.offset,
+			Length: raw.length,
+		})
+	}
+	trace.frames = append(trace.frames, traceFrame{
+		offset: raw.contentOffset,
+		length: len(raw.Content),
+		path:   path,
+	})
+	err = elem.decodeRaw(raw, value)
+	trace.frames = trace.frames[:len(trace.frames)-1]
+	return err
+}
+
+// joinTracePath appends the name of a field or item to a path.
+func joinTracePath(path, name string) string {
+	if path == "" || name[0] == '[' {
+		return path + name
+	}
+	return path + "." + name
+}
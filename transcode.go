@@ -0,0 +1,200 @@
+package asn1
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Rules identifies a set of ASN.1 encoding rules.
+type Rules int
+
+// Encoding rules supported by Transcode and SetRules. Other rules can be
+// added with RegisterRules.
+const (
+	// BER are the Basic Encoding Rules.
+	BER Rules = iota
+	// DER are the Distinguished Encoding Rules, a subset of BER with a
+	// single encoding for each value.
+	DER
+)
+
+// String returns the abbreviation of the rules, or the name given to
+// RegisterRules.
+func (r Rules) String() string {
+	if rules, ok := r.lookup(); ok {
+		return rules.name
+	}
+	return "Rules(" + strconv.Itoa(int(r)) + ")"
+}
+
+// universalStringTags are the universal types that BER allows to be encoded
+// in the constructed form.
+var universalStringTags = map[uint]bool{
+	TagBitString:        true,
+	TagOctetString:      true,
+	TagObjectDescriptor: true,
+	TagUtf8String:       true,
+	TagNumericString:    true,
+	TagPrintableString:  true,
+	TagT61String:        true,
+	TagVideotexString:   true,
+	TagIA5String:        true,
+	TagUtcTime:          true,
+	TagGeneralizedTime:  true,
+	TagGraphicString:    true,
+	TagVisibleString:    true,
+	TagGeneralString:    true,
+	TagUniversalString:  true,
+	TagBmpString:        true,
+}
+
+// Transcode re-encodes the elements in data from one set of encoding rules to
+// another without requiring Go types for them.
+//
+// The data is verified and an error is returned for the encodings that from
+// does not allow, such as indefinite lengths when from is DER. The constructs
+// that to does not allow are replaced by their canonical forms: indefinite
+// lengths by definite ones, constructed strings by primitive ones, the
+// elements of SETs are sorted, the unused bits of BIT STRINGs are cleared and
+// BOOLEAN and INTEGER values of universal types are encoded in their
+// canonical forms. Since implicitly tagged values
+// can't be identified without their types, they are kept unchanged.
+// Identifiers and lengths are always encoded by the RuleSet of to.
+func (ctx *Context) Transcode(data []byte, from, to Rules) ([]byte, error) {
+	fromRules, ok := from.lookup()
+	if !ok {
+		return nil, syntaxError("invalid encoding rules: %s", from)
+	}
+	toRules, ok := to.lookup()
+	if !ok {
+		return nil, syntaxError("invalid encoding rules: %s", to)
+	}
+	if err := ctx.verifyRules(data, fromRules); err != nil {
+		return nil, err
+	}
+	values, err := ctx.transcodeContent(data, toRules.rules)
+	if err != nil {
+		return nil, err
+	}
+	encodings, err := encodeWithRules(toRules.rules, values)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(encodings, nil), nil
+}
+
+// transcodeContent transcodes a sequence of elements.
+func (ctx *Context) transcodeContent(data []byte, to RuleSet) ([]*rawValue, error) {
+	values := []*rawValue{}
+	reader := bytes.NewBuffer(data)
+	for reader.Len() > 0 {
+		raw, err := ctx.readRawValue(reader)
+		if err != nil {
+			return nil, err
+		}
+		raw, err = ctx.transcodeRawValue(raw, to)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, raw)
+	}
+	return values, nil
+}
+
+// transcodeRawValue transcodes a single element.
+func (ctx *Context) transcodeRawValue(raw *rawValue, to RuleSet) (*rawValue, error) {
+	universal := raw.Class == ClassUniversal
+	isString := universal && universalStringTags[raw.Tag]
+	if !raw.Constructed {
+		if universal {
+			switch raw.Tag {
+			case TagBoolean:
+				if !to.Allows(NonCanonicalBoolean) && len(raw.Content) == 1 && raw.Content[0] != 0x00 {
+					raw.Content = []byte{0xff}
+				}
+			case TagInteger, TagEnum:
+				if !to.Allows(NonMinimalInteger) {
+					raw.Content = removeIntLeadingBytes(raw.Content)
+				}
+			case TagBitString:
+				return transcodeBitString(raw, to)
+			}
+		}
+		return raw, nil
+	}
+
+	children, err := ctx.transcodeContent(raw.Content, to)
+	if err != nil {
+		return nil, err
+	}
+	if !to.Allows(IndefiniteLength) {
+		raw.Indefinite = false
+	}
+	if isString && !to.Allows(ConstructedString) {
+		raw, err = joinStringSegments(raw, children)
+		if err != nil || raw.Tag != TagBitString {
+			return raw, err
+		}
+		return transcodeBitString(raw, to)
+	}
+	encodings, err := encodeWithRules(to, children)
+	if err != nil {
+		return nil, err
+	}
+	if universal && raw.Tag == TagSet && !to.Allows(UnsortedSet) {
+		to.SortSet(encodings)
+	}
+	raw.Content = bytes.Join(encodings, nil)
+	return raw, nil
+}
+
+// joinStringSegments returns the primitive form of a constructed string whose
+// segments were already transcoded to DER.
+func joinStringSegments(raw *rawValue, segments []*rawValue) (*rawValue, error) {
+	content := []byte{}
+	unused := byte(0)
+	for i, segment := range segments {
+		if segment.Class != ClassUniversal || segment.Tag != raw.Tag {
+			return nil, parseError("invalid segment %s in constructed %s",
+				TagString(segment.Class, segment.Tag), TagString(raw.Class, raw.Tag))
+		}
+		data := segment.Content
+		if raw.Tag == TagBitString {
+			// Only the last segment can have unused bits
+			if len(data) == 0 || (data[0] != 0 && i != len(segments)-1) {
+				return nil, parseError("invalid segment in constructed BIT STRING")
+			}
+			unused = data[0]
+			data = data[1:]
+		}
+		content = append(content, data...)
+	}
+	if raw.Tag == TagBitString {
+		content = append([]byte{unused}, content...)
+	}
+	return &rawValue{Class: raw.Class, Tag: raw.Tag, Content: content}, nil
+}
+
+// transcodeBitString checks the unused bits of a primitive BIT STRING and
+// clears them when to does not allow them to be set.
+func transcodeBitString(raw *rawValue, to RuleSet) (*rawValue, error) {
+	if len(raw.Content) == 0 || raw.Content[0] > 7 ||
+		(len(raw.Content) == 1 && raw.Content[0] != 0) {
+		return nil, parseError("invalid number of unused bits in BIT STRING")
+	}
+	if !to.Allows(NonZeroUnusedBits) && hasUnusedBitsSet(raw.Content) {
+		content := append([]byte(nil), raw.Content...)
+		content[len(content)-1] &^= byte(1)<<content[0] - 1
+		raw.Content = content
+	}
+	return raw, nil
+}
+
+// hasUnusedBitsSet reports whether the unused bits in the content of a
+// primitive BIT STRING are not zero.
+func hasUnusedBitsSet(content []byte) bool {
+	if len(content) < 2 || content[0] == 0 || content[0] > 7 {
+		return false
+	}
+	return content[len(content)-1]&(byte(1)<<content[0]-1) != 0
+}
@@ -2,9 +2,14 @@ package asn1
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"math/big"
+	"math/bits"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,9 +18,16 @@ var (
 	bigIntType    = reflect.TypeOf((*big.Int)(nil))
 	bitStringType = reflect.TypeOf(BitString{})
 	oidType       = reflect.TypeOf(Oid{})
+	bigOidType    = reflect.TypeOf(BigOid{})
 	nullType      = reflect.TypeOf(Null{})
 	enumType      = reflect.TypeOf(Enum(0))
 	utcTimeType   = reflect.TypeOf(UTCTime{})
+	isoTimeType   = reflect.TypeOf(ISOTime{})
+	rawValueType  = reflect.TypeOf(RawValue{})
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	readerType    = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	writerToType  = reflect.TypeOf((*io.WriterTo)(nil)).Elem()
+	writerType    = reflect.TypeOf((*io.Writer)(nil)).Elem()
 )
 
 /*
@@ -25,6 +37,9 @@ var (
 // A function that encodes data.
 type encoderFunction func(reflect.Value) ([]byte, error)
 
+// A function that encodes the elements of a constructed value.
+type childrenEncoderFunction func(reflect.Value) ([]*rawValue, error)
+
 // A function that decodes data.
 type decoderFunction func([]byte, reflect.Value) error
 
@@ -87,8 +102,12 @@ func (ctx *Context) encodeBigInt(value reflect.Value) ([]byte, error) {
 	return removeIntLeadingBytes(buf), nil
 }
 
+// decodeBigInt decodes an INTEGER of any size, including negative values in
+// two's complement form.
 func (ctx *Context) decodeBigInt(data []byte, value reflect.Value) error {
-	// TODO check value type
+	if value.Type() != bigIntType {
+		return wrongType(bigIntType.String(), value)
+	}
 	err := checkInt(ctx, data)
 	if err != nil {
 		return err
@@ -121,7 +140,7 @@ func (ctx *Context) decodeInt(data []byte, value reflect.Value) error {
 		return err
 	}
 	if len(data) > 8 {
-		return parseError("integer too large for Go type '%s'", value.Type())
+		return fieldError("integer %s overflows Go type '%s'", parseBigInt(data), value.Type())
 	}
 	// Sign extend the value
 	extensionByte := byte(0x00)
@@ -139,6 +158,9 @@ func (ctx *Context) decodeInt(data []byte, value reflect.Value) error {
 		num <<= 8
 		num |= int64(data[i])
 	}
+	if value.OverflowInt(num) {
+		return fieldError("integer %d overflows Go type '%s'", num, value.Type())
+	}
 	value.SetInt(num)
 	return nil
 }
@@ -159,22 +181,33 @@ func (ctx *Context) encodeUint(value reflect.Value) ([]byte, error) {
 	return removeIntLeadingBytes(buf), nil
 }
 
+// decodeUint decodes an INTEGER into an unsigned Go type. Negative values and
+// values that exceed the size of the type are rejected instead of wrapped.
 func (ctx *Context) decodeUint(data []byte, value reflect.Value) error {
 	// TODO check value type
 	err := checkInt(ctx, data)
 	if err != nil {
 		return err
 	}
-	if len(data) > 8 {
-		return parseError("integer too large for Go type '%s'", value.Type())
+	if data[0]&0x80 != 0 {
+		return fieldError("negative integer %s can't be assigned to Go type '%s'",
+			parseBigInt(data), value.Type())
 	}
-	if len(data) > 0 && data[0]&0x80 != 0 {
-		return parseError("negative integer can't be assigned to Go type '%s'", value.Type())
+	// Remove the leading zero of values with the most significant bit set
+	digits := data
+	if len(digits) > 1 && digits[0] == 0x00 {
+		digits = digits[1:]
+	}
+	if len(digits) > 8 {
+		return fieldError("integer %s overflows Go type '%s'", parseBigInt(data), value.Type())
 	}
 	num := uint64(0)
-	for i := 0; i < len(data); i++ {
+	for i := 0; i < len(digits); i++ {
 		num <<= 8
-		num |= uint64(data[i])
+		num |= uint64(digits[i])
+	}
+	if value.OverflowUint(num) {
+		return fieldError("integer %d overflows Go type '%s'", num, value.Type())
 	}
 	value.SetUint(num)
 	return nil
@@ -237,6 +270,166 @@ func (ctx *Context) decodeString(data []byte, value reflect.Value) error {
 	return nil
 }
 
+// readerSource is the content of an OCTET STRING read from an io.Reader or an
+// io.WriterTo when it's written. When the value implements io.Seeker, the
+// content goes from offset to its end, which gives its length, and offset is
+// the position restored after each read. Otherwise the length is unknown and
+// the value is consumed as it's written.
+type readerSource struct {
+	value  interface{}
+	seeker io.Seeker
+	offset int64
+	// length is -1 when the value can't seek.
+	length int64
+}
+
+// newReaderSource returns the source of the content of an OCTET STRING given
+// by an io.Reader or an io.WriterTo. A nil value is encoded as an empty OCTET
+// STRING and has no source. Values whose Seek fails, such as a pipe, are
+// handled as values that can't seek, which are rejected in DER.
+func (ctx *Context) newReaderSource(value reflect.Value) (*readerSource, error) {
+	if value.IsNil() {
+		return nil, nil
+	}
+	source := &readerSource{value: value.Interface(), length: -1}
+	if seeker, ok := source.value.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			end, err := seeker.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			length := end - offset
+			if length < 0 || int64(int(length)) != length {
+				return nil, syntaxError("invalid length %d of the content of '%s'", length, value.Type())
+			}
+			source.seeker, source.offset, source.length = seeker, offset, length
+			return source, nil
+		}
+	}
+	if ctx.der.encoding {
+		return nil, syntaxError("value of Go type '%s' in '%s' must implement io.Seeker to be encoded in DER",
+			value.Elem().Type(), value.Type())
+	}
+	return source, nil
+}
+
+// writeTo writes the content of the source to w. The content of a value that
+// can't seek is written in segments of 1000 octets, as the CER rules require
+// for the constructed form.
+func (s *readerSource) writeTo(w io.Writer) error {
+	if s.seeker == nil {
+		segments := &segmentWriter{writer: w, buf: make([]byte, 0, cerSegmentSize)}
+		if err := s.copyTo(segments, -1); err != nil {
+			return err
+		}
+		return segments.flush()
+	}
+	if _, err := s.seeker.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	err := s.copyTo(w, s.length)
+	if _, seekErr := s.seeker.Seek(s.offset, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	return err
+}
+
+// copyTo copies the value to w, calling its WriteTo method when it implements
+// io.WriterTo. When length isn't negative, it's checked against the number of
+// octets copied.
+func (s *readerSource) copyTo(w io.Writer, length int64) error {
+	var n int64
+	var err error
+	if writerTo, ok := s.value.(io.WriterTo); ok {
+		n, err = writerTo.WriteTo(w)
+	} else if length >= 0 {
+		n, err = io.CopyN(w, s.value.(io.Reader), length)
+	} else {
+		n, err = io.Copy(w, s.value.(io.Reader))
+	}
+	if err == io.EOF || (err == nil && length >= 0 && n != length) {
+		return syntaxError("reader gave %d octets of content instead of %d", n, length)
+	}
+	return err
+}
+
+// decodeReader sets an io.Reader with the content of an OCTET STRING given by
+// its complete encoding. The reader refers to the decoded data, which is not
+// copied, and the segments of the constructed form are read in sequence.
+func (ctx *Context) decodeReader(data []byte, value reflect.Value) error {
+	segments, err := octetStringSegments(data)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 1 {
+		value.Set(reflect.ValueOf(bytes.NewReader(segments[0])))
+		return nil
+	}
+	readers := make([]io.Reader, len(segments))
+	for i, segment := range segments {
+		readers[i] = bytes.NewReader(segment)
+	}
+	value.Set(reflect.ValueOf(io.MultiReader(readers...)))
+	return nil
+}
+
+// decodeWriter writes the content of an OCTET STRING given by its complete
+// encoding to an io.Writer, one segment at a time for the constructed form.
+// The writer must be set before decoding.
+func (ctx *Context) decodeWriter(data []byte, value reflect.Value) error {
+	if value.IsNil() {
+		return syntaxError("cannot decode into a nil '%s'", value.Type())
+	}
+	segments, err := octetStringSegments(data)
+	if err != nil {
+		return err
+	}
+	writer := value.Interface().(io.Writer)
+	for _, segment := range segments {
+		if _, err := writer.Write(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// octetStringSegments returns the contents of the primitive segments of an
+// OCTET STRING given by its complete encoding, or its content when it's
+// primitive.
+func octetStringSegments(data []byte) ([][]byte, error) {
+	raw, err := decodeRawValue(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	return appendStringSegments(nil, raw)
+}
+
+// appendStringSegments appends the contents of the primitive segments of raw
+// to segments.
+func appendStringSegments(segments [][]byte, raw *rawValue) ([][]byte, error) {
+	if !raw.Constructed {
+		return append(segments, raw.Content), nil
+	}
+	reader := bytes.NewBuffer(raw.Content)
+	for reader.Len() > 0 {
+		segment, err := decodeRawValue(reader)
+		if err != nil {
+			return nil, err
+		}
+		if segment.Class != ClassUniversal || segment.Tag != TagOctetString {
+			return nil, parseError("invalid segment %s in constructed OCTET STRING",
+				TagString(segment.Class, segment.Tag))
+		}
+		if segments, err = appendStringSegments(segments, segment); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
 /*
  * Custom types
  */
@@ -245,6 +438,11 @@ func (ctx *Context) decodeString(data []byte, value reflect.Value) error {
 
 type Enum int
 
+// String returns the decimal representation of e.
+func (e Enum) String() string {
+	return strconv.Itoa(int(e))
+}
+
 // BIT STRING
 
 // BitString is the structure to use when you want an ASN.1 BIT STRING type. A
@@ -284,6 +482,16 @@ func (b BitString) RightAlign() []byte {
 	return a
 }
 
+// String returns b in the ASN.1 value notation: a hstring, such as 'A0'H,
+// when b has a whole number of octets or a bstring, such as '101'B,
+// otherwise.
+func (b BitString) String() string {
+	if b.BitLength > 0 && b.BitLength%8 == 0 {
+		return "'" + strings.ToUpper(hex.EncodeToString(b.Bytes)) + "'H"
+	}
+	return "'" + b.bitPattern() + "'B"
+}
+
 func (ctx *Context) encodeBitString(value reflect.Value) ([]byte, error) {
 	bitString, ok := value.Interface().(BitString)
 	if !ok {
@@ -316,7 +524,8 @@ func (ctx *Context) decodeBitString(data []byte, value reflect.Value) error {
 	return nil
 }
 
-// Oid is used to encode and decode ASN.1 OBJECT IDENTIFIERs.
+// Oid is used to encode and decode ASN.1 OBJECT IDENTIFIERs. See BigOid for
+// OBJECT IDENTIFIERs with elements that don't fit in an uint.
 type Oid []uint
 
 // Cmp returns zero if both Oids are the same, a negative value if oid
@@ -326,8 +535,11 @@ func (oid Oid) Cmp(other Oid) int {
 		if i >= len(other) {
 			return 1
 		}
-		if n != other[i] {
-			return int(n) - int(other[i])
+		if n < other[i] {
+			return -1
+		}
+		if n > other[i] {
+			return 1
 		}
 	}
 	return len(oid) - len(other)
@@ -363,12 +575,17 @@ func (ctx *Context) encodeOid(value reflect.Value) ([]byte, error) {
 	value2 := uint(0)
 	if len(oid) >= 2 {
 		value2 = oid[1]
-		if value2 > 39 {
-			return nil, parseError("invalid value for first element of OID: %d", value2)
+		if value1 < 2 && value2 > 39 {
+			return nil, parseError("invalid value for second element of OID: %d", value2)
 		}
 	}
 
-	bytes := []byte{byte(40*value1 + value2)}
+	// The first two arcs are combined in a single subidentifier, which can
+	// be larger than an uint when the first arc is 2
+	first := new(big.Int).SetUint64(uint64(value1))
+	first.Mul(first, big.NewInt(40))
+	first.Add(first, new(big.Int).SetUint64(uint64(value2)))
+	bytes := encodeBigSubidentifier(first)
 	for i := 2; i < len(oid); i++ {
 		bytes = append(bytes, encodeMultiByteTag(oid[i])...)
 	}
@@ -382,15 +599,24 @@ func (ctx *Context) decodeOid(data []byte, value reflect.Value) error {
 		return nil
 	}
 
-	value1 := uint(data[0] / 40)
-	value2 := uint(data[0]) - 40*value1
-	oid := Oid{value1, value2}
+	// The first subidentifier of an Oid is at most 2*40 plus the greatest
+	// uint, which needs one bit more
+	reader := bytes.NewBuffer(data)
+	first, err := decodeBigSubidentifier(reader, intBits+1)
+	if err != nil {
+		return err
+	}
+	value1 := splitFirstSubidentifier(first)
+	if first.BitLen() > intBits {
+		return parseError("second element of Object Identifier too large")
+	}
+	oid := Oid{value1, uint(first.Uint64())}
 
-	reader := bytes.NewBuffer(data[1:])
 	for reader.Len() > 0 {
 		valueN, err := decodeMultiByteTag(reader)
 		if err != nil {
-			return parseError("invalid value element in Object Identifier")
+			return parseError("invalid value element in Object Identifier, " +
+				"BigOid can be used for elements that don't fit in an uint")
 		}
 		oid = append(oid, valueN)
 	}
@@ -399,9 +625,169 @@ func (ctx *Context) decodeOid(data []byte, value reflect.Value) error {
 	return nil
 }
 
+// splitFirstSubidentifier returns the first element of an OBJECT IDENTIFIER
+// from its first subidentifier, which is left with the second element.
+func splitFirstSubidentifier(first *big.Int) uint {
+	var value1 uint
+	switch {
+	case first.Cmp(big.NewInt(40)) < 0:
+		value1 = 0
+	case first.Cmp(big.NewInt(80)) < 0:
+		value1 = 1
+	default:
+		value1 = 2
+	}
+	first.Sub(first, big.NewInt(int64(40*value1)))
+	return value1
+}
+
+// BigOid is used to encode and decode ASN.1 OBJECT IDENTIFIERs with elements
+// that may not fit in an uint, such as the ones under 2.25 formed by UUIDs as
+// defined by X.667.
+type BigOid []*big.Int
+
+// Cmp returns zero if both BigOids are the same, a negative value if oid
+// lexicographically precedes other and a positive value otherwise.
+func (oid BigOid) Cmp(other BigOid) int {
+	for i, n := range oid {
+		if i >= len(other) {
+			return 1
+		}
+		if c := n.Cmp(other[i]); c != 0 {
+			return c
+		}
+	}
+	return len(oid) - len(other)
+}
+
+// String returns the dotted representation of oid.
+func (oid BigOid) String() string {
+	s := ""
+	for _, n := range oid {
+		s += "." + n.String()
+	}
+	return s
+}
+
+func (ctx *Context) encodeBigOid(value reflect.Value) ([]byte, error) {
+	oid, ok := value.Interface().(BigOid)
+	if !ok {
+		return nil, wrongType(bigOidType.String(), value)
+	}
+	for _, n := range oid {
+		if n == nil || n.Sign() < 0 {
+			return nil, syntaxError("invalid element of OID: %v", n)
+		}
+	}
+
+	first := new(big.Int)
+	if len(oid) >= 1 {
+		if oid[0].Cmp(big.NewInt(2)) > 0 {
+			return nil, parseError("invalid value for first element of OID: %s", oid[0])
+		}
+		first.Mul(oid[0], big.NewInt(40))
+	}
+	if len(oid) >= 2 {
+		if oid[0].Cmp(big.NewInt(2)) < 0 && oid[1].Cmp(big.NewInt(39)) > 0 {
+			return nil, parseError("invalid value for second element of OID: %s", oid[1])
+		}
+		first.Add(first, oid[1])
+	}
+	bytes := encodeBigSubidentifier(first)
+	for i := 2; i < len(oid); i++ {
+		bytes = append(bytes, encodeBigSubidentifier(oid[i])...)
+	}
+	return bytes, nil
+}
+
+func (ctx *Context) decodeBigOid(data []byte, value reflect.Value) error {
+	if len(data) == 0 {
+		value.Set(reflect.ValueOf(BigOid{}))
+		return nil
+	}
+
+	reader := bytes.NewBuffer(data)
+	first, err := decodeBigSubidentifier(reader, 0)
+	if err != nil {
+		return err
+	}
+	value1 := splitFirstSubidentifier(first)
+	oid := BigOid{new(big.Int).SetUint64(uint64(value1)), first}
+
+	for reader.Len() > 0 {
+		valueN, err := decodeBigSubidentifier(reader, 0)
+		if err != nil {
+			return err
+		}
+		oid = append(oid, valueN)
+	}
+
+	value.Set(reflect.ValueOf(oid))
+	return nil
+}
+
+// encodeBigSubidentifier encodes an arbitrarily large number as a sequence of
+// 7 bit groups, as done for multi byte tags.
+func encodeBigSubidentifier(n *big.Int) []byte {
+	groups := (n.BitLen() + 6) / 7
+	if groups == 0 {
+		groups = 1
+	}
+	buf := make([]byte, groups)
+	for i := range buf {
+		shift := uint(7 * (len(buf) - i - 1))
+		buf[i] = byte(new(big.Int).Rsh(n, shift).Uint64() & 0x7f)
+		if i != len(buf)-1 {
+			buf[i] |= 0x80
+		}
+	}
+	return buf
+}
+
+// decodeBigSubidentifier decodes a sequence of 7 bit groups. A ParseError is
+// returned as soon as the value needs more than maxBits bits, unless maxBits
+// is zero.
+func decodeBigSubidentifier(reader *bytes.Buffer, maxBits int) (*big.Int, error) {
+	groups := []byte{}
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, parseError("truncated element in Object Identifier")
+		}
+		// Leading zeros would allow elements of any number of octets
+		if len(groups) == 0 && b == 0x80 {
+			return nil, parseError("element of Object Identifier with leading zero octet")
+		}
+		groups = append(groups, b&0x7f)
+		if maxBits > 0 && 7*(len(groups)-1)+bits.Len8(groups[0]) > maxBits {
+			return nil, parseError("element of Object Identifier too large")
+		}
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	// The groups are packed in octets and converted at once
+	buf := make([]byte, (7*len(groups)+7)/8)
+	bit := 0
+	for i := len(groups) - 1; i >= 0; i-- {
+		for j := uint(0); j < 7; j++ {
+			if groups[i]>>j&1 != 0 {
+				buf[len(buf)-1-bit/8] |= 1 << uint(bit%8)
+			}
+			bit++
+		}
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
 // Null is used to encode and decode ASN.1 NULLs.
 type Null struct{}
 
+// String returns "NULL".
+func (Null) String() string {
+	return "NULL"
+}
+
 func (ctx *Context) encodeNull(value reflect.Value) ([]byte, error) {
 	_, ok := value.Interface().(Null)
 	if !ok {
@@ -429,7 +815,8 @@ func (ctx *Context) decodeNull(data []byte, value reflect.Value) error {
 // getActualType recursively gets the underlying type of Interfaces and Pointers.
 func getActualType(value reflect.Value) reflect.Value {
 	for {
-		if value.Type() == bigIntType {
+		switch value.Type() {
+		case bigIntType, readerType, writerToType:
 			return value
 		}
 		switch value.Kind() {
@@ -442,6 +829,9 @@ func getActualType(value reflect.Value) reflect.Value {
 }
 
 func checkInt(ctx *Context, data []byte) error {
+	if len(data) == 0 {
+		return parseError("integer has no content octets")
+	}
 	if ctx.der.decoding {
 		if len(data) >= 2 {
 			if data[0] == 0xff || data[0] == 0x00 {
@@ -457,7 +847,7 @@ func checkInt(ctx *Context, data []byte) error {
 func parseBigInt(data []byte) *big.Int {
 	data = append([]byte{}, data...)
 	neg := false
-	if data[0]&0x80 != 0 {
+	if len(data) > 0 && data[0]&0x80 != 0 {
 		neg = true
 		for i, b := range data {
 			data[i] = ^b
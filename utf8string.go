@@ -0,0 +1,57 @@
+package asn1
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// UTF8Validation controls how the contents of UTF8String elements that are
+// not well-formed UTF-8, or that start with a byte order mark, are handled.
+type UTF8Validation int
+
+// Validations of the UTF8String elements.
+const (
+	// UTF8Reject rejects the invalid contents with an error. It's the
+	// default.
+	UTF8Reject UTF8Validation = iota
+	// UTF8Sanitize replaces each invalid sequence by the replacement
+	// character U+FFFD and removes the leading byte order mark.
+	UTF8Sanitize
+	// UTF8Accept keeps the contents unchanged, as they are for the other
+	// string types.
+	UTF8Accept
+)
+
+// byteOrderMark is the UTF-8 encoding of U+FEFF, which has no use in UTF-8
+// but is written by some editors at the start of the text.
+var byteOrderMark = []byte{0xef, 0xbb, 0xbf}
+
+// SetUTF8Validation sets how the contents of the UTF8String elements are
+// validated when encoding and decoding, so text that breaks the code that
+// displays it is not accepted silently. Only the elements with the universal
+// tag of UTF8String are validated, such as the strings with the options
+// "universal,tag:12".
+func (ctx *Context) SetUTF8Validation(validation UTF8Validation) {
+	ctx.utf8Validation = validation
+}
+
+// validateUTF8 validates the content of raw if it's a UTF8String. The content
+// is replaced when it's sanitized.
+func (ctx *Context) validateUTF8(raw *rawValue) (valid bool) {
+	if raw.Class != ClassUniversal || raw.Tag != TagUtf8String || raw.Constructed {
+		return true
+	}
+	switch ctx.utf8Validation {
+	case UTF8Accept:
+		return true
+	case UTF8Sanitize:
+		content := bytes.TrimPrefix(raw.Content, byteOrderMark)
+		content = bytes.ToValidUTF8(content, []byte(string(utf8.RuneError)))
+		if !bytes.Equal(content, raw.Content) {
+			raw.Content = content
+			raw.encoded = nil
+		}
+		return true
+	}
+	return utf8.Valid(raw.Content) && !bytes.HasPrefix(raw.Content, byteOrderMark)
+}
@@ -0,0 +1,75 @@
+package asn1
+
+import (
+	"reflect"
+)
+
+// Validator is implemented by types that check their invariants. After a
+// value of a type implementing Validator is decoded, including all its
+// fields, Validate is called and the decoding fails if it returns an error.
+// The method can be implemented with a pointer receiver.
+type Validator interface {
+	Validate() error
+}
+
+// AfterDecoder is implemented by types that need the Context after they are
+// decoded, for instance to decode a field holding an open type with the
+// choices registered in the Context. AfterDecode is called before Validate
+// when a type implements both.
+type AfterDecoder interface {
+	AfterDecode(ctx *Context) error
+}
+
+var (
+	validatorType    = reflect.TypeOf((*Validator)(nil)).Elem()
+	afterDecoderType = reflect.TypeOf((*AfterDecoder)(nil)).Elem()
+)
+
+// hasDecodeHooks checks if values of type t, or pointers to them, implement
+// Validator or AfterDecoder.
+func hasDecodeHooks(t reflect.Type) bool {
+	for _, hook := range []reflect.Type{validatorType, afterDecoderType} {
+		if t.Implements(hook) || reflect.PtrTo(t).Implements(hook) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatingDecoder returns a decoder that calls the methods of Validator and
+// AfterDecoder of the values decoded by decoder.
+func (ctx *Context) validatingDecoder(decoder decoderFunction) decoderFunction {
+	return func(data []byte, value reflect.Value) error {
+		if err := decoder(data, value); err != nil {
+			return err
+		}
+		if ctx.skipValidation {
+			return nil
+		}
+		obj := value.Interface()
+		if value.CanAddr() {
+			obj = value.Addr().Interface()
+		}
+		if hook, ok := obj.(AfterDecoder); ok {
+			if err := hook.AfterDecode(ctx); err != nil {
+				return validationError(err, value.Type())
+			}
+		}
+		if validator, ok := obj.(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return validationError(err, value.Type())
+			}
+		}
+		return nil
+	}
+}
+
+// validationError converts an error returned by Validate or AfterDecode into
+// a ParseError.
+func validationError(err error, t reflect.Type) error {
+	switch err.(type) {
+	case *SyntaxError, *ParseError:
+		return err
+	}
+	return fieldError("invalid value of Go type '%s': %s", t, err)
+}
@@ -0,0 +1,86 @@
+package asn1
+
+import (
+	"reflect"
+)
+
+// getVersionField returns the index of the field of the struct type t with
+// the option "version-field", or -1 if there is none.
+func (ctx *Context) getVersionField(t reflect.Type) (int, error) {
+	index := -1
+	for i := 0; i < t.NumField(); i++ {
+		opts, err := ctx.getFieldOptions(t, i)
+		if err != nil {
+			return 0, err
+		}
+		if opts == nil || !opts.versionField {
+			continue
+		}
+		if index >= 0 {
+			return 0, syntaxError("type '%s' has more than one field with the option 'version-field'", t)
+		}
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return 0, syntaxError("field %s.%s: option 'version-field' requires an integer", t.Name(), t.Field(i).Name)
+		}
+		index = i
+	}
+	return index, nil
+}
+
+// getVersion returns the value of the version field of a struct value. It
+// returns an error if the struct has no version field.
+func (ctx *Context) getVersion(value reflect.Value) (int64, error) {
+	index, err := ctx.getVersionField(value.Type())
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 {
+		return 0, syntaxError("type '%s' has fields with 'minver' or 'maxver' but no field with 'version-field'", value.Type())
+	}
+	field := value.Field(index)
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint()), nil
+	}
+	return field.Int(), nil
+}
+
+// isVersioned checks if the options gate a field by version.
+func (opts *fieldOptions) isVersioned() bool {
+	return opts.minVersion != nil || opts.maxVersion != nil
+}
+
+// allowsVersion checks if a field is valid in the given version.
+func (opts *fieldOptions) allowsVersion(version int64) bool {
+	if opts.minVersion != nil && version < int64(*opts.minVersion) {
+		return false
+	}
+	return opts.maxVersion == nil || version <= int64(*opts.maxVersion)
+}
+
+// checkVersion returns a ParseError if a decoded struct value has a field
+// that is not valid in the version of the struct. present holds the names of
+// the fields that were found.
+func (ctx *Context) checkVersion(value reflect.Value, present map[string]bool) error {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		opts, err := ctx.getFieldOptions(t, i)
+		if err != nil {
+			return err
+		}
+		if opts == nil || !opts.isVersioned() || !present[t.Field(i).Name] {
+			continue
+		}
+		version, err := ctx.getVersion(value)
+		if err != nil {
+			return err
+		}
+		if !opts.allowsVersion(version) {
+			return addFieldPath(fieldError("field is not valid in version %d", version), t.Field(i).Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package asn1
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WarningKind identifies the anomaly described by a Warning.
+type WarningKind int
+
+// Kinds of warnings reported during decoding.
+const (
+	// WarningNonMinimalLength is reported when the length of an element is
+	// encoded with more octets than necessary, which BER accepts but DER
+	// does not.
+	WarningNonMinimalLength WarningKind = iota + 1
+	// WarningIgnoredElement is reported when an element of a SEQUENCE or SET
+	// can't be matched to any field and it's skipped.
+	WarningIgnoredElement
+	// WarningDefaultValuePresent is reported when an element equal to the
+	// DEFAULT value of its field is present, which DER does not allow.
+	WarningDefaultValuePresent
+	// WarningNullAsAbsent is reported when a NULL is decoded as an absent
+	// OPTIONAL field, as enabled by SetNullAsAbsent.
+	WarningNullAsAbsent
+)
+
+// Warning describes a non-fatal anomaly found during decoding.
+type Warning struct {
+	Kind WarningKind
+	Msg  string
+}
+
+// String returns the message of the warning.
+func (w Warning) String() string {
+	return w.Msg
+}
+
+// warn reports a warning to the handler set with SetWarningHandler.
+func (ctx *Context) warn(kind WarningKind, msg string, args ...interface{}) {
+	if ctx.warningHandler == nil {
+		return
+	}
+	ctx.warningHandler(Warning{Kind: kind, Msg: fmt.Sprintf(msg, args...)})
+}
+
+// readRawValue parses an element from reader and reports the anomalies found
+// in its encoding. When tracing, its position is also set.
+func (ctx *Context) readRawValue(reader io.Reader) (*rawValue, error) {
+	buf, isBuffer := reader.(*bytes.Buffer)
+	traced := isBuffer && ctx.trace != nil
+	remaining := 0
+	if traced {
+		remaining = buf.Len()
+	}
+	var data []byte
+	if isBuffer {
+		data = buf.Bytes()
+	}
+	limits := rawLimits{
+		maxTagNumber:    ctx.getMaxTagNumber(),
+		maxLengthOctets: ctx.maxLengthOctets,
+	}
+	if ctx.memory != nil {
+		limits.maxContentLength = ctx.memory.remaining()
+	}
+	raw, err := decodeLimitedRawValue(reader, limits)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.memory != nil {
+		ctx.memory.metrics.Elements++
+		if err := ctx.memory.charge(int64(len(raw.Content))); err != nil {
+			return nil, err
+		}
+	}
+	if data != nil {
+		raw.encoded = data[:len(data)-buf.Len()]
+	}
+	if traced {
+		ctx.traceRawValue(raw, buf, remaining)
+	}
+	if raw.nonMinimalLength {
+		ctx.warn(WarningNonMinimalLength,
+			"length of element %s is not encoded in the minimum number of octets",
+			TagString(raw.Class, raw.Tag))
+	}
+	return raw, nil
+}
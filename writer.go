@@ -0,0 +1,142 @@
+package asn1
+
+import (
+	"io"
+)
+
+// defaultPlaceholderOctets is the number of octets of the length written by a
+// SequenceWriter before its final value is known, unless the option
+// "length-octets" gives another one.
+const defaultPlaceholderOctets = 8
+
+// SequenceWriter writes a SEQUENCE OF element by element, such as the records
+// of a log or a CDR file written over hours, without keeping the encoding of
+// the whole SEQUENCE in memory:
+//
+//	w, err := ctx.BeginSequence(file, "")
+//	for record := range records {
+//		err = w.WriteElement(record)
+//	}
+//	err = w.Close()
+//
+// The length of the SEQUENCE is written when it's closed, so the underlying
+// writer must be an io.WriteSeeker, unless the indefinite length form is used.
+type SequenceWriter struct {
+	ctx        *Context
+	writer     io.Writer
+	indefinite bool
+	// Position and number of octets of the length, which is rewritten by
+	// Close.
+	lengthOffset int64
+	lengthOctets int
+	length       uint64
+	closed       bool
+}
+
+// BeginSequence writes the header of a SEQUENCE to w and returns a
+// SequenceWriter that appends its elements. The options can change the tag
+// of the SEQUENCE (ie: "application,tag:1"), mark it as a SET with "set", or
+// select the indefinite length form with "indefinite", which allows any
+// io.Writer. Otherwise, w must be an io.WriteSeeker and a length in the long
+// form with 8 octets, or the number of octets given by "length-octets", is
+// written and fixed by Close. Neither form is allowed by DER, which requires
+// the whole content to be known beforehand.
+func (ctx *Context) BeginSequence(w io.Writer, options string) (*SequenceWriter, error) {
+	opts, err := ctx.parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil || opts.explicit || opts.optional || opts.defaultValue != nil ||
+		opts.choice != nil || opts.encrypt != nil || opts.compress != nil {
+		return nil, syntaxError("invalid options '%s' for a SequenceWriter", options)
+	}
+	raw := rawValue{Class: ClassUniversal, Tag: TagSequence, Constructed: true}
+	if opts.set {
+		raw.Tag = TagSet
+	}
+	if opts.tag != nil {
+		raw.Class = opts.tagClass()
+		raw.Tag = uint(*opts.tag)
+	}
+	header, err := encodeIdentifier(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &SequenceWriter{ctx: ctx, writer: w, indefinite: opts.indefinite}
+	if sw.indefinite {
+		header = append(header, 0x80)
+	} else {
+		seeker, ok := w.(io.WriteSeeker)
+		if !ok {
+			return nil, syntaxError("a SequenceWriter requires an io.WriteSeeker unless 'indefinite' is used")
+		}
+		sw.lengthOctets = defaultPlaceholderOctets
+		if opts.lengthOctets != nil {
+			sw.lengthOctets = *opts.lengthOctets
+		}
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		sw.lengthOffset = start + int64(len(header))
+		length, err := encodeLengthOctets(0, sw.lengthOctets)
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, length...)
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// WriteElement encodes obj, as (*Context).Encode does, and writes it as the
+// next element of the SEQUENCE.
+func (sw *SequenceWriter) WriteElement(obj interface{}) error {
+	if sw.closed {
+		return syntaxError("SequenceWriter is closed")
+	}
+	data, err := sw.ctx.Encode(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := sw.writer.Write(data); err != nil {
+		return err
+	}
+	sw.length += uint64(len(data))
+	return nil
+}
+
+// Close ends the SEQUENCE, writing the end-of-contents octets of the
+// indefinite length form or the final length. The position of the underlying
+// writer is restored to the end of the SEQUENCE. Close doesn't close the
+// underlying writer.
+func (sw *SequenceWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	if sw.indefinite {
+		_, err := sw.writer.Write([]byte{0x00, 0x00})
+		return err
+	}
+	if sw.length > uint64(maxInt) {
+		return syntaxError("content of %d octets is too long", sw.length)
+	}
+	length, err := encodeLengthOctets(uint(sw.length), sw.lengthOctets)
+	if err != nil {
+		return err
+	}
+	seeker := sw.writer.(io.WriteSeeker)
+	if _, err := seeker.Seek(sw.lengthOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := seeker.Write(length); err != nil {
+		return err
+	}
+	end := sw.lengthOffset + int64(len(length)) + int64(sw.length)
+	_, err = seeker.Seek(end, io.SeekStart)
+	return err
+}